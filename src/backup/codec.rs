@@ -0,0 +1,247 @@
+//! Encoding and decoding of backups in each supported format.
+//!
+//! This module handles:
+//! - The `BackupCodec` interface implemented once per format
+//! - Mapping each `BackupFormat` to its codec
+//!
+//! Adding a format means adding a `BackupFormat` variant, a codec for it and an
+//! arm in `codec_for`, which the compiler insists on; code that reads or
+//! writes backups looks the codec up by format and needs no changes.
+
+use super::core::Backup;
+use super::format::BackupFormat;
+use std::env;
+use std::io::{self, Read, Write};
+use std::path::PathBuf;
+
+/// Converts backups to and from one serialized format
+pub trait BackupCodec: Send + Sync {
+    /// Writes a backup to a writer
+    ///
+    /// # Arguments
+    /// * `writer` - Destination for the serialized backup
+    /// * `backup` - The backup to write
+    fn encode(&self, writer: &mut dyn Write, backup: &Backup) -> io::Result<()>;
+
+    /// Reads a backup from a reader
+    ///
+    /// # Returns
+    /// * `Ok(Backup)` containing the parsed backup
+    /// * `Err(io::Error)` if reading fails or the contents are not a valid backup
+    fn decode(&self, reader: &mut dyn Read) -> io::Result<Backup>;
+}
+
+/// Reads all of a reader's contents as UTF-8 text
+fn read_text(reader: &mut dyn Read) -> io::Result<String> {
+    let mut contents = String::new();
+    reader.read_to_string(&mut contents)?;
+    Ok(contents)
+}
+
+/// Pretty-printed JSON document
+struct JsonCodec;
+
+impl BackupCodec for JsonCodec {
+    fn encode(&self, writer: &mut dyn Write, backup: &Backup) -> io::Result<()> {
+        serde_json::to_writer_pretty(&mut *writer, backup)?;
+        Ok(())
+    }
+
+    fn decode(&self, reader: &mut dyn Read) -> io::Result<Backup> {
+        Ok(serde_json::from_reader(reader)?)
+    }
+}
+
+/// TOML document
+struct TomlCodec;
+
+impl BackupCodec for TomlCodec {
+    fn encode(&self, writer: &mut dyn Write, backup: &Backup) -> io::Result<()> {
+        let contents = toml::to_string_pretty(backup)
+            .map_err(|e| io::Error::new(io::ErrorKind::InvalidData, e))?;
+        writer.write_all(contents.as_bytes())
+    }
+
+    fn decode(&self, reader: &mut dyn Read) -> io::Result<Backup> {
+        toml::from_str(&read_text(reader)?)
+            .map_err(|e| io::Error::new(io::ErrorKind::InvalidData, e))
+    }
+}
+
+/// YAML document
+struct YamlCodec;
+
+impl BackupCodec for YamlCodec {
+    fn encode(&self, writer: &mut dyn Write, backup: &Backup) -> io::Result<()> {
+        serde_yaml::to_writer(&mut *writer, backup)
+            .map_err(|e| io::Error::new(io::ErrorKind::InvalidData, e))
+    }
+
+    fn decode(&self, reader: &mut dyn Read) -> io::Result<Backup> {
+        serde_yaml::from_reader(reader).map_err(|e| io::Error::new(io::ErrorKind::InvalidData, e))
+    }
+}
+
+/// Plain text: `#`-prefixed headers followed by one PATH entry per line
+///
+/// A blank line stands for an empty entry.
+struct TextCodec;
+
+impl BackupCodec for TextCodec {
+    fn encode(&self, writer: &mut dyn Write, backup: &Backup) -> io::Result<()> {
+        writeln!(writer, "# pathmaster backup")?;
+        writeln!(writer, "# timestamp: {}", backup.timestamp)?;
+        if let Some(hostname) = &backup.hostname {
+            writeln!(writer, "# hostname: {}", hostname)?;
+        }
+        if let Some(shell) = &backup.shell {
+            writeln!(writer, "# shell: {}", shell)?;
+        }
+        if let Some(hash) = &backup.sha256 {
+            writeln!(writer, "# sha256: {}", hash)?;
+        }
+        if let Some(label) = &backup.label {
+            writeln!(writer, "# label: {}", label)?;
+        }
+        for entry in backup.entries() {
+            writeln!(writer, "{}", entry.to_string_lossy())?;
+        }
+        Ok(())
+    }
+
+    fn decode(&self, reader: &mut dyn Read) -> io::Result<Backup> {
+        let mut timestamp = None;
+        let mut hostname = None;
+        let mut shell = None;
+        let mut sha256 = None;
+        let mut label = None;
+        let mut entries = Vec::new();
+
+        for line in read_text(reader)?.lines() {
+            if let Some(comment) = line.strip_prefix('#') {
+                let comment = comment.trim();
+                if let Some(ts) = comment.strip_prefix("timestamp:") {
+                    timestamp = Some(ts.trim().to_string());
+                } else if let Some(host) = comment.strip_prefix("hostname:") {
+                    hostname = Some(host.trim().to_string());
+                } else if let Some(name) = comment.strip_prefix("shell:") {
+                    shell = Some(name.trim().to_string());
+                } else if let Some(hash) = comment.strip_prefix("sha256:") {
+                    sha256 = Some(hash.trim().to_string());
+                } else if let Some(note) = comment.strip_prefix("label:") {
+                    label = Some(note.trim().to_string());
+                }
+            } else {
+                // Blank lines are empty entries, kept so the hash still matches
+                entries.push(PathBuf::from(line));
+            }
+        }
+
+        let timestamp = timestamp.ok_or_else(|| {
+            io::Error::new(io::ErrorKind::InvalidData, "Missing timestamp header")
+        })?;
+        let path =
+            env::join_paths(&entries).map_err(|e| io::Error::new(io::ErrorKind::InvalidData, e))?;
+
+        Ok(Backup {
+            timestamp,
+            path: path.to_string_lossy().to_string(),
+            hostname,
+            shell,
+            sha256,
+            label,
+        })
+    }
+}
+
+/// Returns the codec for a backup format
+pub fn codec_for(format: BackupFormat) -> &'static dyn BackupCodec {
+    match format {
+        BackupFormat::Json => &JsonCodec,
+        BackupFormat::Toml => &TomlCodec,
+        BackupFormat::Text => &TextCodec,
+        BackupFormat::Yaml => &YamlCodec,
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn sample_backup() -> Backup {
+        let mut backup = Backup {
+            timestamp: String::from("20240101120000"),
+            path: String::from("/usr/bin:/usr/local/bin"),
+            hostname: Some(String::from("workstation")),
+            label: Some(String::from("before installing toolchain X")),
+            ..Default::default()
+        };
+        backup.sha256 = Some(backup.compute_hash());
+        backup
+    }
+
+    #[test]
+    fn test_every_format_round_trips() -> io::Result<()> {
+        for format in [
+            BackupFormat::Json,
+            BackupFormat::Toml,
+            BackupFormat::Text,
+            BackupFormat::Yaml,
+        ] {
+            let codec = codec_for(format);
+            let mut encoded = Vec::new();
+            codec.encode(&mut encoded, &sample_backup())?;
+
+            let decoded = codec.decode(&mut encoded.as_slice())?;
+            assert_eq!(decoded.timestamp, "20240101120000");
+            assert_eq!(decoded.path, "/usr/bin:/usr/local/bin");
+            assert_eq!(decoded.hostname.as_deref(), Some("workstation"));
+            assert_eq!(decoded.shell, None);
+            assert_eq!(decoded.sha256, sample_backup().sha256);
+            assert_eq!(decoded.label, sample_backup().label);
+            assert!(decoded.hash_matches());
+        }
+        Ok(())
+    }
+
+    #[test]
+    fn test_yaml_keeps_numeric_timestamp_as_string() -> io::Result<()> {
+        let mut encoded = Vec::new();
+        YamlCodec.encode(&mut encoded, &sample_backup())?;
+
+        let decoded = YamlCodec.decode(&mut encoded.as_slice())?;
+        assert_eq!(decoded.timestamp, "20240101120000");
+        assert_eq!(
+            decoded.entries(),
+            vec![PathBuf::from("/usr/bin"), PathBuf::from("/usr/local/bin")]
+        );
+        Ok(())
+    }
+
+    #[test]
+    fn test_text_codec() -> io::Result<()> {
+        let mut encoded = Vec::new();
+        TextCodec.encode(&mut encoded, &sample_backup())?;
+        assert_eq!(
+            String::from_utf8_lossy(&encoded),
+            "# pathmaster backup\n# timestamp: 20240101120000\n# hostname: workstation\n# sha256: af02e9480c0c301b9cd87ed4b7c5477a5981c0e996f1b3f41811d01ad00ba249\n# label: before installing toolchain X\n/usr/bin\n/usr/local/bin\n"
+        );
+
+        // Empty entries survive, so their hash still matches
+        let mut backup = Backup {
+            timestamp: String::from("20240101120000"),
+            path: String::from(":/usr/bin::/bin:"),
+            ..Default::default()
+        };
+        backup.sha256 = Some(backup.compute_hash());
+        let mut encoded = Vec::new();
+        TextCodec.encode(&mut encoded, &backup)?;
+        let decoded = TextCodec.decode(&mut encoded.as_slice())?;
+        assert_eq!(decoded.path, backup.path);
+        assert!(decoded.hash_matches());
+
+        let err = TextCodec.decode(&mut "/usr/bin\n".as_bytes()).unwrap_err();
+        assert_eq!(err.kind(), io::ErrorKind::InvalidData);
+        Ok(())
+    }
+}
@@ -0,0 +1,120 @@
+//! Comparing two saved backups for pathmaster.
+//!
+//! This module handles:
+//! - Resolving two backups from timestamps or unique prefixes
+//! - Listing the entries added, removed and moved between them
+//! - Exiting non-zero when they differ, for use in automated checks
+//!
+//! `pathmaster diff` compares a backup with the live PATH; this shows how
+//! PATH changed between two points in time.
+
+use super::core::{find_backup, StoredBackup};
+use crate::commands::diff::{diff_entries, format_line};
+use crate::status;
+use std::process;
+
+/// Renders the unified diff from one backup to another
+///
+/// Moved entries are always shown, as the order of PATH is part of how it
+/// evolved.
+///
+/// # Returns
+/// The lines to print, headers included, and the number of changes
+pub fn render_comparison(old: &StoredBackup, new: &StoredBackup) -> (Vec<String>, usize) {
+    let lines = diff_entries(&old.backup.entries(), &new.backup.entries());
+    let changes = lines.iter().filter(|line| line.is_change(true)).count();
+
+    let mut output = vec![
+        format!("--- {} ({})", old.file.display(), old.backup.timestamp),
+        format!("+++ {} ({})", new.file.display(), new.backup.timestamp),
+    ];
+    output.extend(lines.iter().map(|line| format_line(line, true)));
+    (output, changes)
+}
+
+/// Executes the backup diff command
+///
+/// Exits with status 1 if the backups differ and 2 if either cannot be
+/// found.
+///
+/// # Arguments
+///
+/// * `old` - Timestamp, or unique prefix, of the earlier backup
+/// * `new` - Timestamp, or unique prefix, of the later backup
+///
+/// # Example
+///
+/// ```no_run
+/// # use pathmaster::backup;
+/// backup::compare::execute("20240101", "20240115");
+/// // Output example:
+/// // --- /home/me/.local/share/pathmaster/backups/backup_20240101120000.json (20240101120000)
+/// // +++ /home/me/.local/share/pathmaster/backups/backup_20240115090000.json (20240115090000)
+/// // + /home/me/.cargo/bin
+/// //   /usr/bin
+/// // - /opt/old/bin
+/// ```
+pub fn execute(old: &str, new: &str) {
+    let resolve = |timestamp: &str| {
+        find_backup(timestamp).unwrap_or_else(|e| {
+            eprintln!("{}", e);
+            process::exit(2);
+        })
+    };
+    let (old, new) = (resolve(old), resolve(new));
+
+    let (output, changes) = render_comparison(&old, &new);
+    for line in &output {
+        println!("{}", line);
+    }
+
+    if changes > 0 {
+        status!("\n{} change(s) found.", changes);
+        process::exit(1);
+    }
+
+    status!("\nNo differences found.");
+}
+
+#[cfg(all(test, unix))]
+mod tests {
+    use super::*;
+    use crate::backup::core::Backup;
+    use crate::backup::BackupFormat;
+    use std::path::PathBuf;
+
+    fn stored(timestamp: &str, path: &str) -> StoredBackup {
+        StoredBackup {
+            file: PathBuf::from(format!("backup_{}.json", timestamp)),
+            format: BackupFormat::Json,
+            backup: Backup {
+                timestamp: timestamp.to_string(),
+                path: path.to_string(),
+                ..Default::default()
+            },
+        }
+    }
+
+    #[test]
+    fn test_render_comparison() {
+        let old = stored("20240101120000", "/usr/bin:/opt/old:/bin:/usr/local/bin");
+        let new = stored("20240115090000", "/usr/local/bin:/usr/bin:/bin:/opt/new");
+
+        let (output, changes) = render_comparison(&old, &new);
+        assert_eq!(
+            output,
+            vec![
+                "--- backup_20240101120000.json (20240101120000)",
+                "+++ backup_20240115090000.json (20240115090000)",
+                "~ /usr/local/bin (moved from 4 to 1)",
+                "  /usr/bin",
+                "- /opt/old",
+                "  /bin",
+                "+ /opt/new",
+            ]
+        );
+        assert_eq!(changes, 3);
+
+        assert_eq!(render_comparison(&old, &old).1, 0);
+    }
+}
@@ -1,29 +1,117 @@
 //! Core backup functionality for pathmaster.
 
+use super::codec::codec_for;
+use super::format::{self, BackupFormat, COMPRESSED_EXTENSION};
+use super::name::{self, NameFormat};
+use crate::log_info;
+use crate::utils;
+use crate::utils::xdg;
 use chrono::Local;
+use flate2::read::GzDecoder;
+use flate2::write::GzEncoder;
+use flate2::Compression;
 use lazy_static::lazy_static;
 use serde::{Deserialize, Serialize};
+use sha2::{Digest, Sha256};
 use std::env;
-use std::fs::{self, File};
-use std::io;
-use std::path::PathBuf;
+use std::fs::{self, File, OpenOptions};
+use std::io::{self, BufReader, Read, Write};
+use std::path::{Path, PathBuf};
 use std::sync::Mutex;
 
+/// Format of the timestamp embedded in backups and their file names
+pub const TIMESTAMP_FORMAT: &str = "%Y%m%d%H%M%S";
+
 lazy_static! {
     static ref BACKUP_DIR: Mutex<Option<PathBuf>> = Mutex::new(None);
+    static ref BACKUP_FORMAT: Mutex<BackupFormat> = Mutex::new(BackupFormat::default());
+    static ref NAME_FORMAT: Mutex<NameFormat> = Mutex::new(NameFormat::default());
+    static ref COMPRESS: Mutex<bool> = Mutex::new(false);
 }
 
 /// Represents a PATH backup with timestamp and path data
-#[derive(Debug, Serialize, Deserialize)]
+#[derive(Debug, Default, Serialize, Deserialize)]
 pub struct Backup {
     /// Timestamp when backup was created
     pub timestamp: String,
     /// Complete PATH string at backup time
     pub path: String,
+    /// Host the backup was taken on, recorded for exported backups
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub hostname: Option<String>,
+    /// Shell type of the host, recorded for exported backups
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub shell: Option<String>,
+    /// SHA-256 of the PATH entries, used to detect corrupted or edited backups
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub sha256: Option<String>,
+    /// Note describing why the backup was taken, given with `backup create -m`
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub label: Option<String>,
 }
 
-/// Sets a custom backup directory (primarily for testing)
-#[allow(dead_code)]
+impl Backup {
+    /// Returns the individual PATH entries stored in this backup
+    pub fn entries(&self) -> Vec<PathBuf> {
+        utils::parse_path_entries(&self.path)
+    }
+
+    /// Computes the SHA-256 of the PATH entries as lowercase hex
+    ///
+    /// Every entry is hashed, one per line, so the hash is the same in every
+    /// backup format. Empty entries are included: one slipped into a backup
+    /// would make a restored PATH search the current directory.
+    pub fn compute_hash(&self) -> String {
+        let mut hasher = Sha256::new();
+        for entry in self.entries() {
+            hasher.update(entry.to_string_lossy().as_bytes());
+            hasher.update(b"\n");
+        }
+        format!("{:x}", hasher.finalize())
+    }
+
+    /// Returns whether the label contains `text`, ignoring case
+    pub fn label_contains(&self, text: &str) -> bool {
+        self.label.as_ref().map_or(false, |label| {
+            label.to_lowercase().contains(&text.to_lowercase())
+        })
+    }
+
+    /// Returns whether the stored hash matches the PATH entries
+    ///
+    /// Backups written before hashes were recorded have none and are
+    /// accepted.
+    pub fn hash_matches(&self) -> bool {
+        self.sha256
+            .as_ref()
+            .map_or(true, |hash| hash.eq_ignore_ascii_case(&self.compute_hash()))
+    }
+}
+
+/// A backup loaded from the backup directory
+#[derive(Debug)]
+pub struct StoredBackup {
+    /// File the backup was read from
+    pub file: PathBuf,
+    /// Format the file was parsed as
+    pub format: BackupFormat,
+    /// The parsed backup data
+    pub backup: Backup,
+}
+
+/// A backup file that could not be parsed
+#[derive(Debug)]
+pub struct BackupLoadError {
+    /// File that failed to load
+    pub file: PathBuf,
+    /// Reason the file could not be loaded
+    pub error: io::Error,
+}
+
+/// Sets the directory backups are written to, overriding the default
+///
+/// Used for `--backup-dir` and `backup_dir` in the config file, and by tests
+/// to keep backups out of the real home directory.
 pub fn set_backup_dir(dir: PathBuf) -> io::Result<()> {
     let mut backup_dir = BACKUP_DIR.lock().map_err(|_| {
         io::Error::new(
@@ -37,6 +125,9 @@ pub fn set_backup_dir(dir: PathBuf) -> io::Result<()> {
 
 /// Gets the directory where backups are stored
 ///
+/// Defaults to `$XDG_DATA_HOME/pathmaster/backups`, or the legacy
+/// `~/.pathmaster/backups` if it exists (see [`xdg::backup_dir`]).
+///
 /// # Returns
 /// * `PathBuf` containing the path to the backup directory
 pub fn get_backup_dir() -> io::Result<PathBuf> {
@@ -47,46 +138,459 @@ pub fn get_backup_dir() -> io::Result<PathBuf> {
         )
     })?;
 
-    Ok(backup_dir.clone().unwrap_or_else(|| {
-        let home_dir = dirs_next::home_dir().unwrap_or_else(|| PathBuf::from("/"));
-        home_dir.join(".pathmaster/backups")
+    Ok(backup_dir.clone().unwrap_or_else(xdg::backup_dir))
+}
+
+/// Sets the format used for new backups
+pub fn set_backup_format(format: BackupFormat) -> io::Result<()> {
+    let mut backup_format = BACKUP_FORMAT.lock().map_err(|_| {
+        io::Error::new(
+            io::ErrorKind::Other,
+            "Failed to lock backup format mutex",
+        )
+    })?;
+    *backup_format = format;
+    Ok(())
+}
+
+/// Gets the format used for new backups
+pub fn get_backup_format() -> io::Result<BackupFormat> {
+    let backup_format = BACKUP_FORMAT.lock().map_err(|_| {
+        io::Error::new(
+            io::ErrorKind::Other,
+            "Failed to lock backup format mutex",
+        )
+    })?;
+    Ok(*backup_format)
+}
+
+/// Sets the scheme for the timestamp in new backup file names
+pub fn set_name_format(format: NameFormat) -> io::Result<()> {
+    let mut name_format = NAME_FORMAT
+        .lock()
+        .map_err(|_| io::Error::new(io::ErrorKind::Other, "Failed to lock name format mutex"))?;
+    *name_format = format;
+    Ok(())
+}
+
+/// Gets the scheme for the timestamp in new backup file names
+pub fn get_name_format() -> io::Result<NameFormat> {
+    let name_format = NAME_FORMAT
+        .lock()
+        .map_err(|_| io::Error::new(io::ErrorKind::Other, "Failed to lock name format mutex"))?;
+    Ok(*name_format)
+}
+
+/// Sets whether new backups are gzip-compressed
+pub fn set_compress(compress: bool) -> io::Result<()> {
+    let mut current = COMPRESS.lock().map_err(|_| {
+        io::Error::new(
+            io::ErrorKind::Other,
+            "Failed to lock backup compression mutex",
+        )
+    })?;
+    *current = compress;
+    Ok(())
+}
+
+/// Gets whether new backups are gzip-compressed
+pub fn get_compress() -> io::Result<bool> {
+    let current = COMPRESS.lock().map_err(|_| {
+        io::Error::new(
+            io::ErrorKind::Other,
+            "Failed to lock backup compression mutex",
+        )
+    })?;
+    Ok(*current)
+}
+
+/// Gzip-compresses serialized backup contents
+pub fn compress(contents: &[u8]) -> io::Result<Vec<u8>> {
+    let mut encoder = GzEncoder::new(Vec::new(), Compression::default());
+    encoder.write_all(contents)?;
+    encoder.finish()
+}
+
+/// Opens a backup file for reading, decompressing it if it ends in `.gz`
+pub fn open_backup_file(file: &Path) -> io::Result<Box<dyn Read>> {
+    let reader = BufReader::new(File::open(file)?);
+    if format::is_compressed(file) {
+        Ok(Box::new(GzDecoder::new(reader)))
+    } else {
+        Ok(Box::new(reader))
+    }
+}
+
+/// Reads the serialized contents of a backup file, decompressed
+///
+/// # Returns
+/// * `Ok(Vec<u8>)` - The contents as written by the backup's codec
+/// * `Err(io::Error)` if the file cannot be read or is not valid gzip
+pub fn read_backup_file(file: &Path) -> io::Result<Vec<u8>> {
+    let mut contents = Vec::new();
+    open_backup_file(file)?.read_to_end(&mut contents)?;
+    Ok(contents)
+}
+
+/// Serializes a backup into the given format
+///
+/// # Arguments
+/// * `backup` - The backup to serialize
+/// * `format` - The format to serialize into
+///
+/// # Returns
+/// * `Ok(String)` containing the serialized backup
+/// * `Err(io::Error)` if serialization fails
+pub fn serialize_backup(backup: &Backup, format: BackupFormat) -> io::Result<String> {
+    let mut output = Vec::new();
+    codec_for(format).encode(&mut output, backup)?;
+    String::from_utf8(output).map_err(|e| io::Error::new(io::ErrorKind::InvalidData, e))
+}
+
+/// Serializes a backup and writes it to a writer
+///
+/// # Arguments
+/// * `writer` - Destination for the serialized backup (a file, stdout, ...)
+/// * `backup` - The backup to write
+/// * `format` - The format to serialize into
+pub fn write_backup<W: Write>(
+    writer: &mut W,
+    backup: &Backup,
+    format: BackupFormat,
+) -> io::Result<()> {
+    codec_for(format).encode(writer, backup)?;
+    writer.flush()
+}
+
+/// Parses a backup from its serialized form
+///
+/// # Arguments
+/// * `contents` - The serialized backup
+/// * `format` - The format the backup was written in
+///
+/// # Returns
+/// * `Ok(Backup)` containing the parsed backup
+/// * `Err(io::Error)` if the contents are not a valid backup
+pub fn parse_backup(contents: &str, format: BackupFormat) -> io::Result<Backup> {
+    codec_for(format).decode(&mut contents.as_bytes())
+}
+
+/// Parses a backup whose format is not known in advance
+///
+/// # Arguments
+/// * `contents` - The serialized backup, in any supported format
+///
+/// # Returns
+/// * `Ok((BackupFormat, Backup))` with the detected format and the parsed backup
+/// * `Err(io::Error)` if the format cannot be detected or the contents are invalid
+pub fn parse_backup_detect(contents: &str) -> io::Result<(BackupFormat, Backup)> {
+    let format = BackupFormat::detect(contents).ok_or_else(|| {
+        io::Error::new(
+            io::ErrorKind::InvalidData,
+            "Unrecognized backup format; expected json, toml, text or yaml",
+        )
+    })?;
+    let backup = parse_backup(contents, format)?;
+    Ok((format, backup))
+}
+
+/// Loads a single backup file, detecting its format from the extension
+///
+/// Compressed files, ending in `.gz`, are decompressed first.
+///
+/// # Arguments
+/// * `file` - Path to the backup file
+///
+/// # Returns
+/// * `Ok(StoredBackup)` containing the parsed backup
+/// * `Err(io::Error)` if the file cannot be read or parsed
+pub fn load_backup(file: &Path) -> io::Result<StoredBackup> {
+    let format = BackupFormat::from_path(file).ok_or_else(|| {
+        io::Error::new(
+            io::ErrorKind::InvalidInput,
+            format!("Unrecognized backup file extension: {}", file.display()),
+        )
+    })?;
+    let backup = codec_for(format).decode(&mut open_backup_file(file)?)?;
+
+    Ok(StoredBackup {
+        file: file.to_path_buf(),
+        format,
+        backup,
+    })
+}
+
+/// Lists all backups in the backup directory, newest first
+///
+/// Ordering uses the timestamp embedded in each backup rather than the
+/// file name, so renamed files still sort correctly. Backups from the same
+/// second are ordered by the time and counter in their file names, read in
+/// any naming scheme, so a directory with mixed schemes lists correctly. Files with a known
+/// backup extension that fail to parse are reported separately instead of
+/// aborting the scan; files with other extensions are ignored.
+///
+/// # Returns
+/// * `Ok((backups, errors))` with the parsed backups and the files that failed
+/// * `Err(io::Error)` if the backup directory cannot be read
+pub fn list_backups() -> io::Result<(Vec<StoredBackup>, Vec<BackupLoadError>)> {
+    let backup_dir = get_backup_dir()?;
+    let mut backups = Vec::new();
+    let mut errors = Vec::new();
+
+    let entries = match fs::read_dir(&backup_dir) {
+        Ok(entries) => entries,
+        Err(e) if e.kind() == io::ErrorKind::NotFound => return Ok((backups, errors)),
+        Err(e) => return Err(e),
+    };
+
+    for entry in entries.flatten() {
+        let file = entry.path();
+        if !file.is_file() || BackupFormat::from_path(&file).is_none() {
+            continue;
+        }
+
+        match load_backup(&file) {
+            Ok(backup) => backups.push(backup),
+            Err(error) => errors.push(BackupLoadError { file, error }),
+        }
+    }
+
+    backups.sort_by(|a, b| {
+        b.backup
+            .timestamp
+            .cmp(&a.backup.timestamp)
+            .then_with(|| name::parse_file_name(&b.file).cmp(&name::parse_file_name(&a.file)))
+            .then_with(|| b.file.cmp(&a.file))
+    });
+
+    Ok((backups, errors))
+}
+
+/// Returns whether the backup directory holds at least one backup file
+///
+/// Unlike `list_backups`, files are not parsed, and the scan stops at the
+/// first file with a known backup extension, so this is cheap enough to
+/// call on every prompt render.
+///
+/// # Returns
+/// * `Ok(bool)` - Whether a backup file exists
+/// * `Err(io::Error)` if the backup directory cannot be read
+pub fn has_backup() -> io::Result<bool> {
+    let entries = match fs::read_dir(get_backup_dir()?) {
+        Ok(entries) => entries,
+        Err(e) if e.kind() == io::ErrorKind::NotFound => return Ok(false),
+        Err(e) => return Err(e),
+    };
+
+    Ok(entries.flatten().any(|entry| {
+        entry.file_type().map_or(false, |kind| kind.is_file())
+            && BackupFormat::from_path(&entry.path()).is_some()
     }))
 }
 
-/// Creates a new backup of the current PATH environment
+/// Finds the backup whose embedded timestamp starts with the given prefix,
+/// or whose label contains the given text
+///
+/// A query made only of digits and separators is a timestamp. Separators are
+/// ignored, so `20240115`, `20240115-143022` and `2024-01-15 14:30` all
+/// match a backup taken at `20240115143022`. Any other query is looked for
+/// in backup labels, ignoring case.
+///
+/// # Arguments
+/// * `query` - A full timestamp, a prefix of one, or part of a label
+///
+/// # Returns
+/// * `Ok(StoredBackup)` if exactly one backup matches
+/// * `Err(io::Error)` if no backup matches, or the query matches several
+pub fn find_backup(query: &str) -> io::Result<StoredBackup> {
+    let is_timestamp = query
+        .chars()
+        .all(|c| c.is_ascii_digit() || matches!(c, '-' | ':' | ' ' | 'T' | '_'));
+    let prefix: String = query.chars().filter(|c| c.is_ascii_digit()).collect();
+    if query.trim().is_empty() || (is_timestamp && prefix.is_empty()) {
+        return Err(io::Error::new(
+            io::ErrorKind::InvalidInput,
+            format!("Invalid backup timestamp: {}", query),
+        ));
+    }
+
+    let (backups, _) = list_backups()?;
+    let mut matches: Vec<StoredBackup> = backups
+        .into_iter()
+        .filter(|stored| {
+            if is_timestamp {
+                stored.backup.timestamp.starts_with(&prefix)
+            } else {
+                stored.backup.label_contains(query.trim())
+            }
+        })
+        .collect();
+
+    let what = if is_timestamp { "Timestamp" } else { "Label" };
+    match matches.len() {
+        0 => Err(io::Error::new(
+            io::ErrorKind::NotFound,
+            format!("Backup not found for {}: {}", what.to_lowercase(), query),
+        )),
+        1 => Ok(matches.remove(0)),
+        _ => {
+            let candidates: Vec<String> = matches
+                .iter()
+                .map(|stored| {
+                    let label = stored
+                        .backup
+                        .label
+                        .as_ref()
+                        .map(|label| format!(" \"{}\"", label))
+                        .unwrap_or_default();
+                    format!(
+                        "  {}{} ({})",
+                        stored.backup.timestamp,
+                        label,
+                        stored.file.display()
+                    )
+                })
+                .collect();
+            Err(io::Error::new(
+                io::ErrorKind::InvalidInput,
+                format!(
+                    "{} {} matches {} backups:\n{}",
+                    what,
+                    query,
+                    matches.len(),
+                    candidates.join("\n")
+                ),
+            ))
+        }
+    }
+}
+
+/// Cleans up a backup label for storage
+///
+/// Runs of whitespace, line breaks included, become single spaces so the
+/// label fits on one line in every format.
+///
+/// # Returns
+/// The label, or `None` if it is blank
+pub fn normalize_label(label: &str) -> Option<String> {
+    let label = label.split_whitespace().collect::<Vec<_>>().join(" ");
+    (!label.is_empty()).then_some(label)
+}
+
+/// Captures the current PATH environment as a backup, timestamped now
+pub fn capture_backup() -> Backup {
+    let mut backup = Backup {
+        timestamp: Local::now().format(TIMESTAMP_FORMAT).to_string(),
+        path: env::var("PATH").unwrap_or_default(),
+        ..Default::default()
+    };
+    backup.sha256 = Some(backup.compute_hash());
+    backup
+}
+
+/// Creates a new backup of the current PATH environment in the configured format
+///
+/// # Returns
+/// * `Ok(PathBuf)` with the location of the written backup file
+/// * `Err(io::Error)` if backup creation fails
+pub fn create_backup() -> io::Result<PathBuf> {
+    create_backup_with_format(get_backup_format()?)
+}
+
+/// Creates a new backup of the current PATH environment in the given format
+///
+/// Backups are named after their creation timestamp, in the configured
+/// naming scheme. If a backup with the
+/// same timestamp already exists, a counter suffix is appended so that
+/// existing backups are never overwritten. When compression is on, the
+/// file is gzipped and `.gz` is added to its name.
+///
+/// # Arguments
+/// * `format` - The format to write the backup in
 ///
 /// # Returns
-/// * `Ok(())` on successful backup creation
+/// * `Ok(PathBuf)` with the location of the written backup file
 /// * `Err(io::Error)` if backup creation fails
-pub fn create_backup() -> io::Result<()> {
+pub fn create_backup_with_format(format: BackupFormat) -> io::Result<PathBuf> {
+    create_labeled_backup(format, None)
+}
+
+/// Creates a new backup of the current PATH environment, with a label
+///
+/// Works like [`create_backup_with_format`], storing `label` in the backup.
+///
+/// # Arguments
+/// * `format` - The format to write the backup in
+/// * `label` - Note describing why the backup was taken; normalized with
+///   [`normalize_label`]
+pub fn create_labeled_backup(format: BackupFormat, label: Option<&str>) -> io::Result<PathBuf> {
     let backup_dir = get_backup_dir()?;
 
     // Create backup directory if it doesn't exist
     fs::create_dir_all(&backup_dir)?;
 
-    let timestamp = Local::now().format("%Y%m%d%H%M%S").to_string();
-    let path = env::var("PATH").unwrap_or_default();
-
     let backup = Backup {
-        timestamp: timestamp.clone(),
-        path,
+        label: label.and_then(normalize_label),
+        ..capture_backup()
+    };
+    let stamp = get_name_format()?.stamp(&backup.timestamp);
+    let compressed = get_compress()?;
+    let extension = if compressed {
+        format!("{}.{}", format.extension(), COMPRESSED_EXTENSION)
+    } else {
+        format.extension().to_string()
     };
 
-    let backup_file = backup_dir.join(format!("backup_{}.json", timestamp));
-    println!("Creating backup at: {:?}", backup_file); // Debug print
+    let (backup_file, mut file) = create_unique_file(&backup_dir, &stamp, &extension)?;
+    if compressed {
+        let mut encoder = GzEncoder::new(file, Compression::default());
+        write_backup(&mut encoder, &backup, format)?;
+        encoder.finish()?;
+    } else {
+        write_backup(&mut file, &backup, format)?;
+    }
+    log_info!(
+        "Wrote {} backup of PATH to {}",
+        format,
+        backup_file.display()
+    );
 
-    let file = File::create(&backup_file)?;
-    serde_json::to_writer_pretty(file, &backup)?;
+    Ok(backup_file)
+}
 
-    // Verify file was created
-    if !backup_file.exists() {
-        return Err(io::Error::new(
-            io::ErrorKind::Other,
-            format!("Failed to create backup file at {:?}", backup_file),
-        ));
+/// Creates a new, previously non-existent backup file for the given stamp
+/// and extension
+///
+/// Uses `create_new` so that two backups created within the same second
+/// never clobber each other; on collision a `_N` counter suffix is tried.
+fn create_unique_file(
+    backup_dir: &Path,
+    stamp: &str,
+    extension: &str,
+) -> io::Result<(PathBuf, fs::File)> {
+    for counter in 0..1000 {
+        let name = if counter == 0 {
+            format!("backup_{}.{}", stamp, extension)
+        } else {
+            format!("backup_{}_{}.{}", stamp, counter, extension)
+        };
+        let backup_file = backup_dir.join(name);
+
+        match OpenOptions::new()
+            .write(true)
+            .create_new(true)
+            .open(&backup_file)
+        {
+            Ok(file) => return Ok((backup_file, file)),
+            Err(e) if e.kind() == io::ErrorKind::AlreadyExists => continue,
+            Err(e) => return Err(e),
+        }
     }
 
-    Ok(())
+    Err(io::Error::new(
+        io::ErrorKind::AlreadyExists,
+        format!("Too many backups for timestamp {}", stamp),
+    ))
 }
 
 #[cfg(test)]
@@ -114,6 +618,27 @@ mod tests {
         Ok(count)
     }
 
+    #[test]
+    fn test_hash_covers_empty_entries() {
+        let backup = Backup {
+            timestamp: String::from("20240101120000"),
+            path: String::from("/usr/bin:/bin"),
+            ..Default::default()
+        };
+        let hash = backup.compute_hash();
+
+        for injected in ["/usr/bin::/bin", ":/usr/bin:/bin", "/usr/bin:/bin:"] {
+            let tampered = Backup {
+                timestamp: backup.timestamp.clone(),
+                path: String::from(injected),
+                sha256: Some(hash.clone()),
+                ..Default::default()
+            };
+            assert_ne!(tampered.compute_hash(), hash, "{}", injected);
+            assert!(!tampered.hash_matches());
+        }
+    }
+
     #[test]
     #[serial]
     fn test_backup_creation() -> io::Result<()> {
@@ -256,4 +781,256 @@ mod tests {
 
         Ok(())
     }
+
+    #[test]
+    #[serial]
+    fn test_backup_timestamp_collision() -> io::Result<()> {
+        let temp_dir = TempDir::new()?;
+        let backup_dir = temp_dir.path().to_path_buf();
+        set_backup_dir(backup_dir.clone())?;
+
+        let first = create_unique_file(&backup_dir, "20240115143022", "json")?.0;
+        let second = create_unique_file(&backup_dir, "20240115143022", "json")?.0;
+
+        assert_ne!(first, second);
+        assert!(second
+            .to_string_lossy()
+            .ends_with("backup_20240115143022_1.json"));
+
+        Ok(())
+    }
+
+    #[test]
+    #[serial]
+    fn test_list_backups() -> io::Result<()> {
+        let temp_dir = TempDir::new()?;
+        let backup_dir = temp_dir.path().to_path_buf();
+        set_backup_dir(backup_dir.clone())?;
+
+        // Older backup stored under a name that sorts after the newer one
+        fs::write(
+            backup_dir.join("zz_renamed.json"),
+            r#"{"timestamp": "20240101120000", "path": "/old/bin"}"#,
+        )?;
+        fs::write(
+            backup_dir.join("backup_20240115143022.txt"),
+            "# pathmaster backup\n# timestamp: 20240115143022\n/usr/bin\n/bin\n",
+        )?;
+        fs::write(backup_dir.join("backup_20240110000000.json"), "{ truncated")?;
+        fs::write(backup_dir.join("README.md"), "not a backup")?;
+
+        let (backups, errors) = list_backups()?;
+
+        assert_eq!(backups.len(), 2);
+        assert_eq!(backups[0].backup.timestamp, "20240115143022");
+        assert_eq!(backups[0].format, BackupFormat::Text);
+        assert_eq!(backups[0].backup.path, "/usr/bin:/bin");
+        assert_eq!(backups[1].backup.timestamp, "20240101120000");
+
+        assert_eq!(errors.len(), 1);
+        assert!(errors[0].file.ends_with("backup_20240110000000.json"));
+
+        Ok(())
+    }
+
+    #[test]
+    #[serial]
+    fn test_list_backups_mixed_name_formats() -> io::Result<()> {
+        let temp_dir = TempDir::new()?;
+        let backup_dir = temp_dir.path().to_path_buf();
+        set_backup_dir(backup_dir.clone())?;
+
+        // Two backups from the same second; the second one, named in another
+        // scheme, sorts first by name but must list first by its counter
+        let contents =
+            |path: &str| format!(r#"{{"timestamp": "20240115143022", "path": "{}"}}"#, path);
+        fs::write(
+            backup_dir.join("backup_20240115143022.json"),
+            contents("/first"),
+        )?;
+        let epoch = NameFormat::Epoch.stamp("20240115143022");
+        fs::write(
+            backup_dir.join(format!("backup_{}_1.json", epoch)),
+            contents("/second"),
+        )?;
+
+        let (backups, _) = list_backups()?;
+        assert_eq!(backups[0].backup.path, "/second");
+        assert_eq!(backups[1].backup.path, "/first");
+
+        set_name_format(NameFormat::Epoch)?;
+        let created = create_backup();
+        set_name_format(NameFormat::Compact)?;
+        let created = created?;
+        assert!(name::parse_file_name(&created).is_some());
+        assert_eq!(created.file_stem().unwrap().len(), "backup_".len() + 10);
+
+        Ok(())
+    }
+
+    #[test]
+    #[serial]
+    fn test_find_backup() -> io::Result<()> {
+        let temp_dir = TempDir::new()?;
+        let backup_dir = temp_dir.path().to_path_buf();
+        set_backup_dir(backup_dir.clone())?;
+
+        fs::write(
+            backup_dir.join("backup_20240115143022.json"),
+            r#"{"timestamp": "20240115143022", "path": "/usr/bin"}"#,
+        )?;
+        fs::write(
+            backup_dir.join("backup_20240115150000.json"),
+            r#"{"timestamp": "20240115150000", "path": "/bin"}"#,
+        )?;
+        fs::write(
+            backup_dir.join("backup_20240201090000.json"),
+            r#"{"timestamp": "20240201090000", "path": "/sbin"}"#,
+        )?;
+
+        assert_eq!(find_backup("202402")?.backup.path, "/sbin");
+        assert_eq!(find_backup("20240115-143022")?.backup.path, "/usr/bin");
+        assert_eq!(
+            find_backup("20240115").unwrap_err().kind(),
+            io::ErrorKind::InvalidInput
+        );
+        assert_eq!(
+            find_backup("2023").unwrap_err().kind(),
+            io::ErrorKind::NotFound
+        );
+        assert_eq!(
+            find_backup("latest").unwrap_err().kind(),
+            io::ErrorKind::NotFound
+        );
+        assert_eq!(
+            find_backup("--").unwrap_err().kind(),
+            io::ErrorKind::InvalidInput
+        );
+
+        Ok(())
+    }
+
+    #[test]
+    #[serial]
+    fn test_find_backup_by_label() -> io::Result<()> {
+        let temp_dir = TempDir::new()?;
+        set_backup_dir(temp_dir.path().to_path_buf())?;
+
+        fs::write(
+            temp_dir.path().join("backup_20240115143022.json"),
+            r#"{"timestamp": "20240115143022", "path": "/usr/bin", "label": "Before installing toolchain X"}"#,
+        )?;
+        fs::write(
+            temp_dir.path().join("backup_20240201090000.json"),
+            r#"{"timestamp": "20240201090000", "path": "/sbin", "label": "before upgrade 2"}"#,
+        )?;
+
+        assert_eq!(find_backup("toolchain")?.backup.path, "/usr/bin");
+        assert_eq!(find_backup("UPGRADE 2")?.backup.path, "/sbin");
+        assert_eq!(
+            find_backup("before").unwrap_err().kind(),
+            io::ErrorKind::InvalidInput
+        );
+        assert_eq!(find_backup("2024-02")?.backup.path, "/sbin");
+
+        let created = create_labeled_backup(BackupFormat::Json, Some("  after\n cleanup "))?;
+        assert_eq!(
+            load_backup(&created)?.backup.label.as_deref(),
+            Some("after cleanup")
+        );
+
+        Ok(())
+    }
+
+    #[test]
+    #[serial]
+    fn test_list_backups_missing_dir() -> io::Result<()> {
+        let temp_dir = TempDir::new()?;
+        set_backup_dir(temp_dir.path().join("missing"))?;
+
+        let (backups, errors) = list_backups()?;
+        assert!(backups.is_empty());
+        assert!(errors.is_empty());
+        assert!(!has_backup()?);
+
+        Ok(())
+    }
+
+    #[test]
+    #[serial]
+    fn test_has_backup() -> io::Result<()> {
+        let temp_dir = TempDir::new()?;
+        set_backup_dir(temp_dir.path().to_path_buf())?;
+
+        fs::write(temp_dir.path().join("notes.md"), "not a backup")?;
+        assert!(!has_backup()?);
+
+        fs::write(temp_dir.path().join("backup_20240101120000.yaml"), "")?;
+        assert!(has_backup()?);
+
+        Ok(())
+    }
+
+    #[test]
+    #[serial]
+    fn test_backup_formats() -> io::Result<()> {
+        let temp_dir = TempDir::new()?;
+        set_backup_dir(temp_dir.path().to_path_buf())?;
+        env::set_var("PATH", "/usr/bin:/usr/local/bin");
+
+        let text_file = create_backup_with_format(BackupFormat::Text)?;
+        assert_eq!(text_file.extension().unwrap(), "txt");
+        let content = fs::read_to_string(&text_file)?;
+        assert!(content.starts_with("# pathmaster backup\n# timestamp: "));
+        assert!(content.ends_with("/usr/bin\n/usr/local/bin\n"));
+
+        let toml_file = create_backup_with_format(BackupFormat::Toml)?;
+        assert_eq!(toml_file.extension().unwrap(), "toml");
+        let backup: Backup = toml::from_str(&fs::read_to_string(&toml_file)?)
+            .map_err(|e| io::Error::new(io::ErrorKind::InvalidData, e))?;
+        assert_eq!(backup.path, "/usr/bin:/usr/local/bin");
+
+        Ok(())
+    }
+
+    #[test]
+    #[serial]
+    fn test_compressed_backups_round_trip() -> io::Result<()> {
+        let temp_dir = TempDir::new()?;
+        set_backup_dir(temp_dir.path().to_path_buf())?;
+        env::set_var("PATH", "/usr/bin:/opt/it's here/bin");
+
+        set_compress(true)?;
+        let created = [BackupFormat::Json, BackupFormat::Yaml]
+            .iter()
+            .map(|format| create_backup_with_format(*format))
+            .collect::<io::Result<Vec<PathBuf>>>();
+        set_compress(false)?;
+        let created = created?;
+
+        assert!(created[0].to_string_lossy().ends_with(".json.gz"));
+        assert!(created[1].to_string_lossy().ends_with(".yaml.gz"));
+        // Written as gzip, not as the format's plain text
+        assert_eq!(&fs::read(&created[0])?[..2], &[0x1f, 0x8b]);
+
+        let plain = create_backup_with_format(BackupFormat::Json)?;
+        let (backups, errors) = list_backups()?;
+        assert!(errors.is_empty());
+        assert_eq!(backups.len(), 3);
+        for stored in &backups {
+            assert_eq!(stored.backup.path, "/usr/bin:/opt/it's here/bin");
+            assert!(stored.backup.hash_matches());
+        }
+
+        let stored = load_backup(&created[1])?;
+        assert_eq!(stored.format, BackupFormat::Yaml);
+        assert_eq!(
+            read_backup_file(&created[0])?,
+            serialize_backup(&load_backup(&created[0])?.backup, BackupFormat::Json)?.into_bytes()
+        );
+        assert_eq!(read_backup_file(&plain)?, fs::read(&plain)?);
+        assert!(has_backup()?);
+
+        Ok(())
+    }
 }
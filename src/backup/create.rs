@@ -0,0 +1,136 @@
+//! Backups taken before PATH is changed.
+//!
+//! This module handles:
+//! - Taking a labeled backup on request with `backup create`
+//! - Skipping the automatic backup when `auto_backup` is turned off in the
+//!   config file
+//! - Applying the configured retention limits after each backup, so the
+//!   backup directory stays bounded without running `backup prune`
+
+use super::core::{create_backup, create_labeled_backup, get_backup_format};
+use super::prune::{parse_age, prune_backups};
+use crate::utils::settings;
+use crate::{log_debug, log_info, status};
+use std::io;
+use std::path::PathBuf;
+use std::process;
+
+/// Removes backups beyond the configured retention limits
+///
+/// Backups beyond `keep_backups` or older than `max_backup_age` are removed,
+/// using the same rules as `backup prune`. Neither is set by default, in
+/// which case nothing is removed.
+///
+/// # Returns
+/// * `Ok(Vec<PathBuf>)` with the files that were removed
+/// * `Err(io::Error)` if the age is invalid or old backups cannot be removed
+pub fn enforce_retention() -> io::Result<Vec<PathBuf>> {
+    let settings = settings::get_settings()?;
+    if settings.keep_backups.is_none() && settings.max_backup_age.is_none() {
+        return Ok(Vec::new());
+    }
+
+    let max_age = settings
+        .max_backup_age
+        .as_deref()
+        .map(parse_age)
+        .transpose()
+        .map_err(|e| io::Error::new(io::ErrorKind::InvalidInput, e))?;
+    let removed = prune_backups(settings.keep_backups, max_age)?;
+    log_info!("Pruned {} old backup(s) as configured", removed.len());
+    Ok(removed)
+}
+
+/// Backs up PATH before a change, as configured
+///
+/// After the backup is written, the retention limits are applied with
+/// [`enforce_retention`].
+///
+/// # Returns
+/// * `Ok(Some(PathBuf))` - The backup that was written
+/// * `Ok(None)` - Automatic backups are turned off
+/// * `Err(io::Error)` if the backup cannot be written or old ones removed
+pub fn backup_before_change() -> io::Result<Option<PathBuf>> {
+    let settings = settings::get_settings()?;
+    if !settings.auto_backup {
+        log_debug!("auto_backup is off; not backing up PATH before the change");
+        return Ok(None);
+    }
+
+    let backup_file = create_backup()?;
+    enforce_retention()?;
+
+    Ok(Some(backup_file))
+}
+
+/// Executes the backup create command
+///
+/// Backs up the current PATH in the configured format whether or not
+/// `auto_backup` is on, then applies the retention limits. Exits with
+/// status 1 if the backup cannot be written.
+///
+/// # Arguments
+///
+/// * `message` - Label describing why the backup was taken, shown by
+///   `backup list` and matched by `restore`
+///
+/// # Example
+///
+/// ```no_run
+/// # use pathmaster::backup;
+/// backup::create::execute(Some("before installing toolchain X"));
+/// ```
+pub fn execute(message: Option<&str>) {
+    let created = get_backup_format()
+        .and_then(|format| create_labeled_backup(format, message))
+        .and_then(|file| enforce_retention().map(|_| file));
+
+    match created {
+        Ok(file) => status!("Created PATH backup at: {}", file.display()),
+        Err(e) => {
+            eprintln!("Error creating backup: {}", e);
+            process::exit(1);
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::backup::core::{list_backups, set_backup_dir};
+    use crate::utils::settings::Settings;
+    use serial_test::serial;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[test]
+    #[serial]
+    fn test_retention_after_backup() -> io::Result<()> {
+        let temp_dir = TempDir::new()?;
+        set_backup_dir(temp_dir.path().to_path_buf())?;
+        for timestamp in ["20240101120000", "20240102120000", "20240103120000"] {
+            fs::write(
+                temp_dir.path().join(format!("backup_{}.json", timestamp)),
+                format!(r#"{{"timestamp": "{}", "path": "/usr/bin"}}"#, timestamp),
+            )?;
+        }
+
+        // Off by default: nothing is removed
+        settings::set_settings(Settings::default())?;
+        backup_before_change()?;
+        assert_eq!(list_backups()?.0.len(), 4);
+
+        settings::set_settings(Settings {
+            keep_backups: Some(2),
+            ..Default::default()
+        })?;
+        let created = backup_before_change();
+        settings::set_settings(Settings::default())?;
+        let created = created?.unwrap();
+
+        let (backups, _) = list_backups()?;
+        assert_eq!(backups.len(), 2);
+        assert_eq!(backups[0].file, created);
+        Ok(())
+    }
+}
@@ -0,0 +1,238 @@
+//! Backup file formats for the pathmaster tool.
+//!
+//! This module handles:
+//! - The set of supported backup serialization formats
+//! - Mapping formats to and from file extensions
+//! - Recognizing compressed backups by their `.gz` suffix
+//! - Parsing format names supplied on the command line
+
+use std::fmt;
+use std::path::Path;
+use std::str::FromStr;
+
+/// Extension added after the format's own for gzip-compressed backups,
+/// e.g. `backup_20240115143022.json.gz`
+pub const COMPRESSED_EXTENSION: &str = "gz";
+
+/// Returns whether a backup file is gzip-compressed
+pub fn is_compressed(path: &Path) -> bool {
+    path.extension()
+        .map_or(false, |ext| ext == COMPRESSED_EXTENSION)
+}
+
+/// Strips the compression extension from a backup file name
+///
+/// Returns the file name without `.gz` for a compressed backup, so its
+/// format's extension is last again, and `path` unchanged otherwise.
+pub fn strip_compression(path: &Path) -> &Path {
+    match path.file_stem() {
+        Some(stem) if is_compressed(path) => Path::new(stem),
+        _ => path,
+    }
+}
+
+/// Represents the serialization formats available for PATH backups.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Hash)]
+pub enum BackupFormat {
+    /// Pretty-printed JSON document (default)
+    Json,
+    /// TOML document
+    Toml,
+    /// Plain text, one PATH entry per line
+    Text,
+    /// YAML document
+    Yaml,
+}
+
+impl Default for BackupFormat {
+    fn default() -> Self {
+        Self::Json
+    }
+}
+
+impl fmt::Display for BackupFormat {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        match self {
+            BackupFormat::Json => write!(f, "json"),
+            BackupFormat::Toml => write!(f, "toml"),
+            BackupFormat::Text => write!(f, "text"),
+            BackupFormat::Yaml => write!(f, "yaml"),
+        }
+    }
+}
+
+impl FromStr for BackupFormat {
+    type Err = String;
+
+    fn from_str(s: &str) -> Result<Self, Self::Err> {
+        match s.to_lowercase().as_str() {
+            "json" => Ok(BackupFormat::Json),
+            "toml" => Ok(BackupFormat::Toml),
+            "text" | "txt" => Ok(BackupFormat::Text),
+            "yaml" | "yml" => Ok(BackupFormat::Yaml),
+            _ => Err(format!(
+                "Invalid backup format: {}. Valid formats are: json, toml, text, yaml",
+                s
+            )),
+        }
+    }
+}
+
+impl BackupFormat {
+    /// Returns the file extension used for backups in this format
+    pub fn extension(&self) -> &'static str {
+        match self {
+            BackupFormat::Json => "json",
+            BackupFormat::Toml => "toml",
+            BackupFormat::Text => "txt",
+            BackupFormat::Yaml => "yaml",
+        }
+    }
+
+    /// Determines the backup format from a file's extension
+    ///
+    /// A trailing `.gz` is skipped, so `backup.json.gz` is JSON.
+    ///
+    /// # Returns
+    /// * `Some(BackupFormat)` if the extension is a known backup extension
+    /// * `None` otherwise
+    pub fn from_path(path: &Path) -> Option<Self> {
+        match strip_compression(path).extension()?.to_str()? {
+            "json" => Some(BackupFormat::Json),
+            "toml" => Some(BackupFormat::Toml),
+            "txt" => Some(BackupFormat::Text),
+            "yaml" | "yml" => Some(BackupFormat::Yaml),
+            _ => None,
+        }
+    }
+
+    /// Guesses the format of a serialized backup from its contents
+    ///
+    /// # Returns
+    /// * `Some(BackupFormat)` if the contents look like a known format
+    /// * `None` if no format matches
+    pub fn detect(contents: &str) -> Option<Self> {
+        let first_line = contents
+            .lines()
+            .map(str::trim)
+            .find(|line| !line.is_empty())?;
+
+        // A leading `key:` (as opposed to TOML's `key =`) marks YAML
+        let key_len = first_line
+            .find(|c: char| !c.is_ascii_alphanumeric() && c != '_')
+            .unwrap_or(first_line.len());
+
+        if first_line.starts_with('{') {
+            Some(BackupFormat::Json)
+        } else if first_line.starts_with('#')
+            || first_line.starts_with('/')
+            || has_drive_prefix(first_line)
+        {
+            Some(BackupFormat::Text)
+        } else if first_line == "---" || (key_len > 0 && first_line[key_len..].starts_with(':')) {
+            Some(BackupFormat::Yaml)
+        } else if first_line.contains('=') {
+            Some(BackupFormat::Toml)
+        } else {
+            None
+        }
+    }
+}
+
+/// Checks whether a line starts with a Windows drive path such as `C:\` or `C:/`
+///
+/// These would otherwise read as a YAML `key:` line.
+fn has_drive_prefix(line: &str) -> bool {
+    let bytes = line.as_bytes();
+    bytes.len() >= 3
+        && bytes[0].is_ascii_alphabetic()
+        && bytes[1] == b':'
+        && (bytes[2] == b'\\' || bytes[2] == b'/')
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_format_parsing() {
+        assert_eq!("json".parse::<BackupFormat>().unwrap(), BackupFormat::Json);
+        assert_eq!("TOML".parse::<BackupFormat>().unwrap(), BackupFormat::Toml);
+        assert_eq!("text".parse::<BackupFormat>().unwrap(), BackupFormat::Text);
+        assert_eq!("yml".parse::<BackupFormat>().unwrap(), BackupFormat::Yaml);
+        assert!("xml".parse::<BackupFormat>().is_err());
+    }
+
+    #[test]
+    fn test_format_extensions() {
+        for format in [
+            BackupFormat::Json,
+            BackupFormat::Toml,
+            BackupFormat::Text,
+            BackupFormat::Yaml,
+        ] {
+            let file = format!("backup_20240115143022.{}", format.extension());
+            assert_eq!(BackupFormat::from_path(Path::new(&file)), Some(format));
+        }
+        assert_eq!(
+            BackupFormat::from_path(Path::new("backup_20240115143022.yml")),
+            Some(BackupFormat::Yaml)
+        );
+        assert_eq!(BackupFormat::from_path(Path::new("notes.md")), None);
+    }
+
+    #[test]
+    fn test_compressed_extensions() {
+        let file = Path::new("backup_20240115143022.toml.gz");
+        assert!(is_compressed(file));
+        assert_eq!(
+            strip_compression(file),
+            Path::new("backup_20240115143022.toml")
+        );
+        assert_eq!(BackupFormat::from_path(file), Some(BackupFormat::Toml));
+
+        let plain = Path::new("backup_20240115143022.json");
+        assert!(!is_compressed(plain));
+        assert_eq!(strip_compression(plain), plain);
+        assert_eq!(BackupFormat::from_path(Path::new("notes.gz")), None);
+        assert_eq!(BackupFormat::from_path(Path::new("backup.json.zst")), None);
+    }
+
+    #[test]
+    fn test_format_detection() {
+        assert_eq!(
+            BackupFormat::detect("\n{\n  \"timestamp\": \"20240101120000\"\n}"),
+            Some(BackupFormat::Json)
+        );
+        assert_eq!(
+            BackupFormat::detect("timestamp = \"20240101120000\"\npath = \"/usr/bin\"\n"),
+            Some(BackupFormat::Toml)
+        );
+        assert_eq!(
+            BackupFormat::detect("# pathmaster backup\n# timestamp: 20240101120000\n/usr/bin\n"),
+            Some(BackupFormat::Text)
+        );
+        assert_eq!(
+            BackupFormat::detect("timestamp: '20240101120000'\npath: /usr/bin\n"),
+            Some(BackupFormat::Yaml)
+        );
+        assert_eq!(
+            BackupFormat::detect("---\ntimestamp: '20240101120000'\n"),
+            Some(BackupFormat::Yaml)
+        );
+        assert_eq!(
+            BackupFormat::detect("C:\\Windows\nC:\\Windows\\System32\n"),
+            Some(BackupFormat::Text)
+        );
+        assert_eq!(
+            BackupFormat::detect("D:/tools/bin\n"),
+            Some(BackupFormat::Text)
+        );
+        assert_eq!(
+            BackupFormat::detect("C: /usr/bin\n"),
+            Some(BackupFormat::Yaml)
+        );
+        assert_eq!(BackupFormat::detect("   \n"), None);
+        assert_eq!(BackupFormat::detect("<backup/>"), None);
+    }
+}
@@ -1,11 +1,19 @@
 //! Backup functionality for pathmaster.
 
+pub mod codec;
+pub mod compare;
 pub mod core;
 pub mod create;
+pub mod format;
 pub mod mode;
+pub mod name;
+pub mod prune;
 pub mod restore;
 pub mod show;
+pub mod verify;
 
 pub use core::create_backup;
+pub use format::BackupFormat;
+pub use name::NameFormat;
 pub use restore::execute as restore_from_backup;
 pub use show::show_history;
@@ -0,0 +1,207 @@
+//! Backup file naming schemes for the pathmaster tool.
+//!
+//! This module handles:
+//! - The schemes for the timestamp in a backup's file name
+//! - Parsing scheme names supplied on the command line or in the config file
+//! - Reading the creation time back out of a file name in any scheme
+//!
+//! Only the file name changes between schemes. The timestamp stored inside
+//! each backup is always written the same way, and is what backups are
+//! ordered and looked up by.
+
+use super::core::TIMESTAMP_FORMAT;
+use super::format::strip_compression;
+use chrono::{DateTime, Local, NaiveDateTime, SecondsFormat, TimeZone};
+use std::fmt;
+use std::path::Path;
+use std::str::FromStr;
+
+/// Represents the ways a backup file name can carry its timestamp.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum NameFormat {
+    /// Local time as digits, e.g. `backup_20240115143022.json` (default)
+    Compact,
+    /// ISO 8601 basic local time with offset, e.g.
+    /// `backup_20240115T143022+0100.json`. Unlike the extended RFC 3339 form
+    /// it has no colons, so the name is valid on Windows too.
+    Rfc3339,
+    /// Seconds since the Unix epoch, e.g. `backup_1705325422.json`
+    Epoch,
+}
+
+impl Default for NameFormat {
+    fn default() -> Self {
+        Self::Compact
+    }
+}
+
+impl fmt::Display for NameFormat {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        match self {
+            NameFormat::Compact => write!(f, "compact"),
+            NameFormat::Rfc3339 => write!(f, "rfc3339"),
+            NameFormat::Epoch => write!(f, "epoch"),
+        }
+    }
+}
+
+impl FromStr for NameFormat {
+    type Err = String;
+
+    fn from_str(s: &str) -> Result<Self, Self::Err> {
+        match s.to_lowercase().as_str() {
+            "compact" => Ok(NameFormat::Compact),
+            "rfc3339" => Ok(NameFormat::Rfc3339),
+            "epoch" | "unix" => Ok(NameFormat::Epoch),
+            _ => Err(format!(
+                "Invalid backup name format: {}. Valid formats are: compact, rfc3339, epoch",
+                s
+            )),
+        }
+    }
+}
+
+/// `strftime` format of the timestamp in rfc3339 file names
+const BASIC_ISO_FORMAT: &str = "%Y%m%dT%H%M%S%z";
+
+/// Interprets a compact timestamp as local time
+///
+/// A time repeated when clocks go back is taken as its first occurrence.
+fn local_time(timestamp: &str) -> Option<DateTime<Local>> {
+    let naive = NaiveDateTime::parse_from_str(timestamp, TIMESTAMP_FORMAT).ok()?;
+    Local.from_local_datetime(&naive).earliest()
+}
+
+impl NameFormat {
+    /// Formats a backup's timestamp for its file name
+    ///
+    /// # Arguments
+    /// * `timestamp` - The backup's timestamp, in `TIMESTAMP_FORMAT`
+    ///
+    /// # Returns
+    /// The timestamp in this scheme, or unchanged if it cannot be parsed
+    pub fn stamp(&self, timestamp: &str) -> String {
+        let time = match (self, local_time(timestamp)) {
+            (NameFormat::Compact, _) | (_, None) => return timestamp.to_string(),
+            (_, Some(time)) => time,
+        };
+
+        match self {
+            NameFormat::Rfc3339 => time.format(BASIC_ISO_FORMAT).to_string(),
+            _ => time.timestamp().to_string(),
+        }
+    }
+}
+
+/// Formats a backup's timestamp as RFC 3339 local time with offset
+///
+/// For display and JSON output, not file names: the result contains colons.
+///
+/// # Returns
+/// The timestamp, e.g. `2024-01-15T14:30:22+01:00`, or unchanged if it
+/// cannot be parsed
+pub fn rfc3339(timestamp: &str) -> String {
+    local_time(timestamp).map_or_else(
+        || timestamp.to_string(),
+        |time| time.to_rfc3339_opts(SecondsFormat::Secs, false),
+    )
+}
+
+/// Reads the creation time from a backup file name in any scheme
+///
+/// Names look like `backup_<stamp>.<ext>`, or `backup_<stamp>_<n>.<ext>` when
+/// several backups were taken in the same second, with `.gz` after the
+/// extension for compressed backups.
+///
+/// # Returns
+/// * `Some((seconds, n))` - Seconds since the Unix epoch and the counter,
+///   0 when there is none
+/// * `None` if the name does not follow any scheme
+pub fn parse_file_name(file: &Path) -> Option<(i64, u32)> {
+    let stem = strip_compression(file)
+        .file_stem()?
+        .to_str()?
+        .strip_prefix("backup_")?;
+    let (stamp, counter) = match stem.rsplit_once('_') {
+        Some((stamp, counter)) => (stamp, counter.parse().ok()?),
+        None => (stem, 0),
+    };
+
+    let all_digits = !stamp.is_empty() && stamp.chars().all(|c| c.is_ascii_digit());
+    let seconds = if all_digits && stamp.len() == 14 {
+        local_time(stamp)?.timestamp()
+    } else if all_digits {
+        stamp.parse().ok()?
+    } else if let Ok(time) = DateTime::parse_from_str(stamp, BASIC_ISO_FORMAT) {
+        time.timestamp()
+    } else {
+        // Names written before the colons were dropped
+        DateTime::parse_from_rfc3339(stamp).ok()?.timestamp()
+    };
+    Some((seconds, counter))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_parse_name_format() {
+        assert_eq!("compact".parse(), Ok(NameFormat::Compact));
+        assert_eq!("RFC3339".parse(), Ok(NameFormat::Rfc3339));
+        assert_eq!("unix".parse(), Ok(NameFormat::Epoch));
+        assert!("iso".parse::<NameFormat>().is_err());
+        assert_eq!(NameFormat::default().to_string(), "compact");
+    }
+
+    #[test]
+    fn test_every_scheme_parses_back() {
+        let timestamp = "20240115143022";
+        let seconds = local_time(timestamp).unwrap().timestamp();
+
+        for format in [NameFormat::Compact, NameFormat::Rfc3339, NameFormat::Epoch] {
+            let stamp = format.stamp(timestamp);
+            let name = format!("backup_{}.json", stamp);
+            assert_eq!(parse_file_name(Path::new(&name)), Some((seconds, 0)));
+
+            let name = format!("backup_{}_2.toml", stamp);
+            assert_eq!(parse_file_name(Path::new(&name)), Some((seconds, 2)));
+
+            let name = format!("backup_{}_3.yaml.gz", stamp);
+            assert_eq!(parse_file_name(Path::new(&name)), Some((seconds, 3)));
+        }
+        assert_eq!(NameFormat::Epoch.stamp(timestamp), seconds.to_string());
+        assert!(NameFormat::Rfc3339
+            .stamp(timestamp)
+            .starts_with("20240115T143022"));
+        assert!(rfc3339(timestamp).starts_with("2024-01-15T14:30:22"));
+
+        // Older rfc3339 names with colons are still read
+        let name = format!("backup_{}.json", rfc3339(timestamp));
+        assert_eq!(parse_file_name(Path::new(&name)), Some((seconds, 0)));
+    }
+
+    #[test]
+    fn test_names_are_portable() {
+        for format in [NameFormat::Compact, NameFormat::Rfc3339, NameFormat::Epoch] {
+            let stamp = format.stamp("20240115143022");
+            assert!(
+                !stamp.contains(|c| matches!(
+                    c,
+                    ':' | '<' | '>' | '"' | '/' | '\\' | '|' | '?' | '*'
+                )),
+                "{} gives {}",
+                format,
+                stamp
+            );
+        }
+    }
+
+    #[test]
+    fn test_unrecognized_names() {
+        assert_eq!(NameFormat::Epoch.stamp("garbled"), "garbled");
+        assert_eq!(parse_file_name(Path::new("notes.json")), None);
+        assert_eq!(parse_file_name(Path::new("backup_latest.json")), None);
+        assert_eq!(parse_file_name(Path::new("backup_20240115_x.json")), None);
+    }
+}
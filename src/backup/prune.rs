@@ -0,0 +1,216 @@
+//! Backup pruning for pathmaster.
+//!
+//! This module handles:
+//! - Parsing retention ages such as `30d` or `12h`
+//! - Selecting backups beyond a count or age limit
+//! - Deleting the selected backups while always keeping the newest one
+
+use super::core::{list_backups, StoredBackup, TIMESTAMP_FORMAT};
+use crate::status;
+use crate::utils::settings;
+use chrono::{Local, NaiveDateTime};
+use std::fs;
+use std::io;
+use std::path::PathBuf;
+use std::time::Duration;
+
+/// Parses a retention age such as `30d`, `12h`, `2w`, `45m` or `90s`
+///
+/// # Returns
+/// * `Ok(Duration)` for a whole number followed by a unit (s, m, h, d, w)
+/// * `Err(String)` describing why the age is invalid
+pub fn parse_age(age: &str) -> Result<Duration, String> {
+    let invalid = || {
+        format!(
+            "Invalid age: {}. Use a number followed by s, m, h, d or w (e.g. 30d)",
+            age
+        )
+    };
+
+    let age = age.trim();
+    let split = age.find(|c: char| !c.is_ascii_digit()).unwrap_or(age.len());
+    let (count, unit) = (&age[..split], &age[split..]);
+    let count: u64 = count.parse().map_err(|_| invalid())?;
+
+    let seconds = match unit {
+        "s" => 1,
+        "m" => 60,
+        "h" => 60 * 60,
+        "d" => 24 * 60 * 60,
+        "w" => 7 * 24 * 60 * 60,
+        _ => return Err(invalid()),
+    };
+
+    count
+        .checked_mul(seconds)
+        .map(Duration::from_secs)
+        .ok_or_else(invalid)
+}
+
+/// Selects the backups that fall outside the retention limits
+///
+/// A backup is selected if it is beyond the newest `keep` backups or older
+/// than `max_age`. The newest backup is never selected. Backups whose
+/// timestamp cannot be parsed are only subject to the count limit.
+///
+/// # Arguments
+/// * `backups` - Backups sorted newest first, as returned by `list_backups`
+/// * `keep` - Number of newest backups to keep
+/// * `max_age` - Maximum age of backups to keep
+/// * `now` - The time ages are measured from
+pub fn select_for_pruning(
+    backups: &[StoredBackup],
+    keep: Option<usize>,
+    max_age: Option<Duration>,
+    now: NaiveDateTime,
+) -> Vec<PathBuf> {
+    let max_age = max_age.and_then(|age| chrono::Duration::from_std(age).ok());
+
+    backups
+        .iter()
+        .enumerate()
+        .skip(1)
+        .filter(|(index, stored)| {
+            let beyond_count = keep.map_or(false, |keep| *index >= keep);
+            let too_old = max_age.map_or(false, |max_age| {
+                NaiveDateTime::parse_from_str(&stored.backup.timestamp, TIMESTAMP_FORMAT)
+                    .map_or(false, |created| now - created > max_age)
+            });
+            beyond_count || too_old
+        })
+        .map(|(_, stored)| stored.file.clone())
+        .collect()
+}
+
+/// Deletes backups beyond the newest `keep` count or older than `max_age`
+///
+/// The most recent backup is always kept, even if both limits would remove
+/// it. Backup files that cannot be parsed are left untouched.
+///
+/// # Returns
+/// * `Ok(Vec<PathBuf>)` with the files that were removed
+/// * `Err(io::Error)` if the backups cannot be listed or a file cannot be removed
+pub fn prune_backups(keep: Option<usize>, max_age: Option<Duration>) -> io::Result<Vec<PathBuf>> {
+    let (backups, _) = list_backups()?;
+    let selected = select_for_pruning(&backups, keep, max_age, Local::now().naive_local());
+
+    for file in &selected {
+        fs::remove_file(file)?;
+    }
+
+    Ok(selected)
+}
+
+/// Executes the backup prune command
+///
+/// Limits not given fall back to `keep_backups` and `max_backup_age` from
+/// the config file.
+///
+/// # Arguments
+/// * `keep` - Number of newest backups to keep
+/// * `older_than` - Remove backups older than this age (e.g. `30d`)
+pub fn execute(keep: Option<usize>, older_than: Option<&str>) {
+    // Limits from the config file apply when none are given
+    let settings = match settings::get_settings() {
+        Ok(settings) => settings,
+        Err(e) => {
+            eprintln!("{}", e);
+            std::process::exit(1);
+        }
+    };
+    let keep = keep.or(settings.keep_backups);
+    let older_than = older_than.or(settings.max_backup_age.as_deref());
+
+    if keep.is_none() && older_than.is_none() {
+        eprintln!(
+            "Specify --keep, --older-than or both, or set keep_backups or max_backup_age in {}.",
+            settings::settings_path().display()
+        );
+        std::process::exit(1);
+    }
+
+    let max_age = match older_than.map(parse_age).transpose() {
+        Ok(max_age) => max_age,
+        Err(e) => {
+            eprintln!("{}", e);
+            std::process::exit(1);
+        }
+    };
+
+    match prune_backups(keep, max_age) {
+        Ok(removed) if removed.is_empty() => status!("No backups to prune."),
+        Ok(removed) => {
+            for file in &removed {
+                status!("Removed backup: {}", file.display());
+            }
+            status!("Pruned {} backup(s).", removed.len());
+        }
+        Err(e) => {
+            eprintln!("Error pruning backups: {}", e);
+            std::process::exit(1);
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::backup::core::Backup;
+    use crate::backup::format::BackupFormat;
+
+    fn stored(timestamp: &str) -> StoredBackup {
+        StoredBackup {
+            file: PathBuf::from(format!("backup_{}.json", timestamp)),
+            format: BackupFormat::Json,
+            backup: Backup {
+                timestamp: timestamp.to_string(),
+                path: String::from("/usr/bin"),
+                ..Default::default()
+            },
+        }
+    }
+
+    fn now() -> NaiveDateTime {
+        NaiveDateTime::parse_from_str("20240301000000", TIMESTAMP_FORMAT).unwrap()
+    }
+
+    #[test]
+    fn test_parse_age() {
+        assert_eq!(parse_age("30d").unwrap(), Duration::from_secs(30 * 86400));
+        assert_eq!(parse_age("2w").unwrap(), Duration::from_secs(14 * 86400));
+        assert_eq!(parse_age("90s").unwrap(), Duration::from_secs(90));
+        assert!(parse_age("30").is_err());
+        assert!(parse_age("d").is_err());
+        assert!(parse_age("3x").is_err());
+        assert!(parse_age("").is_err());
+    }
+
+    #[test]
+    fn test_select_by_count() {
+        let backups = vec![
+            stored("20240229000000"),
+            stored("20240228000000"),
+            stored("20240227000000"),
+        ];
+        let selected = select_for_pruning(&backups, Some(2), None, now());
+        assert_eq!(selected, vec![backups[2].file.clone()]);
+    }
+
+    #[test]
+    fn test_select_by_age() {
+        let backups = vec![
+            stored("20240229000000"),
+            stored("20240215000000"),
+            stored("20240101000000"),
+        ];
+        let selected = select_for_pruning(&backups, None, Some(parse_age("30d").unwrap()), now());
+        assert_eq!(selected, vec![backups[2].file.clone()]);
+    }
+
+    #[test]
+    fn test_newest_backup_always_kept() {
+        let backups = vec![stored("20230101000000"), stored("20220101000000")];
+        let selected = select_for_pruning(&backups, Some(0), Some(parse_age("1d").unwrap()), now());
+        assert_eq!(selected, vec![backups[1].file.clone()]);
+    }
+}
@@ -4,94 +4,481 @@
 //! - Restoring PATH from specified backup files
 //! - Finding and using the most recent backup
 //! - Validating backup files
+//! - Refusing backups whose hash does not match unless --force is given
+//! - Refusing backups whose contents do not match their file's format, or
+//!   whose entries look like leftovers of another format, unless --force is
+//!   given
+//! - Previewing the restore with --dry-run
 //! - Updating shell configuration after restore
+//! - Restoring only the entries matching --only patterns, merged into the
+//!   current PATH
 
-use crate::backup::core::get_backup_dir;
+use crate::backup::core::{find_backup, list_backups, read_backup_file, Backup, StoredBackup};
+use crate::backup::format::BackupFormat;
+use crate::commands::preview;
+use crate::status;
 use crate::utils;
+use crate::utils::hooks;
+use crate::utils::path::{check_glob, comparison_key, matches_any_glob};
+use crate::utils::persist;
+use crate::utils::shell::factory;
+use crate::utils::shell::types::ShellType;
 use std::env;
-use std::fs::File;
-use std::io::Read;
+use std::io;
+use std::path::{Path, PathBuf};
+
+/// Returns true if a PATH entry looks like part of a serialized document
+///
+/// A JSON, TOML or YAML backup saved with a `.txt` extension, or pasted into
+/// a text backup, leaves lines such as `{`, `"path": "/usr/bin",` or
+/// `path = "/usr/bin"` that would otherwise be restored as directories.
+fn is_serialization_artifact(entry: &Path) -> bool {
+    let text = entry.to_string_lossy();
+    let text = text.trim();
+
+    text.starts_with(['{', '}', '[', ']', '"', '\''])
+        || text.ends_with([',', '{', '['])
+        || text.contains("\": ")
+        || text.contains(" = ")
+}
+
+/// Checks that a backup's contents agree with the format it was read as
+///
+/// # Arguments
+/// * `contents` - The backup file's contents
+/// * `format` - The format the file was parsed as, from its extension
+/// * `backup` - The parsed backup
+///
+/// # Returns
+/// A description of each problem found; empty if the backup is consistent
+pub fn consistency_problems(contents: &str, format: BackupFormat, backup: &Backup) -> Vec<String> {
+    let mut problems = Vec::new();
+
+    if let Some(detected) = BackupFormat::detect(contents) {
+        if detected != format {
+            problems.push(format!(
+                "it is stored as {} but its contents look like {}",
+                format, detected
+            ));
+        }
+    }
+
+    let artifacts: Vec<String> = backup
+        .entries()
+        .iter()
+        .filter(|entry| is_serialization_artifact(entry))
+        .map(|entry| entry.to_string_lossy().into_owned())
+        .collect();
+    if !artifacts.is_empty() {
+        problems.push(format!(
+            "{} entr{} like serialization leftovers rather than directories: {}",
+            artifacts.len(),
+            if artifacts.len() == 1 {
+                "y looks"
+            } else {
+                "ies look"
+            },
+            artifacts.join(", ")
+        ));
+    }
+
+    problems
+}
+
+/// Merges some of a backup's entries back into the current PATH
+///
+/// Each selected entry that is not already in PATH is put back after the
+/// closest entry that preceded it in the backup and is still in PATH, or
+/// first if there is none, so it regains roughly its old priority. The
+/// current entries keep their order.
+///
+/// # Arguments
+///
+/// * `current` - The current PATH entries
+/// * `backup` - The backup's entries, in order
+/// * `selected` - The backup entries to restore
+pub fn merge_subset(current: &[PathBuf], backup: &[PathBuf], selected: &[PathBuf]) -> Vec<PathBuf> {
+    let mut merged = current.to_vec();
+    let position_of = |merged: &[PathBuf], entry: &Path| {
+        let key = comparison_key(entry, false);
+        merged
+            .iter()
+            .position(|existing| comparison_key(existing, false) == key)
+    };
+
+    for (index, entry) in backup.iter().enumerate() {
+        if !selected.contains(entry) || position_of(&merged, entry).is_some() {
+            continue;
+        }
+        let position = backup[..index]
+            .iter()
+            .rev()
+            .find_map(|earlier| position_of(&merged, earlier))
+            .map_or(0, |found| found + 1);
+        merged.insert(position, entry.clone());
+    }
+
+    merged
+}
+
+/// Restores only the backup entries that match one of the patterns
+///
+/// The current PATH is backed up first, like any other change.
+fn restore_only(stored: &StoredBackup, only: &[String], dry_run: bool) {
+    let backup_entries = restorable_entries(&stored.backup);
+    let selected: Vec<PathBuf> = backup_entries
+        .iter()
+        .filter(|entry| matches_any_glob(entry, only))
+        .cloned()
+        .collect();
+    if selected.is_empty() {
+        eprintln!(
+            "No entry in backup {} matches {}",
+            stored.backup.timestamp,
+            only.join(", ")
+        );
+        std::process::exit(1);
+    }
+
+    let current = match persist::load_entries(false) {
+        Ok(entries) => entries,
+        Err(e) => {
+            eprintln!("Error reading PATH: {}", e);
+            std::process::exit(1);
+        }
+    };
+    let merged = merge_subset(&current, &backup_entries, &selected);
+    let restored = merged.len() - current.len();
+
+    if dry_run {
+        preview::show_preview(&current, &merged);
+        return;
+    }
+    if restored == 0 {
+        status!(
+            "All {} matching entr{} already in PATH; nothing to restore.",
+            selected.len(),
+            if selected.len() == 1 {
+                "y is"
+            } else {
+                "ies are"
+            }
+        );
+        return;
+    }
+
+    match crate::apply(&merged, false) {
+        Ok(Some(backup_file)) => status!("Created PATH backup at: {}", backup_file.display()),
+        Ok(None) => {}
+        Err(e) => {
+            eprintln!("{}", e);
+            std::process::exit(1);
+        }
+    }
+    status!(
+        "Restored {} entr{} from backup: {}",
+        restored,
+        if restored == 1 { "y" } else { "ies" },
+        stored.file.display()
+    );
+}
 
 /// Executes the restore command to recover PATH from a backup
 ///
+/// Exits with status 2 if an `--only` pattern is malformed.
+///
 /// # Arguments
 ///
-/// * `timestamp` - Optional timestamp string to specify which backup to restore.
-///                 If None, restores from the most recent backup.
+/// * `timestamp` - Optional timestamp, or unique timestamp prefix, of the backup
+///                 to restore. If None, restores from the most recent backup.
+/// * `only` - Restore just the backup entries matching one of these glob
+///            patterns, merged into the current PATH; empty restores everything
+/// * `dry_run` - Preview the changes without writing anything
+/// * `force` - Restore the backup even if its hash does not match its entries
+///             or its contents do not match its format
 ///
 /// # Example
 ///
-/// ```
-/// // Restore from specific backup
-/// let timestamp = Some(String::from("20240321120000"));
-/// commands::restore::execute(&timestamp);
+/// ```no_run
+/// # use pathmaster::backup;
+/// // Restore from the only backup taken on 21 March 2024
+/// let timestamp = Some(String::from("20240321"));
+/// backup::restore::execute(&timestamp, &[], false, false);
 ///
 /// // Restore from most recent backup
-/// commands::restore::execute(&None);
+/// backup::restore::execute(&None, &[], false, false);
+///
+/// // Put back just the /opt entries from it
+/// backup::restore::execute(&None, &["/opt/*/bin".to_string()], false, false);
 /// ```
-pub fn execute(timestamp: &Option<String>) {
-    let backup_dir = match get_backup_dir() {
-        Ok(dir) => dir,
-        Err(e) => {
-            eprintln!("Error getting backup directory: {}", e);
-            return;
+pub fn execute(timestamp: &Option<String>, only: &[String], dry_run: bool, force: bool) {
+    for pattern in only {
+        if let Err(e) = check_glob(pattern) {
+            eprintln!("Invalid glob pattern '{}': {}", pattern, e);
+            std::process::exit(2);
         }
-    };
+    }
 
-    let backup_file = match timestamp {
-        Some(ts) => backup_dir.join(format!("backup_{}.json", ts)),
+    let stored = match timestamp {
+        Some(ts) => match find_backup(ts) {
+            Ok(stored) => stored,
+            Err(e) => {
+                eprintln!("{}", e);
+                return;
+            }
+        },
         None => {
-            // Get the most recent backup
-            match get_latest_backup(&backup_dir) {
-                Some(file) => file,
+            let backups = match list_backups() {
+                Ok((backups, _)) => backups,
+                Err(e) => {
+                    eprintln!("Error reading backups: {}", e);
+                    return;
+                }
+            };
+            match get_latest_backup(backups) {
+                Some(stored) => stored,
                 None => {
-                    println!("No backups found.");
+                    status!("No backups found.");
                     return;
                 }
             }
         }
     };
 
-    if !backup_file.exists() {
-        println!("Backup file not found: {}", backup_file.display());
-        return;
+    if !stored.backup.hash_matches() {
+        eprintln!(
+            "Warning: backup {} does not match its recorded hash; it may be corrupted or edited.",
+            stored.file.display()
+        );
+        if !dry_run && !force {
+            eprintln!("Refusing to restore it. Use --force to restore it anyway.");
+            std::process::exit(1);
+        }
     }
 
-    // Read the backup file
-    let mut file = File::open(&backup_file).expect("Failed to open backup file");
-    let mut contents = String::new();
-    file.read_to_string(&mut contents)
-        .expect("Failed to read backup file");
+    let problems = match read_backup_file(&stored.file) {
+        Ok(contents) => consistency_problems(
+            &String::from_utf8_lossy(&contents),
+            stored.format,
+            &stored.backup,
+        ),
+        Err(e) => {
+            eprintln!("Error reading {}: {}", stored.file.display(), e);
+            std::process::exit(1);
+        }
+    };
+    if !problems.is_empty() {
+        eprintln!("Warning: backup {} may be garbled:", stored.file.display());
+        for problem in &problems {
+            eprintln!("  - {}", problem);
+        }
+        if !dry_run && !force {
+            eprintln!("Refusing to restore it. Use --force to restore it anyway.");
+            std::process::exit(1);
+        }
+    }
 
-    // Deserialize the backup
-    let backup: serde_json::Value =
-        serde_json::from_str(&contents).expect("Failed to parse backup file");
-    let path = backup["path"].as_str().unwrap_or_default();
+    if !only.is_empty() {
+        restore_only(&stored, only, dry_run);
+        return;
+    }
 
-    // Update PATH
-    env::set_var("PATH", path);
+    if dry_run {
+        preview::show_preview(
+            &utils::get_path_entries(),
+            &restorable_entries(&stored.backup),
+        );
+        return;
+    }
 
     // Update shell configuration
-    if let Err(e) = utils::update_shell_config(&utils::get_path_entries()) {
+    let config = factory::get_shell_handler().target_config_path();
+    let result = hooks::with_hooks(&config, || {
+        restore_backup(&stored.backup, factory::resolved_shell_type())
+    });
+    if let Err(e) = result {
         eprintln!("Error updating shell configuration: {}", e);
         return;
     }
 
-    println!("PATH restored from backup: {}", backup_file.display());
+    // Update PATH
+    env::set_var("PATH", &stored.backup.path);
+
+    status!("PATH restored from backup: {}", stored.file.display());
 }
 
-/// Gets the most recent backup file
+/// Applies a backup's PATH entries to a shell's configuration file
+///
+/// The existing PATH declaration in the shell's config is replaced in place,
+/// and a `.bak` copy of the config is left next to it before modifying.
 ///
 /// # Arguments
 ///
-/// * `backup_dir` - PathBuf pointing to the backup directory
+/// * `backup` - The parsed backup to restore
+/// * `target` - The shell whose configuration file should be updated
 ///
 /// # Returns
 ///
-/// Option containing PathBuf to the most recent backup file,
-/// or None if no backups exist
-pub fn get_latest_backup(backup_dir: &std::path::Path) -> Option<std::path::PathBuf> {
-    let mut backups: Vec<_> = std::fs::read_dir(backup_dir).ok()?.flatten().collect();
-    backups.sort_by_key(|dir| dir.file_name());
-    backups.last().map(|entry| entry.path())
+/// * `Ok(())` if the configuration was updated
+/// * `Err(io::Error)` if the backup is empty or the config cannot be written
+pub fn restore_backup(backup: &Backup, target: ShellType) -> io::Result<()> {
+    let entries = restorable_entries(backup);
+
+    if entries.is_empty() {
+        return Err(io::Error::new(
+            io::ErrorKind::InvalidData,
+            format!(
+                "Backup {} has no PATH entries; refusing to write an empty PATH",
+                backup.timestamp
+            ),
+        ));
+    }
+
+    let handler = factory::get_handler_for(&target);
+    handler.update_config(&entries)
+}
+
+/// Returns the non-empty PATH entries stored in a backup
+fn restorable_entries(backup: &Backup) -> Vec<PathBuf> {
+    backup
+        .entries()
+        .into_iter()
+        .filter(|entry| !entry.as_os_str().is_empty())
+        .collect()
+}
+
+/// Gets the most recent backup
+///
+/// # Arguments
+///
+/// * `backups` - Backups as returned by `list_backups`, newest first
+///
+/// # Returns
+///
+/// Option containing the most recent backup, or None if no backups exist
+pub fn get_latest_backup(backups: Vec<StoredBackup>) -> Option<StoredBackup> {
+    backups.into_iter().next()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::backup::core::parse_backup;
+    use serial_test::serial;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[cfg(unix)]
+    #[test]
+    fn test_merge_subset() {
+        let paths =
+            |entries: &[&str]| -> Vec<PathBuf> { entries.iter().map(PathBuf::from).collect() };
+        let backup = paths(&[
+            "/opt/a/bin",
+            "/usr/local/bin",
+            "/opt/b/bin",
+            "/usr/bin",
+            "/opt/c/bin",
+        ]);
+        let selected = paths(&["/opt/a/bin", "/opt/b/bin", "/opt/c/bin"]);
+
+        assert_eq!(
+            merge_subset(
+                &paths(&["/usr/bin", "/usr/local/bin", "/bin"]),
+                &backup,
+                &selected
+            ),
+            paths(&[
+                "/opt/a/bin",
+                "/usr/bin",
+                "/opt/c/bin",
+                "/usr/local/bin",
+                "/opt/b/bin",
+                "/bin"
+            ])
+        );
+
+        // Entries already in PATH, under any spelling, stay where they are
+        assert_eq!(
+            merge_subset(&paths(&["/usr/bin", "/opt/b/bin/"]), &backup, &selected),
+            paths(&["/opt/a/bin", "/usr/bin", "/opt/c/bin", "/opt/b/bin/"])
+        );
+    }
+
+    #[test]
+    #[serial]
+    fn test_restore_backup_rewrites_config() -> io::Result<()> {
+        let temp_dir = TempDir::new()?;
+        let original_home = env::var_os("HOME");
+        env::set_var("HOME", temp_dir.path());
+
+        let bashrc = temp_dir.path().join(".bashrc");
+        fs::write(&bashrc, "# rc\nexport PATH=\"/old/bin:/usr/bin\"\nalias ll='ls -l'\n")?;
+
+        let backup = Backup {
+            timestamp: "20240115143022".to_string(),
+            path: "/usr/local/bin:/usr/bin".to_string(),
+            ..Default::default()
+        };
+        let result = restore_backup(&backup, ShellType::Bash);
+
+        if let Some(home) = original_home {
+            env::set_var("HOME", home);
+        }
+        result?;
+
+        let content = fs::read_to_string(&bashrc)?;
+        assert!(content.contains("export PATH=\"/usr/local/bin:/usr/bin\""));
+        assert!(!content.contains("/old/bin"));
+        assert!(content.contains("alias ll='ls -l'"));
+
+        let bak_files = fs::read_dir(temp_dir.path())?
+            .flatten()
+            .filter(|e| e.file_name().to_string_lossy().starts_with(".bashrc.bak"))
+            .count();
+        assert_eq!(bak_files, 1);
+
+        Ok(())
+    }
+
+    #[test]
+    fn test_consistency_problems() {
+        let backup = |path: &str| Backup {
+            timestamp: "20240115143022".to_string(),
+            path: path.to_string(),
+            ..Default::default()
+        };
+
+        let text = "# pathmaster backup\n# timestamp: 20240115143022\n/usr/bin\n";
+        assert!(consistency_problems(text, BackupFormat::Text, &backup("/usr/bin")).is_empty());
+
+        // JSON saved with a .txt extension
+        let json = "{\n  \"timestamp\": \"20240115143022\",\n  \"path\": \"/usr/bin\"\n}";
+        let problems = consistency_problems(json, BackupFormat::Text, &backup("/usr/bin"));
+        assert_eq!(
+            problems,
+            ["it is stored as text but its contents look like json"]
+        );
+
+        // A text backup with stray lines from a JSON document
+        let garbled = "# pathmaster backup\n# timestamp: 20240115143022\n[\n\"/usr/bin\",\n]\n";
+        let parsed = parse_backup(garbled, BackupFormat::Text).unwrap();
+        let problems = consistency_problems(garbled, BackupFormat::Text, &parsed);
+        assert_eq!(
+            problems,
+            ["3 entries look like serialization leftovers rather than directories: [, \"/usr/bin\",, ]"]
+        );
+    }
+
+    #[test]
+    fn test_restore_backup_refuses_empty_path() {
+        let backup = Backup {
+            timestamp: "20240115143022".to_string(),
+            path: String::new(),
+            ..Default::default()
+        };
+
+        let err = restore_backup(&backup, ShellType::Bash).unwrap_err();
+        assert_eq!(err.kind(), io::ErrorKind::InvalidData);
+    }
 }
@@ -1,29 +1,334 @@
 // src/backup/show.rs
 
-use super::core::get_backup_dir;
-use std::fs;
+use super::core::{list_backups, StoredBackup, TIMESTAMP_FORMAT};
+use super::format::is_compressed;
+use super::name::rfc3339;
+use super::prune::parse_age;
+use crate::status;
+use chrono::{Local, NaiveDateTime};
+use serde::Serialize;
+
+/// A backup as described by `--json`
+#[derive(Debug, Serialize, PartialEq)]
+pub struct BackupListing {
+    /// When the backup was taken, as RFC 3339 local time with offset
+    pub timestamp: String,
+    /// Format the backup is stored in, e.g. `json`
+    pub format: String,
+    /// Whether the file is gzip-compressed
+    pub compressed: bool,
+    /// Number of PATH entries in the backup
+    pub entry_count: usize,
+    /// Whether the entries match the recorded hash
+    pub hash_matches: bool,
+    /// The backup file
+    pub file: String,
+    /// Note given with `backup create -m`, if any
+    pub label: Option<String>,
+    /// The PATH entries, with `--full`
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub entries: Option<Vec<String>>,
+}
+
+impl BackupListing {
+    /// Describes a stored backup
+    ///
+    /// A timestamp that cannot be parsed is kept as written.
+    ///
+    /// # Arguments
+    /// * `stored` - The backup to describe
+    /// * `full` - Include every PATH entry
+    pub fn new(stored: &StoredBackup, full: bool) -> Self {
+        let entries = stored.backup.entries();
+        Self {
+            timestamp: rfc3339(&stored.backup.timestamp),
+            format: stored.format.to_string(),
+            compressed: is_compressed(&stored.file),
+            entry_count: entries.len(),
+            hash_matches: stored.backup.hash_matches(),
+            file: stored.file.display().to_string(),
+            label: stored.backup.label.clone(),
+            entries: full.then(|| {
+                entries
+                    .iter()
+                    .map(|entry| entry.display().to_string())
+                    .collect()
+            }),
+        }
+    }
+}
+
+/// Parses a `--since` or `--before` bound
+///
+/// Accepts an age such as `7d`, counted back from `now`, or a date and
+/// optional time written like a backup timestamp, with any separators:
+/// `2024-01-15`, `2024-01-15 14:30` and `20240115143022` all work. Missing
+/// time fields count as zero, so a date means the start of that day.
+///
+/// # Returns
+/// * `Ok(NaiveDateTime)` - The local time the bound stands for
+/// * `Err(String)` if the value is neither an age nor a date
+pub fn parse_time_bound(value: &str, now: NaiveDateTime) -> Result<NaiveDateTime, String> {
+    if let Ok(age) = parse_age(value) {
+        let age = chrono::Duration::from_std(age).map_err(|e| e.to_string())?;
+        return Ok(now - age);
+    }
+
+    let digits: String = value.chars().filter(|c| c.is_ascii_digit()).collect();
+    let separators_only = value
+        .chars()
+        .all(|c| c.is_ascii_digit() || matches!(c, '-' | ':' | ' ' | 'T' | '_'));
+    if separators_only && matches!(digits.len(), 8 | 10 | 12 | 14) {
+        let padded = format!("{:0<14}", digits);
+        if let Ok(time) = NaiveDateTime::parse_from_str(&padded, TIMESTAMP_FORMAT) {
+            return Ok(time);
+        }
+    }
+
+    Err(format!(
+        "Invalid date: {}. Use a date such as 2024-01-15, a timestamp such as \
+         20240115143022, or an age such as 7d",
+        value
+    ))
+}
+
+/// Keeps the backups taken within a time range
+///
+/// Backups whose timestamp cannot be parsed are dropped when either bound is
+/// given. The order of `backups` is kept.
+///
+/// # Arguments
+/// * `backups` - Backups as returned by `list_backups`
+/// * `since` - Keep only backups taken at or after this time
+/// * `before` - Keep only backups taken before this time
+pub fn filter_backups(
+    backups: Vec<StoredBackup>,
+    since: Option<NaiveDateTime>,
+    before: Option<NaiveDateTime>,
+) -> Vec<StoredBackup> {
+    if since.is_none() && before.is_none() {
+        return backups;
+    }
+
+    backups
+        .into_iter()
+        .filter(|stored| {
+            NaiveDateTime::parse_from_str(&stored.backup.timestamp, TIMESTAMP_FORMAT).map_or(
+                false,
+                |created| {
+                    since.map_or(true, |since| created >= since)
+                        && before.map_or(true, |before| created < before)
+                },
+            )
+        })
+        .collect()
+}
 
 /// Displays the history of PATH backups
 ///
-/// Lists all available backups in chronological order
-pub fn show_history() {
-    let backup_dir = match get_backup_dir() {
-        Ok(dir) => dir,
+/// Lists the available backups, newest first, followed by any backup
+/// files that could not be read. Exits with status 2 if a bound is invalid.
+///
+/// # Arguments
+/// * `since` - Show only backups taken at or after this date or age
+/// * `before` - Show only backups taken before this date or age
+/// * `json` - Print a JSON array of [`BackupListing`]s instead
+/// * `full` - Include every PATH entry in the JSON output
+pub fn show_history(since: Option<&str>, before: Option<&str>, json: bool, full: bool) {
+    let now = Local::now().naive_local();
+    let parse = |value: Option<&str>| {
+        value
+            .map(|value| parse_time_bound(value, now))
+            .transpose()
+            .unwrap_or_else(|e| {
+                eprintln!("{}", e);
+                std::process::exit(2);
+            })
+    };
+    let (since, before) = (parse(since), parse(before));
+
+    let (backups, errors) = match list_backups() {
+        Ok(result) => result,
         Err(e) => {
-            eprintln!("Error getting backup directory: {}", e);
+            eprintln!("Error reading backups: {}", e);
             return;
         }
     };
+    let filtered = since.is_some() || before.is_some();
+    let backups = filter_backups(backups, since, before);
 
-    match fs::read_dir(&backup_dir) {
-        Ok(entries) => {
-            println!("Available backups:");
-            for entry in entries.flatten() {
-                println!("- {}", entry.file_name().to_string_lossy());
-            }
+    if json {
+        let listings: Vec<BackupListing> = backups
+            .iter()
+            .map(|stored| BackupListing::new(stored, full))
+            .collect();
+        match serde_json::to_string_pretty(&listings) {
+            Ok(output) => println!("{}", output),
+            Err(e) => eprintln!("Error serializing backups: {}", e),
         }
-        Err(_) => {
-            println!("No backups found.");
+    } else if backups.is_empty() {
+        if filtered {
+            status!("No backups found in the given time range.");
+        } else {
+            status!("No backups found.");
         }
+    } else {
+        status!("Available backups:");
+        for stored in &backups {
+            let label = stored
+                .backup
+                .label
+                .as_ref()
+                .map(|label| format!("\"{}\" ", label))
+                .unwrap_or_default();
+            println!(
+                "- {} ({}) {}{}{}",
+                stored.backup.timestamp,
+                stored.format,
+                label,
+                stored.file.display(),
+                if stored.backup.hash_matches() {
+                    ""
+                } else {
+                    " [hash mismatch]"
+                }
+            );
+        }
+    }
+
+    if backups.iter().any(|stored| !stored.backup.hash_matches()) {
+        eprintln!(
+            "Warning: backups marked [hash mismatch] have been corrupted or edited; restore refuses them without --force."
+        );
+    }
+
+    for error in &errors {
+        eprintln!(
+            "Warning: skipping unreadable backup {}: {}",
+            error.file.display(),
+            error.error
+        );
+    }
+    if !errors.is_empty() {
+        eprintln!("Run `pathmaster backup verify` to check which backups can be repaired.");
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::backup::core::Backup;
+    use crate::backup::format::BackupFormat;
+    use std::path::PathBuf;
+
+    fn stored(timestamp: &str) -> StoredBackup {
+        StoredBackup {
+            file: PathBuf::from(format!("backup_{}.json", timestamp)),
+            format: BackupFormat::Json,
+            backup: Backup {
+                timestamp: timestamp.to_string(),
+                path: String::from("/usr/bin"),
+                ..Default::default()
+            },
+        }
+    }
+
+    fn time(timestamp: &str) -> NaiveDateTime {
+        NaiveDateTime::parse_from_str(timestamp, TIMESTAMP_FORMAT).unwrap()
+    }
+
+    #[test]
+    fn test_parse_time_bound() {
+        let now = time("20240301120000");
+
+        assert_eq!(parse_time_bound("7d", now), Ok(time("20240223120000")));
+        assert_eq!(parse_time_bound("12h", now), Ok(time("20240301000000")));
+        assert_eq!(
+            parse_time_bound("2024-01-15", now),
+            Ok(time("20240115000000"))
+        );
+        assert_eq!(
+            parse_time_bound("2024-01-15 14:30", now),
+            Ok(time("20240115143000"))
+        );
+        assert_eq!(
+            parse_time_bound("20240115143022", now),
+            Ok(time("20240115143022"))
+        );
+        assert!(parse_time_bound("2024", now).is_err());
+        assert!(parse_time_bound("2024-13-01", now).is_err());
+        assert!(parse_time_bound("yesterday", now).is_err());
+    }
+
+    #[test]
+    fn test_filter_backups() {
+        let timestamps = |backups: Vec<StoredBackup>| -> Vec<String> {
+            backups
+                .into_iter()
+                .map(|stored| stored.backup.timestamp)
+                .collect()
+        };
+        let backups = || {
+            vec![
+                stored("20240301000000"),
+                stored("20240115143022"),
+                stored("garbled"),
+                stored("20231231235959"),
+            ]
+        };
+
+        assert_eq!(
+            timestamps(filter_backups(
+                backups(),
+                Some(time("20240101000000")),
+                None
+            )),
+            ["20240301000000", "20240115143022"]
+        );
+        assert_eq!(
+            timestamps(filter_backups(
+                backups(),
+                None,
+                Some(time("20240115143022"))
+            )),
+            ["20231231235959"]
+        );
+        assert_eq!(
+            timestamps(filter_backups(
+                backups(),
+                Some(time("20240101000000")),
+                Some(time("20240201000000"))
+            )),
+            ["20240115143022"]
+        );
+        assert_eq!(filter_backups(backups(), None, None).len(), 4);
+    }
+
+    #[cfg(unix)]
+    #[test]
+    fn test_backup_listing_json() {
+        let mut backup = stored("20240115143022");
+        backup.backup.path = String::from("/usr/bin:/opt/tool/bin");
+        backup.file = PathBuf::from("/backups/backup_20240115143022.json.gz");
+
+        let json = serde_json::to_value(BackupListing::new(&backup, false)).unwrap();
+        assert!(json["timestamp"]
+            .as_str()
+            .unwrap()
+            .starts_with("2024-01-15T14:30:22"));
+        assert!(chrono::DateTime::parse_from_rfc3339(json["timestamp"].as_str().unwrap()).is_ok());
+        assert_eq!(json["format"], "json");
+        assert_eq!(json["compressed"], true);
+        assert_eq!(json["entry_count"], 2);
+        assert_eq!(json["hash_matches"], true);
+        assert_eq!(json["file"], "/backups/backup_20240115143022.json.gz");
+        assert_eq!(json["label"], serde_json::Value::Null);
+        assert!(json.get("entries").is_none());
+
+        let json = serde_json::to_value(BackupListing::new(&backup, true)).unwrap();
+        assert_eq!(
+            json["entries"],
+            serde_json::json!(["/usr/bin", "/opt/tool/bin"])
+        );
     }
 }
@@ -0,0 +1,347 @@
+//! Auditing and repairing stored backups.
+//!
+//! This module handles:
+//! - Parsing every backup in the backup directory and reporting its health
+//! - Recovering the backup from partially corrupt files, such as JSON followed
+//!   by stray bytes or a TOML/YAML file with a damaged tail
+//! - Detecting backups whose entries no longer match their recorded hash
+//! - Rewriting a clean copy of recoverable files with --repair
+//!
+//! A repaired file's original contents are kept next to it with a `.corrupt`
+//! suffix, which backup listing ignores.
+
+use super::core::{
+    compress, list_backups, parse_backup, read_backup_file, serialize_backup, Backup,
+};
+use super::format::{is_compressed, BackupFormat};
+use crate::status;
+use crate::utils::atomic::write_atomic;
+use std::fs;
+use std::io;
+use std::path::{Path, PathBuf};
+
+/// The result of checking one backup file
+#[derive(Debug)]
+pub enum BackupHealth {
+    /// The file parses as a backup
+    Healthy,
+    /// The file parses, but its entries do not match the recorded hash
+    HashMismatch,
+    /// The file does not parse, but a backup could be recovered from it
+    Repairable {
+        /// Why the file failed to parse
+        error: io::Error,
+        /// The recovered backup
+        backup: Backup,
+    },
+    /// The file does not parse and nothing could be recovered
+    Corrupt(io::Error),
+}
+
+/// A backup file together with its health
+#[derive(Debug)]
+pub struct VerifiedBackup {
+    /// The backup file
+    pub file: PathBuf,
+    /// What verification found
+    pub health: BackupHealth,
+}
+
+/// Returns true if a line holds bytes that cannot be part of a PATH entry
+fn is_garbage_line(line: &str) -> bool {
+    line.chars()
+        .any(|c| c == '\u{fffd}' || (c.is_control() && c != '\t'))
+}
+
+/// Attempts to recover a backup from a file that does not parse
+///
+/// # Arguments
+/// * `bytes` - The raw file contents
+/// * `format` - The format the file was written in
+///
+/// # Returns
+/// * `Some(Backup)` if a backup with a timestamp and PATH could be recovered
+/// * `None` otherwise
+pub fn recover_backup(bytes: &[u8], format: BackupFormat) -> Option<Backup> {
+    let text = String::from_utf8_lossy(bytes);
+    let text = text.trim_start_matches(|c: char| c == '\u{feff}' || c == '\0' || c.is_whitespace());
+
+    let backup = match format {
+        // Take the first complete JSON document and ignore whatever follows
+        BackupFormat::Json => serde_json::Deserializer::from_str(text)
+            .into_iter::<Backup>()
+            .next()?
+            .ok()?,
+        BackupFormat::Text => {
+            let clean: Vec<&str> = text.lines().filter(|line| !is_garbage_line(line)).collect();
+            parse_backup(&clean.join("\n"), format).ok()?
+        }
+        // Drop trailing lines until the rest parses
+        BackupFormat::Toml | BackupFormat::Yaml => {
+            let lines: Vec<&str> = text.lines().collect();
+            (1..=lines.len())
+                .rev()
+                .find_map(|len| parse_backup(&lines[..len].join("\n"), format).ok())?
+        }
+    };
+
+    if backup.timestamp.is_empty() || backup.path.is_empty() {
+        return None;
+    }
+    Some(backup)
+}
+
+/// Checks every backup in the backup directory
+///
+/// # Returns
+/// * `Ok(Vec<VerifiedBackup>)` with healthy backups first, newest first,
+///   followed by the files that failed to parse
+/// * `Err(io::Error)` if the backup directory cannot be read
+pub fn verify_backups() -> io::Result<Vec<VerifiedBackup>> {
+    let (backups, errors) = list_backups()?;
+
+    let mut verified: Vec<VerifiedBackup> = backups
+        .into_iter()
+        .map(|stored| VerifiedBackup {
+            health: if stored.backup.hash_matches() {
+                BackupHealth::Healthy
+            } else {
+                BackupHealth::HashMismatch
+            },
+            file: stored.file,
+        })
+        .collect();
+
+    for failed in errors {
+        let recovered = BackupFormat::from_path(&failed.file).and_then(|format| {
+            read_backup_file(&failed.file)
+                .ok()
+                .and_then(|bytes| recover_backup(&bytes, format))
+        });
+
+        let health = match recovered {
+            Some(backup) => BackupHealth::Repairable {
+                error: failed.error,
+                backup,
+            },
+            None => BackupHealth::Corrupt(failed.error),
+        };
+        verified.push(VerifiedBackup {
+            file: failed.file,
+            health,
+        });
+    }
+
+    Ok(verified)
+}
+
+/// Rewrites a backup file with a clean copy of a recovered backup
+///
+/// The original contents are first copied to `<file>.corrupt`. A compressed
+/// backup is rewritten compressed.
+///
+/// # Returns
+/// * `Ok(PathBuf)` with the location of the preserved original
+/// * `Err(io::Error)` if the file cannot be copied or rewritten
+pub fn repair_backup(file: &Path, backup: &Backup) -> io::Result<PathBuf> {
+    let format = BackupFormat::from_path(file).ok_or_else(|| {
+        io::Error::new(
+            io::ErrorKind::InvalidInput,
+            format!("Unrecognized backup file extension: {}", file.display()),
+        )
+    })?;
+
+    let mut original = file.as_os_str().to_owned();
+    original.push(".corrupt");
+    let original = PathBuf::from(original);
+
+    let mut contents = serialize_backup(backup, format)?.into_bytes();
+    if is_compressed(file) {
+        contents = compress(&contents)?;
+    }
+
+    fs::copy(file, &original)?;
+    write_atomic(file, &contents)?;
+    Ok(original)
+}
+
+/// Executes the backup verify command
+///
+/// Exits with status 1 if any backup is corrupt, or repairable but not
+/// repaired.
+///
+/// # Arguments
+///
+/// * `repair` - Rewrite a clean copy of every recoverable backup
+///
+/// # Example
+///
+/// ```no_run
+/// # use pathmaster::backup;
+/// backup::verify::execute(true);
+/// ```
+pub fn execute(repair: bool) {
+    let verified = match verify_backups() {
+        Ok(verified) => verified,
+        Err(e) => {
+            eprintln!("Error reading backups: {}", e);
+            std::process::exit(1);
+        }
+    };
+
+    if verified.is_empty() {
+        status!("No backups found.");
+        return;
+    }
+
+    let (mut healthy, mut repaired, mut broken) = (0, 0, 0);
+    for entry in &verified {
+        match &entry.health {
+            BackupHealth::Healthy => {
+                healthy += 1;
+                println!("ok          {}", entry.file.display());
+            }
+            BackupHealth::HashMismatch => {
+                broken += 1;
+                println!(
+                    "mismatch    {}: entries do not match the recorded hash",
+                    entry.file.display()
+                );
+            }
+            BackupHealth::Repairable { error, backup } if repair => {
+                match repair_backup(&entry.file, backup) {
+                    Ok(original) => {
+                        repaired += 1;
+                        println!(
+                            "repaired    {} (original kept at {})",
+                            entry.file.display(),
+                            original.display()
+                        );
+                    }
+                    Err(e) => {
+                        broken += 1;
+                        println!("repairable  {}: {}", entry.file.display(), error);
+                        eprintln!("Error repairing {}: {}", entry.file.display(), e);
+                    }
+                }
+            }
+            BackupHealth::Repairable { error, .. } => {
+                broken += 1;
+                println!("repairable  {}: {}", entry.file.display(), error);
+            }
+            BackupHealth::Corrupt(error) => {
+                broken += 1;
+                println!("corrupt     {}: {}", entry.file.display(), error);
+            }
+        }
+    }
+
+    status!(
+        "\n{} healthy, {} repaired, {} with problems.",
+        healthy,
+        repaired,
+        broken
+    );
+    if broken > 0 {
+        if !repair
+            && verified
+                .iter()
+                .any(|entry| matches!(entry.health, BackupHealth::Repairable { .. }))
+        {
+            status!("Run `pathmaster backup verify --repair` to fix repairable backups.");
+        }
+        std::process::exit(1);
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::backup::core::set_backup_dir;
+    use serial_test::serial;
+    use tempfile::TempDir;
+
+    const JSON: &str = "{\n  \"timestamp\": \"20240101120000\",\n  \"path\": \"/usr/bin:/bin\"\n}";
+
+    #[test]
+    fn test_recover_json_with_trailing_garbage() {
+        let bytes = format!("{}\0\0garbage}}", JSON).into_bytes();
+        let backup = recover_backup(&bytes, BackupFormat::Json).unwrap();
+        assert_eq!(backup.timestamp, "20240101120000");
+        assert_eq!(backup.path, "/usr/bin:/bin");
+
+        // Truncated JSON has no complete document to recover
+        assert!(recover_backup(&JSON.as_bytes()[..40], BackupFormat::Json).is_none());
+    }
+
+    #[test]
+    fn test_recover_text_with_stray_bytes() {
+        let mut bytes = b"# pathmaster backup\n# timestamp: 20240101120000\n/usr/bin\n".to_vec();
+        bytes.extend_from_slice(b"\xff\xfe\x00\x01\n/bin\n");
+        let backup = recover_backup(&bytes, BackupFormat::Text).unwrap();
+        assert_eq!(
+            backup.entries(),
+            vec![PathBuf::from("/usr/bin"), PathBuf::from("/bin")]
+        );
+    }
+
+    #[test]
+    #[serial]
+    fn test_verify_and_repair() -> io::Result<()> {
+        let temp_dir = TempDir::new()?;
+        set_backup_dir(temp_dir.path().to_path_buf())?;
+
+        let healthy = temp_dir.path().join("backup_20240101120000.json");
+        let damaged = temp_dir.path().join("backup_20240102120000.json");
+        let corrupt = temp_dir.path().join("backup_20240103120000.json");
+        fs::write(&healthy, JSON)?;
+        fs::write(&damaged, format!("{}trailing", JSON))?;
+        fs::write(&corrupt, "{\"timestamp\": ")?;
+
+        let verified = verify_backups()?;
+        assert_eq!(verified.len(), 3);
+        assert!(matches!(verified[0].health, BackupHealth::Healthy));
+
+        let health_of = |file: &Path| {
+            verified
+                .iter()
+                .find(|entry| entry.file == file)
+                .map(|entry| &entry.health)
+        };
+        assert!(matches!(
+            health_of(&corrupt),
+            Some(BackupHealth::Corrupt(_))
+        ));
+        let backup = match health_of(&damaged) {
+            Some(BackupHealth::Repairable { backup, .. }) => backup,
+            other => panic!("expected a repairable backup, got {:?}", other),
+        };
+
+        let original = repair_backup(&damaged, backup)?;
+        assert!(fs::read_to_string(&original)?.ends_with("trailing"));
+        assert_eq!(list_backups()?.0.len(), 2);
+        Ok(())
+    }
+
+    #[test]
+    #[serial]
+    fn test_verify_detects_hash_mismatch() -> io::Result<()> {
+        let temp_dir = TempDir::new()?;
+        set_backup_dir(temp_dir.path().to_path_buf())?;
+
+        let mut backup = parse_backup(JSON, BackupFormat::Json)?;
+        backup.sha256 = Some(backup.compute_hash());
+        let file = temp_dir.path().join("backup_20240101120000.json");
+        fs::write(&file, serialize_backup(&backup, BackupFormat::Json)?)?;
+        assert!(matches!(verify_backups()?[0].health, BackupHealth::Healthy));
+
+        // Edit an entry without updating the hash
+        let edited = fs::read_to_string(&file)?.replace("/usr/bin", "/tmp/evil");
+        fs::write(&file, edited)?;
+        assert!(matches!(
+            verify_backups()?[0].health,
+            BackupHealth::HashMismatch
+        ));
+        Ok(())
+    }
+}
@@ -2,77 +2,625 @@
 //!
 //! This module handles:
 //! - Validating new directories
-//! - Adding directories to PATH
-//! - Updating shell configuration
+//! - Rejecting relative directories, or converting them to absolute ones
+//!   with confirmation, unless --allow-relative is given
+//! - Leaving PATH, the shell configuration and the backups untouched when
+//!   every directory is already in place, so provisioning scripts can run
+//!   add on every boot; --force re-adds them
+//! - Adding directories to the end or front of PATH, moving ones that are
+//!   already elsewhere
+//! - Writing directories unexpanded (e.g. `$HOME/bin`) with --literal
+//! - Asking for confirmation before a new directory hides commands in the
+//!   system directories, with --warn-shadows
+//! - Adding every directory listed in a file with --from-file, in one edit
+//!   with one backup, reporting what happened to each line
+//! - Updating shell configuration (or the registry on Windows)
+//! - Previewing changes with --dry-run
 //! - Creating backups before modifications
 
-use crate::backup;
-use crate::utils;
-use std::path::PathBuf;
+use crate::commands::preview;
+use crate::commands::validator::is_valid_path_entry;
+use crate::commands::which::{self, Shadow};
+use crate::status;
+use crate::utils::path::normalize_path;
+use std::collections::HashMap;
+use std::env;
+use std::fs;
+use std::io::{self, BufRead, Read, Write};
+use std::path::{Path, PathBuf};
+
+/// Resolves a relative directory against `cwd`
+///
+/// `.` and `..` segments are removed, so `./bin` run from `/home/me/project`
+/// becomes `/home/me/project/bin`.
+pub fn absolutize(dir: &Path, cwd: &Path) -> PathBuf {
+    let joined = cwd.join(dir);
+    normalize_path(&joined.to_string_lossy(), false).unwrap_or(joined)
+}
+
+/// Asks a yes/no question on stdin, defaulting to no
+fn confirm(question: &str) -> io::Result<bool> {
+    print!("{} [y/N] ", question);
+    io::stdout().flush()?;
+
+    let mut line = String::new();
+    io::stdin().lock().read_line(&mut line)?;
+    Ok(matches!(line.trim().to_lowercase().as_str(), "y" | "yes"))
+}
+
+/// Decides what to do with a relative directory
+///
+/// Offers to use the absolute form instead.
+///
+/// # Returns
+/// * `Some(PathBuf)` - The absolute directory to add instead
+/// * `None` - The user declined, or the working directory is unknown
+fn resolve_relative(dir: &Path) -> Option<PathBuf> {
+    let absolute = absolutize(dir, &env::current_dir().ok()?);
+    let question = format!(
+        "'{}' is a relative path, which PATH resolves against whatever directory \
+         you are in. Add '{}' instead?",
+        dir.display(),
+        absolute.display()
+    );
+    match confirm(&question) {
+        Ok(true) => Some(absolute),
+        _ => None,
+    }
+}
+
+/// Warns that a directory is skipped because it does not exist
+fn warn_invalid(dir: &Path) {
+    eprintln!("Warning: '{}' is not a valid directory.", dir.display());
+}
+
+/// Warns about commands that new directories would hide in the system
+/// directories, and asks whether to go ahead
+///
+/// Nothing is asked in a dry run. Without an answer, as when stdin is not a
+/// terminal, the add does not go ahead.
+///
+/// # Returns
+/// * `true` - Nothing is hidden, or the user agreed
+/// * `false` - The user declined
+fn confirm_shadows(shadows: &[Shadow], dry_run: bool) -> bool {
+    if shadows.is_empty() {
+        return true;
+    }
+
+    eprintln!("Warning: the new directories would hide system commands:");
+    for shadow in shadows {
+        let hidden: Vec<String> = shadow
+            .shadowed
+            .iter()
+            .map(|dir| dir.join(&shadow.command).display().to_string())
+            .collect();
+        eprintln!(
+            "  {} would run instead of {}",
+            shadow.winner.join(&shadow.command).display(),
+            hidden.join(", ")
+        );
+    }
+    dry_run || confirm("Add anyway?").unwrap_or(false)
+}
+
+/// Checks that unexpanded entries can be written for the current target
+///
+/// Windows stores PATH in the registry, and Elvish and Nushell configs quote
+/// every entry, so `$HOME` would not be expanded there.
+pub fn check_literal_support() -> io::Result<()> {
+    #[cfg(windows)]
+    {
+        Err(io::Error::new(
+            io::ErrorKind::Unsupported,
+            "--literal is not supported on Windows",
+        ))
+    }
+
+    #[cfg(not(windows))]
+    {
+        use crate::utils::shell::factory::resolved_shell_type;
+        use crate::utils::shell::types::ShellType;
+
+        match resolved_shell_type() {
+            shell @ (ShellType::Elvish | ShellType::Nushell) => Err(io::Error::new(
+                io::ErrorKind::Unsupported,
+                format!("--literal is not supported for {} configuration", shell),
+            )),
+            _ => Ok(()),
+        }
+    }
+}
+
+/// Reads the directories listed in a file, one per line
+///
+/// Surrounding whitespace is trimmed, and blank lines and lines starting with
+/// `#` are skipped.
+///
+/// # Returns
+/// The line number, counting from 1, and the directory on each listed line
+pub fn parse_directory_list(content: &str) -> Vec<(usize, String)> {
+    content
+        .lines()
+        .enumerate()
+        .map(|(index, line)| (index + 1, line.trim()))
+        .filter(|(_, line)| !line.is_empty() && !line.starts_with('#'))
+        .map(|(number, line)| (number, line.to_string()))
+        .collect()
+}
+
+/// Reads a directory list from a file, or stdin if the file is `-`
+pub fn read_directory_list(file: &Path) -> io::Result<Vec<(usize, String)>> {
+    let content = if file == Path::new("-") {
+        let mut content = String::new();
+        io::stdin().read_to_string(&mut content)?;
+        content
+    } else {
+        fs::read_to_string(file)?
+    };
+    Ok(parse_directory_list(&content))
+}
+
+/// What happened to one line of a --from-file list
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum LineOutcome {
+    /// The directory was added
+    Added,
+    /// The directory is already in PATH, or listed on an earlier line
+    Duplicate,
+    /// The directory does not exist or is not a directory
+    Invalid,
+    /// The directory is relative and --allow-relative was not given
+    Relative,
+}
+
+impl LineOutcome {
+    /// Describes the outcome for the per-line report
+    fn describe(&self, dry_run: bool) -> &'static str {
+        match self {
+            LineOutcome::Added if dry_run => "would add",
+            LineOutcome::Added => "added",
+            LineOutcome::Duplicate => "already in PATH",
+            LineOutcome::Invalid => "not a valid directory",
+            LineOutcome::Relative => "relative, needs --allow-relative",
+        }
+    }
+}
+
+/// Works out which listed directories a plan adds
+///
+/// Only the first line naming a directory counts as adding it; later lines
+/// naming it again are duplicates.
+///
+/// # Arguments
+///
+/// * `listed` - Line numbers with the directory each names, expanded
+/// * `added` - Directories the plan adds, as in [`AddPlan::added`]
+pub fn listed_outcomes(
+    listed: &[(usize, PathBuf)],
+    added: &[PathBuf],
+) -> Vec<(usize, LineOutcome)> {
+    let mut claimed: Vec<&PathBuf> = Vec::new();
+    listed
+        .iter()
+        .map(|(line, saved)| {
+            if added.contains(saved) && !claimed.contains(&saved) {
+                claimed.push(saved);
+                (*line, LineOutcome::Added)
+            } else {
+                (*line, LineOutcome::Duplicate)
+            }
+        })
+        .collect()
+}
+
+/// The outcome of adding directories to PATH, before anything is written
+#[derive(Debug, PartialEq)]
+pub struct AddPlan {
+    /// PATH entries before the add
+    pub current: Vec<PathBuf>,
+    /// PATH entries after the add
+    pub entries: Vec<PathBuf>,
+    /// The same entries in the form written to the shell configuration
+    pub saved: Vec<PathBuf>,
+    /// Directories added, or moved to where they were asked for, expanded
+    pub added: Vec<PathBuf>,
+    /// Directories left alone because they are already where they were asked
+    /// for, with their position counting from 1
+    pub present: Vec<(PathBuf, usize)>,
+}
+
+/// Works out the PATH that adding directories produces
+///
+/// A directory already in place, at the front of PATH when prepending or at
+/// the end otherwise, is left alone, so running the same add again changes
+/// nothing. A directory elsewhere in PATH is moved into place. Several
+/// directories are placed in the given order, and a directory given twice
+/// only counts once. With `force`, every existing occurrence is removed and
+/// the directory is added again even if it is in place.
+///
+/// # Arguments
+///
+/// * `current` - PATH entries before the add
+/// * `dirs` - Directories to add, as (expanded, form to write) pairs
+/// * `prepend` - Put the directories at the front of PATH, in the given order
+/// * `force` - Re-add directories that are already in place
+pub fn plan_add(
+    current: &[PathBuf],
+    dirs: Vec<(PathBuf, PathBuf)>,
+    prepend: bool,
+    force: bool,
+) -> AddPlan {
+    let mut plan = AddPlan {
+        current: current.to_vec(),
+        entries: current.to_vec(),
+        saved: current.to_vec(),
+        added: Vec::new(),
+        present: Vec::new(),
+    };
+
+    let mut requested: Vec<(PathBuf, PathBuf)> = Vec::new();
+    for (dir_path, saved) in dirs {
+        if !requested.iter().any(|(dir, _)| *dir == dir_path) {
+            requested.push((dir_path, saved));
+        }
+    }
+    // The end of PATH is filled from the back, so the order is kept there too
+    if !prepend {
+        requested.reverse();
+    }
+
+    let mut in_place: Vec<PathBuf> = Vec::new();
+    for (placed, (dir_path, saved)) in requested.into_iter().enumerate() {
+        let target = if prepend {
+            Some(placed)
+        } else {
+            plan.entries.len().checked_sub(placed + 1)
+        };
+        if !force && target.and_then(|index| plan.entries.get(index)) == Some(&dir_path) {
+            in_place.push(dir_path);
+            continue;
+        }
+
+        while let Some(index) = plan.entries.iter().position(|entry| *entry == dir_path) {
+            plan.entries.remove(index);
+            plan.saved.remove(index);
+        }
+        let index = if prepend {
+            placed
+        } else {
+            plan.entries.len() - placed
+        };
+        plan.entries.insert(index, dir_path.clone());
+        plan.saved.insert(index, saved);
+        plan.added.push(dir_path);
+    }
+
+    if !prepend {
+        plan.added.reverse();
+        in_place.reverse();
+    }
+    for dir_path in in_place {
+        let index = if prepend {
+            plan.entries.iter().position(|entry| *entry == dir_path)
+        } else {
+            plan.entries.iter().rposition(|entry| *entry == dir_path)
+        };
+        let position = index.map_or(0, |index| index + 1);
+        plan.present.push((dir_path, position));
+    }
+
+    plan
+}
+
+/// Finds the commands in `trusted` directories that an add would hide
+///
+/// The directories are compared expanded, so ones written with --literal,
+/// such as `$HOME/bin`, are checked where they really are.
+pub fn added_shadows(plan: &AddPlan, trusted: &[PathBuf]) -> Vec<Shadow> {
+    which::find_trusted_shadows(&plan.added, &plan.entries, trusted)
+}
 
 /// Executes the add command to include new directories in PATH
 ///
 /// # Arguments
 ///
 /// * `directories` - A slice of strings containing directories to add
+/// * `prepend` - Whether to put the new directories at the front of PATH
+/// * `system` - Edit the machine-wide PATH instead of the user PATH (Windows only)
+/// * `literal` - Write the directories to the shell configuration as given,
+///               without expanding `~` or variables
+/// * `allow_relative` - Add relative directories as given instead of
+///                      offering to make them absolute
+/// * `force` - Re-add directories that are already in place, dropping any
+///             other occurrences
+/// * `from_file` - Add the directories listed in this file, or stdin for `-`,
+///                 instead of `directories`
+/// * `warn_shadows` - Ask before adding a directory whose commands would hide
+///                    ones in the system directories
+/// * `dry_run` - Preview the changes without writing anything
 ///
 /// # Example
 ///
-/// ```
+/// ```no_run
+/// # use pathmaster::commands;
 /// let dirs = vec![String::from("~/bin")];
-/// commands::add::execute(&dirs);
+/// commands::add::execute(&dirs, false, false, false, false, false, None, false, false);
 /// ```
-pub fn execute(directories: &[String]) {
-    // Expand and normalize the directory paths
-    let dirs_to_add: Vec<PathBuf> = directories
-        .iter()
-        .map(|dir| utils::expand_path(dir))
-        .collect();
+#[allow(clippy::too_many_arguments)]
+pub fn execute(
+    directories: &[String],
+    prepend: bool,
+    system: bool,
+    literal: bool,
+    allow_relative: bool,
+    force: bool,
+    from_file: Option<&Path>,
+    warn_shadows: bool,
+    dry_run: bool,
+) {
+    // Directories from a list are numbered by line for the report; relative
+    // ones are skipped there rather than asked about one by one
+    let requested: Vec<(usize, String)> = match from_file {
+        Some(file) => match read_directory_list(file) {
+            Ok(listed) => listed,
+            Err(e) => {
+                eprintln!("Error reading {}: {}", file.display(), e);
+                std::process::exit(1);
+            }
+        },
+        None => directories.iter().cloned().enumerate().collect(),
+    };
+    let mut report: Vec<(usize, LineOutcome)> = Vec::new();
+    let mut listed: Vec<(usize, PathBuf)> = Vec::new();
 
-    // Backup current PATH
-    if let Err(e) = backup::create_backup() {
-        eprintln!("Error creating backup: {}", e);
-        return;
+    // Expand and check the directories, keeping the form to write
+    let mut dirs_to_add: Vec<(PathBuf, PathBuf)> = Vec::new();
+    for (line, dir) in &requested {
+        let (expanded, saved) = crate::expand_new_dir(dir, literal);
+        if crate::check_new_dir(&expanded, allow_relative).is_ok() {
+            listed.push((*line, expanded.clone()));
+            dirs_to_add.push((expanded, saved));
+        } else if from_file.is_some() {
+            let outcome = if expanded.is_absolute() || allow_relative {
+                LineOutcome::Invalid
+            } else {
+                LineOutcome::Relative
+            };
+            report.push((*line, outcome));
+        } else if expanded.is_absolute() || allow_relative {
+            warn_invalid(&expanded);
+        } else {
+            match resolve_relative(&expanded) {
+                Some(absolute) if is_valid_path_entry(&absolute) => {
+                    dirs_to_add.push((absolute.clone(), absolute))
+                }
+                Some(absolute) => warn_invalid(&absolute),
+                None => eprintln!(
+                    "Skipping relative path '{}'; use --allow-relative to add it as is.",
+                    dir
+                ),
+            }
+        }
     }
 
-    // Get current PATH
-    let mut path_entries = utils::get_path_entries();
+    let options = crate::AddOptions {
+        prepend,
+        system,
+        literal,
+        allow_relative,
+        force,
+    };
+    let plan = match crate::plan_add(dirs_to_add, &options) {
+        Ok(plan) => plan,
+        Err(e) => {
+            eprintln!("{}", e);
+            std::process::exit(1);
+        }
+    };
+
+    if warn_shadows && !plan.added.is_empty() {
+        let trusted: Vec<PathBuf> = which::TRUSTED_DIRS.iter().map(PathBuf::from).collect();
+        if !confirm_shadows(&added_shadows(&plan, &trusted), dry_run) {
+            status!("No directories were added to PATH.");
+            std::process::exit(1);
+        }
+    }
 
-    // Track the number of directories added
-    let mut added_count = 0;
+    if let Some(file) = from_file {
+        report.extend(listed_outcomes(&listed, &plan.added));
+        report.sort_by_key(|(line, _)| *line);
 
-    for dir_path in dirs_to_add {
-        if !dir_path.is_dir() {
-            eprintln!(
-                "Warning: '{}' is not a valid directory.",
-                dir_path.display()
+        let lines: HashMap<usize, &String> =
+            requested.iter().map(|(line, dir)| (*line, dir)).collect();
+        for (line, outcome) in &report {
+            println!(
+                "{}:{}: {}: {}",
+                file.display(),
+                line,
+                outcome.describe(dry_run),
+                lines[line]
             );
-            continue;
         }
+    } else {
+        for (dir_path, position) in &plan.present {
+            status!(
+                "'{}' is already in PATH at position {}; nothing to do.",
+                dir_path.display(),
+                position
+            );
+        }
+    }
 
-        if path_entries.contains(&dir_path) {
-            println!("Directory '{}' is already in PATH.", dir_path.display());
-            continue;
+    if plan.added.is_empty() {
+        if plan.present.is_empty() {
+            status!("No new directories were added to PATH.");
         }
+        return;
+    }
 
-        // Add the new directory
-        path_entries.push(dir_path.clone());
-        added_count += 1;
-        println!("Added '{}' to PATH.", dir_path.display());
+    if dry_run {
+        preview::show_preview(&plan.current, &plan.saved);
+        return;
     }
 
-    if added_count > 0 {
-        // Update PATH
-        utils::set_path_entries(&path_entries);
+    // Back up PATH, then update it and the shell configuration
+    match crate::apply_add(&plan, system) {
+        Ok(Some(backup_file)) => status!("Created PATH backup at: {}", backup_file.display()),
+        Ok(None) => {}
+        Err(e) => {
+            eprintln!("{}", e);
+            std::process::exit(1);
+        }
+    }
 
-        // Update shell configuration
-        if let Err(e) = utils::update_shell_config(&path_entries) {
-            eprintln!("Error updating shell configuration: {}", e);
-            return;
+    if from_file.is_none() {
+        for dir_path in &plan.added {
+            status!("Added '{}' to PATH.", dir_path.display());
         }
+    }
 
-        println!("Successfully added {} directory(ies) to PATH.", added_count);
-    } else {
-        println!("No new directories were added to PATH.");
+    status!(
+        "Successfully added {} directory(ies) to PATH.",
+        plan.added.len()
+    );
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_plan_add_is_idempotent() {
+        let path = |name: &str| PathBuf::from(format!("/opt/{}", name));
+        let pair = |name: &str| (path(name), path(name));
+        let current = vec![path("a"), path("b")];
+
+        let plan = plan_add(&current, vec![pair("new"), pair("a")], true, false);
+        assert_eq!(plan.entries, [path("new"), path("a"), path("b")]);
+        assert_eq!(plan.added, [path("new")]);
+        assert_eq!(plan.present, [(path("a"), 2)]);
+
+        // Running the same add again finds nothing to do
+        let again = plan_add(&plan.entries, vec![pair("new"), pair("a")], true, false);
+        assert_eq!(again.entries, plan.entries);
+        assert!(again.added.is_empty());
+        assert_eq!(again.present, [(path("new"), 1), (path("a"), 2)]);
+
+        // Forcing re-adds a directory that is in place
+        let forced = plan_add(&plan.entries, vec![pair("b")], false, true);
+        assert_eq!(forced.entries, plan.entries);
+        assert_eq!(forced.added, [path("b")]);
+        assert!(forced.present.is_empty());
+    }
+
+    #[test]
+    fn test_plan_add_moves_dirs_into_place() {
+        let path = |name: &str| PathBuf::from(format!("/opt/{}", name));
+        let pair = |name: &str| (path(name), path(name));
+        let current = vec![path("x"), path("a"), path("y")];
+
+        // Prepending a directory that is last moves it to the front
+        let prepended = plan_add(&current, vec![pair("y")], true, false);
+        assert_eq!(prepended.entries, [path("y"), path("x"), path("a")]);
+        assert_eq!(prepended.added, [path("y")]);
+        assert!(prepended.present.is_empty());
+
+        // Appending a directory that is first moves it to the end
+        let appended = plan_add(&current, vec![pair("x")], false, false);
+        assert_eq!(appended.entries, [path("a"), path("y"), path("x")]);
+        assert_eq!(appended.added, [path("x")]);
+        assert!(appended.present.is_empty());
+
+        // Appended directories keep the given order at the end
+        let both = plan_add(&current, vec![pair("x"), pair("y")], false, false);
+        assert_eq!(both.entries, [path("a"), path("x"), path("y")]);
+        assert_eq!(both.added, [path("x")]);
+        assert_eq!(both.present, [(path("y"), 3)]);
+
+        let unchanged = plan_add(&current, vec![pair("y")], false, false);
+        assert_eq!(unchanged.entries, current);
+        assert_eq!(unchanged.present, [(path("y"), 3)]);
+    }
+
+    #[test]
+    fn test_parse_directory_list() {
+        let content = "# tools\n/opt/a/bin\n\n   ~/bin  \n\t# indented comment\n$HOME/.cargo/bin\n";
+        assert_eq!(
+            parse_directory_list(content),
+            vec![
+                (2, "/opt/a/bin".to_string()),
+                (4, "~/bin".to_string()),
+                (6, "$HOME/.cargo/bin".to_string()),
+            ]
+        );
+        assert!(parse_directory_list("\n# nothing here\n").is_empty());
+    }
+
+    #[test]
+    fn test_listed_outcomes() {
+        let path = |name: &str| PathBuf::from(format!("/opt/{}", name));
+        let current = vec![path("a")];
+        let listed = vec![(1, path("new")), (2, path("a")), (4, path("new"))];
+        let dirs = listed
+            .iter()
+            .map(|(_, dir)| (dir.clone(), dir.clone()))
+            .collect();
+
+        let plan = plan_add(&current, dirs, false, false);
+        assert_eq!(plan.entries, [path("new"), path("a")]);
+        assert_eq!(
+            listed_outcomes(&listed, &plan.added),
+            vec![
+                (1, LineOutcome::Added),
+                (2, LineOutcome::Duplicate),
+                (4, LineOutcome::Duplicate),
+            ]
+        );
+    }
+
+    #[cfg(unix)]
+    #[test]
+    fn test_added_shadows_of_literal_dirs() {
+        use std::os::unix::fs::PermissionsExt;
+
+        let temp_dir = tempfile::TempDir::new().unwrap();
+        let [new, system]: [PathBuf; 2] = ["new", "system"].map(|name| temp_dir.path().join(name));
+        for dir in [&new, &system] {
+            fs::create_dir(dir).unwrap();
+            fs::write(dir.join("ls"), "#!/bin/sh\n").unwrap();
+            fs::set_permissions(dir.join("ls"), fs::Permissions::from_mode(0o755)).unwrap();
+        }
+
+        // With --literal the directory is written as `$HOME/...`
+        let literal = (new.clone(), PathBuf::from("$HOME/new"));
+        let plan = plan_add(&[system.clone()], vec![literal], true, false);
+        assert_eq!(plan.saved, [PathBuf::from("$HOME/new"), system.clone()]);
+        assert_eq!(
+            added_shadows(&plan, &[system.clone()]),
+            vec![Shadow {
+                command: "ls".to_string(),
+                winner: new,
+                shadowed: vec![system],
+            }]
+        );
+    }
+
+    #[cfg(unix)]
+    #[test]
+    fn test_absolutize_relative_dirs() {
+        let cwd = Path::new("/home/me/project");
+        assert_eq!(
+            absolutize(Path::new("."), cwd),
+            PathBuf::from("/home/me/project")
+        );
+        assert_eq!(
+            absolutize(Path::new("./bin"), cwd),
+            PathBuf::from("/home/me/project/bin")
+        );
+        assert_eq!(
+            absolutize(Path::new("../tools/bin/"), cwd),
+            PathBuf::from("/home/me/tools/bin")
+        );
     }
 }
@@ -0,0 +1,229 @@
+//! Command implementation for applying the configured PATH to the running shell.
+//!
+//! This module provides functionality to:
+//! - Read the PATH the shell configuration declares
+//! - Print a command in the shell's own syntax that sets PATH to it, for
+//!   `eval "$(pathmaster apply)"`
+//!
+//! Editing a config file does not change shells that are already running;
+//! this saves re-sourcing the whole file after each change.
+
+use crate::utils;
+use crate::utils::shell::factory::get_shell_handler;
+use crate::utils::shell::types::{PathModification, ShellType};
+use std::fs;
+use std::io;
+use std::path::PathBuf;
+use std::process;
+
+/// Quotes a string for POSIX shells and tcsh
+///
+/// Single quotes are closed, escaped and reopened, so nothing inside is
+/// expanded.
+fn quote_posix(value: &str) -> String {
+    format!("'{}'", value.replace('\'', "'\\''"))
+}
+
+/// Quotes a string for fish, where a single quote is escaped inside quotes
+fn quote_fish(value: &str) -> String {
+    format!("'{}'", value.replace('\\', "\\\\").replace('\'', "\\'"))
+}
+
+/// Quotes a string for elvish, where a single quote is doubled
+fn quote_elvish(value: &str) -> String {
+    format!("'{}'", value.replace('\'', "''"))
+}
+
+/// Builds a command that sets PATH in a running shell
+///
+/// # Arguments
+///
+/// * `shell` - The shell that will evaluate the command
+/// * `entries` - The PATH entries, already expanded
+pub fn session_command(shell: &ShellType, entries: &[PathBuf]) -> String {
+    let list: Vec<String> = entries
+        .iter()
+        .map(|entry| entry.to_string_lossy().into_owned())
+        .collect();
+    let joined = utils::build_path_string(entries);
+
+    match shell {
+        ShellType::Bash | ShellType::Zsh | ShellType::Ksh | ShellType::Generic => {
+            format!("export PATH={}", quote_posix(&joined))
+        }
+        ShellType::Fish => {
+            let quoted: Vec<String> = list.iter().map(|entry| quote_fish(entry)).collect();
+            format!("set -gx PATH {}", quoted.join(" "))
+        }
+        ShellType::Tcsh => format!("setenv PATH {}", quote_posix(&joined)),
+        ShellType::Elvish => format!("set-env PATH {}", quote_elvish(&joined)),
+        // Nushell's double-quoted strings use the same escapes as JSON
+        ShellType::Nushell => format!(
+            "$env.PATH = {}",
+            serde_json::to_string(&list).unwrap_or_else(|_| "[]".to_string())
+        ),
+    }
+}
+
+/// Returns whether PATH declarations build on the PATH the shell inherited
+///
+/// Such a config, e.g. `export PATH="$HOME/bin:$PATH"`, does not say what the
+/// whole PATH should be, so it cannot be applied without sourcing it.
+pub fn extends_inherited_path(modifications: &[PathModification]) -> bool {
+    modifications.iter().any(|modification| {
+        ["$PATH", "${PATH}", "$path", "$env.PATH", "$paths"]
+            .iter()
+            .any(|reference| modification.content.contains(reference))
+    })
+}
+
+/// Reads the PATH entries the config declares, expanded
+///
+/// # Returns
+/// * `Ok(Vec<PathBuf>)` - The declared entries
+/// * `Err(io::Error)` if the config cannot be read, does not set PATH, or
+///   only adds to the inherited PATH
+fn declared_entries() -> io::Result<Vec<PathBuf>> {
+    let handler = get_shell_handler();
+    let config = handler.target_config_path();
+    let content = fs::read_to_string(&config).map_err(|e| {
+        io::Error::new(e.kind(), format!("Cannot read {}: {}", config.display(), e))
+    })?;
+
+    let modifications = handler.detect_path_modifications(&content);
+    if modifications.is_empty() {
+        return Err(io::Error::new(
+            io::ErrorKind::NotFound,
+            format!("{} does not set PATH; nothing to apply", config.display()),
+        ));
+    }
+    if extends_inherited_path(&modifications) {
+        return Err(io::Error::new(
+            io::ErrorKind::InvalidData,
+            format!(
+                "{} adds to the inherited PATH instead of setting all of it, so it \
+                 cannot be applied on its own; source it instead",
+                config.display()
+            ),
+        ));
+    }
+
+    // Entries written with --literal are expanded as the shell would
+    Ok(handler
+        .parse_path_entries(&content)
+        .iter()
+        .map(|entry| utils::path::expand_variables(&entry.to_string_lossy()))
+        .collect())
+}
+
+/// Executes the apply command
+///
+/// Prints a command that sets PATH to what the shell configuration declares,
+/// in the syntax of the configured shell. Errors go to stderr, so an `eval`
+/// of the output does nothing when there is nothing to apply.
+///
+/// # Example
+///
+/// ```no_run
+/// # use pathmaster::commands;
+/// commands::apply::execute();
+/// // Output example, for bash:
+/// // export PATH='/home/me/.cargo/bin:/usr/local/bin:/usr/bin:/bin'
+/// ```
+pub fn execute() {
+    if cfg!(windows) {
+        eprintln!("apply is not needed on Windows; open a new terminal to pick up PATH changes");
+        process::exit(1);
+    }
+
+    match declared_entries() {
+        Ok(entries) => {
+            let shell = get_shell_handler().get_shell_type();
+            println!("{}", session_command(&shell, &entries));
+        }
+        Err(e) => {
+            eprintln!("{}", e);
+            process::exit(1);
+        }
+    }
+}
+
+#[cfg(all(test, unix))]
+mod tests {
+    use super::*;
+    use crate::utils::shell::config::set_config_file;
+    use crate::utils::shell::factory::set_shell_override;
+    use crate::utils::shell::types::ModificationType;
+    use serial_test::serial;
+    use std::env;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_session_command_syntax() {
+        let entries = vec![PathBuf::from("/usr/bin"), PathBuf::from("/opt/it's/bin")];
+
+        assert_eq!(
+            session_command(&ShellType::Bash, &entries),
+            "export PATH='/usr/bin:/opt/it'\\''s/bin'"
+        );
+        assert_eq!(
+            session_command(&ShellType::Fish, &entries),
+            "set -gx PATH '/usr/bin' '/opt/it\\'s/bin'"
+        );
+        assert_eq!(
+            session_command(&ShellType::Tcsh, &entries),
+            "setenv PATH '/usr/bin:/opt/it'\\''s/bin'"
+        );
+        assert_eq!(
+            session_command(&ShellType::Elvish, &entries),
+            "set-env PATH '/usr/bin:/opt/it''s/bin'"
+        );
+        assert_eq!(
+            session_command(&ShellType::Nushell, &entries),
+            "$env.PATH = [\"/usr/bin\",\"/opt/it's/bin\"]"
+        );
+    }
+
+    #[test]
+    #[serial]
+    fn test_declared_entries_expand_literals() {
+        let temp_dir = TempDir::new().unwrap();
+        let home = env::var("HOME").unwrap();
+        let config = temp_dir.path().join(".zshrc");
+        fs::write(&config, "path=($HOME/bin /usr/bin)\n").unwrap();
+
+        set_shell_override(Some(ShellType::Zsh)).unwrap();
+        set_config_file(Some(config)).unwrap();
+        let entries = declared_entries();
+        set_config_file(None).unwrap();
+        set_shell_override(None).unwrap();
+
+        assert_eq!(
+            entries.unwrap(),
+            vec![
+                PathBuf::from(format!("{}/bin", home)),
+                PathBuf::from("/usr/bin")
+            ]
+        );
+    }
+
+    #[test]
+    fn test_extends_inherited_path() {
+        let declaration = |content: &str| PathModification {
+            line_number: 1,
+            content: content.to_string(),
+            modification_type: ModificationType::Assignment,
+        };
+
+        assert!(!extends_inherited_path(&[declaration(
+            "export PATH=\"/usr/bin:/bin\""
+        )]));
+        assert!(extends_inherited_path(&[
+            declaration("export PATH=\"/usr/bin\""),
+            declaration("export PATH=\"$HOME/bin:$PATH\""),
+        ]));
+        assert!(extends_inherited_path(&[declaration(
+            "set -gx PATH ~/bin $PATH"
+        )]));
+    }
+}
@@ -0,0 +1,254 @@
+//! Command implementation for auditing PATH directory permissions.
+//!
+//! This module provides functionality to:
+//! - Look up the mode bits and ownership of every PATH entry
+//! - Flag entries that other users could write programs into
+//! - Rank findings by severity
+//! - Exit non-zero when anything is flagged, for use in scripts and CI
+//!
+//! Anyone who can write to a directory in PATH can plant a program that
+//! shadows a system command, so such directories are a privilege-escalation
+//! risk.
+
+#[cfg(unix)]
+use crate::status;
+use crate::utils;
+use std::fmt;
+use std::io;
+#[cfg(unix)]
+use std::path::Path;
+use std::path::PathBuf;
+use std::process;
+
+/// How serious a finding is, most serious first
+#[derive(Debug, Clone, Copy, PartialEq, Eq, PartialOrd, Ord)]
+pub enum Severity {
+    /// Any user on the system can write to the directory
+    High,
+    /// The directory belongs to another user
+    Medium,
+    /// Members of a group other than root or your own can write to it
+    Low,
+}
+
+impl fmt::Display for Severity {
+    fn fmt(&self, f: &mut fmt::Formatter) -> fmt::Result {
+        let label = match self {
+            Severity::High => "HIGH",
+            Severity::Medium => "MEDIUM",
+            Severity::Low => "LOW",
+        };
+        f.pad(label)
+    }
+}
+
+/// A permission problem with a PATH entry
+#[derive(Debug, Clone, PartialEq)]
+pub struct Finding {
+    /// How serious the problem is
+    pub severity: Severity,
+    /// The PATH entry
+    pub entry: PathBuf,
+    /// What is wrong with it
+    pub reason: String,
+}
+
+/// The user and groups whose write access is not a risk
+#[derive(Debug, Clone, Copy, PartialEq)]
+pub struct Identity {
+    /// The current user's id
+    pub uid: u32,
+    /// The current user's primary group id
+    pub gid: u32,
+}
+
+impl Identity {
+    /// Returns the identity of the user running pathmaster
+    #[cfg(unix)]
+    pub fn current() -> Self {
+        // SAFETY: getuid and getgid cannot fail
+        unsafe {
+            Self {
+                uid: libc::getuid(),
+                gid: libc::getgid(),
+            }
+        }
+    }
+}
+
+/// Audits one PATH entry's permissions and ownership
+///
+/// Entries that do not exist are not reported; `pathmaster check` covers
+/// them.
+///
+/// # Returns
+/// * `Ok(Vec<Finding>)` - Every problem with the entry, empty if it is safe
+/// * `Err(io::Error)` if the entry exists but cannot be looked up
+#[cfg(unix)]
+pub fn audit_entry(entry: &Path, identity: Identity) -> io::Result<Vec<Finding>> {
+    use std::fs;
+    use std::os::unix::fs::MetadataExt;
+
+    let metadata = match fs::metadata(entry) {
+        Ok(metadata) => metadata,
+        Err(e) if e.kind() == io::ErrorKind::NotFound => return Ok(Vec::new()),
+        Err(e) => return Err(e),
+    };
+    let mode = metadata.mode() & 0o7777;
+    let mut findings = Vec::new();
+    let mut flag = |severity, reason: String| {
+        findings.push(Finding {
+            severity,
+            entry: entry.to_path_buf(),
+            reason,
+        })
+    };
+
+    if mode & 0o002 != 0 {
+        flag(
+            Severity::High,
+            format!("world-writable (mode {:04o})", mode),
+        );
+    }
+    if metadata.uid() != 0 && metadata.uid() != identity.uid {
+        flag(
+            Severity::Medium,
+            format!("owned by uid {}, not you or root", metadata.uid()),
+        );
+    }
+    if mode & 0o020 != 0 && metadata.gid() != 0 && metadata.gid() != identity.gid {
+        flag(
+            Severity::Low,
+            format!(
+                "group-writable by gid {} (mode {:04o})",
+                metadata.gid(),
+                mode
+            ),
+        );
+    }
+
+    Ok(findings)
+}
+
+/// Audits PATH entries, most serious findings first
+///
+/// Findings of the same severity keep PATH order. Empty and repeated
+/// entries are audited once.
+#[cfg(unix)]
+pub fn audit_entries(entries: &[PathBuf], identity: Identity) -> io::Result<Vec<Finding>> {
+    let mut seen = std::collections::HashSet::new();
+    let mut findings = Vec::new();
+    for entry in entries {
+        if utils::is_empty_entry(entry) || !seen.insert(entry) {
+            continue;
+        }
+        findings.extend(audit_entry(entry, identity)?);
+    }
+
+    // Stable, so PATH order is kept within a severity
+    findings.sort_by_key(|finding| finding.severity);
+    Ok(findings)
+}
+
+/// Executes the audit command
+///
+/// Exits with status 1 if anything is flagged.
+///
+/// # Example
+///
+/// ```no_run
+/// # use pathmaster::commands;
+/// commands::audit::execute();
+/// ```
+pub fn execute() {
+    #[cfg(unix)]
+    let findings = audit_entries(&utils::get_path_entries(), Identity::current());
+    #[cfg(not(unix))]
+    let findings: io::Result<Vec<Finding>> = Err(io::Error::new(
+        io::ErrorKind::Unsupported,
+        "The audit command is only supported on Unix",
+    ));
+
+    let findings = match findings {
+        Ok(findings) => findings,
+        Err(e) => {
+            eprintln!("{}", e);
+            process::exit(1);
+        }
+    };
+
+    if findings.is_empty() {
+        status!("No PATH directories are writable by other users");
+        return;
+    }
+
+    status!("PATH audit found {} issue(s):\n", findings.len());
+    for finding in &findings {
+        println!(
+            "{:<7} {}: {}",
+            finding.severity,
+            finding.entry.display(),
+            finding.reason
+        );
+    }
+    process::exit(1);
+}
+
+#[cfg(all(test, unix))]
+mod tests {
+    use super::*;
+    use std::fs;
+    use std::os::unix::fs::{MetadataExt, PermissionsExt};
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_audit_ranks_findings() -> io::Result<()> {
+        let temp_dir = TempDir::new()?;
+        let safe = temp_dir.path().join("safe");
+        let shared = temp_dir.path().join("shared");
+        let open = temp_dir.path().join("open");
+        for (dir, mode) in [(&safe, 0o755), (&shared, 0o775), (&open, 0o777)] {
+            fs::create_dir(dir)?;
+            fs::set_permissions(dir, fs::Permissions::from_mode(mode))?;
+        }
+
+        let metadata = fs::metadata(temp_dir.path())?;
+        let me = Identity {
+            uid: metadata.uid(),
+            gid: metadata.gid(),
+        };
+        let entries = vec![safe.clone(), shared.clone(), open.clone()];
+        let findings = audit_entries(&entries, me)?;
+        assert_eq!(findings.len(), 1);
+        assert_eq!(findings[0].severity, Severity::High);
+        assert_eq!(findings[0].entry, open);
+
+        // Seen by someone else, the same tree is owned by another user and
+        // writable by a group they do not trust
+        let stranger = Identity {
+            uid: me.uid + 1,
+            gid: me.gid + 1,
+        };
+        let severities: Vec<(Severity, PathBuf)> = audit_entries(&entries, stranger)?
+            .into_iter()
+            .map(|finding| (finding.severity, finding.entry))
+            .collect();
+        if me.uid == 0 {
+            // Root owns everything it creates, which is always trusted
+            assert_eq!(severities[0], (Severity::High, open));
+            return Ok(());
+        }
+        assert_eq!(
+            severities,
+            vec![
+                (Severity::High, open.clone()),
+                (Severity::Medium, safe),
+                (Severity::Medium, shared.clone()),
+                (Severity::Medium, open.clone()),
+                (Severity::Low, shared),
+                (Severity::Low, open),
+            ]
+        );
+        Ok(())
+    }
+}
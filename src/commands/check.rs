@@ -0,0 +1,554 @@
+//! Command implementation for checking PATH health.
+//!
+//! This module provides functionality to:
+//! - Validate every PATH entry
+//! - Categorize problems (empty, missing, not a directory, permission
+//!   denied, unreachable, duplicate, effective duplicate, relative)
+//! - Warn when PATH nears the platform's length limit
+//! - Warn about PATH values that splitting and rejoining would change, such as
+//!   a directory whose name contains the separator
+//! - Report problems grouped by category
+//! - Collapse entries that differ only by separators with --fix
+//! - Report commands shadowed by another copy earlier in PATH with --shadows
+//! - Exit non-zero when PATH is unhealthy, for use in scripts and CI
+
+use crate::commands::preview;
+use crate::commands::validator::{EntryKind, ValidityCache};
+use crate::commands::which::{self, Shadow};
+use crate::status;
+use crate::utils;
+use crate::utils::output::{self, paint, Color};
+use crate::utils::path::{
+    collapse_separators, length_warning, path_length_limit, split_anomalies, LengthWarning,
+    SplitAnomaly,
+};
+use std::collections::{HashMap, HashSet};
+use std::env;
+use std::ffi::OsStr;
+use std::path::PathBuf;
+use std::process;
+
+/// Problems found in PATH, grouped by category
+#[derive(Debug, Default, PartialEq)]
+pub struct CheckReport {
+    /// Positions (counting from 1) of empty entries, which the shell treats
+    /// as the current directory
+    pub empty: Vec<usize>,
+    /// Entries that do not exist
+    pub missing: Vec<PathBuf>,
+    /// Entries that exist but are not directories
+    pub not_directories: Vec<PathBuf>,
+    /// Entries that cannot be looked up by this user
+    pub no_permission: Vec<PathBuf>,
+    /// Entries whose lookup timed out, e.g. on an unresponsive network mount
+    pub unreachable: Vec<PathBuf>,
+    /// Entries that appear more than once (reported once per extra occurrence)
+    pub duplicates: Vec<PathBuf>,
+    /// Entries spelled differently from an earlier one only by trailing or
+    /// repeated separators, such as `/usr/bin/` after `/usr/bin`, as
+    /// (earlier, later). The shell searches the same directory for both.
+    pub effective_duplicates: Vec<(PathBuf, PathBuf)>,
+    /// Entries that are not absolute paths
+    pub relative: Vec<PathBuf>,
+    /// Commands provided by more than one directory; only filled in when
+    /// shadows are asked for, as every directory has to be listed. These are
+    /// warnings, not problems: most systems ship some commands twice.
+    pub shadows: Vec<Shadow>,
+    /// Set when PATH is close to the platform's length limit, beyond which
+    /// commands fail to start
+    pub length: Option<LengthWarning>,
+    /// Parts of the PATH value that splitting it into entries and joining
+    /// them again would change; only filled in when the whole value is
+    /// checked
+    pub split: Vec<SplitAnomaly>,
+}
+
+impl CheckReport {
+    /// Returns the total number of problems found
+    pub fn problem_count(&self) -> usize {
+        self.empty.len()
+            + self.missing.len()
+            + self.not_directories.len()
+            + self.no_permission.len()
+            + self.unreachable.len()
+            + self.duplicates.len()
+            + self.effective_duplicates.len()
+            + self.relative.len()
+            + usize::from(self.length.is_some())
+            + self.split.len()
+    }
+
+    /// Returns whether no problems were found
+    pub fn is_healthy(&self) -> bool {
+        self.problem_count() == 0
+    }
+
+    /// Returns each problem category with its label and the color its
+    /// entries are shown in, in display order
+    fn categories(&self) -> [(&'static str, &Vec<PathBuf>, Color); 6] {
+        [
+            ("Missing directories", &self.missing, Color::Red),
+            ("Not directories", &self.not_directories, Color::Red),
+            ("Permission denied", &self.no_permission, Color::Red),
+            ("Unreachable directories", &self.unreachable, Color::Red),
+            ("Duplicate entries", &self.duplicates, Color::Yellow),
+            ("Relative paths", &self.relative, Color::Yellow),
+        ]
+    }
+}
+
+/// Checks PATH entries and categorizes any problems
+///
+/// # Arguments
+///
+/// * `entries` - PATH entries in priority order
+/// * `cache` - Lookups shared with the rest of the command run
+///
+/// # Returns
+///
+/// A `CheckReport` describing every problem found
+pub fn check_entries(entries: &[PathBuf], cache: &mut ValidityCache) -> CheckReport {
+    let mut report = CheckReport::default();
+    // `PathBuf` equality ignores trailing and repeated separators, so the
+    // first spelling is kept to tell exact duplicates from effective ones
+    let mut seen: HashMap<&PathBuf, &PathBuf> = HashMap::new();
+
+    for (index, entry) in entries.iter().enumerate() {
+        if utils::is_empty_entry(entry) {
+            report.empty.push(index + 1);
+            continue;
+        }
+
+        match seen.get(entry) {
+            Some(first) if first.as_os_str() == entry.as_os_str() => {
+                report.duplicates.push(entry.clone())
+            }
+            Some(first) => report
+                .effective_duplicates
+                .push(((*first).clone(), entry.clone())),
+            None => {
+                seen.insert(entry, entry);
+            }
+        }
+
+        if !entry.is_absolute() {
+            report.relative.push(entry.clone());
+        }
+
+        match cache.kind(entry) {
+            EntryKind::Directory => {}
+            EntryKind::NotDirectory => report.not_directories.push(entry.clone()),
+            EntryKind::Missing => report.missing.push(entry.clone()),
+            EntryKind::NoPermission => report.no_permission.push(entry.clone()),
+            EntryKind::Unreachable => report.unreachable.push(entry.clone()),
+        }
+    }
+
+    report.length = length_warning(utils::build_path_string(entries).len(), path_length_limit());
+    report
+}
+
+/// Checks a whole PATH value
+///
+/// Finds everything `check_entries` does, and also the parts of the value
+/// that would not survive being split into entries and joined again.
+///
+/// # Arguments
+///
+/// * `path_var` - A PATH value
+/// * `cache` - Lookups shared with the rest of the command run
+pub fn check_path_value(path_var: &OsStr, cache: &mut ValidityCache) -> CheckReport {
+    let mut report = check_entries(&utils::parse_path_entries(path_var), cache);
+    report.split = split_anomalies(path_var, |dir| cache.kind(dir) == EntryKind::Directory);
+    report
+}
+
+/// Describes a split anomaly for the report
+fn describe_anomaly(anomaly: &SplitAnomaly) -> String {
+    match anomaly {
+        SplitAnomaly::RoundTrip(Some(rejoined)) => {
+            format!("PATH changes when split and joined again, to: {}", rejoined)
+        }
+        SplitAnomaly::RoundTrip(None) => {
+            "an entry contains the PATH separator, so PATH cannot be rebuilt from its entries"
+                .to_string()
+        }
+        SplitAnomaly::Whitespace(position, entry) => format!(
+            "entry {} '{}' has whitespace around it, which is dropped when PATH is saved",
+            position,
+            entry.display()
+        ),
+        SplitAnomaly::Quoted(position, entry) => format!(
+            "entry {} {} is quoted; the quotes are part of the directory name to the shell",
+            position,
+            entry.display()
+        ),
+        SplitAnomaly::SeparatorInName(position, dir) => format!(
+            "entries from {} on are pieces of {}, whose name contains the PATH separator; \
+             it cannot be added to PATH, so link it from a directory without one",
+            position,
+            dir.display()
+        ),
+    }
+}
+
+/// Collapses entries that differ only by trailing or repeated separators
+///
+/// When a directory is spelled more than one way, its first occurrence is
+/// kept with separators collapsed and every later occurrence is removed.
+/// Other entries, including exact duplicates, are left alone.
+///
+/// # Returns
+///
+/// The fixed entries and the number of entries removed
+pub fn collapse_effective_duplicates(entries: &[PathBuf]) -> (Vec<PathBuf>, usize) {
+    let mut spellings: HashMap<&PathBuf, HashSet<&std::ffi::OsStr>> = HashMap::new();
+    for entry in entries {
+        spellings
+            .entry(entry)
+            .or_default()
+            .insert(entry.as_os_str());
+    }
+
+    let mut kept = HashSet::new();
+    let mut fixed = Vec::with_capacity(entries.len());
+    let mut removed = 0;
+    for entry in entries {
+        if spellings[entry].len() < 2 {
+            fixed.push(entry.clone());
+        } else if kept.insert(entry) {
+            fixed.push(collapse_separators(entry));
+        } else {
+            removed += 1;
+        }
+    }
+
+    (fixed, removed)
+}
+
+/// Executes the check command to report PATH health
+///
+/// Exits with status 1 if any problems are found. Shadowed commands are
+/// reported as warnings and do not change the exit status. With `--quiet` the
+/// report is not printed, so only the exit status is meaningful.
+///
+/// # Arguments
+///
+/// * `fix` - Collapse effective duplicates before reporting
+/// * `dry_run` - With `fix`, preview the changes without writing anything
+/// * `shadows` - Also report commands shadowed by an earlier copy in PATH
+pub fn execute(fix: bool, dry_run: bool, shadows: bool) {
+    let path_var = env::var_os("PATH").unwrap_or_default();
+    let mut entries = utils::parse_path_entries(&path_var);
+    let mut cache = ValidityCache::new();
+    if let Err(e) = cache.prefetch(&entries) {
+        eprintln!("{}", e);
+        process::exit(1);
+    }
+    let mut report = check_path_value(&path_var, &mut cache);
+
+    if fix && !report.effective_duplicates.is_empty() {
+        let (fixed, removed) = collapse_effective_duplicates(&entries);
+        if dry_run {
+            preview::show_preview(&entries, &fixed);
+            return;
+        }
+
+        // Back up PATH, then update it and the shell configuration
+        match crate::apply(&fixed, false) {
+            Ok(Some(backup_file)) => {
+                status!("Created PATH backup at: {}", backup_file.display())
+            }
+            Ok(None) => {}
+            Err(e) => {
+                eprintln!("{}", e);
+                process::exit(1);
+            }
+        }
+        status!(
+            "Collapsed {} effective duplicate(s) and updated shell configuration.\n",
+            removed
+        );
+        report = check_path_value(&env::var_os("PATH").unwrap_or_default(), &mut cache);
+        entries = fixed;
+    }
+
+    if shadows {
+        report.shadows = which::find_shadows(&entries);
+    }
+
+    if !output::is_quiet() {
+        print_report(&report);
+    }
+
+    if !report.is_healthy() {
+        process::exit(1);
+    }
+}
+
+/// How to shorten a PATH that is close to the length limit
+pub const LENGTH_ADVICE: &str =
+    "Shorten it with `pathmaster dedupe` and `pathmaster flush`, or `pathmaster clean` for both";
+
+/// Prints a check report grouped by category
+pub fn print_report(report: &CheckReport) {
+    if report.is_healthy() {
+        println!(
+            "{}",
+            paint("All directories in PATH are valid", Color::Green)
+        );
+        print_shadows(&report.shadows);
+        return;
+    }
+
+    println!("PATH check found {} problem(s):", report.problem_count());
+    if !report.empty.is_empty() {
+        let positions: Vec<String> = report.empty.iter().map(|p| p.to_string()).collect();
+        println!(
+            "\nEmpty entries ({}), risky because they search the current directory:",
+            report.empty.len()
+        );
+        println!(
+            "  at position(s) {}",
+            paint(&positions.join(", "), Color::Red)
+        );
+    }
+    for (label, entries, color) in report.categories() {
+        if entries.is_empty() {
+            continue;
+        }
+        println!("\n{} ({}):", label, entries.len());
+        for entry in entries {
+            println!("  {}", paint(&entry.display().to_string(), color));
+        }
+    }
+    if !report.effective_duplicates.is_empty() {
+        println!(
+            "\nEffective duplicates ({}), the same directory to the shell (fix with --fix):",
+            report.effective_duplicates.len()
+        );
+        for (first, later) in &report.effective_duplicates {
+            let later = paint(&later.display().to_string(), Color::Yellow);
+            println!("  {} (same as {})", later, first.display());
+        }
+    }
+    if let Some(warning) = &report.length {
+        println!(
+            "\n{}",
+            paint(
+                &format!(
+                    "PATH is {} bytes, {}% of the {} bytes this system allows; commands fail to \
+                     start beyond it",
+                    warning.length,
+                    warning.percent(),
+                    warning.limit
+                ),
+                Color::Red
+            )
+        );
+        println!("  {}", LENGTH_ADVICE);
+    }
+    if !report.split.is_empty() {
+        println!(
+            "\nEntries that do not split cleanly ({}):",
+            report.split.len()
+        );
+        for anomaly in &report.split {
+            println!("  {}", paint(&describe_anomaly(anomaly), Color::Red));
+        }
+    }
+    print_shadows(&report.shadows);
+}
+
+/// Prints the shadowed commands, which are warnings rather than problems
+fn print_shadows(shadows: &[Shadow]) {
+    if shadows.is_empty() {
+        return;
+    }
+    println!(
+        "\nShadowed commands ({}), not counted as problems:",
+        shadows.len()
+    );
+    for shadow in shadows {
+        let shadowed: Vec<String> = shadow
+            .shadowed
+            .iter()
+            .map(|dir| dir.display().to_string())
+            .collect();
+        println!(
+            "  {}: {} shadows {}",
+            paint(&shadow.command, Color::Yellow),
+            shadow.winner.display(),
+            shadowed.join(", ")
+        );
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_check_categories() {
+        let temp_dir = TempDir::new().unwrap();
+        let valid = temp_dir.path().to_path_buf();
+        let missing = temp_dir.path().join("missing");
+        let file = temp_dir.path().join("file");
+        fs::write(&file, "").unwrap();
+        let relative = PathBuf::from("relative/bin");
+
+        let report = check_entries(
+            &[
+                valid.clone(),
+                missing.clone(),
+                file.clone(),
+                valid.clone(),
+                relative.clone(),
+            ],
+            &mut ValidityCache::new(),
+        );
+
+        assert_eq!(report.missing, vec![missing, relative.clone()]);
+        assert_eq!(report.not_directories, vec![file]);
+        assert_eq!(report.duplicates, vec![valid]);
+        assert_eq!(report.relative, vec![relative]);
+        assert_eq!(report.problem_count(), 5);
+    }
+
+    #[test]
+    fn test_check_flags_empty_entries() {
+        for (path, expected) in [(":/usr/bin", vec![1]), ("/usr/bin::/bin", vec![2])] {
+            let entries = utils::parse_path_entries(path);
+            let report = check_entries(&entries, &mut ValidityCache::new());
+            assert_eq!(report.empty, expected, "PATH {}", path);
+            assert!(report.missing.is_empty() && report.relative.is_empty());
+            assert!(!report.is_healthy());
+        }
+    }
+
+    #[cfg(unix)]
+    #[test]
+    fn test_check_flags_malformed_path_value() {
+        let temp_dir = TempDir::new().unwrap();
+        let odd = temp_dir.path().join("a:b");
+        fs::create_dir(&odd).unwrap();
+        let path_var = format!(
+            "{}:{}: {} ",
+            temp_dir.path().display(),
+            odd.display(),
+            temp_dir.path().display()
+        );
+
+        let report = check_path_value(OsStr::new(&path_var), &mut ValidityCache::new());
+        assert_eq!(
+            report.split,
+            vec![
+                SplitAnomaly::SeparatorInName(2, odd),
+                SplitAnomaly::Whitespace(
+                    4,
+                    PathBuf::from(format!(" {} ", temp_dir.path().display()))
+                ),
+            ]
+        );
+        assert!(report.problem_count() >= 2);
+        assert!(describe_anomaly(&report.split[0]).contains("a:b"));
+
+        let healthy = temp_dir.path().display().to_string();
+        let report = check_path_value(OsStr::new(&healthy), &mut ValidityCache::new());
+        assert!(report.is_healthy());
+    }
+
+    #[test]
+    fn test_check_flags_relative_entries() {
+        let temp_dir = TempDir::new().unwrap();
+        let entries = vec![
+            PathBuf::from("."),
+            PathBuf::from("./bin"),
+            temp_dir.path().to_path_buf(),
+        ];
+
+        let report = check_entries(&entries, &mut ValidityCache::new());
+        assert_eq!(
+            report.relative,
+            vec![PathBuf::from("."), PathBuf::from("./bin")]
+        );
+    }
+
+    #[cfg(unix)]
+    #[test]
+    fn test_check_flags_effective_duplicates() {
+        let temp_dir = TempDir::new().unwrap();
+        let dir = temp_dir.path().display().to_string();
+        let entries: Vec<PathBuf> = [
+            dir.clone(),
+            format!("{}/", dir),
+            dir.replace('/', "//"),
+            dir.clone(),
+        ]
+        .iter()
+        .map(PathBuf::from)
+        .collect();
+
+        let report = check_entries(&entries, &mut ValidityCache::new());
+        assert_eq!(
+            report.effective_duplicates,
+            vec![
+                (entries[0].clone(), entries[1].clone()),
+                (entries[0].clone(), entries[2].clone()),
+            ]
+        );
+        assert_eq!(report.duplicates, vec![entries[3].clone()]);
+        assert_eq!(report.problem_count(), 3);
+    }
+
+    #[cfg(unix)]
+    #[test]
+    fn test_collapse_effective_duplicates() {
+        let entries: Vec<PathBuf> = ["/usr/bin/", "/bin", "/usr//bin", "/usr/bin", "/bin"]
+            .iter()
+            .map(PathBuf::from)
+            .collect();
+
+        let (fixed, removed) = collapse_effective_duplicates(&entries);
+        assert_eq!(
+            fixed,
+            vec![
+                PathBuf::from("/usr/bin"),
+                PathBuf::from("/bin"),
+                PathBuf::from("/bin"),
+            ]
+        );
+        assert_eq!(removed, 2);
+    }
+
+    #[test]
+    fn test_healthy_path() {
+        let temp_dir = TempDir::new().unwrap();
+        let mut report = check_entries(&[temp_dir.path().to_path_buf()], &mut ValidityCache::new());
+        assert!(report.is_healthy());
+
+        // Shadowed commands are only warnings
+        report.shadows = vec![Shadow {
+            command: "python3".to_string(),
+            winner: PathBuf::from("/usr/local/bin"),
+            shadowed: vec![PathBuf::from("/usr/bin")],
+        }];
+        assert!(report.is_healthy());
+    }
+
+    #[test]
+    fn test_very_long_path_is_reported() {
+        // Entries of 100 bytes with their separator, enough to pass the limit
+        let count = path_length_limit() / 100 + 1;
+        let entries: Vec<PathBuf> = (0..count)
+            .map(|i| PathBuf::from(format!("/opt/{:0>94}", i)))
+            .collect();
+
+        let report = check_entries(&entries, &mut ValidityCache::new());
+        let warning = report.length.expect("PATH over the limit must be reported");
+        assert_eq!(warning.length, utils::build_path_string(&entries).len());
+        assert!(report.problem_count() > report.missing.len());
+    }
+}
@@ -0,0 +1,421 @@
+//! Command implementation for normalizing the whole PATH in one pass.
+//!
+//! This module handles:
+//! - Removing empty and whitespace-only entries
+//! - Removing trailing separators
+//! - Removing duplicate entries (unless --keep-dupes), keeping the first
+//!   occurrence or, with --keep-last, the last
+//! - Removing entries that do not exist (unless --no-prune)
+//! - Summarizing each category of change, then backing up PATH and
+//!   rewriting the shell configuration once
+//! - With --fix-separators, collapsing stray `:` separators in the PATH
+//!   assignments of the shell configuration itself
+
+use crate::commands::flush::should_remove;
+use crate::commands::preview;
+use crate::commands::validator::ValidityCache;
+use crate::status;
+use crate::utils;
+use crate::utils::filesystem::{FileSystem, RealFileSystem};
+use crate::utils::hooks;
+use crate::utils::lock::lock_config;
+use crate::utils::path::comparison_key;
+use crate::utils::shell::factory;
+use crate::utils::shell::posix;
+use crate::utils::shell::types::ShellType;
+use crate::utils::undo;
+use std::collections::{HashMap, HashSet};
+use std::fs;
+use std::io;
+use std::path::{Path, PathBuf, MAIN_SEPARATOR};
+
+/// Which cleaning steps to run
+///
+/// Empty entries and trailing separators are always cleaned up.
+#[derive(Debug, Clone, Copy, PartialEq)]
+pub struct CleanOptions {
+    /// Remove repeated entries, keeping the first occurrence
+    pub dedupe: bool,
+    /// When removing repeated entries, keep the last occurrence instead
+    pub keep_last: bool,
+    /// Remove entries that do not exist
+    pub prune: bool,
+}
+
+impl Default for CleanOptions {
+    fn default() -> Self {
+        Self {
+            dedupe: true,
+            keep_last: false,
+            prune: true,
+        }
+    }
+}
+
+/// What cleaning changed, by category
+#[derive(Debug, Default, PartialEq)]
+pub struct CleanReport {
+    /// Number of empty entries removed
+    pub empty: usize,
+    /// Entries whose trailing separators were removed, as (before, after)
+    pub normalized: Vec<(PathBuf, PathBuf)>,
+    /// Repeated entries that were removed
+    pub duplicates: Vec<PathBuf>,
+    /// Entries removed because they do not exist
+    pub invalid: Vec<PathBuf>,
+}
+
+impl CleanReport {
+    /// Returns whether cleaning changed nothing
+    pub fn is_empty(&self) -> bool {
+        self.empty == 0
+            && self.normalized.is_empty()
+            && self.duplicates.is_empty()
+            && self.invalid.is_empty()
+    }
+}
+
+/// Removes trailing separators from an entry, leaving the root alone
+///
+/// Returns `None` when there is nothing to remove. `PathBuf` comparisons
+/// ignore trailing separators, so this works on the entry's text.
+fn trim_trailing_separators(entry: &Path) -> Option<PathBuf> {
+    let text = entry.to_str()?;
+    let trimmed = text.trim_end_matches(|c| c == '/' || c == MAIN_SEPARATOR);
+    if trimmed.is_empty() || trimmed.len() == text.len() {
+        None
+    } else {
+        Some(PathBuf::from(trimmed))
+    }
+}
+
+/// Cleans PATH entries according to `options`
+///
+/// # Arguments
+///
+/// * `entries` - PATH entries in priority order
+/// * `options` - Which optional steps to run
+/// * `cache` - Lookups shared with the rest of the command run
+///
+/// # Returns
+///
+/// The cleaned entries and a report of what changed
+pub fn clean_entries(
+    entries: &[PathBuf],
+    options: CleanOptions,
+    cache: &mut ValidityCache,
+) -> (Vec<PathBuf>, CleanReport) {
+    let mut report = CleanReport::default();
+    let mut seen = HashSet::new();
+    let mut cleaned = Vec::new();
+
+    // With keep_last, an entry survives only at the last position it has
+    let mut last_positions = HashMap::new();
+    if options.keep_last {
+        for (index, entry) in entries.iter().enumerate() {
+            let trimmed = trim_trailing_separators(entry).unwrap_or_else(|| entry.clone());
+            last_positions.insert(comparison_key(&trimmed, false), index);
+        }
+    }
+
+    for (index, entry) in entries.iter().enumerate() {
+        if utils::is_empty_entry(entry) {
+            report.empty += 1;
+            continue;
+        }
+
+        let entry = match trim_trailing_separators(entry) {
+            Some(trimmed) => {
+                report.normalized.push((entry.clone(), trimmed.clone()));
+                trimmed
+            }
+            None => entry.clone(),
+        };
+
+        if options.dedupe {
+            let key = comparison_key(&entry, false);
+            let duplicate = if options.keep_last {
+                last_positions.get(&key) != Some(&index)
+            } else {
+                !seen.insert(key)
+            };
+            if duplicate {
+                report.duplicates.push(entry);
+                continue;
+            }
+        }
+
+        if options.prune && should_remove(cache.kind(&entry), false) {
+            report.invalid.push(entry);
+            continue;
+        }
+
+        cleaned.push(entry);
+    }
+
+    (cleaned, report)
+}
+
+/// Prints what cleaning changed, one section per category
+fn print_report(report: &CleanReport) {
+    if report.empty > 0 {
+        status!("Removed {} empty entry(ies).", report.empty);
+    }
+    if !report.normalized.is_empty() {
+        status!(
+            "Removed trailing separators from {} entry(ies):",
+            report.normalized.len()
+        );
+        for (before, after) in &report.normalized {
+            status!("  {} -> {}", before.display(), after.display());
+        }
+    }
+    if !report.duplicates.is_empty() {
+        status!("Removed {} duplicate(s):", report.duplicates.len());
+        for entry in &report.duplicates {
+            status!("  {}", entry.display());
+        }
+    }
+    if !report.invalid.is_empty() {
+        status!("Removed {} invalid path(s):", report.invalid.len());
+        for entry in &report.invalid {
+            status!("  {}", entry.display());
+        }
+    }
+}
+
+/// Executes the clean command to normalize PATH in place
+///
+/// # Arguments
+///
+/// * `options` - Which optional steps to run
+/// * `dry_run` - Preview the changes without writing anything
+///
+/// # Example
+///
+/// ```no_run
+/// # use pathmaster::commands;
+/// # use pathmaster::commands::clean::CleanOptions;
+/// // Clean up, but leave entries that do not exist
+/// let options = CleanOptions { prune: false, ..Default::default() };
+/// commands::clean::execute(options, false);
+/// ```
+pub fn execute(options: CleanOptions, dry_run: bool) {
+    let current_entries = utils::get_path_entries();
+    let mut cache = ValidityCache::new();
+    if options.prune {
+        if let Err(e) = cache.prefetch(&current_entries) {
+            eprintln!("{}", e);
+            std::process::exit(1);
+        }
+    }
+    let (cleaned, report) = clean_entries(&current_entries, options, &mut cache);
+
+    if report.is_empty() {
+        status!("PATH is already clean.");
+        return;
+    }
+
+    print_report(&report);
+
+    if dry_run {
+        status!();
+        preview::show_preview(&current_entries, &cleaned);
+        return;
+    }
+
+    // Back up PATH, then update it and the shell configuration
+    match crate::apply(&cleaned, false) {
+        Ok(Some(backup_file)) => status!("Created PATH backup at: {}", backup_file.display()),
+        Ok(None) => {}
+        Err(e) => {
+            eprintln!("{}", e);
+            std::process::exit(1);
+        }
+    }
+
+    status!("Successfully cleaned PATH and updated shell configuration.");
+}
+
+/// Reports that `fix_separators` found nothing to change
+fn report_no_redundant_separators(config: &Path) {
+    status!(
+        "PATH assignments in {} have no redundant separators.",
+        config.display()
+    );
+}
+
+/// Collapses redundant separators in the shell configuration's PATH assignments
+///
+/// Rewrites lines such as `export PATH=:$PATH::/opt/bin:` to
+/// `export PATH=$PATH:/opt/bin`, so the shell stops adding empty entries,
+/// which most shells read as the current directory. The rest of the file,
+/// including where each assignment refers to `$PATH`, is left as it is.
+/// Only POSIX-style shells (bash, zsh, ksh and sh) are supported.
+///
+/// # Arguments
+/// * `dry_run` - Show the lines that would change without writing anything
+///
+/// # Example
+///
+/// ```no_run
+/// # use pathmaster::commands;
+/// commands::clean::fix_separators(true);
+/// // Output example:
+/// // Dry run: no changes will be made.
+/// //
+/// // Changes to /home/user/.bashrc:
+/// // -   12  export PATH=$PATH::/opt/bin:
+/// // +   12  export PATH=$PATH:/opt/bin
+/// ```
+pub fn fix_separators(dry_run: bool) {
+    let shell = factory::resolved_shell_type();
+    if !matches!(
+        shell,
+        ShellType::Bash | ShellType::Zsh | ShellType::Ksh | ShellType::Generic
+    ) {
+        eprintln!(
+            "--fix-separators only supports bash, zsh, ksh and sh configurations, not {}",
+            shell
+        );
+        std::process::exit(1);
+    }
+
+    let config = factory::get_handler_for(&shell).target_config_path();
+    let before = match fs::read_to_string(&config) {
+        Ok(content) => content,
+        Err(e) if e.kind() == io::ErrorKind::NotFound => {
+            status!("{} does not exist; nothing to fix.", config.display());
+            return;
+        }
+        Err(e) => {
+            eprintln!("Error reading {}: {}", config.display(), e);
+            std::process::exit(1);
+        }
+    };
+
+    let (after, found) = posix::fix_separators(&before);
+    if found == 0 {
+        report_no_redundant_separators(&config);
+        return;
+    }
+
+    if dry_run {
+        preview::show_config_preview(&config, &before, &after);
+        return;
+    }
+
+    let result = hooks::with_hooks(&config, || {
+        let _lock = lock_config(&config)?;
+
+        // Read again under the lock, so an edit made meanwhile is not lost
+        let files = RealFileSystem;
+        let (after, fixed) = posix::fix_separators(&files.read_to_string(&config)?);
+        if fixed > 0 {
+            undo::record_snapshot(&config)?;
+            files.write_atomic(&config, after.as_bytes())?;
+        }
+        Ok(fixed)
+    });
+    let fixed = match result {
+        Ok(0) => return report_no_redundant_separators(&config),
+        Ok(fixed) => fixed,
+        Err(e) => {
+            eprintln!("Error updating shell configuration: {}", e);
+            std::process::exit(1);
+        }
+    };
+
+    status!(
+        "Fixed separators in {} PATH assignment{} in {}.",
+        fixed,
+        if fixed == 1 { "" } else { "s" },
+        config.display()
+    );
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_clean_entries() {
+        let temp_dir = TempDir::new().unwrap();
+        let valid = temp_dir.path().to_path_buf();
+        let slashed = PathBuf::from(format!("{}/", valid.display()));
+        let missing = temp_dir.path().join("missing");
+        let entries = vec![
+            slashed.clone(),
+            PathBuf::new(),
+            valid.clone(),
+            PathBuf::from(" "),
+            missing.clone(),
+            PathBuf::from("/"),
+        ];
+
+        let (cleaned, report) =
+            clean_entries(&entries, CleanOptions::default(), &mut ValidityCache::new());
+        assert_eq!(cleaned, vec![valid.clone(), PathBuf::from("/")]);
+        assert_eq!(report.empty, 2);
+        assert_eq!(report.normalized, vec![(slashed, valid.clone())]);
+        assert_eq!(report.duplicates, vec![valid.clone()]);
+        assert_eq!(report.invalid, vec![missing.clone()]);
+
+        let options = CleanOptions {
+            dedupe: false,
+            prune: false,
+            ..Default::default()
+        };
+        let (cleaned, report) = clean_entries(&entries, options, &mut ValidityCache::new());
+        assert_eq!(
+            cleaned,
+            vec![valid.clone(), valid, missing, PathBuf::from("/")]
+        );
+        assert!(report.duplicates.is_empty() && report.invalid.is_empty());
+    }
+
+    #[test]
+    fn test_clean_entries_keep_last() {
+        let entries: Vec<PathBuf> = ["/opt/bin", "/usr/bin", "/opt/bin/", "/bin", "/usr/bin"]
+            .iter()
+            .map(PathBuf::from)
+            .collect();
+        let keep_first = CleanOptions {
+            prune: false,
+            ..Default::default()
+        };
+        let keep_last = CleanOptions {
+            keep_last: true,
+            ..keep_first
+        };
+
+        let (cleaned, report) = clean_entries(&entries, keep_first, &mut ValidityCache::new());
+        assert_eq!(
+            cleaned,
+            vec![
+                PathBuf::from("/opt/bin"),
+                PathBuf::from("/usr/bin"),
+                PathBuf::from("/bin")
+            ]
+        );
+        assert_eq!(
+            report.duplicates,
+            vec![PathBuf::from("/opt/bin"), PathBuf::from("/usr/bin")]
+        );
+
+        let (cleaned, report) = clean_entries(&entries, keep_last, &mut ValidityCache::new());
+        assert_eq!(
+            cleaned,
+            vec![
+                PathBuf::from("/opt/bin"),
+                PathBuf::from("/bin"),
+                PathBuf::from("/usr/bin")
+            ]
+        );
+        assert_eq!(
+            report.duplicates,
+            vec![PathBuf::from("/opt/bin"), PathBuf::from("/usr/bin")]
+        );
+    }
+}
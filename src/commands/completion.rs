@@ -0,0 +1,669 @@
+//! Command implementation for generating shell completion scripts.
+//!
+//! This module handles:
+//! - Describing the commands, aliases and options of the command line
+//! - Writing completion scripts for bash, zsh and fish to stdout
+//! - Completing the PATH entries given to delete and move
+//!
+//! The scripts are generated from the clap definition, so new commands and
+//! options are picked up automatically. PATH entries are read by the script
+//! at completion time, from the PATH of the shell being typed in.
+
+use crate::utils::shell::types::ShellType;
+use clap::Command;
+use std::io::{self, Write};
+use std::str::FromStr;
+
+/// Arguments completed with the current PATH entries, as (command, argument id)
+const PATH_ENTRY_ARGS: &[(&str, &str)] = &[
+    ("delete", "directories"),
+    ("move", "directory"),
+    ("move", "before"),
+    ("move", "after"),
+];
+
+/// An option of a command
+struct OptionSpec {
+    long: String,
+    short: Option<char>,
+    help: String,
+    /// Name of the option's value, if it takes one
+    value: Option<String>,
+    /// Whether the value is a PATH entry
+    entries: bool,
+}
+
+/// A positional argument of a command
+struct PositionalSpec {
+    name: String,
+    multiple: bool,
+    /// Whether the argument is a PATH entry
+    entries: bool,
+}
+
+/// A command and what can follow it
+struct CommandSpec {
+    name: String,
+    about: String,
+    /// Words that select the command: its name, aliases and short flag
+    selectors: Vec<String>,
+    options: Vec<OptionSpec>,
+    positionals: Vec<PositionalSpec>,
+    /// Nested commands, as (name, about)
+    subcommands: Vec<(String, String)>,
+}
+
+impl CommandSpec {
+    fn from_command(cmd: &Command) -> Self {
+        let name = cmd.get_name().to_string();
+        let mut selectors = vec![name.clone()];
+        selectors.extend(cmd.get_all_aliases().map(str::to_string));
+        selectors.extend(cmd.get_short_flag().map(|c| format!("-{}", c)));
+
+        let is_entry = |id: &str| PATH_ENTRY_ARGS.contains(&(name.as_str(), id));
+        let mut options = Vec::new();
+        let mut positionals = Vec::new();
+
+        // Global options are listed once, on the top-level command
+        for arg in cmd
+            .get_arguments()
+            .filter(|arg| !arg.is_hide_set() && !arg.is_global_set())
+        {
+            let id = arg.get_id().as_str();
+            let value = arg
+                .get_value_names()
+                .and_then(|names| names.first())
+                .map(|name| name.to_string());
+
+            if arg.is_positional() {
+                positionals.push(PositionalSpec {
+                    name: value.unwrap_or_else(|| id.to_uppercase()),
+                    multiple: arg
+                        .get_num_args()
+                        .map_or(false, |range| range.max_values() > 1),
+                    entries: is_entry(id),
+                });
+            } else if let Some(long) = arg.get_long() {
+                let takes_value = arg.get_action().takes_values();
+                options.push(OptionSpec {
+                    long: long.to_string(),
+                    short: arg.get_short(),
+                    help: first_line(arg.get_help().map(|help| help.to_string())),
+                    value: takes_value.then(|| value.unwrap_or_else(|| id.to_uppercase())),
+                    entries: is_entry(id),
+                });
+            }
+        }
+
+        Self {
+            about: first_line(cmd.get_about().map(|about| about.to_string())),
+            subcommands: cmd
+                .get_subcommands()
+                .filter(|sub| !sub.is_hide_set())
+                .map(|sub| {
+                    (
+                        sub.get_name().to_string(),
+                        first_line(sub.get_about().map(|about| about.to_string())),
+                    )
+                })
+                .collect(),
+            name,
+            selectors,
+            options,
+            positionals,
+        }
+    }
+
+    /// Returns the words that complete options of this command
+    fn option_words(&self) -> Vec<String> {
+        let mut words = Vec::new();
+        for option in &self.options {
+            words.push(format!("--{}", option.long));
+            words.extend(option.short.map(|c| format!("-{}", c)));
+        }
+        words
+    }
+
+    /// Returns whether any argument of this command is a PATH entry
+    fn completes_entries(&self) -> bool {
+        self.positionals.iter().any(|positional| positional.entries)
+    }
+}
+
+fn first_line(text: Option<String>) -> String {
+    text.unwrap_or_default()
+        .lines()
+        .next()
+        .unwrap_or_default()
+        .trim()
+        .to_string()
+}
+
+/// Writes a completion script for `shell`
+///
+/// # Arguments
+///
+/// * `out` - Where to write the script
+/// * `shell` - The shell to generate the script for
+/// * `cli` - The command-line definition to complete
+///
+/// # Returns
+///
+/// * `Ok(())` if the script was written
+/// * `Err(io::Error)` if the shell is not supported or writing fails
+pub fn write_script(out: &mut dyn Write, shell: &ShellType, cli: &Command) -> io::Result<()> {
+    let mut cli = cli.clone();
+    cli.build();
+
+    let root = CommandSpec::from_command(&cli);
+    let commands: Vec<CommandSpec> = cli
+        .get_subcommands()
+        .filter(|sub| !sub.is_hide_set())
+        .map(CommandSpec::from_command)
+        .collect();
+    let globals: Vec<OptionSpec> = cli
+        .get_arguments()
+        .filter(|arg| arg.is_global_set() && !arg.is_hide_set())
+        .filter_map(|arg| {
+            Some(OptionSpec {
+                long: arg.get_long()?.to_string(),
+                short: arg.get_short(),
+                help: first_line(arg.get_help().map(|help| help.to_string())),
+                value: arg.get_action().takes_values().then(|| {
+                    arg.get_value_names()
+                        .and_then(|names| names.first())
+                        .map_or_else(
+                            || arg.get_id().as_str().to_uppercase(),
+                            |name| name.to_string(),
+                        )
+                }),
+                entries: false,
+            })
+        })
+        .collect();
+
+    match shell {
+        ShellType::Bash => write_bash(out, &root, &globals, &commands),
+        ShellType::Zsh => write_zsh(out, &root, &globals, &commands),
+        ShellType::Fish => write_fish(out, &root, &globals, &commands),
+        other => Err(io::Error::new(
+            io::ErrorKind::Unsupported,
+            format!(
+                "Completion scripts are not available for {}. Supported shells are: bash, zsh, fish",
+                other
+            ),
+        )),
+    }
+}
+
+fn write_bash(
+    out: &mut dyn Write,
+    root: &CommandSpec,
+    globals: &[OptionSpec],
+    commands: &[CommandSpec],
+) -> io::Result<()> {
+    let bin = &root.name;
+    let func = format!("_{}", bin.replace('-', "_"));
+    let mut valued: Vec<&OptionSpec> = globals
+        .iter()
+        .filter(|option| option.value.is_some())
+        .collect();
+    valued.extend(
+        commands
+            .iter()
+            .flat_map(|cmd| &cmd.options)
+            .filter(|option| option.value.is_some()),
+    );
+    let global_words: Vec<String> = globals
+        .iter()
+        .map(|option| format!("--{}", option.long))
+        .collect();
+
+    writeln!(out, "# bash completion for {}", bin)?;
+    writeln!(
+        out,
+        "# Install with: {} completion bash > ~/.local/share/bash-completion/completions/{}",
+        bin, bin
+    )?;
+    writeln!(out)?;
+    writeln!(out, "{}_path_entries() {{", func)?;
+    writeln!(out, "    local IFS=$'\\n'")?;
+    writeln!(
+        out,
+        "    COMPREPLY=($(compgen -W \"${{PATH//:/$'\\n'}}\" -- \"$cur\"))"
+    )?;
+    writeln!(out, "}}")?;
+    writeln!(out)?;
+    writeln!(out, "{}() {{", func)?;
+    writeln!(out, "    local cur prev cmd i")?;
+    writeln!(out, "    cur=\"${{COMP_WORDS[COMP_CWORD]}}\"")?;
+    writeln!(out, "    prev=\"${{COMP_WORDS[COMP_CWORD-1]}}\"")?;
+    writeln!(out, "    cmd=\"\"")?;
+    writeln!(out)?;
+    writeln!(
+        out,
+        "    # Find the command, skipping global options and their values"
+    )?;
+    writeln!(out, "    for ((i = 1; i < COMP_CWORD; i++)); do")?;
+    writeln!(out, "        case \"${{COMP_WORDS[i]}}\" in")?;
+    let global_valued: Vec<String> = globals
+        .iter()
+        .filter(|option| option.value.is_some())
+        .map(|option| format!("--{}", option.long))
+        .collect();
+    if !global_valued.is_empty() {
+        writeln!(out, "            {}) ((i++)) ;;", global_valued.join("|"))?;
+    }
+    for cmd in commands {
+        writeln!(
+            out,
+            "            {}) cmd={}; break ;;",
+            cmd.selectors.join("|"),
+            cmd.name
+        )?;
+    }
+    writeln!(out, "        esac")?;
+    writeln!(out, "    done")?;
+    writeln!(out)?;
+
+    let entry_options: Vec<String> = valued
+        .iter()
+        .filter(|option| option.entries)
+        .map(|option| format!("--{}", option.long))
+        .collect();
+    let mut other_options: Vec<String> = valued
+        .iter()
+        .filter(|option| !option.entries)
+        .map(|option| format!("--{}", option.long))
+        .collect();
+    other_options.sort();
+    other_options.dedup();
+    writeln!(out, "    case \"$prev\" in")?;
+    if !entry_options.is_empty() {
+        writeln!(
+            out,
+            "        {}) {}_path_entries; return ;;",
+            entry_options.join("|"),
+            func
+        )?;
+    }
+    if !other_options.is_empty() {
+        writeln!(out, "        {}) return ;;", other_options.join("|"))?;
+    }
+    writeln!(out, "    esac")?;
+    writeln!(out)?;
+
+    writeln!(out, "    case \"$cmd\" in")?;
+    let names: Vec<&str> = commands.iter().map(|cmd| cmd.name.as_str()).collect();
+    writeln!(out, "        \"\")")?;
+    writeln!(
+        out,
+        "            COMPREPLY=($(compgen -W \"{} {}\" -- \"$cur\"))",
+        names.join(" "),
+        global_words.join(" ")
+    )?;
+    writeln!(out, "            ;;")?;
+    for cmd in commands {
+        let mut words = cmd.option_words();
+        words.extend(global_words.iter().cloned());
+        let nested: Vec<&str> = cmd
+            .subcommands
+            .iter()
+            .map(|(name, _)| name.as_str())
+            .collect();
+
+        writeln!(out, "        {})", cmd.name)?;
+        writeln!(out, "            if [[ $cur == -* ]]; then")?;
+        writeln!(
+            out,
+            "                COMPREPLY=($(compgen -W \"{}\" -- \"$cur\"))",
+            words.join(" ")
+        )?;
+        if cmd.completes_entries() {
+            writeln!(out, "            else")?;
+            writeln!(out, "                {}_path_entries", func)?;
+        } else if !nested.is_empty() {
+            writeln!(out, "            else")?;
+            writeln!(
+                out,
+                "                COMPREPLY=($(compgen -W \"{}\" -- \"$cur\"))",
+                nested.join(" ")
+            )?;
+        }
+        writeln!(out, "            fi")?;
+        writeln!(out, "            ;;")?;
+    }
+    writeln!(out, "    esac")?;
+    writeln!(out, "}}")?;
+    writeln!(out)?;
+    writeln!(out, "complete -o default -F {} {}", func, bin)?;
+    Ok(())
+}
+
+/// Escapes text for use inside a zsh single-quoted string
+fn zsh_quote(text: &str) -> String {
+    text.replace('\'', "'\\''")
+}
+
+/// Escapes text for use inside a single-quoted zsh `_arguments` spec
+fn zsh_escape(text: &str) -> String {
+    zsh_quote(text)
+        .replace('[', "\\[")
+        .replace(']', "\\]")
+        .replace(':', "\\:")
+}
+
+/// Returns the `_arguments` spec for an option
+fn zsh_option(option: &OptionSpec, func: &str) -> String {
+    let help = zsh_escape(&option.help);
+    let value = match &option.value {
+        Some(name) if option.entries => format!(":{}:{}_path_entries", name, func),
+        Some(name) => format!(":{}: ", name),
+        None => String::new(),
+    };
+
+    match option.short {
+        Some(short) => format!(
+            "'(-{short} --{long})'{{-{short},--{long}}}'[{help}]{value}'",
+            short = short,
+            long = option.long,
+            help = help,
+            value = value
+        ),
+        None => format!("'--{}[{}]{}'", option.long, help, value),
+    }
+}
+
+fn write_zsh(
+    out: &mut dyn Write,
+    root: &CommandSpec,
+    globals: &[OptionSpec],
+    commands: &[CommandSpec],
+) -> io::Result<()> {
+    let bin = &root.name;
+    let func = format!("_{}", bin.replace('-', "_"));
+
+    writeln!(out, "#compdef {}", bin)?;
+    writeln!(
+        out,
+        "# Install with: {} completion zsh > \"${{fpath[1]}}/_{}\"",
+        bin, bin
+    )?;
+    writeln!(out)?;
+    writeln!(out, "{}_path_entries() {{", func)?;
+    writeln!(out, "    local -a entries expl")?;
+    writeln!(out, "    entries=(${{(s.:.)PATH}})")?;
+    writeln!(
+        out,
+        "    _wanted path-entries expl 'PATH entry' compadd -a entries"
+    )?;
+    writeln!(out, "}}")?;
+    writeln!(out)?;
+    writeln!(out, "{}() {{", func)?;
+    writeln!(out, "    local curcontext=\"$curcontext\" state line")?;
+    writeln!(out, "    local -a commands")?;
+    writeln!(out, "    commands=(")?;
+    for cmd in commands {
+        writeln!(out, "        '{}:{}'", cmd.name, zsh_quote(&cmd.about))?;
+    }
+    writeln!(out, "    )")?;
+    writeln!(out)?;
+    writeln!(out, "    _arguments -C \\")?;
+    for option in globals {
+        writeln!(out, "        {} \\", zsh_option(option, &func))?;
+    }
+    writeln!(out, "        '1: :->command' \\")?;
+    writeln!(out, "        '*:: :->args'")?;
+    writeln!(out)?;
+    writeln!(out, "    case $state in")?;
+    writeln!(out, "        command)")?;
+    writeln!(
+        out,
+        "            _describe -t commands '{} command' commands",
+        bin
+    )?;
+    writeln!(out, "            ;;")?;
+    writeln!(out, "        args)")?;
+    writeln!(out, "            case $line[1] in")?;
+    for cmd in commands {
+        writeln!(out, "                {})", cmd.selectors.join("|"))?;
+        if !cmd.subcommands.is_empty() {
+            writeln!(out, "                    local -a subcommands")?;
+            writeln!(out, "                    subcommands=(")?;
+            for (name, about) in &cmd.subcommands {
+                writeln!(
+                    out,
+                    "                        '{}:{}'",
+                    name,
+                    zsh_quote(about)
+                )?;
+            }
+            writeln!(out, "                    )")?;
+            writeln!(
+                out,
+                "                    _describe -t commands '{} {} command' subcommands",
+                bin, cmd.name
+            )?;
+            writeln!(out, "                    ;;")?;
+            continue;
+        }
+
+        let mut specs: Vec<String> = cmd
+            .options
+            .iter()
+            .map(|option| zsh_option(option, &func))
+            .collect();
+        for (index, positional) in cmd.positionals.iter().enumerate() {
+            let action = if positional.entries {
+                format!("{}_path_entries", func)
+            } else {
+                String::from("_default")
+            };
+            let position = if positional.multiple {
+                String::from("*")
+            } else {
+                (index + 1).to_string()
+            };
+            specs.push(format!("'{}:{}:{}'", position, positional.name, action));
+        }
+
+        if specs.is_empty() {
+            writeln!(out, "                    _message 'no more arguments'")?;
+        } else {
+            writeln!(out, "                    _arguments \\")?;
+            writeln!(
+                out,
+                "                        {}",
+                specs.join(" \\\n                        ")
+            )?;
+        }
+        writeln!(out, "                    ;;")?;
+    }
+    writeln!(out, "            esac")?;
+    writeln!(out, "            ;;")?;
+    writeln!(out, "    esac")?;
+    writeln!(out, "}}")?;
+    writeln!(out)?;
+    writeln!(out, "{} \"$@\"", func)?;
+    Ok(())
+}
+
+/// Quotes text as a fish single-quoted string
+fn fish_quote(text: &str) -> String {
+    format!("'{}'", text.replace('\\', "\\\\").replace('\'', "\\'"))
+}
+
+/// Returns the `complete` arguments for an option
+fn fish_option(option: &OptionSpec, func: &str) -> String {
+    let mut args = format!("-l {}", option.long);
+    if let Some(short) = option.short {
+        args.push_str(&format!(" -s {}", short));
+    }
+    match &option.value {
+        Some(_) if option.entries => args.push_str(&format!(" -x -a '({})'", func)),
+        Some(_) => args.push_str(" -r"),
+        None => {}
+    }
+    if !option.help.is_empty() {
+        args.push_str(&format!(" -d {}", fish_quote(&option.help)));
+    }
+    args
+}
+
+fn write_fish(
+    out: &mut dyn Write,
+    root: &CommandSpec,
+    globals: &[OptionSpec],
+    commands: &[CommandSpec],
+) -> io::Result<()> {
+    let bin = &root.name;
+    let func = format!("__{}_path_entries", bin.replace('-', "_"));
+
+    writeln!(out, "# fish completion for {}", bin)?;
+    writeln!(
+        out,
+        "# Install with: {} completion fish > ~/.config/fish/completions/{}.fish",
+        bin, bin
+    )?;
+    writeln!(out)?;
+    writeln!(out, "function {}", func)?;
+    writeln!(out, "    string join \\n -- $PATH")?;
+    writeln!(out, "end")?;
+    writeln!(out)?;
+    for option in globals {
+        writeln!(out, "complete -c {} {}", bin, fish_option(option, &func))?;
+    }
+    for cmd in commands {
+        writeln!(
+            out,
+            "complete -c {} -n __fish_use_subcommand -f -a {} -d {}",
+            bin,
+            cmd.name,
+            fish_quote(&cmd.about)
+        )?;
+    }
+    for cmd in commands {
+        let condition = format!("'__fish_seen_subcommand_from {}'", cmd.selectors.join(" "));
+        for option in &cmd.options {
+            writeln!(
+                out,
+                "complete -c {} -n {} {}",
+                bin,
+                condition,
+                fish_option(option, &func)
+            )?;
+        }
+        if cmd.completes_entries() {
+            writeln!(
+                out,
+                "complete -c {} -n {} -f -a '({})'",
+                bin, condition, func
+            )?;
+        }
+        for (name, about) in &cmd.subcommands {
+            writeln!(
+                out,
+                "complete -c {} -n {} -f -a {} -d {}",
+                bin,
+                condition,
+                name,
+                fish_quote(about)
+            )?;
+        }
+    }
+    Ok(())
+}
+
+/// Executes the completion command, writing the script to stdout
+///
+/// # Arguments
+///
+/// * `shell` - Name of the shell to generate a script for
+/// * `cli` - The command-line definition to complete
+///
+/// # Example
+///
+/// ```no_run
+/// # use pathmaster::commands;
+/// # let cli = clap::Command::new("pathmaster");
+/// commands::completion::execute("zsh", &cli);
+/// ```
+pub fn execute(shell: &str, cli: &Command) {
+    let shell = match ShellType::from_str(shell) {
+        Ok(shell) => shell,
+        Err(e) => {
+            eprintln!("{}", e);
+            std::process::exit(1);
+        }
+    };
+
+    let stdout = io::stdout();
+    if let Err(e) = write_script(&mut stdout.lock(), &shell, cli) {
+        // A closed pipe (e.g. `| head`) is not worth reporting
+        if e.kind() != io::ErrorKind::BrokenPipe {
+            eprintln!("Error generating completions: {}", e);
+            std::process::exit(1);
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use clap::Arg;
+
+    fn cli() -> Command {
+        Command::new("pathmaster")
+            .arg(
+                Arg::new("shell")
+                    .long("shell")
+                    .value_name("SHELL")
+                    .global(true),
+            )
+            .subcommand(
+                Command::new("delete")
+                    .about("Delete directories from the PATH")
+                    .short_flag('d')
+                    .alias("remove")
+                    .arg(Arg::new("directories").num_args(1..))
+                    .arg(
+                        Arg::new("dry_run")
+                            .long("dry-run")
+                            .action(clap::ArgAction::SetTrue),
+                    ),
+            )
+            .subcommand(Command::new("list").about("List current PATH entries"))
+    }
+
+    fn script(shell: ShellType) -> String {
+        let mut output = Vec::new();
+        write_script(&mut output, &shell, &cli()).unwrap();
+        String::from_utf8(output).unwrap()
+    }
+
+    #[test]
+    fn test_scripts_complete_commands_and_entries() {
+        let bash = script(ShellType::Bash);
+        assert!(bash.contains("compgen -W \"delete list help --shell\""));
+        assert!(bash.contains("delete|remove|-d) cmd=delete; break ;;"));
+        assert!(bash.contains("--shell) ((i++)) ;;"));
+        assert!(bash.contains("complete -o default -F _pathmaster pathmaster"));
+
+        let zsh = script(ShellType::Zsh);
+        assert!(zsh.starts_with("#compdef pathmaster\n"));
+        assert!(zsh.contains("'delete:Delete directories from the PATH'"));
+        assert!(zsh.contains("'*:DIRECTORIES:_pathmaster_path_entries'"));
+
+        let fish = script(ShellType::Fish);
+        assert!(fish.contains("complete -c pathmaster -n __fish_use_subcommand -f -a list"));
+        assert!(fish.contains(
+            "complete -c pathmaster -n '__fish_seen_subcommand_from delete remove -d' -f -a '(__pathmaster_path_entries)'"
+        ));
+    }
+
+    #[test]
+    fn test_unsupported_shell() {
+        let err = write_script(&mut Vec::new(), &ShellType::Tcsh, &cli()).unwrap_err();
+        assert_eq!(err.kind(), io::ErrorKind::Unsupported);
+    }
+}
@@ -0,0 +1,128 @@
+//! Command implementation for showing the effective configuration.
+//!
+//! This module provides functionality to:
+//! - Print every setting in config file syntax
+//! - Show which settings are unset and which shell was detected
+//! - Report where the config file is and whether it exists
+
+use crate::status;
+use crate::utils::settings::{self, Settings};
+use crate::utils::shell::factory;
+use crate::utils::shell::types::ShellType;
+use crate::utils::xdg;
+use std::path::Path;
+use std::process;
+
+/// Renders settings as the lines of a config file
+///
+/// Unset settings are shown as comments. When no shell or backup directory
+/// is configured, the detected shell and default directory are shown with a
+/// note.
+pub fn render_settings(
+    settings: &Settings,
+    detected_shell: &ShellType,
+    default_backup_dir: &Path,
+) -> String {
+    let backup_dir = match &settings.backup_dir {
+        Some(dir) => format!("backup_dir = \"{}\"", dir.display()),
+        None => format!(
+            "backup_dir = \"{}\"  # default",
+            default_backup_dir.display()
+        ),
+    };
+    let keep_backups = match settings.keep_backups {
+        Some(keep) => format!("keep_backups = {}", keep),
+        None => "# keep_backups is not set".to_string(),
+    };
+    let max_backup_age = match &settings.max_backup_age {
+        Some(age) => format!("max_backup_age = \"{}\"", age),
+        None => "# max_backup_age is not set".to_string(),
+    };
+    let hook = |key: &str, hook: &Option<String>| match hook {
+        Some(command) => format!("{} = {}", key, toml::Value::String(command.clone())),
+        None => format!("# {} is not set", key),
+    };
+    let shell = match &settings.shell {
+        Some(shell) => format!("shell = \"{}\"", shell),
+        None => format!("shell = \"{}\"  # detected", detected_shell),
+    };
+
+    [
+        format!("backup_format = \"{}\"", settings.backup_format),
+        format!("backup_name_format = \"{}\"", settings.backup_name_format),
+        format!("compress_backups = {}", settings.compress_backups),
+        backup_dir,
+        format!("auto_backup = {}", settings.auto_backup),
+        keep_backups,
+        max_backup_age,
+        shell,
+        format!("prepend = {}", settings.prepend),
+        format!("warn_shadows = {}", settings.warn_shadows),
+        hook("pre_edit_hook", &settings.pre_edit_hook),
+        hook("post_edit_hook", &settings.post_edit_hook),
+    ]
+    .join("\n")
+}
+
+/// Executes the config command
+///
+/// Prints the settings in effect for this run: the config file, or the
+/// built-in defaults, with any command-line options applied on top.
+pub fn execute() {
+    let settings = match settings::get_settings() {
+        Ok(settings) => settings,
+        Err(e) => {
+            eprintln!("{}", e);
+            process::exit(1);
+        }
+    };
+
+    let file = settings::settings_path();
+    if file.exists() {
+        status!("# Effective configuration, from {}", file.display());
+    } else {
+        status!(
+            "# Effective configuration; {} does not exist, so built-in defaults apply",
+            file.display()
+        );
+    }
+    println!(
+        "{}",
+        render_settings(&settings, &factory::detect_shell_type(), &xdg::backup_dir())
+    );
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::backup::{BackupFormat, NameFormat};
+    use std::path::PathBuf;
+
+    #[test]
+    fn test_render_settings() {
+        let default_dir = Path::new("/home/me/.local/share/pathmaster/backups");
+        let rendered = render_settings(&Settings::default(), &ShellType::Zsh, default_dir);
+        assert_eq!(
+            rendered,
+            "backup_format = \"json\"\nbackup_name_format = \"compact\"\ncompress_backups = false\n\
+             backup_dir = \"/home/me/.local/share/pathmaster/backups\"  # default\n\
+             auto_backup = true\n# keep_backups is not set\n\
+             # max_backup_age is not set\nshell = \"zsh\"  # detected\nprepend = false\n\
+             warn_shadows = false\n# pre_edit_hook is not set\n# post_edit_hook is not set"
+        );
+
+        // What is printed can be read back as a config file
+        let settings = Settings {
+            backup_format: BackupFormat::Toml,
+            backup_name_format: NameFormat::Epoch,
+            compress_backups: true,
+            backup_dir: Some(PathBuf::from("/srv/backups")),
+            keep_backups: Some(10),
+            shell: Some(ShellType::Fish),
+            post_edit_hook: Some(String::from("git -C ~/dotfiles add \"$PATHMASTER_FILE\"")),
+            ..Default::default()
+        };
+        let rendered = render_settings(&settings, &ShellType::Zsh, default_dir);
+        assert_eq!(settings::parse_settings(&rendered).unwrap(), settings);
+    }
+}
@@ -0,0 +1,120 @@
+//! Command implementation for merging scattered PATH declarations.
+//!
+//! This module handles:
+//! - Finding every line of the shell configuration that modifies PATH
+//! - Replacing them with a single declaration of the combined PATH
+//! - Previewing changes with --dry-run
+//! - Creating backups before modification
+
+use crate::backup;
+use crate::commands::preview;
+use crate::status;
+use crate::utils;
+use crate::utils::hooks;
+use crate::utils::persist;
+use crate::utils::shell::factory;
+use std::collections::BTreeSet;
+use std::fs;
+use std::io;
+
+/// Executes the consolidate command to merge all PATH declarations into one
+///
+/// The combined PATH is the session PATH plus any entries that the
+/// configuration adds but the session has not picked up yet.
+///
+/// # Arguments
+///
+/// * `dry_run` - Preview the changes without writing anything
+///
+/// # Example
+///
+/// ```no_run
+/// # use pathmaster::commands;
+/// commands::consolidate::execute(false);
+/// ```
+pub fn execute(dry_run: bool) {
+    let handler = factory::get_shell_handler();
+    let config_path = handler.target_config_path();
+
+    let content = match fs::read_to_string(&config_path) {
+        Ok(content) => content,
+        Err(e) if e.kind() == io::ErrorKind::NotFound => {
+            status!(
+                "{} does not exist; nothing to consolidate.",
+                config_path.display()
+            );
+            return;
+        }
+        Err(e) => {
+            eprintln!("Error reading {}: {}", config_path.display(), e);
+            std::process::exit(1);
+        }
+    };
+
+    let modifications = handler.detect_path_modifications(&content);
+    let lines: BTreeSet<usize> = modifications
+        .iter()
+        .map(|modification| modification.line_number)
+        .collect();
+
+    if lines.len() < 2 {
+        status!(
+            "{} has {} PATH declaration(s); nothing to consolidate.",
+            config_path.display(),
+            lines.len()
+        );
+        return;
+    }
+
+    status!(
+        "Found {} lines modifying PATH in {}:",
+        lines.len(),
+        config_path.display()
+    );
+    let config_lines: Vec<&str> = content.lines().collect();
+    for &line in &lines {
+        status!("{:>6}  {}", line, config_lines[line - 1].trim());
+    }
+    status!();
+
+    let current_entries = utils::get_path_entries();
+    let entries = match persist::load_entries(false) {
+        Ok(entries) => entries,
+        Err(e) => {
+            eprintln!("Error reading PATH: {}", e);
+            std::process::exit(1);
+        }
+    };
+
+    if dry_run {
+        preview::show_preview(&current_entries, &entries);
+        return;
+    }
+
+    let result = hooks::with_hooks(&config_path, || {
+        let backup_file = backup::create::backup_before_change()
+            .map_err(|e| io::Error::new(e.kind(), format!("Error creating backup: {}", e)))?;
+        utils::set_path_entries(&entries);
+        handler.update_config(&entries).map_err(|e| {
+            io::Error::new(
+                e.kind(),
+                format!("Error updating shell configuration: {}", e),
+            )
+        })?;
+        Ok(backup_file)
+    });
+    match result {
+        Ok(Some(backup_file)) => status!("Created PATH backup at: {}", backup_file.display()),
+        Ok(None) => {}
+        Err(e) => {
+            eprintln!("{}", e);
+            std::process::exit(1);
+        }
+    }
+
+    status!(
+        "Consolidated {} PATH declarations in {} into one.",
+        lines.len(),
+        config_path.display()
+    );
+}
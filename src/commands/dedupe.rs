@@ -0,0 +1,61 @@
+//! Command implementation for removing duplicate PATH entries.
+//!
+//! This module handles:
+//! - Detecting repeated PATH entries, including trailing-slash variants
+//! - Keeping the highest-priority occurrence of each entry, or the lowest
+//!   with --keep-last
+//! - Previewing changes with --dry-run
+//! - Creating backups before modification
+//! - Updating shell configuration
+
+use crate::commands::preview;
+use crate::status;
+use crate::utils;
+
+/// Executes the dedupe command to remove duplicate entries from PATH
+///
+/// # Arguments
+///
+/// * `resolve_symlinks` - Treat entries that resolve to the same real directory as duplicates
+/// * `keep_last` - Keep the last occurrence of each entry instead of the first
+/// * `dry_run` - Preview the changes without writing anything
+///
+/// # Example
+///
+/// ```no_run
+/// # use pathmaster::commands;
+/// commands::dedupe::execute(false, false, false);
+/// ```
+pub fn execute(resolve_symlinks: bool, keep_last: bool, dry_run: bool) {
+    let current_entries = utils::get_path_entries();
+    let (deduped, removed) = if keep_last {
+        utils::dedupe_entries_keeping_last(&current_entries, resolve_symlinks)
+    } else {
+        utils::dedupe_entries(&current_entries, resolve_symlinks)
+    };
+
+    if removed == 0 {
+        status!("No duplicate entries found in PATH.");
+        return;
+    }
+
+    if dry_run {
+        preview::show_preview(&current_entries, &deduped);
+        return;
+    }
+
+    // Back up PATH, then update it and the shell configuration
+    match crate::apply(&deduped, false) {
+        Ok(Some(backup_file)) => status!("Created PATH backup at: {}", backup_file.display()),
+        Ok(None) => {}
+        Err(e) => {
+            eprintln!("{}", e);
+            std::process::exit(1);
+        }
+    }
+
+    status!(
+        "Successfully removed {} duplicate entry(ies) from PATH.",
+        removed
+    );
+}
@@ -2,55 +2,340 @@
 //!
 //! This module handles:
 //! - Removing specified directories from PATH
+//! - Matching entries exactly, by substring or by glob pattern
+//! - Removing every directory listed in a file with --from-file
+//! - Removing only the first or last of duplicate entries
+//! - Leaving entries pathmaster did not add alone with --mine-only
+//! - Previewing changes with --dry-run
 //! - Creating backups before modification
-//! - Updating shell configuration
+//! - Updating shell configuration (or the registry on Windows)
 //! - Maintaining PATH integrity
 
-use crate::backup;
-use crate::utils;
+use crate::commands::add::read_directory_list;
+use crate::commands::preview;
+use crate::status;
+use crate::utils::path::{comparison_key, glob_match};
+use std::io;
+use std::path::{Path, PathBuf};
+use std::process;
+
+/// Which of several entries matching the same directory to remove
+#[derive(Debug, Clone, Copy, Default, PartialEq)]
+pub enum Occurrence {
+    /// Every matching entry
+    #[default]
+    All,
+    /// Only the highest-priority match
+    First,
+    /// Only the lowest-priority match
+    Last,
+}
+
+/// Determines whether a PATH entry matches a directory given on the command line
+///
+/// # Arguments
+///
+/// * `entry` - The PATH entry to test
+/// * `directory` - The directory or substring supplied by the user
+/// * `contains` - Match any entry containing `directory` instead of exact paths
+/// * `resolve_symlinks` - Compare exact paths by their real location
+pub fn matches_entry(
+    entry: &Path,
+    directory: &str,
+    contains: bool,
+    resolve_symlinks: bool,
+) -> bool {
+    if contains {
+        entry.to_string_lossy().contains(directory)
+    } else {
+        comparison_key(entry, resolve_symlinks)
+            == comparison_key(Path::new(directory), resolve_symlinks)
+    }
+}
+
+/// Finds the indexes of the PATH entries to remove, in PATH order
+///
+/// Each directory and each pattern is matched on its own, so with
+/// `Occurrence::First` every one of them removes its first match.
+///
+/// # Arguments
+///
+/// * `entries` - PATH entries in priority order
+/// * `directories` - Directories or substrings supplied by the user
+/// * `globs` - Glob patterns supplied by the user
+/// * `contains` - Match any entry containing one of `directories`
+/// * `resolve_symlinks` - Compare exact paths by their real location
+/// * `occurrence` - Which of several matches to remove
+pub fn select_removals(
+    entries: &[PathBuf],
+    directories: &[String],
+    globs: &[String],
+    contains: bool,
+    resolve_symlinks: bool,
+    occurrence: Occurrence,
+) -> Vec<usize> {
+    let matching = |matches: &dyn Fn(&Path) -> bool| -> Vec<usize> {
+        entries
+            .iter()
+            .enumerate()
+            .filter(|(_, entry)| matches(entry))
+            .map(|(index, _)| index)
+            .collect()
+    };
+    let by_directory = directories.iter().map(|directory| {
+        matching(&|entry| matches_entry(entry, directory, contains, resolve_symlinks))
+    });
+    let by_glob = globs
+        .iter()
+        .map(|pattern| matching(&|entry| glob_match(pattern, entry).unwrap_or(false)));
+
+    let mut indexes: Vec<usize> = Vec::new();
+    for matched in by_directory.chain(by_glob) {
+        match occurrence {
+            Occurrence::All => indexes.extend(matched),
+            Occurrence::First => indexes.extend(matched.first()),
+            Occurrence::Last => indexes.extend(matched.last()),
+        }
+    }
+    indexes.sort_unstable();
+    indexes.dedup();
+    indexes
+}
+
+/// The outcome of removing directories from PATH, before anything is written
+#[derive(Debug, PartialEq)]
+pub struct RemovePlan {
+    /// PATH entries before the removal
+    pub current: Vec<PathBuf>,
+    /// PATH entries after the removal
+    pub entries: Vec<PathBuf>,
+    /// Entries removed, with their index in `current`
+    pub removed: Vec<(usize, PathBuf)>,
+    /// Matching entries left alone because pathmaster did not add them
+    pub not_mine: Vec<PathBuf>,
+}
+
+/// Works out the PATH that removing the selected entries produces
+///
+/// # Arguments
+///
+/// * `current` - PATH entries before the removal
+/// * `indexes` - Indexes of the matching entries, as from `select_removals`
+/// * `removable` - Whether a matching entry may be removed; with --mine-only,
+///                 whether pathmaster added it
+pub fn plan_removal(
+    current: Vec<PathBuf>,
+    indexes: &[usize],
+    removable: impl Fn(&Path) -> bool,
+) -> RemovePlan {
+    let mut removed: Vec<(usize, PathBuf)> = Vec::new();
+    let mut not_mine: Vec<PathBuf> = Vec::new();
+    for &index in indexes {
+        let entry = &current[index];
+        if removable(entry) {
+            removed.push((index, entry.clone()));
+        } else {
+            not_mine.push(entry.clone());
+        }
+    }
+
+    let entries = current
+        .iter()
+        .enumerate()
+        .filter(|(index, _)| !removed.iter().any(|(removed, _)| removed == index))
+        .map(|(_, entry)| entry.clone())
+        .collect();
+    RemovePlan {
+        current,
+        entries,
+        removed,
+        not_mine,
+    }
+}
 
 /// Executes the delete command to remove directories from PATH
 ///
+/// Exits with a non-zero status if none of the directories match, and with
+/// status 2 if a pattern is malformed or the list file cannot be read.
+///
 /// # Arguments
 ///
 /// * `directories` - A slice of strings containing directories to remove
+/// * `globs` - Also remove every entry matching one of these patterns
+/// * `from_file` - Also remove the directories listed in this file, one per
+///                 line, or stdin for `-`
+/// * `contains` - Remove every entry containing one of the given substrings
+/// * `resolve_symlinks` - Also remove entries that are symlinks to the given directories
+/// * `occurrence` - Which of several entries matching a directory to remove
+/// * `mine_only` - Only remove entries that pathmaster added
+/// * `system` - Edit the machine-wide PATH instead of the user PATH (Windows only)
+/// * `dry_run` - Preview the changes without writing anything
 ///
 /// # Example
 ///
-/// ```
+/// ```no_run
+/// # use pathmaster::commands;
 /// let dirs = vec![String::from("~/old/bin")];
-/// commands::delete::execute(&dirs);
+/// let globs = vec![String::from("/opt/*/bin")];
+/// let occurrence = commands::delete::Occurrence::All;
+/// commands::delete::execute(&dirs, &globs, None, false, false, occurrence, false, false, false);
 /// ```
-pub fn execute(directories: &[String]) {
-    // Backup current PATH
-    if let Err(e) = backup::create_backup() {
-        eprintln!("Error creating backup: {}", e);
-        return;
+#[allow(clippy::too_many_arguments)]
+pub fn execute(
+    directories: &[String],
+    globs: &[String],
+    from_file: Option<&Path>,
+    contains: bool,
+    resolve_symlinks: bool,
+    occurrence: Occurrence,
+    mine_only: bool,
+    system: bool,
+    dry_run: bool,
+) {
+    let mut directories = directories.to_vec();
+    if let Some(file) = from_file {
+        match read_directory_list(file) {
+            Ok(listed) => directories.extend(listed.into_iter().map(|(_, dir)| dir)),
+            Err(e) => {
+                eprintln!("Error reading {}: {}", file.display(), e);
+                process::exit(2);
+            }
+        }
     }
 
-    // Get current PATH
-    let mut path_entries = utils::get_path_entries();
+    let options = crate::RemoveOptions {
+        contains,
+        resolve_symlinks,
+        occurrence,
+        mine_only,
+        system,
+    };
+    let plan = match crate::plan_remove(&directories, globs, &options) {
+        Ok(plan) => plan,
+        Err(e) => {
+            eprintln!("{}", e);
+            // A malformed pattern is a usage error
+            if e.kind() == io::ErrorKind::InvalidInput {
+                process::exit(2);
+            }
+            process::exit(1);
+        }
+    };
 
-    // Remove the directories
-    let original_len = path_entries.len();
-    for directory in directories {
-        let dir_path = utils::expand_path(directory);
-        path_entries.retain(|p| p != &dir_path);
+    for entry in &plan.not_mine {
+        status!(
+            "Leaving '{}' alone; it was not added by pathmaster.",
+            entry.display()
+        );
+    }
+    if plan.removed.is_empty() {
+        if plan.not_mine.is_empty() {
+            eprintln!("None of the directories were found in PATH.");
+        } else {
+            eprintln!("None of the matching entries were added by pathmaster.");
+        }
+        process::exit(1);
     }
 
-    if path_entries.len() == original_len {
-        println!("None of the directories were found in PATH.");
+    if dry_run {
+        preview::show_preview(&plan.current, &plan.entries);
         return;
     }
 
-    // Update PATH
-    utils::set_path_entries(&path_entries);
+    // Back up PATH, then update it and the shell configuration
+    match crate::apply(&plan.entries, system) {
+        Ok(Some(backup_file)) => status!("Created PATH backup at: {}", backup_file.display()),
+        Ok(None) => {}
+        Err(e) => {
+            eprintln!("{}", e);
+            process::exit(1);
+        }
+    }
 
-    // Make persistent changes (update shell config)
-    if let Err(e) = utils::update_shell_config(&path_entries) {
-        eprintln!("Error updating shell configuration: {}", e);
-        return;
+    for (index, entry) in &plan.removed {
+        if occurrence == Occurrence::All {
+            status!("Removing '{}' from PATH.", entry.display());
+        } else {
+            status!(
+                "Removing '{}' at position {} from PATH.",
+                entry.display(),
+                index + 1
+            );
+        }
     }
 
-    println!("Successfully removed directories from PATH.");
+    status!(
+        "Successfully removed {} entry(ies) from PATH.",
+        plan.removed.len()
+    );
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_exact_match() {
+        let entry = Path::new("/opt/tool/bin");
+        assert!(matches_entry(entry, "/opt/tool/bin", false, false));
+        assert!(matches_entry(entry, "/opt/tool/bin/", false, false));
+        assert!(!matches_entry(entry, "/opt/tool", false, false));
+    }
+
+    #[test]
+    fn test_exact_match_expands_tilde() {
+        let home = dirs_next::home_dir().unwrap();
+        assert!(matches_entry(&home.join("bin"), "~/bin", false, false));
+    }
+
+    #[test]
+    fn test_contains_match() {
+        assert!(matches_entry(
+            Path::new("/opt/tool/bin"),
+            "tool",
+            true,
+            false
+        ));
+        assert!(!matches_entry(Path::new("/usr/bin"), "tool", true, false));
+    }
+
+    #[cfg(unix)]
+    #[test]
+    fn test_select_removals() {
+        let entries: Vec<PathBuf> = [
+            "/opt/bin",
+            "/usr/bin",
+            "/opt/bin",
+            "/opt/go/bin",
+            "/opt/bin",
+        ]
+        .iter()
+        .map(PathBuf::from)
+        .collect();
+        let dirs = vec!["/opt/bin".to_string()];
+        let select = |globs: &[String], occurrence| {
+            select_removals(&entries, &dirs, globs, false, false, occurrence)
+        };
+
+        assert_eq!(select(&[], Occurrence::All), vec![0, 2, 4]);
+        assert_eq!(select(&[], Occurrence::First), vec![0]);
+        assert_eq!(select(&[], Occurrence::Last), vec![4]);
+
+        // Each pattern picks its own match
+        let globs = vec!["/opt/*/bin".to_string()];
+        assert_eq!(select(&globs, Occurrence::First), vec![0, 3]);
+        assert_eq!(select(&globs, Occurrence::Last), vec![3, 4]);
+    }
+
+    #[test]
+    fn test_plan_removal() {
+        let path = |name: &str| PathBuf::from(format!("/opt/{}", name));
+        let current = vec![path("a"), path("mine"), path("b"), path("theirs")];
+
+        let plan = plan_removal(current.clone(), &[1, 3], |entry| entry != path("theirs"));
+        assert_eq!(plan.current, current);
+        assert_eq!(plan.entries, [path("a"), path("b"), path("theirs")]);
+        assert_eq!(plan.removed, [(1, path("mine"))]);
+        assert_eq!(plan.not_mine, [path("theirs")]);
+    }
 }
@@ -0,0 +1,273 @@
+//! Command implementation for comparing PATH against a backup.
+//!
+//! This module provides functionality to:
+//! - Compute the entries added, removed and moved between two PATHs
+//! - Display the changes with unified-diff-like `+`/`-` markers
+//! - Exit non-zero when there are differences, for use in scripts
+
+use crate::backup::core::{list_backups, load_backup, StoredBackup};
+use crate::backup::restore::get_latest_backup;
+use crate::status;
+use crate::utils;
+use std::path::{Path, PathBuf};
+use std::process;
+
+/// A single line of a diff
+///
+/// Used for PATH entries by default, and for config-file lines when previewing changes.
+#[derive(Debug, Clone, PartialEq)]
+pub enum DiffLine<T = PathBuf> {
+    /// Item present on both sides at a consistent position
+    Unchanged(T),
+    /// Item only present on the new side
+    Added(T),
+    /// Item only present on the old side
+    Removed(T),
+    /// Item present on both sides but at a different relative position
+    ///
+    /// Positions are 1-based indices into the old and new lists.
+    Moved { entry: T, from: usize, to: usize },
+}
+
+impl<T> DiffLine<T> {
+    /// Returns whether this line represents a change
+    ///
+    /// # Arguments
+    ///
+    /// * `reorder` - Whether moved entries count as changes
+    pub fn is_change(&self, reorder: bool) -> bool {
+        match self {
+            DiffLine::Unchanged(_) => false,
+            DiffLine::Moved { .. } => reorder,
+            DiffLine::Added(_) | DiffLine::Removed(_) => true,
+        }
+    }
+}
+
+/// Aligns two lists using their longest common subsequence
+///
+/// The result only contains `Unchanged`, `Added` and `Removed` lines, in
+/// the order of a unified diff.
+///
+/// # Arguments
+///
+/// * `old` - The earlier list
+/// * `new` - The later list
+pub fn align<T: Clone + PartialEq>(old: &[T], new: &[T]) -> Vec<DiffLine<T>> {
+    // lcs[i][j] is the length of the longest common subsequence of old[i..] and new[j..]
+    let mut lcs = vec![vec![0usize; new.len() + 1]; old.len() + 1];
+    for i in (0..old.len()).rev() {
+        for j in (0..new.len()).rev() {
+            lcs[i][j] = if old[i] == new[j] {
+                lcs[i + 1][j + 1] + 1
+            } else {
+                lcs[i + 1][j].max(lcs[i][j + 1])
+            };
+        }
+    }
+
+    let mut lines = Vec::new();
+    let (mut i, mut j) = (0, 0);
+    while i < old.len() || j < new.len() {
+        if i < old.len() && j < new.len() && old[i] == new[j] {
+            lines.push(DiffLine::Unchanged(new[j].clone()));
+            i += 1;
+            j += 1;
+        } else if i < old.len() && (j == new.len() || lcs[i + 1][j] >= lcs[i][j + 1]) {
+            lines.push(DiffLine::Removed(old[i].clone()));
+            i += 1;
+        } else {
+            lines.push(DiffLine::Added(new[j].clone()));
+            j += 1;
+        }
+    }
+
+    lines
+}
+
+/// Computes the differences between two lists of PATH entries
+///
+/// Entries are aligned using their longest common subsequence, so the
+/// result reads like a unified diff. An entry removed from one position and
+/// added at another is reported once as `Moved`, at its new position.
+///
+/// # Arguments
+///
+/// * `old` - The earlier PATH entries (e.g. from a backup)
+/// * `new` - The later PATH entries (e.g. the live PATH)
+pub fn diff_entries(old: &[PathBuf], new: &[PathBuf]) -> Vec<DiffLine> {
+    // Number each line with its 1-based position on the side it belongs to
+    let (mut i, mut j) = (0, 0);
+    let mut lines: Vec<(DiffLine, usize)> = align(old, new)
+        .into_iter()
+        .map(|line| match line {
+            DiffLine::Removed(_) => {
+                i += 1;
+                (line, i)
+            }
+            DiffLine::Added(_) => {
+                j += 1;
+                (line, j)
+            }
+            _ => {
+                i += 1;
+                j += 1;
+                (line, j)
+            }
+        })
+        .collect();
+
+    // Turn each addition that has a matching removal into a move
+    let mut dropped = vec![false; lines.len()];
+    for pos in 0..lines.len() {
+        let entry = match &lines[pos].0 {
+            DiffLine::Added(entry) => entry.clone(),
+            _ => continue,
+        };
+        let removal = lines.iter().enumerate().position(|(other, (line, _))| {
+            !dropped[other] && matches!(line, DiffLine::Removed(removed) if *removed == entry)
+        });
+        if let Some(other) = removal {
+            dropped[other] = true;
+            let (from, to) = (lines[other].1, lines[pos].1);
+            lines[pos].0 = DiffLine::Moved { entry, from, to };
+        }
+    }
+
+    lines
+        .into_iter()
+        .zip(dropped)
+        .filter(|(_, dropped)| !dropped)
+        .map(|((line, _), _)| line)
+        .collect()
+}
+
+/// Formats a diff line with its unified-diff marker
+///
+/// # Arguments
+///
+/// * `line` - The diff line to format
+/// * `reorder` - Whether to mark moved entries; otherwise they are shown as unchanged
+pub fn format_line(line: &DiffLine, reorder: bool) -> String {
+    match line {
+        DiffLine::Unchanged(entry) => format!("  {}", entry.display()),
+        DiffLine::Added(entry) => format!("+ {}", entry.display()),
+        DiffLine::Removed(entry) => format!("- {}", entry.display()),
+        DiffLine::Moved { entry, from, to } if reorder => {
+            format!("~ {} (moved from {} to {})", entry.display(), from, to)
+        }
+        DiffLine::Moved { entry, .. } => format!("  {}", entry.display()),
+    }
+}
+
+/// Loads the backup to compare against
+///
+/// # Arguments
+///
+/// * `file` - Backup file to load, or None for the most recent backup
+fn load_target(file: Option<&Path>) -> Result<StoredBackup, String> {
+    match file {
+        Some(file) => load_backup(file).map_err(|e| format!("Error reading backup: {}", e)),
+        None => {
+            let (backups, _) =
+                list_backups().map_err(|e| format!("Error reading backups: {}", e))?;
+            get_latest_backup(backups).ok_or_else(|| String::from("No backups found."))
+        }
+    }
+}
+
+/// Executes the diff command to compare the live PATH against a backup
+///
+/// Exits with status 1 if there are differences and 2 if the backup
+/// cannot be loaded.
+///
+/// # Arguments
+///
+/// * `file` - Backup file to compare against, or None for the most recent backup
+/// * `reorder` - Also report entries whose position changed
+///
+/// # Example
+///
+/// ```no_run
+/// # use pathmaster::commands;
+/// commands::diff::execute(None, true);
+/// ```
+pub fn execute(file: Option<&Path>, reorder: bool) {
+    let stored = match load_target(file) {
+        Ok(stored) => stored,
+        Err(message) => {
+            eprintln!("{}", message);
+            process::exit(2);
+        }
+    };
+
+    let lines = diff_entries(&stored.backup.entries(), &utils::get_path_entries());
+    let changes = lines.iter().filter(|line| line.is_change(reorder)).count();
+
+    println!(
+        "--- {} ({})",
+        stored.file.display(),
+        stored.backup.timestamp
+    );
+    println!("+++ current PATH");
+    for line in &lines {
+        println!("{}", format_line(line, reorder));
+    }
+
+    if changes > 0 {
+        status!("\n{} change(s) found.", changes);
+        process::exit(1);
+    }
+
+    status!("\nNo differences found.");
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn paths(entries: &[&str]) -> Vec<PathBuf> {
+        entries.iter().map(PathBuf::from).collect()
+    }
+
+    #[test]
+    fn test_identical_entries() {
+        let entries = paths(&["/usr/bin", "/bin"]);
+        let lines = diff_entries(&entries, &entries);
+        assert!(lines.iter().all(|line| !line.is_change(true)));
+        assert_eq!(lines.len(), 2);
+    }
+
+    #[test]
+    fn test_added_and_removed() {
+        let old = paths(&["/usr/bin", "/opt/old", "/bin"]);
+        let new = paths(&["/usr/bin", "/bin", "/opt/new"]);
+        assert_eq!(
+            diff_entries(&old, &new),
+            vec![
+                DiffLine::Unchanged(PathBuf::from("/usr/bin")),
+                DiffLine::Removed(PathBuf::from("/opt/old")),
+                DiffLine::Unchanged(PathBuf::from("/bin")),
+                DiffLine::Added(PathBuf::from("/opt/new")),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_moved_entry() {
+        let old = paths(&["/usr/bin", "/bin", "/usr/local/bin"]);
+        let new = paths(&["/usr/local/bin", "/usr/bin", "/bin"]);
+        let lines = diff_entries(&old, &new);
+        assert_eq!(
+            lines[0],
+            DiffLine::Moved {
+                entry: PathBuf::from("/usr/local/bin"),
+                from: 3,
+                to: 1,
+            }
+        );
+        assert_eq!(lines.len(), 3);
+        assert_eq!(lines.iter().filter(|l| l.is_change(false)).count(), 0);
+        assert_eq!(lines.iter().filter(|l| l.is_change(true)).count(), 1);
+    }
+}
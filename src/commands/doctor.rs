@@ -0,0 +1,457 @@
+//! Command implementation for diagnosing pathmaster's environment.
+//!
+//! This module provides functionality to:
+//! - Check that the shell can be detected
+//! - Locate the shell configuration file and test that it can be written,
+//!   without changing it
+//! - Test that the backup directory can be written
+//! - Look for invalid PATH entries and ones that are a security risk
+//! - Print a pass/warn/fail report with a hint for each problem
+//! - Exit non-zero when any check fails, for use in scripts and CI
+//!
+//! Each check exercises the same code the other commands rely on, so a clean
+//! report means a change made with pathmaster can be saved and backed up.
+
+use crate::backup;
+#[cfg(unix)]
+use crate::commands::audit::{self, Identity, Severity};
+use crate::commands::check::{self, CheckReport};
+use crate::commands::validator::ValidityCache;
+use crate::status;
+use crate::utils::output::{paint, Color};
+use crate::utils::shell::factory;
+use crate::utils::shell::types::ShellType;
+use std::env;
+use std::fmt;
+use std::fs::{self, OpenOptions};
+use std::io;
+use std::path::{Path, PathBuf};
+use std::process;
+
+/// The result of a single check
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum Outcome {
+    /// Nothing to do
+    Pass,
+    /// Works, but deserves a look
+    Warn,
+    /// Stops pathmaster from working properly
+    Fail,
+}
+
+impl fmt::Display for Outcome {
+    fn fmt(&self, f: &mut fmt::Formatter) -> fmt::Result {
+        let label = match self {
+            Outcome::Pass => "PASS",
+            Outcome::Warn => "WARN",
+            Outcome::Fail => "FAIL",
+        };
+        f.pad(label)
+    }
+}
+
+impl Outcome {
+    /// Returns the color the outcome is shown in
+    fn color(&self) -> Color {
+        match self {
+            Outcome::Pass => Color::Green,
+            Outcome::Warn => Color::Yellow,
+            Outcome::Fail => Color::Red,
+        }
+    }
+}
+
+/// A finding of the doctor command
+#[derive(Debug, Clone, PartialEq)]
+pub struct Diagnostic {
+    /// What was checked
+    pub name: &'static str,
+    /// How it went
+    pub outcome: Outcome,
+    /// What was found
+    pub detail: String,
+    /// How to fix a warning or failure
+    pub hint: Option<String>,
+}
+
+impl Diagnostic {
+    fn new(name: &'static str, outcome: Outcome, detail: String) -> Self {
+        Self {
+            name,
+            outcome,
+            detail,
+            hint: None,
+        }
+    }
+
+    fn hint(mut self, hint: &str) -> Self {
+        self.hint = Some(hint.to_string());
+        self
+    }
+}
+
+/// Returns the closest ancestor of `path`, itself included, that exists
+fn existing_ancestor(path: &Path) -> Option<&Path> {
+    path.ancestors()
+        .find(|ancestor| !ancestor.as_os_str().is_empty() && ancestor.exists())
+}
+
+/// Tests whether files can be created in a directory
+///
+/// Creates an empty file with a name no other program uses and removes it
+/// again.
+pub fn probe_directory(dir: &Path) -> io::Result<()> {
+    let probe = dir.join(format!(".pathmaster-doctor-{}", process::id()));
+    OpenOptions::new()
+        .write(true)
+        .create_new(true)
+        .open(&probe)?;
+    fs::remove_file(&probe)
+}
+
+/// Checks that the shell was recognized
+///
+/// # Arguments
+/// * `shell` - The shell pathmaster works with
+/// * `overridden` - Whether it was set with `--shell` or the config file
+pub fn diagnose_shell(shell: &ShellType, overridden: bool) -> Diagnostic {
+    const NAME: &str = "Shell";
+    match (shell, overridden) {
+        (ShellType::Generic, false) => Diagnostic::new(
+            NAME,
+            Outcome::Warn,
+            "no known shell found in SHELL or the process tree; using ~/.profile".to_string(),
+        )
+        .hint("Set SHELL, or pass --shell or set `shell` in ~/.pathmaster/config.toml"),
+        (shell, true) => Diagnostic::new(NAME, Outcome::Pass, format!("{} (configured)", shell)),
+        (shell, false) => Diagnostic::new(NAME, Outcome::Pass, format!("{} (detected)", shell)),
+    }
+}
+
+/// Checks that the shell configuration file can be written
+///
+/// An existing file is opened for appending without writing anything, so its
+/// contents and modification time are left alone. A missing file only needs
+/// a directory it can be created in.
+pub fn diagnose_config(config: &Path) -> Diagnostic {
+    const NAME: &str = "Shell config";
+    if config.is_file() {
+        return match OpenOptions::new().append(true).open(config) {
+            Ok(_) => Diagnostic::new(
+                NAME,
+                Outcome::Pass,
+                format!("{} is writable", config.display()),
+            ),
+            Err(e) => Diagnostic::new(
+                NAME,
+                Outcome::Fail,
+                format!("{} cannot be written: {}", config.display(), e),
+            )
+            .hint("Fix the file's ownership or permissions so PATH changes can be saved"),
+        };
+    }
+    if config.exists() {
+        return Diagnostic::new(
+            NAME,
+            Outcome::Fail,
+            format!("{} is not a regular file", config.display()),
+        )
+        .hint("Move it aside, or pass --shell to use another shell's configuration");
+    }
+
+    match existing_ancestor(config).map(probe_directory) {
+        Some(Ok(())) => Diagnostic::new(
+            NAME,
+            Outcome::Warn,
+            format!(
+                "{} does not exist; it is created on the first change",
+                config.display()
+            ),
+        )
+        .hint("Check that this is the file your shell reads at startup, or pass --shell"),
+        Some(Err(e)) => Diagnostic::new(
+            NAME,
+            Outcome::Fail,
+            format!(
+                "{} does not exist and cannot be created: {}",
+                config.display(),
+                e
+            ),
+        )
+        .hint("Create the file, or fix the permissions of its directory"),
+        None => Diagnostic::new(
+            NAME,
+            Outcome::Fail,
+            format!("{} cannot be created", config.display()),
+        )
+        .hint("Check that HOME points at your home directory"),
+    }
+}
+
+/// Checks that backups can be written to a directory
+///
+/// A missing directory passes when it can be created, as it is on the first
+/// backup.
+pub fn diagnose_backup_dir(dir: &Path) -> Diagnostic {
+    const NAME: &str = "Backup directory";
+    if dir.exists() && !dir.is_dir() {
+        return Diagnostic::new(
+            NAME,
+            Outcome::Fail,
+            format!("{} is not a directory", dir.display()),
+        )
+        .hint("Move it aside, or choose another directory with --backup-dir");
+    }
+
+    let created = !dir.exists();
+    match existing_ancestor(dir).map(probe_directory) {
+        Some(Ok(())) if created => Diagnostic::new(
+            NAME,
+            Outcome::Pass,
+            format!("{} is created on the first backup", dir.display()),
+        ),
+        Some(Ok(())) => Diagnostic::new(
+            NAME,
+            Outcome::Pass,
+            format!("{} is writable", dir.display()),
+        ),
+        Some(Err(e)) => Diagnostic::new(
+            NAME,
+            Outcome::Fail,
+            format!("{} cannot be written: {}", dir.display(), e),
+        )
+        .hint("Fix its permissions, or choose another directory with --backup-dir"),
+        None => Diagnostic::new(
+            NAME,
+            Outcome::Fail,
+            format!("{} cannot be created", dir.display()),
+        )
+        .hint("Choose another directory with --backup-dir"),
+    }
+}
+
+/// Checks PATH for entries that do not work
+///
+/// Entries that cannot be found are only a warning, as lookups skip them.
+/// Empty and relative entries fail, as they make the shell search the
+/// current directory.
+pub fn diagnose_entries(report: &CheckReport) -> Diagnostic {
+    const NAME: &str = "PATH entries";
+    let unsafe_entries = report.empty.len() + report.relative.len();
+    if unsafe_entries > 0 {
+        return Diagnostic::new(
+            NAME,
+            Outcome::Fail,
+            format!(
+                "{} empty or relative entr{}, which search the current directory",
+                unsafe_entries,
+                if unsafe_entries == 1 { "y" } else { "ies" }
+            ),
+        )
+        .hint("Run `pathmaster check` to list them and `pathmaster delete` to remove them");
+    }
+
+    if report.is_healthy() {
+        return Diagnostic::new(NAME, Outcome::Pass, "all entries are valid".to_string());
+    }
+    Diagnostic::new(
+        NAME,
+        Outcome::Warn,
+        format!("{} problem(s) found", report.problem_count()),
+    )
+    .hint("Run `pathmaster check` for details, or `pathmaster clean` to fix the common ones")
+}
+
+/// Checks PATH for directories other users can write to
+#[cfg(unix)]
+fn diagnose_permissions(entries: &[PathBuf]) -> Diagnostic {
+    const NAME: &str = "PATH permissions";
+    let findings = match audit::audit_entries(entries, Identity::current()) {
+        Ok(findings) => findings,
+        Err(e) => return Diagnostic::new(NAME, Outcome::Warn, format!("cannot be audited: {}", e)),
+    };
+
+    let outcome = match findings.iter().map(|finding| finding.severity).min() {
+        None => {
+            return Diagnostic::new(
+                NAME,
+                Outcome::Pass,
+                "no directory is writable by other users".to_string(),
+            )
+        }
+        Some(Severity::High) => Outcome::Fail,
+        Some(_) => Outcome::Warn,
+    };
+    Diagnostic::new(
+        NAME,
+        outcome,
+        format!(
+            "{} director{} other users can write programs into",
+            findings.len(),
+            if findings.len() == 1 { "y" } else { "ies" }
+        ),
+    )
+    .hint("Run `pathmaster audit` for details, then tighten the permissions or remove them")
+}
+
+/// Runs every check, in the order they are reported
+pub fn run_diagnostics() -> Vec<Diagnostic> {
+    let overridden = matches!(factory::get_shell_override(), Ok(Some(_)));
+    let shell = factory::resolved_shell_type();
+    let handler = factory::get_handler_for(&shell);
+
+    let mut diagnostics = vec![
+        diagnose_shell(&shell, overridden),
+        diagnose_config(&handler.target_config_path()),
+    ];
+
+    diagnostics.push(match backup::core::get_backup_dir() {
+        Ok(dir) => diagnose_backup_dir(&dir),
+        Err(e) => Diagnostic::new("Backup directory", Outcome::Fail, e.to_string()),
+    });
+
+    let path_var = env::var_os("PATH").unwrap_or_default();
+    let mut cache = ValidityCache::new();
+    diagnostics.push(diagnose_entries(&check::check_path_value(
+        &path_var, &mut cache,
+    )));
+
+    #[cfg(unix)]
+    diagnostics.push(diagnose_permissions(&crate::utils::parse_path_entries(
+        &path_var,
+    )));
+
+    diagnostics
+}
+
+/// Executes the doctor command
+///
+/// Prints one line per check, with a hint under each warning and failure,
+/// and exits with status 1 if any check fails.
+///
+/// # Example
+///
+/// ```no_run
+/// # use pathmaster::commands;
+/// commands::doctor::execute();
+/// // Output example:
+/// // [PASS] Shell: bash (detected)
+/// // [PASS] Shell config: /home/me/.bashrc is writable
+/// // [PASS] Backup directory: /home/me/.local/share/pathmaster/backups is writable
+/// // [WARN] PATH entries: 2 problem(s) found
+/// //        hint: Run `pathmaster check` for details, or `pathmaster clean` to fix the common ones
+/// // [PASS] PATH permissions: no directory is writable by other users
+/// ```
+pub fn execute() {
+    let diagnostics = run_diagnostics();
+
+    for diagnostic in &diagnostics {
+        println!(
+            "[{}] {}: {}",
+            paint(&diagnostic.outcome.to_string(), diagnostic.outcome.color()),
+            diagnostic.name,
+            diagnostic.detail
+        );
+        if let Some(hint) = &diagnostic.hint {
+            println!("       hint: {}", hint);
+        }
+    }
+
+    let count = |outcome| {
+        diagnostics
+            .iter()
+            .filter(|diagnostic| diagnostic.outcome == outcome)
+            .count()
+    };
+    let failed = count(Outcome::Fail);
+    status!(
+        "\n{} passed, {} warning(s), {} failed",
+        count(Outcome::Pass),
+        count(Outcome::Warn),
+        failed
+    );
+
+    if failed > 0 {
+        process::exit(1);
+    }
+}
+
+#[cfg(all(test, unix))]
+mod tests {
+    use super::*;
+    use std::os::unix::fs::PermissionsExt;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_diagnose_shell() {
+        assert_eq!(
+            diagnose_shell(&ShellType::Bash, false).outcome,
+            Outcome::Pass
+        );
+        assert_eq!(
+            diagnose_shell(&ShellType::Generic, true).outcome,
+            Outcome::Pass
+        );
+
+        let generic = diagnose_shell(&ShellType::Generic, false);
+        assert_eq!(generic.outcome, Outcome::Warn);
+        assert!(generic.hint.is_some());
+    }
+
+    #[test]
+    fn test_diagnose_config_leaves_file_alone() -> io::Result<()> {
+        let temp_dir = TempDir::new()?;
+        let config = temp_dir.path().join(".bashrc");
+        fs::write(&config, "export PATH=/usr/bin\n")?;
+        let modified = fs::metadata(&config)?.modified()?;
+
+        assert_eq!(diagnose_config(&config).outcome, Outcome::Pass);
+        assert_eq!(fs::read_to_string(&config)?, "export PATH=/usr/bin\n");
+        assert_eq!(fs::metadata(&config)?.modified()?, modified);
+
+        let missing = temp_dir.path().join(".zshrc");
+        assert_eq!(diagnose_config(&missing).outcome, Outcome::Warn);
+        assert!(!missing.exists());
+        assert_eq!(fs::read_dir(temp_dir.path())?.count(), 1);
+        Ok(())
+    }
+
+    #[test]
+    fn test_diagnose_backup_dir() -> io::Result<()> {
+        let temp_dir = TempDir::new()?;
+        let dir = temp_dir.path().join("backups");
+        assert_eq!(diagnose_backup_dir(&dir).outcome, Outcome::Pass);
+        assert!(!dir.exists());
+
+        fs::write(&dir, "")?;
+        assert_eq!(diagnose_backup_dir(&dir).outcome, Outcome::Fail);
+        fs::remove_file(&dir)?;
+
+        // Root can write anywhere, so the failure cannot be provoked
+        fs::create_dir(&dir)?;
+        fs::set_permissions(&dir, fs::Permissions::from_mode(0o555))?;
+        let writable = probe_directory(&dir).is_ok();
+        let diagnostic = diagnose_backup_dir(&dir);
+        fs::set_permissions(&dir, fs::Permissions::from_mode(0o755))?;
+        if !writable {
+            assert_eq!(diagnostic.outcome, Outcome::Fail);
+            assert!(diagnostic.hint.is_some());
+        }
+        assert_eq!(fs::read_dir(&dir)?.count(), 0);
+        Ok(())
+    }
+
+    #[test]
+    fn test_diagnose_entries() {
+        let mut report = CheckReport::default();
+        assert_eq!(diagnose_entries(&report).outcome, Outcome::Pass);
+
+        report.missing.push(PathBuf::from("/nonexistent"));
+        assert_eq!(diagnose_entries(&report).outcome, Outcome::Warn);
+
+        report.relative.push(PathBuf::from("bin"));
+        let diagnostic = diagnose_entries(&report);
+        assert_eq!(diagnostic.outcome, Outcome::Fail);
+        assert!(diagnostic.detail.starts_with("1 empty or relative entry"));
+    }
+}
@@ -0,0 +1,128 @@
+//! Command implementation for editing the shell config by hand.
+//!
+//! This module provides functionality to:
+//! - Open the shell config file that declares PATH in the user's editor
+//! - Wait for the editor to exit
+//! - Check the PATH the edited file declares and warn about any problems
+
+use crate::commands::check;
+use crate::commands::watch::check_config;
+use crate::status;
+use crate::utils::shell::factory::get_shell_handler;
+use std::env;
+use std::fs;
+use std::io;
+use std::path::Path;
+use std::process::{self, Command};
+
+/// Editor used when neither VISUAL nor EDITOR is set
+#[cfg(unix)]
+const FALLBACK_EDITOR: &str = "vi";
+#[cfg(not(unix))]
+const FALLBACK_EDITOR: &str = "notepad";
+
+/// Chooses the editor command from the VISUAL and EDITOR values
+///
+/// VISUAL is preferred, as it names a full-screen editor. The value may
+/// include arguments, such as `code --wait`.
+///
+/// # Returns
+/// The program followed by its arguments
+pub fn editor_command(visual: Option<String>, editor: Option<String>) -> Vec<String> {
+    [visual, editor]
+        .into_iter()
+        .flatten()
+        .map(|value| {
+            value
+                .split_whitespace()
+                .map(String::from)
+                .collect::<Vec<_>>()
+        })
+        .find(|words| !words.is_empty())
+        .unwrap_or_else(|| vec![FALLBACK_EDITOR.to_string()])
+}
+
+/// Opens a file in the editor and waits for it to exit
+fn run_editor(file: &Path) -> io::Result<()> {
+    let command = editor_command(env::var("VISUAL").ok(), env::var("EDITOR").ok());
+    let status = Command::new(&command[0])
+        .args(&command[1..])
+        .arg(file)
+        .status()
+        .map_err(|e| io::Error::new(e.kind(), format!("Cannot run {}: {}", command[0], e)))?;
+
+    if !status.success() {
+        return Err(io::Error::new(
+            io::ErrorKind::Other,
+            format!("{} exited with {}", command[0], status),
+        ));
+    }
+    Ok(())
+}
+
+/// Executes the edit command
+///
+/// Opens the config file that declares PATH (the one other commands would
+/// edit) in `$VISUAL` or `$EDITOR`, then checks the PATH it declares.
+///
+/// # Example
+///
+/// ```no_run
+/// # use pathmaster::commands;
+/// commands::edit::execute();
+/// ```
+pub fn execute() {
+    let handler = get_shell_handler();
+    let config = handler.target_config_path();
+    let before = fs::read_to_string(&config).ok();
+
+    status!("Opening {}", config.display());
+    if let Err(e) = run_editor(&config) {
+        eprintln!("Error editing {}: {}", config.display(), e);
+        process::exit(1);
+    }
+
+    if fs::read_to_string(&config).ok() == before {
+        status!("No changes made to {}", config.display());
+        return;
+    }
+
+    match check_config(handler.as_ref(), &config) {
+        Ok(Some(report)) if report.is_healthy() => {
+            status!(
+                "All directories in the PATH set by {} are valid",
+                config.display()
+            );
+        }
+        Ok(Some(report)) => {
+            eprintln!(
+                "Warning: the PATH set by {} has problems after your edit.",
+                config.display()
+            );
+            check::print_report(&report);
+        }
+        Ok(None) => status!("{} was removed", config.display()),
+        Err(e) => {
+            eprintln!("Error checking {}: {}", config.display(), e);
+            process::exit(1);
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_editor_command() {
+        let some = |value: &str| Some(value.to_string());
+
+        assert_eq!(
+            editor_command(some("code --wait"), some("vim")),
+            ["code", "--wait"]
+        );
+        assert_eq!(editor_command(None, some("nano")), ["nano"]);
+        assert_eq!(editor_command(some("  "), some("nano")), ["nano"]);
+        assert_eq!(editor_command(None, None), [FALLBACK_EDITOR]);
+    }
+}
@@ -0,0 +1,288 @@
+//! Command implementation for explaining a single PATH entry.
+//!
+//! This module provides functionality to:
+//! - Find where a directory appears in PATH, under any spelling
+//! - Report whether it is valid
+//! - Show its permissions and ownership, with any audit findings
+//! - Count the commands it provides, and list those that shadow or are
+//!   shadowed by copies elsewhere in PATH
+//!
+//! Nothing is changed; this gathers what `check`, `audit` and `which` say
+//! about one directory.
+
+use crate::commands::audit::Finding;
+#[cfg(unix)]
+use crate::commands::audit::{self, Identity};
+use crate::commands::validator::EntryKind;
+use crate::commands::which::{self, Shadow};
+use crate::status;
+use crate::utils;
+use crate::utils::path::comparison_key;
+use std::fs;
+use std::path::{Path, PathBuf};
+use std::process;
+
+/// Everything known about one directory in PATH
+#[derive(Debug, PartialEq)]
+pub struct Explanation {
+    /// The directory asked about
+    pub entry: PathBuf,
+    /// Where it appears in PATH, counting from 1, as each occurrence is
+    /// spelled; empty if it is not in PATH
+    pub occurrences: Vec<(usize, PathBuf)>,
+    /// What is at the path
+    pub kind: EntryKind,
+    /// Permission problems, as `pathmaster audit` reports them
+    pub findings: Vec<Finding>,
+    /// Number of commands the directory provides
+    pub commands: usize,
+    /// Commands it provides that hide copies later in PATH
+    pub shadowing: Vec<Shadow>,
+    /// Commands it provides that copies earlier in PATH hide
+    pub shadowed: Vec<Shadow>,
+}
+
+/// Counts the commands a directory provides
+fn count_commands(dir: &Path) -> usize {
+    fs::read_dir(dir)
+        .map(|listing| {
+            listing
+                .flatten()
+                .filter(|file| which::command_name(&file.path()).is_some())
+                .count()
+        })
+        .unwrap_or(0)
+}
+
+/// Gathers everything known about one directory in PATH
+///
+/// Entries are matched after expansion, normalization and symlink
+/// resolution, so `/usr/local/bin/` and a symlink to it count as the same
+/// directory. Every directory in PATH is listed to find shadowed commands.
+///
+/// # Arguments
+///
+/// * `entry` - The directory to explain
+/// * `entries` - PATH entries in priority order
+pub fn explain(entry: &Path, entries: &[PathBuf]) -> Explanation {
+    let key = comparison_key(entry, true);
+    let occurrences: Vec<(usize, PathBuf)> = entries
+        .iter()
+        .enumerate()
+        .filter(|(_, candidate)| {
+            !utils::is_empty_entry(candidate) && comparison_key(candidate, true) == key
+        })
+        .map(|(index, candidate)| (index + 1, candidate.clone()))
+        .collect();
+
+    #[cfg(unix)]
+    let findings = audit::audit_entry(entry, Identity::current()).unwrap_or_default();
+    #[cfg(not(unix))]
+    let findings = Vec::new();
+
+    let is_entry = |dir: &PathBuf| comparison_key(dir, true) == key;
+    let (shadowing, shadowed) = if occurrences.is_empty() {
+        (Vec::new(), Vec::new())
+    } else {
+        which::find_shadows(entries)
+            .into_iter()
+            .filter(|shadow| is_entry(&shadow.winner) || shadow.shadowed.iter().any(is_entry))
+            .partition(|shadow| is_entry(&shadow.winner))
+    };
+
+    Explanation {
+        entry: entry.to_path_buf(),
+        occurrences,
+        kind: EntryKind::of(entry),
+        findings,
+        commands: count_commands(entry),
+        shadowing,
+        shadowed,
+    }
+}
+
+/// Describes what is at the path
+fn describe_kind(kind: EntryKind) -> &'static str {
+    match kind {
+        EntryKind::Directory => "valid, an existing directory",
+        EntryKind::NotDirectory => "invalid, not a directory",
+        EntryKind::Missing => "invalid, does not exist",
+        EntryKind::NoPermission => "invalid, cannot be accessed by you",
+        EntryKind::Unreachable => "unreachable, the lookup timed out",
+    }
+}
+
+/// Describes the mode and ownership of a directory
+#[cfg(unix)]
+fn describe_permissions(entry: &Path) -> Option<String> {
+    use std::os::unix::fs::MetadataExt;
+
+    let metadata = fs::metadata(entry).ok()?;
+    Some(format!(
+        "mode {:04o}, owner uid {}, group gid {}",
+        metadata.mode() & 0o7777,
+        metadata.uid(),
+        metadata.gid()
+    ))
+}
+
+/// Prints an explanation
+pub fn print_explanation(explanation: &Explanation, total: usize) {
+    println!("{}", explanation.entry.display());
+
+    match explanation.occurrences.split_first() {
+        None => println!("  Position:    not in PATH"),
+        Some(((position, _), rest)) => {
+            println!(
+                "  Position:    {} of {}, searched after {} entr{}",
+                position,
+                total,
+                position - 1,
+                if *position == 2 { "y" } else { "ies" }
+            );
+            for (position, spelling) in rest {
+                println!(
+                    "  Duplicate:   {} as {}, never searched",
+                    position,
+                    spelling.display()
+                );
+            }
+        }
+    }
+
+    println!("  Status:      {}", describe_kind(explanation.kind));
+
+    #[cfg(unix)]
+    if let Some(permissions) = describe_permissions(&explanation.entry) {
+        println!("  Permissions: {}", permissions);
+    }
+    if explanation.findings.is_empty() {
+        println!("  Audit:       no issues");
+    }
+    for finding in &explanation.findings {
+        println!("  Audit:       {} {}", finding.severity, finding.reason);
+    }
+
+    println!("  Commands:    {} provided", explanation.commands);
+    if !explanation.shadowing.is_empty() {
+        println!(
+            "  Shadows {} command(s) found later in PATH:",
+            explanation.shadowing.len()
+        );
+        for shadow in &explanation.shadowing {
+            let hidden: Vec<String> = shadow
+                .shadowed
+                .iter()
+                .map(|dir| dir.display().to_string())
+                .collect();
+            println!("    {} (hides {})", shadow.command, hidden.join(", "));
+        }
+    }
+    if !explanation.shadowed.is_empty() {
+        println!(
+            "  Shadowed for {} command(s) by copies earlier in PATH:",
+            explanation.shadowed.len()
+        );
+        for shadow in &explanation.shadowed {
+            println!(
+                "    {} (runs from {})",
+                shadow.command,
+                shadow.winner.display()
+            );
+        }
+    }
+}
+
+/// Executes the explain command
+///
+/// Exits with status 1 if the directory is not in PATH, after explaining
+/// what can be found out about it anyway.
+///
+/// # Arguments
+///
+/// * `entry` - The directory to explain; `~` and environment variables are
+///   expanded
+///
+/// # Example
+///
+/// ```no_run
+/// # use pathmaster::commands;
+/// commands::explain::execute("/usr/local/bin");
+/// // Output example:
+/// // /usr/local/bin
+/// //   Position:    2 of 9, searched after 1 entry
+/// //   Status:      valid, an existing directory
+/// //   Permissions: mode 0755, owner uid 0, group gid 0
+/// //   Audit:       no issues
+/// //   Commands:    14 provided
+/// //   Shadows 1 command(s) found later in PATH:
+/// //     python3 (hides /usr/bin)
+/// ```
+pub fn execute(entry: &str) {
+    let entries = utils::get_path_entries();
+    let explanation = explain(&utils::expand_path(entry), &entries);
+
+    print_explanation(&explanation, entries.len());
+
+    if explanation.occurrences.is_empty() {
+        status!("\nAdd it with `pathmaster add {}`.", entry);
+        process::exit(1);
+    }
+}
+
+#[cfg(all(test, unix))]
+mod tests {
+    use super::*;
+    use std::io;
+    use std::os::unix::fs::PermissionsExt;
+    use tempfile::TempDir;
+
+    fn install(dir: &Path, command: &str) -> io::Result<()> {
+        let file = dir.join(command);
+        fs::write(&file, "#!/bin/sh\n")?;
+        fs::set_permissions(&file, fs::Permissions::from_mode(0o755))
+    }
+
+    #[test]
+    fn test_explain() -> io::Result<()> {
+        let temp_dir = TempDir::new()?;
+        let first = temp_dir.path().join("first");
+        let second = temp_dir.path().join("second");
+        for dir in [&first, &second] {
+            fs::create_dir(dir)?;
+            fs::set_permissions(dir, fs::Permissions::from_mode(0o755))?;
+            install(dir, "tool")?;
+        }
+        install(&second, "other")?;
+
+        let spelled = PathBuf::from(format!("{}/", second.display()));
+        let entries = vec![first.clone(), second.clone(), spelled.clone()];
+
+        let explanation = explain(&second, &entries);
+        assert_eq!(
+            explanation.occurrences,
+            vec![(2, second.clone()), (3, spelled)]
+        );
+        assert_eq!(explanation.kind, EntryKind::Directory);
+        assert_eq!(explanation.commands, 2);
+        assert!(explanation.shadowing.is_empty());
+        assert_eq!(explanation.shadowed.len(), 1);
+        assert_eq!(explanation.shadowed[0].command, "tool");
+        assert_eq!(explanation.shadowed[0].winner, first);
+
+        let explanation = explain(&first, &entries);
+        assert_eq!(explanation.occurrences, vec![(1, first.clone())]);
+        assert_eq!(explanation.shadowing.len(), 1);
+        assert!(explanation.shadowed.is_empty());
+        Ok(())
+    }
+
+    #[test]
+    fn test_explain_entry_not_in_path() {
+        let explanation = explain(Path::new("/nonexistent/bin"), &[PathBuf::from("/usr/bin")]);
+        assert!(explanation.occurrences.is_empty());
+        assert_eq!(explanation.kind, EntryKind::Missing);
+        assert_eq!(explanation.commands, 0);
+        assert!(explanation.shadowed.is_empty());
+    }
+}
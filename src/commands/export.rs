@@ -0,0 +1,77 @@
+//! Command implementation for exporting PATH as a portable backup.
+//!
+//! This module handles:
+//! - Capturing the current PATH in any backup format
+//! - Recording the hostname and shell type alongside it
+//! - Streaming the result to stdout so it can be redirected or piped
+//!
+//! Exported backups can be read back by any command that loads backup files.
+
+use crate::backup::core::{capture_backup, write_backup, Backup};
+use crate::backup::BackupFormat;
+use crate::utils::host;
+use crate::utils::shell::factory;
+use std::io;
+
+/// Captures the current PATH along with information about this machine
+pub fn export_backup() -> Backup {
+    Backup {
+        hostname: host::hostname(),
+        shell: Some(factory::resolved_shell_type().to_string()),
+        ..capture_backup()
+    }
+}
+
+/// Executes the export command, writing the current PATH to stdout
+///
+/// # Arguments
+///
+/// * `format` - The backup format to write
+///
+/// # Example
+///
+/// ```no_run
+/// # use pathmaster::commands;
+/// # use pathmaster::BackupFormat;
+/// commands::export::execute(BackupFormat::Json);
+/// ```
+pub fn execute(format: BackupFormat) {
+    let backup = export_backup();
+
+    let stdout = io::stdout();
+    if let Err(e) = write_backup(&mut stdout.lock(), &backup, format) {
+        // A closed pipe (e.g. `| head`) is not worth reporting
+        if e.kind() != io::ErrorKind::BrokenPipe {
+            eprintln!("Error exporting PATH: {}", e);
+            std::process::exit(1);
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::backup::core::parse_backup;
+
+    #[test]
+    fn test_export_round_trips_metadata() -> io::Result<()> {
+        let backup = Backup {
+            timestamp: String::from("20240101120000"),
+            path: String::from("/usr/bin:/bin"),
+            hostname: Some(String::from("workstation")),
+            shell: Some(String::from("zsh")),
+            ..Default::default()
+        };
+
+        for format in [BackupFormat::Json, BackupFormat::Toml, BackupFormat::Text] {
+            let mut output = Vec::new();
+            write_backup(&mut output, &backup, format)?;
+
+            let parsed = parse_backup(&String::from_utf8_lossy(&output), format)?;
+            assert_eq!(parsed.path, backup.path);
+            assert_eq!(parsed.hostname.as_deref(), Some("workstation"));
+            assert_eq!(parsed.shell.as_deref(), Some("zsh"));
+        }
+        Ok(())
+    }
+}
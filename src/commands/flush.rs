@@ -1,63 +1,158 @@
 //! Path management functionality for removing invalid entries from PATH.
 //!
 //! This module provides functionality to:
-//! - Identify and remove invalid PATH entries
+//! - Identify and remove invalid and empty PATH entries
+//! - Preview removals without editing anything
+//! - Leave entries pathmaster did not add alone with --mine-only
 //! - Update shell configuration files
 //! - Maintain backups of configurations
 //! - Provide detailed feedback about changes
 
-use crate::backup;
-use crate::commands::validator::is_valid_path_entry;
+use crate::commands::preview;
+use crate::commands::validator::{EntryKind, ValidityCache};
+use crate::status;
 use crate::utils;
+use crate::utils::managed;
 use std::path::PathBuf;
 
-/// Removes invalid directories from the PATH environment variable.
-pub fn execute() {
-    // Backup current PATH
-    if let Err(e) = backup::create_backup() {
-        eprintln!("Error creating backup: {}", e);
-        return;
+/// Returns whether flush removes an entry of the given kind
+///
+/// Only missing entries are removed by default. Entries that are not
+/// directories or cannot be looked up by this user are removed only when
+/// `aggressive` is set, since they may be valid for another user. Entries
+/// whose lookup timed out are always kept.
+pub fn should_remove(kind: EntryKind, aggressive: bool) -> bool {
+    match kind {
+        EntryKind::Missing => true,
+        EntryKind::NotDirectory | EntryKind::NoPermission => aggressive,
+        EntryKind::Directory | EntryKind::Unreachable => false,
     }
+}
 
-    // Get current PATH entries
+/// Removes invalid directories from the PATH environment variable.
+///
+/// Empty entries, which the shell treats as the current directory, are
+/// always removed, unless `mine_only` is set: then only invalid entries
+/// that pathmaster added are.
+///
+/// # Arguments
+///
+/// * `aggressive` - Also remove entries that are not directories or not accessible
+/// * `mine_only` - Only remove entries that pathmaster added
+/// * `dry_run` - Preview the changes without writing anything
+pub fn execute(aggressive: bool, mine_only: bool, dry_run: bool) {
     let current_entries = utils::get_path_entries();
-    let original_count = current_entries.len();
-
-    // Filter out non-existing paths
-    let valid_entries: Vec<PathBuf> = current_entries
-        .into_iter()
-        .filter(|path| {
-            if is_valid_path_entry(path) {
-                true
-            } else {
-                println!("Removing invalid path: {}", path.display());
-                false
+    let mut cache = ValidityCache::new();
+    if let Err(e) = cache.prefetch(&current_entries) {
+        eprintln!("{}", e);
+        std::process::exit(1);
+    }
+    let managed = if mine_only {
+        match managed::load_managed() {
+            Ok(managed) => Some(managed),
+            Err(e) => {
+                eprintln!("Error reading the entries pathmaster added: {}", e);
+                std::process::exit(1);
             }
-        })
-        .collect();
+        }
+    } else {
+        None
+    };
+    let mine = |path: &PathBuf| {
+        managed
+            .as_ref()
+            .map_or(true, |managed| managed::is_managed(managed, path, false))
+    };
 
-    let removed_count = original_count - valid_entries.len();
+    let mut valid_entries: Vec<PathBuf> = Vec::new();
+    let mut invalid_entries: Vec<PathBuf> = Vec::new();
+    let mut kept_unmanaged = 0;
+    for path in &current_entries {
+        if !utils::is_empty_entry(path) && !should_remove(cache.kind(path), aggressive) {
+            valid_entries.push(path.clone());
+        } else if mine(path) {
+            invalid_entries.push(path.clone());
+        } else {
+            kept_unmanaged += 1;
+            valid_entries.push(path.clone());
+        }
+    }
+
+    if kept_unmanaged > 0 {
+        status!(
+            "Keeping {} invalid or empty entry(ies) not added by pathmaster.",
+            kept_unmanaged
+        );
+    }
 
-    if removed_count == 0 {
-        println!("No invalid paths found in PATH.");
+    let kept_invalid = valid_entries
+        .iter()
+        .filter(|path| mine(path) && cache.kind(path).is_invalid())
+        .count();
+    if kept_invalid > 0 {
+        status!(
+            "Keeping {} path(s) that are not directories or cannot be accessed; use --aggressive to remove them.",
+            kept_invalid
+        );
+    }
+
+    let unreachable = valid_entries
+        .iter()
+        .filter(|path| cache.kind(path) == EntryKind::Unreachable)
+        .count();
+    if unreachable > 0 {
+        status!(
+            "Keeping {} unreachable path(s); run `pathmaster check` for details.",
+            unreachable
+        );
+    }
+
+    if invalid_entries.is_empty() {
+        status!("No invalid paths found in PATH.");
         return;
     }
 
-    // Update PATH environment variable
-    utils::set_path_entries(&valid_entries);
+    if dry_run {
+        preview::show_preview(&current_entries, &valid_entries);
+        return;
+    }
 
-    // Update shell configuration files
-    match utils::update_shell_config(&valid_entries) {
-        Ok(_) => {
-            println!(
-                "Successfully removed {} invalid path(s) and updated shell configuration.",
-                removed_count
-            );
-        }
+    // Back up PATH, then update it and the shell configuration
+    match crate::apply(&valid_entries, false) {
+        Ok(Some(backup_file)) => status!("Created PATH backup at: {}", backup_file.display()),
+        Ok(None) => {}
         Err(e) => {
-            eprintln!("Error updating shell configuration: {}", e);
-            println!("Warning: PATH environment variable was updated for current session only.");
-            println!("To make changes permanent, you'll need to manually update your shell configuration.");
+            eprintln!("{}", e);
+            std::process::exit(1);
+        }
+    }
+
+    for path in &invalid_entries {
+        if utils::is_empty_entry(path) {
+            status!("Removing empty entry");
+        } else {
+            status!("Removing invalid path: {}", path.display());
         }
     }
+
+    status!(
+        "Successfully removed {} invalid path(s) and updated shell configuration.",
+        invalid_entries.len()
+    );
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_should_remove() {
+        assert!(should_remove(EntryKind::Missing, false));
+        assert!(!should_remove(EntryKind::NoPermission, false));
+        assert!(!should_remove(EntryKind::NotDirectory, false));
+        assert!(should_remove(EntryKind::NoPermission, true));
+        assert!(should_remove(EntryKind::NotDirectory, true));
+        assert!(!should_remove(EntryKind::Unreachable, true));
+        assert!(!should_remove(EntryKind::Directory, true));
+    }
 }
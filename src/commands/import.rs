@@ -0,0 +1,124 @@
+//! Command implementation for importing PATH from a portable backup.
+//!
+//! This module handles:
+//! - Reading a backup from a file or stdin, in any supported format
+//! - Replacing PATH with the imported entries, or merging them in
+//! - Warning about imported directories that do not exist
+//! - Previewing changes with --dry-run
+//! - Creating backups before modification
+//! - Updating shell configuration
+
+use crate::backup::core::parse_backup_detect;
+use crate::commands::preview;
+use crate::commands::validator::is_valid_path_entry;
+use crate::status;
+use crate::utils;
+use std::fs;
+use std::io::{self, Read};
+use std::path::{Path, PathBuf};
+
+/// Reads a serialized backup from a file, or stdin if no file (or `-`) is given
+fn read_input(file: Option<&Path>) -> io::Result<String> {
+    match file {
+        Some(file) if file != Path::new("-") => fs::read_to_string(file),
+        _ => {
+            let mut contents = String::new();
+            io::stdin().read_to_string(&mut contents)?;
+            Ok(contents)
+        }
+    }
+}
+
+/// Executes the import command to apply a backup produced by `export`
+///
+/// # Arguments
+///
+/// * `file` - Backup file to read, or None (or `-`) to read stdin
+/// * `merge` - Add the imported entries to the current PATH instead of replacing it
+/// * `prepend_imported` - When merging, put imported entries ahead of current ones
+/// * `dry_run` - Preview the changes without writing anything
+///
+/// # Example
+///
+/// ```no_run
+/// # use pathmaster::commands;
+/// # use std::path::Path;
+/// // Add the entries from another machine's PATH after the local ones
+/// commands::import::execute(Some(Path::new("path.json")), true, false, false);
+/// ```
+pub fn execute(file: Option<&Path>, merge: bool, prepend_imported: bool, dry_run: bool) {
+    let source = file
+        .filter(|file| *file != Path::new("-"))
+        .map_or_else(|| String::from("stdin"), |file| file.display().to_string());
+
+    let (format, backup) =
+        match read_input(file).and_then(|contents| parse_backup_detect(&contents)) {
+            Ok(parsed) => parsed,
+            Err(e) => {
+                eprintln!("Error reading backup from {}: {}", source, e);
+                std::process::exit(1);
+            }
+        };
+
+    let imported: Vec<PathBuf> = backup
+        .entries()
+        .into_iter()
+        .filter(|entry| !entry.as_os_str().is_empty())
+        .collect();
+
+    if imported.is_empty() {
+        eprintln!(
+            "Backup from {} has no PATH entries; refusing to write an empty PATH.",
+            source
+        );
+        std::process::exit(1);
+    }
+
+    // Entries may come from another machine; keep them but say so
+    for entry in imported.iter().filter(|entry| !is_valid_path_entry(entry)) {
+        eprintln!(
+            "Warning: '{}' does not exist on this system.",
+            entry.display()
+        );
+    }
+
+    let current_entries = utils::get_path_entries();
+    let new_entries = if merge {
+        utils::merge_entries(&current_entries, &imported, prepend_imported)
+    } else {
+        imported.clone()
+    };
+
+    if new_entries == current_entries {
+        status!("PATH already matches the imported backup.");
+        return;
+    }
+
+    if dry_run {
+        preview::show_preview(&current_entries, &new_entries);
+        return;
+    }
+
+    // Back up PATH, then update it and the shell configuration
+    match crate::apply(&new_entries, false) {
+        Ok(Some(backup_file)) => status!("Created PATH backup at: {}", backup_file.display()),
+        Ok(None) => {}
+        Err(e) => {
+            eprintln!("{}", e);
+            std::process::exit(1);
+        }
+    }
+
+    let origin = match (&backup.hostname, &backup.shell) {
+        (Some(host), Some(shell)) => format!(" (exported from {} using {})", host, shell),
+        (Some(host), None) => format!(" (exported from {})", host),
+        _ => String::new(),
+    };
+    status!(
+        "Imported {} {} entry(ies) from {}{}.",
+        imported.len(),
+        format,
+        source,
+        origin
+    );
+}
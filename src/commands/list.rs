@@ -1,32 +1,192 @@
 //! Command implementation for listing PATH entries.
 //!
 //! This module provides functionality to:
-//! - Display all current PATH entries
-//! - Format output for readability
-//! - Show full paths with proper display formatting
+//! - Display all current PATH entries, numbered by priority
+//! - Annotate invalid and duplicate entries
+//! - Emit the list as JSON for scripting
+//! - List the PATH of another running process with --pid (Linux only)
 
+use crate::commands::validator::{EntryKind, ValidityCache};
+use crate::status;
 use crate::utils;
+use crate::utils::output::{paint, Color};
+use serde::Serialize;
+use std::collections::HashSet;
+use std::path::PathBuf;
+
+/// A single PATH entry along with its health annotations
+#[derive(Debug, Serialize, PartialEq)]
+pub struct ListEntry {
+    /// The directory as it appears in PATH
+    pub path: String,
+    /// Whether the directory exists and is a directory
+    pub valid: bool,
+    /// What the entry refers to, e.g. `missing` or `no_permission`
+    pub status: EntryKind,
+    /// Whether the directory already appeared earlier in PATH
+    pub duplicate: bool,
+}
+
+/// Annotates PATH entries with validity and duplicate information
+///
+/// # Arguments
+///
+/// * `entries` - PATH entries in priority order
+/// * `cache` - Lookups shared with the rest of the command run
+///
+/// # Returns
+///
+/// A `ListEntry` for every input entry, in the same order
+pub fn annotate_entries(entries: &[PathBuf], cache: &mut ValidityCache) -> Vec<ListEntry> {
+    let mut seen = HashSet::new();
+
+    entries
+        .iter()
+        .map(|entry| {
+            let kind = cache.kind(entry);
+            ListEntry {
+                path: entry.display().to_string(),
+                valid: kind == EntryKind::Directory,
+                status: kind,
+                duplicate: !seen.insert(entry.clone()),
+            }
+        })
+        .collect()
+}
 
 /// Executes the list command to display current PATH entries
 ///
-/// Lists all directories currently in PATH, with each entry on a new line
-/// prefixed with a bullet point for better readability.
+/// Lists all directories currently in PATH, numbered in priority order,
+/// with invalid and duplicate entries annotated.
+///
+/// # Arguments
+///
+/// * `invalid_only` - Only show entries that are not valid directories
+/// * `json` - Emit a JSON array instead of human-readable output
+/// * `pid` - List the PATH of this running process instead of the current one
 ///
 /// # Example
 ///
-/// ```
-/// commands::list::execute();
+/// ```no_run
+/// # use pathmaster::commands;
+/// commands::list::execute(false, false, None);
 /// // Output example:
 /// // Current PATH entries:
-/// // - /usr/local/bin
-/// // - /usr/bin
-/// // - ~/custom/bin
+/// //   1. /usr/local/bin
+/// //   2. /usr/bin
+/// //   3. ~/custom/bin [invalid]
 /// ```
-pub fn execute() {
-    let path_entries = utils::get_path_entries();
+pub fn execute(invalid_only: bool, json: bool, pid: Option<u32>) {
+    let entries = match pid {
+        Some(pid) => match utils::process::process_path_entries(pid) {
+            Ok(entries) => entries,
+            Err(e) => {
+                eprintln!("{}", e);
+                std::process::exit(1);
+            }
+        },
+        None => utils::get_path_entries(),
+    };
+    let mut cache = ValidityCache::new();
+    if let Err(e) = cache.prefetch(&entries) {
+        eprintln!("{}", e);
+        std::process::exit(1);
+    }
+    let entries = annotate_entries(&entries, &mut cache);
+
+    // Keep the original positions so numbering reflects PATH priority
+    let shown: Vec<(usize, &ListEntry)> = entries
+        .iter()
+        .enumerate()
+        .filter(|(_, entry)| !invalid_only || !entry.valid)
+        .collect();
+
+    if json {
+        let list: Vec<&ListEntry> = shown.iter().map(|(_, entry)| *entry).collect();
+        match serde_json::to_string_pretty(&list) {
+            Ok(output) => println!("{}", output),
+            Err(e) => eprintln!("Error serializing PATH entries: {}", e),
+        }
+        return;
+    }
+
+    let whose = match pid {
+        Some(pid) => format!(" of process {}", pid),
+        None => String::new(),
+    };
+    if invalid_only {
+        if shown.is_empty() {
+            status!("All directories in PATH{} are valid", whose);
+            return;
+        }
+        status!("Invalid PATH entries{}:", whose);
+    } else if pid.is_some() {
+        status!("PATH entries{}:", whose);
+    } else {
+        status!("Current PATH entries:");
+    }
+
+    for (index, entry) in shown {
+        let mut notes = Vec::new();
+        match entry.status {
+            EntryKind::Directory => {}
+            EntryKind::Unreachable => notes.push("unreachable"),
+            EntryKind::NoPermission => notes.push("no permission"),
+            EntryKind::NotDirectory | EntryKind::Missing => notes.push("invalid"),
+        }
+        if entry.duplicate {
+            notes.push("duplicate");
+        }
+
+        let color = if !entry.valid {
+            Color::Red
+        } else if entry.duplicate {
+            Color::Yellow
+        } else {
+            Color::Green
+        };
+        let text = if notes.is_empty() {
+            entry.path.clone()
+        } else {
+            format!("{} [{}]", entry.path, notes.join(", "))
+        };
+        println!("{:>3}. {}", index + 1, paint(&text, color));
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_annotate_entries() {
+        let temp_dir = TempDir::new().unwrap();
+        let valid = temp_dir.path().to_path_buf();
+        let missing = temp_dir.path().join("missing");
+
+        let entries = annotate_entries(
+            &[valid.clone(), missing.clone(), valid.clone()],
+            &mut ValidityCache::new(),
+        );
+
+        assert_eq!(entries.len(), 3);
+        assert!(entries[0].valid && !entries[0].duplicate);
+        assert!(!entries[1].valid && !entries[1].duplicate);
+        assert!(entries[2].valid && entries[2].duplicate);
+    }
+
+    #[test]
+    fn test_json_fields() {
+        let entries = annotate_entries(
+            &[PathBuf::from("/nonexistent/pathmaster")],
+            &mut ValidityCache::new(),
+        );
+        let json = serde_json::to_value(&entries).unwrap();
 
-    println!("Current PATH entries:");
-    for path in path_entries {
-        println!("- {}", path.display());
+        assert_eq!(json[0]["path"], "/nonexistent/pathmaster");
+        assert_eq!(json[0]["valid"], false);
+        assert_eq!(json[0]["status"], "missing");
+        assert_eq!(json[0]["duplicate"], false);
     }
 }
@@ -1,6 +1,31 @@
 // src/commands/mod.rs
 pub mod add;
+pub mod apply;
+pub mod audit;
+pub mod check;
+pub mod clean;
+pub mod completion;
+pub mod config;
+pub mod consolidate;
+pub mod dedupe;
 pub mod delete;
+pub mod diff;
+pub mod doctor;
+pub mod edit;
+pub mod explain;
+pub mod export;
 pub mod flush;
+pub mod import;
 pub mod list;
+pub mod move_entry;
+pub mod preview;
+pub mod redo;
+pub mod reorder;
+pub mod run;
+pub mod status;
+pub mod summary;
+pub mod system;
+pub mod undo;
 pub mod validator;
+pub mod watch;
+pub mod which;
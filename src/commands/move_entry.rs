@@ -0,0 +1,186 @@
+//! Command implementation for changing the priority of a PATH entry.
+//!
+//! This module handles:
+//! - Locating an existing PATH entry
+//! - Moving it to a position, or before or after another entry
+//! - Previewing changes with --dry-run
+//! - Creating backups before modification
+//! - Updating shell configuration
+
+use crate::commands::delete::matches_entry;
+use crate::commands::preview;
+use crate::status;
+use crate::utils;
+use std::path::PathBuf;
+
+/// Where to move a PATH entry
+#[derive(Debug, Clone, PartialEq)]
+pub enum Target {
+    /// A 1-based position, where 1 is the highest priority
+    Position(usize),
+    /// Immediately before another entry
+    Before(String),
+    /// Immediately after another entry
+    After(String),
+}
+
+/// Finds the index of the first PATH entry matching a directory
+fn find_entry(entries: &[PathBuf], directory: &str) -> Option<usize> {
+    entries
+        .iter()
+        .position(|entry| matches_entry(entry, directory, false, false))
+}
+
+/// Moves a PATH entry to a new position
+///
+/// # Arguments
+///
+/// * `entries` - PATH entries in priority order
+/// * `directory` - The entry to move
+/// * `target` - Where to move it
+///
+/// # Returns
+///
+/// * `Ok(Vec<PathBuf>)` with the updated entries
+/// * `Err(String)` if the entry or the target cannot be found
+pub fn move_entry(
+    entries: &[PathBuf],
+    directory: &str,
+    target: &Target,
+) -> Result<Vec<PathBuf>, String> {
+    let from = find_entry(entries, directory)
+        .ok_or_else(|| format!("Directory '{}' is not in PATH.", directory))?;
+
+    let mut moved = entries.to_vec();
+    let entry = moved.remove(from);
+
+    let to = match target {
+        Target::Position(position) => {
+            if *position == 0 || *position > entries.len() {
+                return Err(format!(
+                    "Position {} is out of range: PATH has entries 1-{}",
+                    position,
+                    entries.len()
+                ));
+            }
+            position - 1
+        }
+        Target::Before(anchor) | Target::After(anchor) => {
+            if matches_entry(&entry, anchor, false, false) {
+                return Err(String::from("Cannot move an entry relative to itself."));
+            }
+            let index = find_entry(&moved, anchor)
+                .ok_or_else(|| format!("Directory '{}' is not in PATH.", anchor))?;
+            if matches!(target, Target::After(_)) {
+                index + 1
+            } else {
+                index
+            }
+        }
+    };
+
+    moved.insert(to, entry);
+    Ok(moved)
+}
+
+/// Executes the move command to change a PATH entry's priority
+///
+/// # Arguments
+///
+/// * `directory` - The entry to move
+/// * `target` - Where to move it
+/// * `dry_run` - Preview the changes without writing anything
+///
+/// # Example
+///
+/// ```no_run
+/// # use pathmaster::commands;
+/// # use pathmaster::commands::move_entry::Target;
+/// // Give /usr/local/bin the highest priority
+/// commands::move_entry::execute("/usr/local/bin", &Target::Position(1), false);
+/// ```
+pub fn execute(directory: &str, target: &Target, dry_run: bool) {
+    let path_entries = utils::get_path_entries();
+
+    let moved = match move_entry(&path_entries, directory, target) {
+        Ok(moved) => moved,
+        Err(e) => {
+            eprintln!("{}", e);
+            std::process::exit(1);
+        }
+    };
+
+    if moved == path_entries {
+        status!("'{}' is already at the requested position.", directory);
+        return;
+    }
+
+    if dry_run {
+        preview::show_preview(&path_entries, &moved);
+        return;
+    }
+
+    // Back up PATH, then update it and the shell configuration
+    match crate::apply(&moved, false) {
+        Ok(Some(backup_file)) => status!("Created PATH backup at: {}", backup_file.display()),
+        Ok(None) => {}
+        Err(e) => {
+            eprintln!("{}", e);
+            std::process::exit(1);
+        }
+    }
+
+    let position = find_entry(&moved, directory).map_or(0, |index| index + 1);
+    status!("Moved '{}' to position {} in PATH.", directory, position);
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn paths(entries: &[&str]) -> Vec<PathBuf> {
+        entries.iter().map(PathBuf::from).collect()
+    }
+
+    #[test]
+    fn test_move_to_position() {
+        let entries = paths(&["/usr/bin", "/bin", "/usr/local/bin"]);
+        assert_eq!(
+            move_entry(&entries, "/usr/local/bin", &Target::Position(1)).unwrap(),
+            paths(&["/usr/local/bin", "/usr/bin", "/bin"])
+        );
+        assert_eq!(
+            move_entry(&entries, "/usr/bin/", &Target::Position(3)).unwrap(),
+            paths(&["/bin", "/usr/local/bin", "/usr/bin"])
+        );
+        assert!(move_entry(&entries, "/bin", &Target::Position(4)).is_err());
+        assert!(move_entry(&entries, "/bin", &Target::Position(0)).is_err());
+    }
+
+    #[test]
+    fn test_move_relative_to_entry() {
+        let entries = paths(&["/usr/bin", "/bin", "/usr/local/bin"]);
+        assert_eq!(
+            move_entry(
+                &entries,
+                "/usr/local/bin",
+                &Target::Before("/usr/bin".into())
+            )
+            .unwrap(),
+            paths(&["/usr/local/bin", "/usr/bin", "/bin"])
+        );
+        assert_eq!(
+            move_entry(&entries, "/usr/bin", &Target::After("/bin".into())).unwrap(),
+            paths(&["/bin", "/usr/bin", "/usr/local/bin"])
+        );
+        assert!(move_entry(&entries, "/usr/bin", &Target::After("/usr/bin".into())).is_err());
+        assert!(move_entry(&entries, "/usr/bin", &Target::After("/opt/bin".into())).is_err());
+    }
+
+    #[test]
+    fn test_move_missing_entry() {
+        let entries = paths(&["/usr/bin"]);
+        let err = move_entry(&entries, "/opt/bin", &Target::Position(1)).unwrap_err();
+        assert!(err.contains("not in PATH"));
+    }
+}
@@ -0,0 +1,414 @@
+//! Dry-run previews for commands that modify PATH.
+//!
+//! This module provides functionality to:
+//! - Show the PATH before and after a change
+//! - Show the PATH entries added, removed and moved
+//! - Show the shell configuration lines that would change
+//! - Print the configuration change as a unified diff, with `--patch`
+//!
+//! Every mutating command computes its new PATH entries and, when run with
+//! `--dry-run` or `--patch`, hands them to `show_preview` instead of writing
+//! anything.
+
+use crate::commands::diff::{align, diff_entries, format_line, DiffLine};
+use crate::status;
+use crate::utils::shell::factory;
+use crate::utils::shell::ShellHandler;
+use lazy_static::lazy_static;
+use std::env;
+use std::fs;
+use std::io;
+use std::path::{Path, PathBuf};
+use std::sync::Mutex;
+
+lazy_static! {
+    static ref PATCH: Mutex<bool> = Mutex::new(false);
+}
+
+/// Lines of unchanged context around each change in a patch
+const PATCH_CONTEXT: usize = 3;
+
+/// Sets whether previews are printed as a unified diff
+pub fn set_patch(patch: bool) -> io::Result<()> {
+    let mut current = PATCH
+        .lock()
+        .map_err(|_| io::Error::new(io::ErrorKind::Other, "Failed to lock patch mutex"))?;
+    *current = patch;
+    Ok(())
+}
+
+/// Gets whether previews are printed as a unified diff
+pub fn get_patch() -> io::Result<bool> {
+    let current = PATCH
+        .lock()
+        .map_err(|_| io::Error::new(io::ErrorKind::Other, "Failed to lock patch mutex"))?;
+    Ok(*current)
+}
+
+/// Joins PATH entries with the platform separator for display
+fn join_entries(entries: &[PathBuf]) -> String {
+    env::join_paths(entries)
+        .map(|joined| joined.to_string_lossy().into_owned())
+        .unwrap_or_else(|_| {
+            entries
+                .iter()
+                .map(|entry| entry.display().to_string())
+                .collect::<Vec<_>>()
+                .join(":")
+        })
+}
+
+/// Renders the configuration lines that differ between two file contents
+///
+/// Removed lines are numbered by their position in the old content and
+/// added lines by their position in the new content.
+pub fn render_config_changes(before: &str, after: &str) -> Vec<String> {
+    let before_lines: Vec<&str> = before.lines().collect();
+    let after_lines: Vec<&str> = after.lines().collect();
+    let (mut old_line, mut new_line) = (0, 0);
+    let mut rendered = Vec::new();
+
+    for line in align(&before_lines, &after_lines) {
+        match line {
+            DiffLine::Removed(text) => {
+                old_line += 1;
+                rendered.push(format!("-{:>5}  {}", old_line, text));
+            }
+            DiffLine::Added(text) => {
+                new_line += 1;
+                rendered.push(format!("+{:>5}  {}", new_line, text));
+            }
+            _ => {
+                old_line += 1;
+                new_line += 1;
+            }
+        }
+    }
+
+    rendered
+}
+
+/// Names a file in a patch header
+///
+/// Files under the home directory are named relative to it, so the patch
+/// applies with `git apply` in a dotfiles repository kept there, or with
+/// `patch -p1` run from it.
+fn patch_name(file: &Path) -> String {
+    let relative = dirs_next::home_dir()
+        .and_then(|home| file.strip_prefix(home).ok().map(Path::to_path_buf))
+        .unwrap_or_else(|| file.components().skip(1).collect());
+    relative.to_string_lossy().replace('\\', "/")
+}
+
+/// Formats the range of a hunk header, e.g. `3,7`
+///
+/// An empty range names the line before it, as `diff -u` does.
+fn hunk_range(start: usize, count: usize) -> String {
+    if count == 0 {
+        format!("{},0", start.saturating_sub(1))
+    } else {
+        format!("{},{}", start, count)
+    }
+}
+
+/// Renders the change between two file contents as a unified diff
+///
+/// # Arguments
+///
+/// * `file` - The file the contents belong to
+/// * `before` - Its contents before the change
+/// * `after` - Its contents after the change
+/// * `exists` - Whether the file exists before the change
+///
+/// # Returns
+///
+/// The patch, or an empty string if the contents are the same
+pub fn render_patch(file: &Path, before: &str, after: &str, exists: bool) -> String {
+    // Lines keep their terminators, so a missing final newline is a change
+    let before_lines: Vec<&str> = before.split_inclusive('\n').collect();
+    let after_lines: Vec<&str> = after.split_inclusive('\n').collect();
+    let lines = align(&before_lines, &after_lines);
+
+    let changed: Vec<usize> = lines
+        .iter()
+        .enumerate()
+        .filter(|(_, line)| !matches!(line, DiffLine::Unchanged(_)))
+        .map(|(index, _)| index)
+        .collect();
+    if changed.is_empty() {
+        return String::new();
+    }
+
+    // Group changes whose context would overlap into one hunk
+    let mut hunks: Vec<(usize, usize)> = Vec::new();
+    for &index in &changed {
+        let start = index.saturating_sub(PATCH_CONTEXT);
+        let end = (index + 1 + PATCH_CONTEXT).min(lines.len());
+        match hunks.last_mut() {
+            Some(hunk) if start <= hunk.1 => hunk.1 = end,
+            _ => hunks.push((start, end)),
+        }
+    }
+
+    let name = patch_name(file);
+    let mut patch = if exists {
+        format!("--- a/{}\n+++ b/{}\n", name, name)
+    } else {
+        format!("--- /dev/null\n+++ b/{}\n", name)
+    };
+
+    // Line numbers, counting from 1, of the next old and new lines
+    let (mut old_line, mut new_line) = (1, 1);
+    let mut position = 0;
+    for (start, end) in hunks {
+        for line in &lines[position..start] {
+            if !matches!(line, DiffLine::Added(_)) {
+                old_line += 1;
+            }
+            if !matches!(line, DiffLine::Removed(_)) {
+                new_line += 1;
+            }
+        }
+
+        let mut body = String::new();
+        let (mut old_count, mut new_count) = (0, 0);
+        for line in &lines[start..end] {
+            let (marker, text) = match line {
+                DiffLine::Removed(text) => {
+                    old_count += 1;
+                    ('-', text)
+                }
+                DiffLine::Added(text) => {
+                    new_count += 1;
+                    ('+', text)
+                }
+                DiffLine::Unchanged(text) | DiffLine::Moved { entry: text, .. } => {
+                    old_count += 1;
+                    new_count += 1;
+                    (' ', text)
+                }
+            };
+            body.push(marker);
+            body.push_str(text);
+            if !text.ends_with('\n') {
+                body.push_str("\n\\ No newline at end of file\n");
+            }
+        }
+
+        patch.push_str(&format!(
+            "@@ -{} +{} @@\n{}",
+            hunk_range(old_line, old_count),
+            hunk_range(new_line, new_count),
+            body
+        ));
+        old_line += old_count;
+        new_line += new_count;
+        position = end;
+    }
+
+    patch
+}
+
+/// Renders a preview of a PATH change
+///
+/// # Arguments
+///
+/// * `old` - PATH entries before the change
+/// * `new` - PATH entries after the change
+/// * `handler` - Shell handler whose configuration file would be updated
+///
+/// # Returns
+///
+/// * `Ok(String)` with the preview text
+/// * `Err(io::Error)` if the configuration file exists but cannot be read
+pub fn render_preview(
+    old: &[PathBuf],
+    new: &[PathBuf],
+    handler: &dyn ShellHandler,
+) -> io::Result<String> {
+    let mut lines = vec![
+        String::from("PATH before:"),
+        format!("  {}", join_entries(old)),
+        String::from("PATH after:"),
+        format!("  {}", join_entries(new)),
+        String::new(),
+    ];
+
+    let path_changes: Vec<String> = diff_entries(old, new)
+        .iter()
+        .filter(|line| line.is_change(true))
+        .map(|line| format_line(line, true))
+        .collect();
+    if path_changes.is_empty() {
+        lines.push(String::from("PATH entries are unchanged."));
+    } else {
+        lines.push(String::from("PATH changes:"));
+        lines.extend(path_changes);
+    }
+    lines.push(String::new());
+
+    let config_path = handler.target_config_path();
+    let (before, exists) = match fs::read_to_string(&config_path) {
+        Ok(content) => (content, true),
+        Err(e) if e.kind() == io::ErrorKind::NotFound => (String::new(), false),
+        Err(e) => return Err(e),
+    };
+    let after = handler.update_path_in_config(&before, new);
+
+    let config_changes = render_config_changes(&before, &after);
+    if config_changes.is_empty() {
+        lines.push(format!("No changes to {}.", config_path.display()));
+    } else {
+        let created = if exists { "" } else { " (would be created)" };
+        lines.push(format!("Changes to {}{}:", config_path.display(), created));
+        lines.extend(config_changes);
+    }
+
+    Ok(lines.join("\n"))
+}
+
+/// Prints the configuration change as a unified diff
+fn show_patch(new: &[PathBuf], handler: &dyn ShellHandler) -> io::Result<()> {
+    let config_path = handler.target_config_path();
+    let (before, exists) = match fs::read_to_string(&config_path) {
+        Ok(content) => (content, true),
+        Err(e) if e.kind() == io::ErrorKind::NotFound => (String::new(), false),
+        Err(e) => return Err(e),
+    };
+    let after = handler.update_path_in_config(&before, new);
+
+    let patch = render_patch(&config_path, &before, &after, exists);
+    if patch.is_empty() {
+        eprintln!("No changes to {}.", config_path.display());
+    } else {
+        print!("{}", patch);
+    }
+    Ok(())
+}
+
+/// Prints a preview of a PATH change without writing anything
+///
+/// Uses the configuration file of the detected shell. With `--patch`, only
+/// the change to it is printed, as a unified diff.
+///
+/// # Arguments
+///
+/// * `old` - PATH entries before the change
+/// * `new` - PATH entries after the change
+pub fn show_preview(old: &[PathBuf], new: &[PathBuf]) {
+    let handler = factory::get_shell_handler();
+
+    if get_patch().unwrap_or(false) {
+        if let Err(e) = show_patch(new, handler.as_ref()) {
+            eprintln!("Error reading shell configuration: {}", e);
+        }
+        return;
+    }
+
+    status!("Dry run: no changes will be made.\n");
+    match render_preview(old, new, handler.as_ref()) {
+        Ok(preview) => println!("{}", preview),
+        Err(e) => eprintln!("Error reading shell configuration: {}", e),
+    }
+}
+
+/// Prints a preview of an edit to a configuration file without writing it
+///
+/// For edits made to the file's text rather than to the PATH it declares.
+/// With `--patch`, the edit is printed as a unified diff.
+///
+/// # Arguments
+///
+/// * `file` - The configuration file
+/// * `before` - Its current contents
+/// * `after` - Its contents after the edit
+pub fn show_config_preview(file: &Path, before: &str, after: &str) {
+    if get_patch().unwrap_or(false) {
+        print!("{}", render_patch(file, before, after, true));
+        return;
+    }
+
+    status!("Dry run: no changes will be made.\n");
+    println!("Changes to {}:", file.display());
+    for line in render_config_changes(before, after) {
+        println!("{}", line);
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::utils::shell::handlers::BashHandler;
+    use serial_test::serial;
+    use tempfile::TempDir;
+
+    fn paths(entries: &[&str]) -> Vec<PathBuf> {
+        entries.iter().map(PathBuf::from).collect()
+    }
+
+    #[test]
+    fn test_render_config_changes() {
+        let before = "# rc\nexport PATH=\"/usr/bin\"\nalias ll='ls -l'\n";
+        let after = "# rc\nexport PATH=\"/opt/bin:/usr/bin\"\nalias ll='ls -l'\n";
+        assert_eq!(
+            render_config_changes(before, after),
+            vec![
+                "-    2  export PATH=\"/usr/bin\"",
+                "+    2  export PATH=\"/opt/bin:/usr/bin\"",
+            ]
+        );
+        assert!(render_config_changes(before, before).is_empty());
+    }
+
+    #[test]
+    fn test_render_patch() {
+        let file = Path::new("/nonexistent/home/.bashrc");
+        let before = "# 1\n# 2\n# 3\n# 4\nexport PATH=\"/usr/bin\"\n# 6\n# 7\n# 8\n# 9\n";
+        let after = "# 1\n# 2\n# 3\n# 4\nexport PATH=\"/opt/bin:/usr/bin\"\n# 6\n# 7\n# 8\n# 9\n";
+        assert_eq!(
+            render_patch(file, before, after, true),
+            "--- a/nonexistent/home/.bashrc\n+++ b/nonexistent/home/.bashrc\n\
+             @@ -2,7 +2,7 @@\n # 2\n # 3\n # 4\n-export PATH=\"/usr/bin\"\n\
+             +export PATH=\"/opt/bin:/usr/bin\"\n # 6\n # 7\n # 8\n"
+        );
+        assert_eq!(render_patch(file, before, before, true), "");
+
+        // A new file, without a final newline
+        assert_eq!(
+            render_patch(file, "", "export PATH=\"/usr/bin\"", false),
+            "--- /dev/null\n+++ b/nonexistent/home/.bashrc\n@@ -0,0 +1,1 @@\n\
+             +export PATH=\"/usr/bin\"\n\\ No newline at end of file\n"
+        );
+    }
+
+    #[test]
+    #[serial]
+    fn test_render_preview_does_not_write() -> io::Result<()> {
+        let temp_dir = TempDir::new()?;
+        let original_home = env::var_os("HOME");
+        env::set_var("HOME", temp_dir.path());
+
+        let bashrc = temp_dir.path().join(".bashrc");
+        let original = "export PATH=\"/usr/bin:/bin\"\n";
+        fs::write(&bashrc, original)?;
+
+        let result = render_preview(
+            &paths(&["/usr/bin", "/bin"]),
+            &paths(&["/opt/bin", "/usr/bin", "/bin"]),
+            &BashHandler::new(),
+        );
+
+        if let Some(home) = original_home {
+            env::set_var("HOME", home);
+        }
+        let preview = result?;
+
+        assert!(preview.contains("PATH after:\n  /opt/bin:/usr/bin:/bin"));
+        assert!(preview.contains("\n+ /opt/bin"));
+        assert!(preview.contains("-    1  export PATH=\"/usr/bin:/bin\""));
+        assert!(preview.contains("/opt/bin:/usr/bin:/bin\""));
+        assert_eq!(fs::read_to_string(&bashrc)?, original);
+
+        Ok(())
+    }
+}
@@ -0,0 +1,39 @@
+//! Command implementation for reapplying undone pathmaster edits.
+//!
+//! Redo works like an editor's: it steps forward through edits reverted by
+//! `pathmaster undo`, and any new edit discards them. See `utils::undo`.
+
+use crate::status;
+use crate::utils::hooks;
+use crate::utils::undo::{next_redo, redo_last};
+
+/// Executes the redo command
+///
+/// # Example
+///
+/// ```no_run
+/// # use pathmaster::commands;
+/// // Reapply the change reverted by the last undo
+/// commands::redo::execute();
+/// ```
+pub fn execute() {
+    let result = next_redo().and_then(|next| match next {
+        Some(stored) => hooks::with_hooks(&stored.snapshot.location(), redo_last),
+        None => Ok(None),
+    });
+    match result {
+        Ok(Some(snapshot)) => {
+            status!(
+                "Reapplied the change to {} undone at {}",
+                snapshot.location().display(),
+                snapshot.timestamp
+            );
+            status!("Open a new shell to use the restored PATH.");
+        }
+        Ok(None) => status!("Nothing to redo."),
+        Err(e) => {
+            eprintln!("Error redoing the last undone change: {}", e);
+            std::process::exit(1);
+        }
+    }
+}
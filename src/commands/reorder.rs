@@ -0,0 +1,186 @@
+//! Command implementation for reordering PATH entries.
+//!
+//! This module handles:
+//! - Listing numbered PATH entries and prompting for a new order
+//! - Validating that the new order is a permutation of the existing entries
+//! - Previewing changes with --dry-run
+//! - Creating backups before modification
+//! - Updating shell configuration
+
+use crate::commands::preview;
+use crate::status;
+use crate::utils;
+use std::io::{self, BufRead, Write};
+use std::path::PathBuf;
+
+/// Parses a new PATH order given as 1-based indices
+///
+/// Indices may be separated by commas and/or whitespace (e.g. `3,1,2`).
+///
+/// # Arguments
+///
+/// * `order` - The requested order
+/// * `count` - The number of entries in PATH
+///
+/// # Returns
+///
+/// * `Ok(Vec<usize>)` with 0-based indices if the order names every entry exactly once
+/// * `Err(String)` describing why the order is invalid
+pub fn parse_order(order: &str, count: usize) -> Result<Vec<usize>, String> {
+    let mut indices = Vec::new();
+    let mut seen = vec![false; count];
+
+    for token in order
+        .split(|c: char| c == ',' || c.is_whitespace())
+        .filter(|token| !token.is_empty())
+    {
+        let index: usize = token
+            .parse()
+            .map_err(|_| format!("Invalid index '{}': expected a number", token))?;
+        if index == 0 || index > count {
+            return Err(format!(
+                "Index {} is out of range: PATH has entries 1-{}",
+                index, count
+            ));
+        }
+        if seen[index - 1] {
+            return Err(format!("Index {} appears more than once", index));
+        }
+        seen[index - 1] = true;
+        indices.push(index - 1);
+    }
+
+    let missing: Vec<String> = seen
+        .iter()
+        .enumerate()
+        .filter(|(_, seen)| !**seen)
+        .map(|(index, _)| (index + 1).to_string())
+        .collect();
+    if !missing.is_empty() {
+        return Err(format!(
+            "Every entry must appear exactly once; missing: {}",
+            missing.join(", ")
+        ));
+    }
+
+    Ok(indices)
+}
+
+/// Prints the numbered PATH entries and reads the new order from stdin
+fn prompt_for_order(entries: &[PathBuf]) -> io::Result<String> {
+    println!("Current PATH entries:");
+    for (index, entry) in entries.iter().enumerate() {
+        println!("{:>3}. {}", index + 1, entry.display());
+    }
+    print!("New order (e.g. 3,1,2): ");
+    io::stdout().flush()?;
+
+    let mut line = String::new();
+    io::stdin().lock().read_line(&mut line)?;
+    Ok(line)
+}
+
+/// Executes the reorder command to rearrange PATH entries
+///
+/// # Arguments
+///
+/// * `order` - The new order as 1-based indices, or None to prompt for it
+/// * `dry_run` - Preview the changes without writing anything
+///
+/// # Example
+///
+/// ```no_run
+/// # use pathmaster::commands;
+/// // Move the third entry to the front
+/// commands::reorder::execute(Some("3,1,2"), false);
+/// ```
+pub fn execute(order: Option<&str>, dry_run: bool) {
+    let path_entries = utils::get_path_entries();
+    if path_entries.is_empty() {
+        status!("PATH is empty; nothing to reorder.");
+        return;
+    }
+
+    let order = match order {
+        Some(order) => order.to_string(),
+        None => match prompt_for_order(&path_entries) {
+            Ok(order) => order,
+            Err(e) => {
+                eprintln!("Error reading new order: {}", e);
+                return;
+            }
+        },
+    };
+
+    let indices = match parse_order(&order, path_entries.len()) {
+        Ok(indices) => indices,
+        Err(e) => {
+            eprintln!("{}", e);
+            std::process::exit(1);
+        }
+    };
+
+    if indices
+        .iter()
+        .enumerate()
+        .all(|(position, index)| position == *index)
+    {
+        status!("PATH order is unchanged.");
+        return;
+    }
+
+    let reordered: Vec<PathBuf> = indices
+        .iter()
+        .map(|index| path_entries[*index].clone())
+        .collect();
+
+    if dry_run {
+        preview::show_preview(&path_entries, &reordered);
+        return;
+    }
+
+    // Back up PATH, then update it and the shell configuration
+    match crate::apply(&reordered, false) {
+        Ok(Some(backup_file)) => status!("Created PATH backup at: {}", backup_file.display()),
+        Ok(None) => {}
+        Err(e) => {
+            eprintln!("{}", e);
+            std::process::exit(1);
+        }
+    }
+
+    status!("Successfully reordered PATH:");
+    for (index, entry) in reordered.iter().enumerate() {
+        status!("{:>3}. {}", index + 1, entry.display());
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_parse_order() {
+        assert_eq!(parse_order("3,1,2", 3).unwrap(), vec![2, 0, 1]);
+        assert_eq!(parse_order(" 2, 1 ", 2).unwrap(), vec![1, 0]);
+        assert_eq!(parse_order("2 3 1", 3).unwrap(), vec![1, 2, 0]);
+    }
+
+    #[test]
+    fn test_parse_order_rejects_malformed_input() {
+        assert!(parse_order("1,x,2", 3)
+            .unwrap_err()
+            .contains("Invalid index"));
+        assert!(parse_order("1,4,2", 3)
+            .unwrap_err()
+            .contains("out of range"));
+        assert!(parse_order("0,1,2", 3)
+            .unwrap_err()
+            .contains("out of range"));
+        assert!(parse_order("1,1,2", 3)
+            .unwrap_err()
+            .contains("more than once"));
+        assert!(parse_order("3,1", 3).unwrap_err().contains("missing: 2"));
+        assert!(parse_order("", 2).unwrap_err().contains("missing: 1, 2"));
+    }
+}
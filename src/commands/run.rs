@@ -0,0 +1,151 @@
+//! Command implementation for running one command with an adjusted PATH.
+//!
+//! This module provides functionality to:
+//! - Build a PATH with directories added in front of or behind the current one
+//! - Run a command with that PATH, the way `env PATH=... cmd` would
+//! - Pass the command's exit status back to the caller
+//!
+//! Nothing is saved: neither the shell configuration nor the PATH of the
+//! calling shell changes, so scripts can tweak PATH for a single command.
+
+use crate::utils;
+use std::io;
+use std::path::PathBuf;
+use std::process::{self, Command};
+
+/// Builds the PATH a command is run with
+///
+/// Prepended directories come first, in the order given, and appended ones
+/// last. Any other occurrence of an added directory is dropped so its
+/// position is the one asked for.
+///
+/// # Arguments
+///
+/// * `current` - The current PATH entries
+/// * `prepend` - Directories to search before the current PATH
+/// * `append` - Directories to search after the current PATH
+pub fn run_entries(current: &[PathBuf], prepend: &[PathBuf], append: &[PathBuf]) -> Vec<PathBuf> {
+    let mut entries: Vec<PathBuf> = prepend.to_vec();
+    entries.extend(
+        current
+            .iter()
+            .filter(|entry| !prepend.contains(entry) && !append.contains(entry))
+            .cloned(),
+    );
+    entries.extend(
+        append
+            .iter()
+            .filter(|entry| !prepend.contains(entry))
+            .cloned(),
+    );
+    entries
+}
+
+/// Returns the exit status for a command that could not be started
+///
+/// Follows `env`: 127 when the command is not found, 126 otherwise.
+fn launch_failure_status(error: &io::Error) -> i32 {
+    if error.kind() == io::ErrorKind::NotFound {
+        127
+    } else {
+        126
+    }
+}
+
+/// Replaces this process with the command, so signals and the exit status
+/// reach the caller directly
+#[cfg(unix)]
+fn run(command: &mut Command) -> io::Error {
+    use std::os::unix::process::CommandExt;
+
+    command.exec()
+}
+
+/// Runs the command and exits with its status
+#[cfg(not(unix))]
+fn run(command: &mut Command) -> io::Error {
+    match command.status() {
+        Ok(status) => process::exit(status.code().unwrap_or(1)),
+        Err(e) => e,
+    }
+}
+
+/// Executes the run command
+///
+/// Runs `command` with the adjusted PATH, which is also used to find the
+/// command itself, and exits with its status. If it cannot be started, exits
+/// with 127 when it is not found and 126 otherwise.
+///
+/// # Arguments
+///
+/// * `prepend` - Directories to search before the current PATH; `~` and
+///   environment variables are expanded
+/// * `append` - Directories to search after the current PATH
+/// * `command` - The program followed by its arguments
+///
+/// # Example
+///
+/// ```no_run
+/// # use pathmaster::commands;
+/// commands::run::execute(
+///     &["/opt/foo/bin".to_string()],
+///     &[],
+///     &["mycmd".to_string(), "--flag".to_string()],
+/// );
+/// ```
+pub fn execute(prepend: &[String], append: &[String], command: &[String]) {
+    let expand = |dirs: &[String]| -> Vec<PathBuf> {
+        dirs.iter().map(|dir| utils::expand_path(dir)).collect()
+    };
+    let entries = run_entries(
+        &utils::get_path_entries(),
+        &expand(prepend),
+        &expand(append),
+    );
+
+    let (program, args) = match command.split_first() {
+        Some(split) => split,
+        None => {
+            eprintln!("No command given to run");
+            process::exit(2);
+        }
+    };
+
+    let error = run(Command::new(program)
+        .args(args)
+        .env("PATH", utils::build_path_string(&entries)));
+    eprintln!("Cannot run {}: {}", program, error);
+    process::exit(launch_failure_status(&error));
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn paths(entries: &[&str]) -> Vec<PathBuf> {
+        entries.iter().map(PathBuf::from).collect()
+    }
+
+    #[test]
+    fn test_run_entries() {
+        let current = paths(&["/usr/bin", "/opt/foo/bin", "/bin"]);
+
+        assert_eq!(
+            run_entries(&current, &paths(&["/opt/foo/bin", "/opt/bar/bin"]), &[]),
+            paths(&["/opt/foo/bin", "/opt/bar/bin", "/usr/bin", "/bin"])
+        );
+        assert_eq!(
+            run_entries(&current, &[], &paths(&["/usr/bin"])),
+            paths(&["/opt/foo/bin", "/bin", "/usr/bin"])
+        );
+        assert_eq!(run_entries(&current, &[], &[]), current);
+    }
+
+    #[test]
+    fn test_launch_failure_status() {
+        let missing = io::Error::new(io::ErrorKind::NotFound, "missing");
+        let denied = io::Error::new(io::ErrorKind::PermissionDenied, "denied");
+        assert_eq!(launch_failure_status(&missing), 127);
+        assert_eq!(launch_failure_status(&denied), 126);
+    }
+}
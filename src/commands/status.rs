@@ -0,0 +1,191 @@
+//! Command implementation for a compact PATH health summary.
+//!
+//! This module provides functionality to:
+//! - Count PATH entries, invalid entries and duplicates
+//! - Report whether a backup exists
+//! - Print the summary as one line or as compact JSON for shell prompts
+//!
+//! The command may run on every prompt render, so each distinct entry is
+//! stat'ed once and backups are not parsed.
+
+use crate::backup;
+use crate::commands::validator::{EntryKind, ValidityCache};
+use crate::utils;
+use serde::Serialize;
+use std::collections::HashSet;
+use std::path::PathBuf;
+use std::str::FromStr;
+
+/// Output formats for the status command
+#[derive(Debug, Clone, Copy, PartialEq)]
+pub enum StatusFormat {
+    /// A single human-readable summary line
+    Text,
+    /// A compact JSON object
+    Json,
+}
+
+impl FromStr for StatusFormat {
+    type Err = String;
+
+    fn from_str(s: &str) -> Result<Self, Self::Err> {
+        match s.to_lowercase().as_str() {
+            "text" => Ok(StatusFormat::Text),
+            "json" => Ok(StatusFormat::Json),
+            _ => Err(format!(
+                "Invalid status format: {}. Valid formats are: text, json",
+                s
+            )),
+        }
+    }
+}
+
+/// Summary of PATH health
+#[derive(Debug, Serialize, PartialEq)]
+pub struct PathStatus {
+    /// Number of entries in PATH
+    pub entries: usize,
+    /// Entries that are not existing directories, counting every occurrence
+    pub invalid: usize,
+    /// Entries whose lookup timed out, counting every occurrence
+    pub unreachable: usize,
+    /// Extra occurrences of entries that appear more than once
+    pub duplicates: usize,
+    /// Whether at least one backup exists
+    pub backup: bool,
+}
+
+impl PathStatus {
+    /// Formats the status as a single summary line
+    ///
+    /// Unreachable entries are only mentioned when there are some.
+    pub fn summary(&self) -> String {
+        let unreachable = if self.unreachable > 0 {
+            format!(", {} unreachable", self.unreachable)
+        } else {
+            String::new()
+        };
+
+        format!(
+            "PATH: {} entries, {} invalid{}, {} duplicate(s), {}",
+            self.entries,
+            self.invalid,
+            unreachable,
+            self.duplicates,
+            if self.backup {
+                "backed up"
+            } else {
+                "no backup"
+            }
+        )
+    }
+}
+
+/// Summarizes the health of PATH entries
+///
+/// Validity is read through `cache`, so repeated entries do not touch the
+/// filesystem again.
+///
+/// # Arguments
+///
+/// * `entries` - PATH entries in priority order
+/// * `backup` - Whether a backup exists
+/// * `cache` - Lookups shared with the rest of the command run
+pub fn path_status(entries: &[PathBuf], backup: bool, cache: &mut ValidityCache) -> PathStatus {
+    let mut seen = HashSet::new();
+    let mut status = PathStatus {
+        entries: entries.len(),
+        invalid: 0,
+        unreachable: 0,
+        duplicates: 0,
+        backup,
+    };
+
+    for entry in entries {
+        if !seen.insert(entry) {
+            status.duplicates += 1;
+        }
+        match cache.kind(entry) {
+            EntryKind::Directory => {}
+            EntryKind::Unreachable => status.unreachable += 1,
+            _ => status.invalid += 1,
+        }
+    }
+
+    status
+}
+
+/// Executes the status command to print a PATH health summary
+///
+/// # Arguments
+///
+/// * `format` - Print a summary line or a compact JSON object
+///
+/// # Example
+///
+/// ```no_run
+/// # use pathmaster::commands;
+/// # use pathmaster::commands::status::StatusFormat;
+/// commands::status::execute(StatusFormat::Json);
+/// // Output example:
+/// // {"entries":12,"invalid":1,"unreachable":0,"duplicates":2,"backup":true}
+/// ```
+pub fn execute(format: StatusFormat) {
+    // A prompt should still render when the backup directory is unreadable
+    let backup = backup::core::has_backup().unwrap_or(false);
+    let entries = utils::get_path_entries();
+    let mut cache = ValidityCache::new();
+    if let Err(e) = cache.prefetch(&entries) {
+        eprintln!("{}", e);
+        std::process::exit(1);
+    }
+    let status = path_status(&entries, backup, &mut cache);
+
+    match format {
+        StatusFormat::Text => println!("{}", status.summary()),
+        StatusFormat::Json => match serde_json::to_string(&status) {
+            Ok(output) => println!("{}", output),
+            Err(e) => {
+                eprintln!("Error serializing PATH status: {}", e);
+                std::process::exit(1);
+            }
+        },
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_path_status() {
+        let temp_dir = TempDir::new().unwrap();
+        let valid = temp_dir.path().to_path_buf();
+        let missing = temp_dir.path().join("missing");
+
+        let status = path_status(
+            &[valid.clone(), missing.clone(), valid.clone(), missing],
+            true,
+            &mut ValidityCache::new(),
+        );
+        assert_eq!(
+            status,
+            PathStatus {
+                entries: 4,
+                invalid: 2,
+                unreachable: 0,
+                duplicates: 2,
+                backup: true,
+            }
+        );
+        assert_eq!(
+            serde_json::to_string(&status).unwrap(),
+            r#"{"entries":4,"invalid":2,"unreachable":0,"duplicates":2,"backup":true}"#
+        );
+        assert_eq!(
+            status.summary(),
+            "PATH: 4 entries, 2 invalid, 2 duplicate(s), backed up"
+        );
+    }
+}
@@ -0,0 +1,232 @@
+//! Command implementation for quick PATH statistics.
+//!
+//! This module provides functionality to:
+//! - Count PATH entries, valid and invalid entries and duplicates
+//! - Measure the PATH string and find its longest and shortest entries
+//! - Print the statistics as a table or as JSON for scripts and dashboards
+//!
+//! A bloated PATH can push the environment past the system's limit and make
+//! commands fail with "argument list too long", so the length is reported in
+//! full, with the limit and a warning once PATH gets close to it.
+
+use crate::commands::check::LENGTH_ADVICE;
+use crate::commands::validator::{EntryKind, ValidityCache};
+use crate::status;
+use crate::utils;
+use crate::utils::path::{length_warning, path_length_limit};
+use serde::Serialize;
+use std::collections::HashSet;
+use std::env;
+
+/// Statistics about a PATH string
+#[derive(Debug, Serialize, PartialEq)]
+pub struct PathSummary {
+    /// Number of entries in PATH
+    pub entries: usize,
+    /// Entries that are existing directories, counting every occurrence
+    pub valid: usize,
+    /// Entries that are not existing directories, counting every occurrence
+    pub invalid: usize,
+    /// Extra occurrences of entries that appear more than once
+    pub duplicates: usize,
+    /// Number of characters in the PATH string, separators included
+    pub length: usize,
+    /// Longest PATH string this system accepts, in bytes
+    pub limit: usize,
+    /// Whether PATH is close enough to the limit to be warned about
+    pub near_limit: bool,
+    /// The longest entry, the first one if several are equally long
+    pub longest: Option<String>,
+    /// The shortest entry, the first one if several are equally short
+    pub shortest: Option<String>,
+}
+
+/// Computes statistics for a PATH string
+///
+/// # Arguments
+///
+/// * `path` - The PATH value
+/// * `limit` - The platform limit on the PATH string, in bytes
+/// * `cache` - Lookups shared with the rest of the command run
+pub fn summarize(path: &str, limit: usize, cache: &mut ValidityCache) -> PathSummary {
+    // Splitting an empty PATH yields one empty entry, but there is nothing in it
+    let entries = if path.is_empty() {
+        Vec::new()
+    } else {
+        utils::parse_path_entries(path)
+    };
+    let mut seen = HashSet::new();
+    let mut summary = PathSummary {
+        entries: entries.len(),
+        valid: 0,
+        invalid: 0,
+        duplicates: 0,
+        length: path.chars().count(),
+        limit,
+        near_limit: length_warning(path.len(), limit).is_some(),
+        longest: None,
+        shortest: None,
+    };
+
+    for entry in &entries {
+        if !seen.insert(entry) {
+            summary.duplicates += 1;
+        }
+        if cache.kind(entry) == EntryKind::Directory {
+            summary.valid += 1;
+        } else {
+            summary.invalid += 1;
+        }
+
+        let text = entry.display().to_string();
+        let len = text.chars().count();
+        if summary
+            .longest
+            .as_ref()
+            .map_or(true, |longest| len > longest.chars().count())
+        {
+            summary.longest = Some(text.clone());
+        }
+        if summary
+            .shortest
+            .as_ref()
+            .map_or(true, |shortest| len < shortest.chars().count())
+        {
+            summary.shortest = Some(text);
+        }
+    }
+
+    summary
+}
+
+/// Formats an entry with its length, or a dash when PATH is empty
+fn describe(entry: &Option<String>) -> String {
+    match entry {
+        Some(entry) => format!("{} ({} characters)", entry, entry.chars().count()),
+        None => "-".to_string(),
+    }
+}
+
+/// Executes the summary command to print PATH statistics
+///
+/// Nothing is changed; each distinct entry is stat'ed once.
+///
+/// # Arguments
+///
+/// * `json` - Emit a JSON object instead of a table
+///
+/// # Example
+///
+/// ```no_run
+/// # use pathmaster::commands;
+/// commands::summary::execute(false);
+/// // Output example:
+/// // PATH summary:
+/// //   Entries:     12
+/// //   Valid:       11
+/// //   Invalid:     1
+/// //   Duplicates:  2
+/// //   Length:      412 characters
+/// //   Limit:       131066 bytes
+/// //   Longest:     /home/me/.local/share/pnpm/global/bin (38 characters)
+/// //   Shortest:    /bin (4 characters)
+/// ```
+pub fn execute(json: bool) {
+    let path = env::var_os("PATH")
+        .map(|path| path.to_string_lossy().into_owned())
+        .unwrap_or_default();
+    let mut cache = ValidityCache::new();
+    if let Err(e) = cache.prefetch(&utils::parse_path_entries(&path)) {
+        eprintln!("{}", e);
+        std::process::exit(1);
+    }
+    let summary = summarize(&path, path_length_limit(), &mut cache);
+    if summary.near_limit {
+        eprintln!(
+            "Warning: PATH is close to the {} bytes this system allows; commands fail to start \
+             beyond it. {}.",
+            summary.limit, LENGTH_ADVICE
+        );
+    }
+
+    if json {
+        match serde_json::to_string_pretty(&summary) {
+            Ok(output) => println!("{}", output),
+            Err(e) => {
+                eprintln!("Error serializing PATH summary: {}", e);
+                std::process::exit(1);
+            }
+        }
+        return;
+    }
+
+    status!("PATH summary:");
+    println!("  Entries:     {}", summary.entries);
+    println!("  Valid:       {}", summary.valid);
+    println!("  Invalid:     {}", summary.invalid);
+    println!("  Duplicates:  {}", summary.duplicates);
+    println!("  Length:      {} characters", summary.length);
+    println!("  Limit:       {} bytes", summary.limit);
+    println!("  Longest:     {}", describe(&summary.longest));
+    println!("  Shortest:    {}", describe(&summary.shortest));
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_summarize() {
+        let temp_dir = TempDir::new().unwrap();
+        let valid = temp_dir.path().display().to_string();
+        let missing = temp_dir.path().join("missing").display().to_string();
+        let path = env::join_paths([&valid, &missing, &valid])
+            .unwrap()
+            .into_string()
+            .unwrap();
+
+        let summary = summarize(&path, 131_066, &mut ValidityCache::new());
+        assert_eq!(
+            summary,
+            PathSummary {
+                entries: 3,
+                valid: 2,
+                invalid: 1,
+                duplicates: 1,
+                length: path.chars().count(),
+                limit: 131_066,
+                near_limit: false,
+                longest: Some(missing),
+                shortest: Some(valid),
+            }
+        );
+
+        let json = serde_json::to_value(&summary).unwrap();
+        assert_eq!(json["length"], path.chars().count());
+        assert_eq!(json["duplicates"], 1);
+    }
+
+    #[test]
+    fn test_summarize_empty_path() {
+        let summary = summarize("", 131_066, &mut ValidityCache::new());
+        assert_eq!(summary.entries, 0);
+        assert_eq!(summary.length, 0);
+        assert_eq!(summary.longest, None);
+        assert_eq!(describe(&summary.shortest), "-");
+    }
+
+    #[test]
+    fn test_summarize_very_long_path() {
+        let entry = format!("/{}", "d".repeat(98));
+        let path = env::join_paths(vec![entry; 1000])
+            .unwrap()
+            .into_string()
+            .unwrap();
+
+        let summary = summarize(&path, 131_066, &mut ValidityCache::new());
+        assert_eq!(summary.entries, 1000);
+        assert!(summary.near_limit);
+        assert!(!summarize(&path, 1_000_000, &mut ValidityCache::new()).near_limit);
+    }
+}
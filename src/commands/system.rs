@@ -0,0 +1,191 @@
+//! Command implementation for reporting PATH set in system-wide files.
+//!
+//! This module provides functionality to:
+//! - Find the files under `/etc` that set PATH for every user
+//! - Report the entries each of them contributes, line by line
+//! - Show which of those entries are in the current PATH
+//! - Say whether the files could be edited without root
+//!
+//! Read:
+//! - `/etc/environment` - `PATH=...`, read by PAM at login
+//! - `/etc/paths` and `/etc/paths.d/*` - One directory per line, read by
+//!   `path_helper` on macOS
+//! - `/etc/profile`, `/etc/profile.d/*.sh`, `/etc/bash.bashrc`, `/etc/bashrc`,
+//!   `/etc/zshenv`, `/etc/zprofile` and their `/etc/zsh/` forms - PATH
+//!   assignments in shell scripts
+//!
+//! Nothing is changed. These files are shared by all users and owned by root,
+//! so pathmaster only reports on them.
+
+use crate::status;
+use crate::utils;
+use crate::utils::system_files::{candidate_files, parse_contributions};
+use std::fs::{self, OpenOptions};
+use std::path::{Path, PathBuf};
+
+pub use crate::utils::system_files::{Contribution, SystemFileKind};
+
+/// A system file that sets PATH
+#[derive(Debug, Clone, PartialEq)]
+pub struct SystemFile {
+    /// The file
+    pub file: PathBuf,
+    /// How it lists entries
+    pub kind: SystemFileKind,
+    /// Lines that add entries
+    pub contributions: Vec<Contribution>,
+    /// Whether the current user could edit it
+    pub writable: bool,
+}
+
+/// Reads the system files that set PATH
+///
+/// Files that are missing, unreadable or add no entries are left out.
+///
+/// # Arguments
+/// * `root` - Directory standing for `/`
+pub fn scan_system_files(root: &Path) -> Vec<SystemFile> {
+    candidate_files(root)
+        .into_iter()
+        .filter_map(|(file, kind)| {
+            let contributions = parse_contributions(&fs::read_to_string(&file).ok()?, kind);
+            if contributions.is_empty() {
+                return None;
+            }
+            // Opening for append checks permission without changing anything
+            let writable = OpenOptions::new().append(true).open(&file).is_ok();
+            Some(SystemFile {
+                file,
+                kind,
+                contributions,
+                writable,
+            })
+        })
+        .collect()
+}
+
+/// Prints what each system file adds to PATH
+///
+/// # Arguments
+/// * `files` - The files, as returned by `scan_system_files`
+/// * `current` - The current PATH entries
+pub fn print_system_files(files: &[SystemFile], current: &[PathBuf]) {
+    for system_file in files {
+        println!(
+            "{}{}",
+            system_file.file.display(),
+            if system_file.writable {
+                ""
+            } else {
+                " (editing needs root)"
+            }
+        );
+        for contribution in &system_file.contributions {
+            for entry in &contribution.entries {
+                println!(
+                    "  line {}: {}{}",
+                    contribution.line_number,
+                    entry.display(),
+                    if current.contains(entry) {
+                        ""
+                    } else {
+                        " (not in PATH)"
+                    }
+                );
+            }
+        }
+    }
+}
+
+/// Executes the system command
+///
+/// Lists the system-wide files that set PATH and what each of them adds,
+/// then counts how many current PATH entries they account for.
+///
+/// # Example
+///
+/// ```no_run
+/// # use pathmaster::commands;
+/// commands::system::execute();
+/// // Output example:
+/// // /etc/environment (editing needs root)
+/// //   line 1: /usr/local/sbin
+/// //   line 1: /usr/local/bin
+/// //   line 1: /usr/bin
+/// // /etc/profile.d/go.sh (editing needs root)
+/// //   line 2: /usr/local/go/bin (not in PATH)
+/// //
+/// // 3 of 7 PATH entries are set by system files.
+/// ```
+pub fn execute() {
+    if cfg!(windows) {
+        status!("System-wide PATH is kept in the registry on Windows; edit it with `add --system` or `delete --system`.");
+        return;
+    }
+
+    let files = scan_system_files(Path::new("/"));
+    if files.is_empty() {
+        status!("No system file sets PATH.");
+        return;
+    }
+
+    let current = utils::get_path_entries();
+    print_system_files(&files, &current);
+
+    let from_system = current
+        .iter()
+        .filter(|entry| {
+            files
+                .iter()
+                .flat_map(|file| &file.contributions)
+                .any(|contribution| contribution.entries.contains(entry))
+        })
+        .count();
+    status!(
+        "\n{} of {} PATH entries are set by system files.",
+        from_system,
+        current.len()
+    );
+}
+
+#[cfg(all(test, unix))]
+mod tests {
+    use super::*;
+    use std::io;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_scan_system_files() -> io::Result<()> {
+        let root = TempDir::new()?;
+        let etc = root.path().join("etc");
+        fs::create_dir_all(etc.join("profile.d"))?;
+        fs::create_dir_all(etc.join("paths.d"))?;
+        fs::write(etc.join("environment"), "PATH=\"/usr/bin:/bin\"\n")?;
+        fs::write(etc.join("paths.d/tool"), "/opt/tool/bin\n")?;
+        fs::write(
+            etc.join("profile.d/go.sh"),
+            "export PATH=$PATH:/opt/go/bin\n",
+        )?;
+        fs::write(
+            etc.join("profile.d/go.csh"),
+            "setenv PATH $PATH:/opt/go/bin\n",
+        )?;
+        fs::write(etc.join("profile"), "umask 022\n")?;
+
+        let files = scan_system_files(root.path());
+        let scanned: Vec<(PathBuf, SystemFileKind)> = files
+            .iter()
+            .map(|file| (file.file.clone(), file.kind))
+            .collect();
+        assert_eq!(
+            scanned,
+            vec![
+                (etc.join("environment"), SystemFileKind::Environment),
+                (etc.join("paths.d/tool"), SystemFileKind::PathList),
+                (etc.join("profile.d/go.sh"), SystemFileKind::Script),
+            ]
+        );
+        assert!(files.iter().all(|file| file.writable));
+        Ok(())
+    }
+}
@@ -0,0 +1,92 @@
+//! Command implementation for undoing pathmaster edits.
+//!
+//! This module handles:
+//! - Restoring the shell config touched by the most recent pathmaster edit
+//! - Stepping further back on repeated runs
+//! - Listing the undo history
+//!
+//! Snapshots are recorded by every shell config edit; see `utils::undo`.
+
+use crate::status;
+use crate::utils::hooks;
+use crate::utils::undo::{list_snapshots, next_undo, undo_last, StoredSnapshot};
+
+/// Executes the undo command
+///
+/// # Arguments
+///
+/// * `list` - Show the undo history instead of undoing anything
+///
+/// # Example
+///
+/// ```no_run
+/// # use pathmaster::commands;
+/// // Revert the last add, delete, flush, ...
+/// commands::undo::execute(false);
+/// ```
+pub fn execute(list: bool) {
+    if list {
+        match list_snapshots() {
+            Ok(snapshots) => print_history(&snapshots),
+            Err(e) => {
+                eprintln!("Error reading undo history: {}", e);
+                std::process::exit(1);
+            }
+        }
+        return;
+    }
+
+    // Hooks see the file the undo is about to restore
+    let result = next_undo().and_then(|next| match next {
+        Some(stored) => hooks::with_hooks(&stored.snapshot.location(), undo_last),
+        None => Ok(None),
+    });
+    match result {
+        Ok(Some(snapshot)) => {
+            if snapshot.content.is_some() || snapshot.fish_user_paths.is_some() {
+                status!(
+                    "Restored {} to its state before the change at {}",
+                    snapshot.location().display(),
+                    snapshot.timestamp
+                );
+            } else {
+                status!(
+                    "Removed {}, which was created by the change at {}",
+                    snapshot.file.display(),
+                    snapshot.timestamp
+                );
+            }
+            status!("Open a new shell to use the restored PATH, or run `pathmaster redo` to reapply the change.");
+        }
+        Ok(None) => status!("Nothing to undo."),
+        Err(e) => {
+            eprintln!("Error undoing the last change: {}", e);
+            std::process::exit(1);
+        }
+    }
+}
+
+/// Prints the undo stack, most recent first
+fn print_history(snapshots: &[StoredSnapshot]) {
+    if snapshots.is_empty() {
+        status!("Nothing to undo.");
+        return;
+    }
+
+    status!("Undo history (most recent first):");
+    for (index, stored) in snapshots.iter().enumerate() {
+        let note = if stored.snapshot.content.is_none() && stored.snapshot.fish_user_paths.is_none()
+        {
+            " (created)"
+        } else {
+            ""
+        };
+        println!(
+            "{:>3}. {} {}{}",
+            index + 1,
+            stored.snapshot.timestamp,
+            stored.snapshot.location().display(),
+            note
+        );
+    }
+}
@@ -3,9 +3,72 @@
 //! This module provides functionality to validate directories in the PATH
 //! environment variable, separating them into existing and missing directories.
 //! It handles validation of both individual paths and the complete PATH.
+//!
+//! Large PATHs can be validated concurrently by a bounded pool of worker
+//! threads, with an optional timeout so entries on unresponsive network
+//! mounts cannot hang pathmaster. Entries that do not answer in time are
+//! reported as unreachable rather than invalid.
 
+use crate::utils;
+use lazy_static::lazy_static;
+use serde::Serialize;
+use std::collections::HashMap;
 use std::env;
+use std::fs;
+use std::io;
 use std::path::{Path, PathBuf};
+use std::sync::atomic::{AtomicUsize, Ordering};
+use std::sync::{mpsc, Arc, Mutex};
+use std::thread;
+use std::time::{Duration, Instant};
+
+lazy_static! {
+    static ref VALIDATION_JOBS: Mutex<Option<usize>> = Mutex::new(None);
+    static ref VALIDATION_TIMEOUT: Mutex<Option<Duration>> = Mutex::new(None);
+}
+
+/// Sets how many entries are validated at once, or restores the default with `None`
+pub fn set_validation_jobs(jobs: Option<usize>) -> io::Result<()> {
+    let mut validation_jobs = VALIDATION_JOBS.lock().map_err(|_| {
+        io::Error::new(io::ErrorKind::Other, "Failed to lock validation jobs mutex")
+    })?;
+    *validation_jobs = jobs;
+    Ok(())
+}
+
+/// Gets how many entries are validated at once
+///
+/// Defaults to the number of available CPUs.
+pub fn get_validation_jobs() -> io::Result<usize> {
+    let validation_jobs = VALIDATION_JOBS.lock().map_err(|_| {
+        io::Error::new(io::ErrorKind::Other, "Failed to lock validation jobs mutex")
+    })?;
+    Ok(validation_jobs.unwrap_or_else(|| thread::available_parallelism().map_or(1, |n| n.get())))
+}
+
+/// Sets how long to wait for entries before reporting them unreachable, or
+/// removes the limit with `None`
+pub fn set_validation_timeout(timeout: Option<Duration>) -> io::Result<()> {
+    let mut validation_timeout = VALIDATION_TIMEOUT.lock().map_err(|_| {
+        io::Error::new(
+            io::ErrorKind::Other,
+            "Failed to lock validation timeout mutex",
+        )
+    })?;
+    *validation_timeout = timeout;
+    Ok(())
+}
+
+/// Gets how long to wait for entries before reporting them unreachable
+pub fn get_validation_timeout() -> io::Result<Option<Duration>> {
+    let validation_timeout = VALIDATION_TIMEOUT.lock().map_err(|_| {
+        io::Error::new(
+            io::ErrorKind::Other,
+            "Failed to lock validation timeout mutex",
+        )
+    })?;
+    Ok(*validation_timeout)
+}
 
 /// Represents the validation results of PATH directories.
 #[derive(Debug, PartialEq)]
@@ -25,7 +88,191 @@ pub struct PathValidation {
 /// * `true` if the path exists and is a directory
 /// * `false` otherwise
 pub fn is_valid_path_entry(path: &Path) -> bool {
-    path.exists() && path.is_dir()
+    EntryKind::of(path) == EntryKind::Directory
+}
+
+/// What a PATH entry refers to on the filesystem
+#[derive(Debug, Clone, Copy, PartialEq, Serialize)]
+#[serde(rename_all = "snake_case")]
+pub enum EntryKind {
+    /// An existing directory
+    Directory,
+    /// Something that exists but is not a directory
+    NotDirectory,
+    /// Nothing exists at the path
+    Missing,
+    /// The path cannot be looked up by this user, but may be valid for others
+    NoPermission,
+    /// The lookup did not finish in time, e.g. on a hung network mount
+    Unreachable,
+}
+
+impl EntryKind {
+    /// Returns whether the entry is known to be unusable in PATH by this user
+    ///
+    /// Unreachable entries are not invalid: they may work once their
+    /// filesystem responds again.
+    pub fn is_invalid(self) -> bool {
+        matches!(
+            self,
+            EntryKind::NotDirectory | EntryKind::Missing | EntryKind::NoPermission
+        )
+    }
+
+    /// Looks up a path with a single metadata call
+    ///
+    /// # Example
+    /// ```rust
+    /// # use pathmaster::commands::validator::EntryKind;
+    /// # use std::path::Path;
+    /// assert_eq!(EntryKind::of(Path::new("/nonexistent/pathmaster")), EntryKind::Missing);
+    /// ```
+    pub fn of(path: &Path) -> Self {
+        match fs::metadata(path) {
+            Ok(metadata) if metadata.is_dir() => EntryKind::Directory,
+            Ok(_) => EntryKind::NotDirectory,
+            Err(e) if e.kind() == io::ErrorKind::PermissionDenied => EntryKind::NoPermission,
+            Err(_) => EntryKind::Missing,
+        }
+    }
+}
+
+/// Memoizes filesystem lookups of PATH entries for a single command run.
+///
+/// Repeated or equivalent entries (e.g. `/usr/bin` and `/usr/bin/`) are
+/// looked up once, which matters on large PATHs and slow network
+/// filesystems. Results are not invalidated, so a cache should not outlive
+/// the command that created it.
+#[derive(Debug, Default)]
+pub struct ValidityCache {
+    kinds: HashMap<PathBuf, EntryKind>,
+}
+
+impl ValidityCache {
+    /// Creates an empty cache
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// Returns what the path refers to, looking it up only on first use.
+    ///
+    /// Entries are keyed on their components, which drops repeated and
+    /// trailing separators and `.` components. `..` is kept because it is
+    /// resolved through symlinks, and `~` and variables are not expanded
+    /// because PATH lookups do not expand them either.
+    pub fn kind(&mut self, path: &Path) -> EntryKind {
+        let key: PathBuf = path.components().collect();
+        *self.kinds.entry(key).or_insert_with(|| EntryKind::of(path))
+    }
+
+    /// Returns whether the path is an existing directory
+    pub fn is_valid(&mut self, path: &Path) -> bool {
+        self.kind(path) == EntryKind::Directory
+    }
+
+    /// Looks up every entry not yet cached, concurrently
+    ///
+    /// Uses the configured number of jobs and timeout (see
+    /// [`set_validation_jobs`] and [`set_validation_timeout`]). Entries that
+    /// do not answer within the timeout are cached as unreachable.
+    pub fn prefetch(&mut self, entries: &[PathBuf]) -> io::Result<()> {
+        let mut pending = Vec::new();
+        let mut keys = Vec::new();
+        for entry in entries {
+            let key: PathBuf = entry.components().collect();
+            if !self.kinds.contains_key(&key) && !keys.contains(&key) {
+                pending.push(entry.clone());
+                keys.push(key);
+            }
+        }
+
+        let kinds = validate_entries(&pending, get_validation_jobs()?, get_validation_timeout()?);
+        self.kinds.extend(keys.into_iter().zip(kinds));
+        Ok(())
+    }
+}
+
+/// Looks up PATH entries concurrently, returning results in the original order
+///
+/// At most `jobs` lookups run at a time. A lookup stuck on a dead network
+/// mount cannot be interrupted, so on timeout its worker thread is left
+/// behind and the entries that did not finish are reported as
+/// [`EntryKind::Unreachable`].
+///
+/// # Arguments
+/// * `entries` - The entries to look up
+/// * `jobs` - Maximum number of concurrent lookups (at least one is used)
+/// * `timeout` - How long to wait for all lookups, or `None` to wait indefinitely
+///
+/// # Returns
+/// One result per entry, in the same order
+pub fn validate_entries(
+    entries: &[PathBuf],
+    jobs: usize,
+    timeout: Option<Duration>,
+) -> Vec<EntryKind> {
+    lookup_concurrently(entries, jobs, timeout, EntryKind::of)
+}
+
+/// Runs `lookup` over the entries in a bounded worker pool
+///
+/// Generic over the lookup so timeouts can be tested without a hung mount.
+fn lookup_concurrently(
+    entries: &[PathBuf],
+    jobs: usize,
+    timeout: Option<Duration>,
+    lookup: fn(&Path) -> EntryKind,
+) -> Vec<EntryKind> {
+    let deadline = timeout.map(|timeout| Instant::now() + timeout);
+    let paths = Arc::new(entries.to_vec());
+    let next = Arc::new(AtomicUsize::new(0));
+    let (sender, receiver) = mpsc::channel();
+
+    for _ in 0..jobs.max(1).min(entries.len()) {
+        let paths = Arc::clone(&paths);
+        let next = Arc::clone(&next);
+        let sender = sender.clone();
+        thread::spawn(move || loop {
+            let index = next.fetch_add(1, Ordering::Relaxed);
+            let path = match paths.get(index) {
+                Some(path) => path,
+                None => break,
+            };
+            // The receiver is gone once the caller has timed out
+            if sender.send((index, lookup(path))).is_err() {
+                break;
+            }
+        });
+    }
+    drop(sender);
+
+    let mut kinds: Vec<Option<EntryKind>> = vec![None; entries.len()];
+    for _ in 0..entries.len() {
+        let received = match deadline {
+            Some(deadline) => receiver
+                .recv_timeout(deadline.saturating_duration_since(Instant::now()))
+                .ok(),
+            None => receiver.recv().ok(),
+        };
+        match received {
+            Some((index, kind)) => kinds[index] = Some(kind),
+            None => break,
+        }
+    }
+
+    kinds
+        .into_iter()
+        .map(|kind| kind.unwrap_or(EntryKind::Unreachable))
+        .collect()
+}
+
+/// Looks up a single path, giving up after `timeout`
+///
+/// # Returns
+/// * `EntryKind::Unreachable` if the lookup did not finish in time
+/// * What the path refers to otherwise
+pub fn entry_kind_within(path: &Path, timeout: Duration) -> EntryKind {
+    validate_entries(&[path.to_path_buf()], 1, Some(timeout))[0]
 }
 
 impl PathValidation {
@@ -61,6 +308,7 @@ impl PathValidation {
 /// # Returns
 /// * `Ok(PathValidation)` - Validation results with existing and missing directories
 /// * `Err(std::io::Error)` - If there are problems accessing the filesystem
+#[allow(dead_code)]
 pub fn validate_path() -> std::io::Result<PathValidation> {
     let mut validation = PathValidation::new();
 
@@ -77,7 +325,7 @@ pub fn validate_path() -> std::io::Result<PathValidation> {
     };
 
     // Process each PATH entry
-    for entry in env::split_paths(&path_var) {
+    for entry in utils::parse_path_entries(&path_var) {
         if !entry.as_os_str().is_empty() {
             validation.add_path(entry);
         }
@@ -105,6 +353,115 @@ mod tests {
         assert!(!is_valid_path_entry(&invalid_path));
     }
 
+    #[test]
+    fn test_validity_cache() {
+        let temp_dir = TempDir::new().unwrap();
+        let dir = temp_dir.path().join("bin");
+        let file = temp_dir.path().join("file");
+        fs::create_dir(&dir).unwrap();
+        fs::write(&file, "").unwrap();
+
+        let mut cache = ValidityCache::new();
+        assert_eq!(cache.kind(&dir), EntryKind::Directory);
+        assert_eq!(cache.kind(&file), EntryKind::NotDirectory);
+        assert_eq!(
+            cache.kind(&temp_dir.path().join("missing")),
+            EntryKind::Missing
+        );
+
+        // Later lookups of the same entry, in any spelling, hit the cache
+        fs::remove_dir(&dir).unwrap();
+        assert!(cache.is_valid(&dir));
+        assert!(cache.is_valid(&PathBuf::from(format!("{}/./", dir.display()))));
+        assert!(!is_valid_path_entry(&dir));
+    }
+
+    #[test]
+    fn test_validate_entries_keeps_order() {
+        let temp_dir = TempDir::new().unwrap();
+        let file = temp_dir.path().join("file");
+        fs::write(&file, "").unwrap();
+
+        let mut entries = Vec::new();
+        let mut expected = Vec::new();
+        for i in 0..40 {
+            let (entry, kind) = match i % 3 {
+                0 => (temp_dir.path().to_path_buf(), EntryKind::Directory),
+                1 => (file.clone(), EntryKind::NotDirectory),
+                _ => (
+                    temp_dir.path().join(format!("missing{}", i)),
+                    EntryKind::Missing,
+                ),
+            };
+            entries.push(entry);
+            expected.push(kind);
+        }
+
+        assert_eq!(validate_entries(&entries, 4, None), expected);
+        // Zero jobs still makes progress
+        assert_eq!(
+            validate_entries(&entries, 0, Some(Duration::from_secs(30))),
+            expected
+        );
+        assert!(validate_entries(&[], 4, None).is_empty());
+        assert_eq!(
+            entry_kind_within(temp_dir.path(), Duration::from_secs(30)),
+            EntryKind::Directory
+        );
+    }
+
+    #[test]
+    fn test_slow_entries_are_unreachable() {
+        fn lookup(path: &Path) -> EntryKind {
+            if path.starts_with("/hung") {
+                thread::sleep(Duration::from_secs(5));
+            }
+            EntryKind::Directory
+        }
+
+        let entries = vec![PathBuf::from("/usr/bin"), PathBuf::from("/hung/mount/bin")];
+        let kinds = lookup_concurrently(&entries, 2, Some(Duration::from_millis(500)), lookup);
+        assert_eq!(kinds, vec![EntryKind::Directory, EntryKind::Unreachable]);
+        assert!(!EntryKind::Unreachable.is_invalid());
+    }
+
+    #[cfg(unix)]
+    #[test]
+    fn test_no_permission() {
+        use std::os::unix::fs::PermissionsExt;
+
+        let temp_dir = TempDir::new().unwrap();
+        let locked = temp_dir.path().join("locked");
+        let bin = locked.join("bin");
+        fs::create_dir_all(&bin).unwrap();
+        fs::set_permissions(&locked, fs::Permissions::from_mode(0o000)).unwrap();
+
+        let kind = EntryKind::of(&bin);
+        fs::set_permissions(&locked, fs::Permissions::from_mode(0o755)).unwrap();
+
+        // root bypasses permission checks
+        if kind != EntryKind::Directory {
+            assert_eq!(kind, EntryKind::NoPermission);
+            assert!(kind.is_invalid());
+        }
+    }
+
+    #[test]
+    fn test_prefetch_fills_cache() {
+        let temp_dir = TempDir::new().unwrap();
+        let dir = temp_dir.path().join("bin");
+        fs::create_dir(&dir).unwrap();
+
+        let mut cache = ValidityCache::new();
+        cache
+            .prefetch(&[dir.clone(), dir.join("."), temp_dir.path().join("missing")])
+            .unwrap();
+        assert_eq!(cache.kinds.len(), 2);
+
+        fs::remove_dir(&dir).unwrap();
+        assert!(cache.is_valid(&dir));
+    }
+
     #[test]
     fn test_validation_struct() {
         let mut validation = PathValidation::new();
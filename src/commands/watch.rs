@@ -0,0 +1,123 @@
+//! Command implementation for linting the shell config as it is edited.
+//!
+//! This module provides functionality to:
+//! - Watch the shell config file that declares PATH
+//! - Re-check the PATH entries it declares whenever it is saved
+//! - Print problems as they are introduced, until interrupted with Ctrl-C
+
+use crate::commands::check::{self, CheckReport};
+use crate::commands::validator::ValidityCache;
+use crate::status;
+use crate::utils::shell::factory::get_shell_handler;
+use crate::utils::shell::handlers::ShellHandler;
+use crate::utils::watch::{self, FileWatcher};
+use chrono::Local;
+use std::fs;
+use std::io;
+use std::path::Path;
+use std::process;
+use std::time::Duration;
+
+/// Checks the PATH entries declared in a config file
+///
+/// # Returns
+/// * `Ok(Some(CheckReport))` - Problems found in the declared entries
+/// * `Ok(None)` - The config file does not exist
+/// * `Err(io::Error)` if the file cannot be read
+pub fn check_config(handler: &dyn ShellHandler, config: &Path) -> io::Result<Option<CheckReport>> {
+    let content = match fs::read_to_string(config) {
+        Ok(content) => content,
+        Err(e) if e.kind() == io::ErrorKind::NotFound => return Ok(None),
+        Err(e) => return Err(e),
+    };
+
+    let entries = handler.parse_path_entries(&content);
+    // Directories may have come and gone since the last check
+    let mut cache = ValidityCache::new();
+    cache.prefetch(&entries)?;
+    Ok(Some(check::check_entries(&entries, &mut cache)))
+}
+
+/// Checks the config and prints the result with the current time
+fn report(handler: &dyn ShellHandler, config: &Path) {
+    print!("[{}] ", Local::now().format("%H:%M:%S"));
+    match check_config(handler, config) {
+        Ok(Some(report)) => check::print_report(&report),
+        Ok(None) => println!("{} does not exist", config.display()),
+        Err(e) => eprintln!("Error checking {}: {}", config.display(), e),
+    }
+}
+
+/// Executes the watch command
+///
+/// Runs until interrupted with Ctrl-C.
+///
+/// # Arguments
+///
+/// * `debounce` - How long the file must be quiet before it is checked
+///
+/// # Example
+///
+/// ```no_run
+/// # use pathmaster::commands;
+/// # use std::time::Duration;
+/// commands::watch::execute(Duration::from_millis(300));
+/// ```
+pub fn execute(debounce: Duration) {
+    let handler = get_shell_handler();
+    let config = handler.target_config_path();
+
+    let mut watcher =
+        match watch::install_interrupt_handler().and_then(|_| FileWatcher::new(&config)) {
+            Ok(watcher) => watcher,
+            Err(e) => {
+                eprintln!("Error watching {}: {}", config.display(), e);
+                process::exit(1);
+            }
+        };
+
+    status!(
+        "Watching {} for PATH changes (press Ctrl-C to stop)",
+        watcher.file().display()
+    );
+    report(handler.as_ref(), &config);
+
+    loop {
+        match watcher.wait_for_change(debounce) {
+            Ok(true) => report(handler.as_ref(), &config),
+            Ok(false) => break,
+            Err(e) => {
+                eprintln!("Error watching {}: {}", config.display(), e);
+                process::exit(1);
+            }
+        }
+    }
+
+    status!("\nStopped watching {}", config.display());
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::utils::shell::handlers::zsh::ZshHandler;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_check_config_reports_declared_entries() -> io::Result<()> {
+        let temp_dir = TempDir::new()?;
+        let config = temp_dir.path().join(".zshrc");
+        let handler = ZshHandler::new();
+        assert!(check_config(&handler, &config)?.is_none());
+
+        let valid = temp_dir.path().display().to_string();
+        fs::write(
+            &config,
+            format!("export PATH=\"{0}:{0}/missing:{0}\"\n", valid),
+        )?;
+
+        let report = check_config(&handler, &config)?.unwrap();
+        assert_eq!(report.missing, vec![temp_dir.path().join("missing")]);
+        assert_eq!(report.duplicates, vec![temp_dir.path().to_path_buf()]);
+        Ok(())
+    }
+}
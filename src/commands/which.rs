@@ -0,0 +1,480 @@
+//! Command implementation for finding which PATH entry provides a command.
+//!
+//! This module provides functionality to:
+//! - Search every PATH entry for a command, in priority order
+//! - Report the copy the shell runs and every copy it shadows
+//! - Point out copies that are the same file reached through a symlink, and
+//!   files with the command's name that are not executable
+//! - Find every command shadowed by another copy earlier in PATH, for
+//!   `check --shadows`
+//! - Find commands in new directories that would hide system commands, for
+//!   `add --warn-shadows`
+//!
+//! On Windows the extensions in `PATHEXT` are tried as well, as the shell does.
+
+use crate::status;
+use crate::utils;
+use std::collections::HashMap;
+use std::env;
+use std::fs;
+use std::path::{Path, PathBuf};
+use std::process;
+
+/// Directories holding the system's own commands
+#[cfg(not(windows))]
+pub const TRUSTED_DIRS: &[&str] = &["/usr/bin", "/bin", "/usr/sbin", "/sbin"];
+
+/// Directories holding the system's own commands
+#[cfg(windows)]
+pub const TRUSTED_DIRS: &[&str] = &["C:\\Windows\\System32", "C:\\Windows"];
+
+/// A file named like the command in one PATH entry
+#[derive(Debug, PartialEq)]
+pub struct CommandMatch {
+    /// Position of the PATH entry, counting from 1
+    pub position: usize,
+    /// The matching file
+    pub file: PathBuf,
+    /// Whether the file can be run; others are skipped by the shell
+    pub executable: bool,
+    /// Position of an earlier match that is the same file, e.g. through a
+    /// symlinked directory such as `/bin` pointing at `/usr/bin`
+    pub same_as: Option<usize>,
+}
+
+/// Returns whether a file can be run
+#[cfg(unix)]
+fn is_executable(file: &Path) -> bool {
+    use std::os::unix::fs::PermissionsExt;
+
+    fs::metadata(file)
+        .map(|metadata| metadata.is_file() && metadata.permissions().mode() & 0o111 != 0)
+        .unwrap_or(false)
+}
+
+/// Returns whether a file can be run
+#[cfg(not(unix))]
+fn is_executable(file: &Path) -> bool {
+    file.is_file()
+}
+
+/// Returns the file names the shell tries for a command
+///
+/// Just the name on Unix. On Windows, a name without an extension is tried
+/// with each extension in `PATHEXT`.
+fn candidate_names(command: &str) -> Vec<String> {
+    if !cfg!(windows) || Path::new(command).extension().is_some() {
+        return vec![command.to_string()];
+    }
+
+    let extensions = env::var("PATHEXT").unwrap_or_else(|_| ".COM;.EXE;.BAT;.CMD".to_string());
+    extensions
+        .split(';')
+        .filter(|ext| !ext.is_empty())
+        .map(|ext| format!("{}{}", command, ext.to_lowercase()))
+        .collect()
+}
+
+/// Finds every copy of a command in PATH entries
+///
+/// # Arguments
+///
+/// * `command` - The command name, e.g. `gcc`
+/// * `entries` - PATH entries in priority order
+///
+/// # Returns
+///
+/// Every file named like the command, in priority order. The first
+/// executable one is the copy the shell runs.
+pub fn find_command(command: &str, entries: &[PathBuf]) -> Vec<CommandMatch> {
+    let names = candidate_names(command);
+    let mut matches: Vec<CommandMatch> = Vec::new();
+    let mut resolved: Vec<(usize, PathBuf)> = Vec::new();
+
+    for (index, entry) in entries.iter().enumerate() {
+        if utils::is_empty_entry(entry) {
+            continue;
+        }
+
+        for name in &names {
+            let file = entry.join(name);
+            if !file.is_file() {
+                continue;
+            }
+
+            let canonical = fs::canonicalize(&file).unwrap_or_else(|_| file.clone());
+            let same_as = resolved
+                .iter()
+                .find(|(_, earlier)| *earlier == canonical)
+                .map(|(position, _)| *position);
+            resolved.push((index + 1, canonical));
+
+            matches.push(CommandMatch {
+                position: index + 1,
+                executable: is_executable(&file),
+                file,
+                same_as,
+            });
+        }
+    }
+
+    matches
+}
+
+/// A command found in more than one PATH directory
+#[derive(Debug, PartialEq)]
+pub struct Shadow {
+    /// The command name
+    pub command: String,
+    /// Directory of the copy the shell runs
+    pub winner: PathBuf,
+    /// Directories of the copies it hides, in priority order
+    pub shadowed: Vec<PathBuf>,
+}
+
+/// Returns the command a file provides, if it is executable
+///
+/// On Windows the extension must be one of `PATHEXT`, and is dropped.
+pub fn command_name(file: &Path) -> Option<String> {
+    if !is_executable(file) {
+        return None;
+    }
+    let name = file.file_name()?.to_str()?;
+    if !cfg!(windows) {
+        return Some(name.to_string());
+    }
+
+    let extension = format!(".{}", file.extension()?.to_str()?).to_lowercase();
+    let extensions = env::var("PATHEXT").unwrap_or_else(|_| ".COM;.EXE;.BAT;.CMD".to_string());
+    if !extensions
+        .to_lowercase()
+        .split(';')
+        .any(|ext| ext == extension)
+    {
+        return None;
+    }
+    Some(file.file_stem()?.to_str()?.to_lowercase())
+}
+
+/// Finds commands that more than one PATH directory provides
+///
+/// Every directory is listed, so this is much slower than looking up one
+/// command. A directory listed twice, or reached twice through a symlink,
+/// does not shadow itself, and neither does a copy that is the same file as
+/// the winning one.
+///
+/// # Arguments
+///
+/// * `entries` - PATH entries in priority order
+///
+/// # Returns
+///
+/// One `Shadow` per shadowed command, sorted by command name
+pub fn find_shadows(entries: &[PathBuf]) -> Vec<Shadow> {
+    let mut seen_dirs = Vec::new();
+    // Each command's copies, as (directory, file)
+    let mut copies: HashMap<String, Vec<(PathBuf, PathBuf)>> = HashMap::new();
+
+    for entry in entries {
+        if utils::is_empty_entry(entry) {
+            continue;
+        }
+        let dir = fs::canonicalize(entry).unwrap_or_else(|_| entry.clone());
+        if seen_dirs.contains(&dir) {
+            continue;
+        }
+        seen_dirs.push(dir);
+
+        let listing = match fs::read_dir(entry) {
+            Ok(listing) => listing,
+            Err(_) => continue,
+        };
+        for file in listing.flatten() {
+            let file = file.path();
+            if let Some(command) = command_name(&file) {
+                copies
+                    .entry(command)
+                    .or_default()
+                    .push((entry.clone(), file));
+            }
+        }
+    }
+
+    let mut shadows: Vec<Shadow> = copies
+        .into_iter()
+        .filter(|(_, found)| found.len() > 1)
+        .filter_map(|(command, found)| {
+            // Only now is each copy resolved, as most commands have one
+            let mut files: Vec<PathBuf> = Vec::new();
+            let mut distinct = Vec::new();
+            for (dir, file) in found {
+                let resolved = fs::canonicalize(&file).unwrap_or(file);
+                if !files.contains(&resolved) {
+                    files.push(resolved);
+                    distinct.push(dir);
+                }
+            }
+            if distinct.len() < 2 {
+                return None;
+            }
+            let winner = distinct.remove(0);
+            Some(Shadow {
+                command,
+                winner,
+                shadowed: distinct,
+            })
+        })
+        .collect();
+
+    shadows.sort_by(|a, b| a.command.cmp(&b.command));
+    shadows
+}
+
+/// Finds commands in new PATH directories that would hide a trusted copy
+///
+/// Only the new directories and the trusted ones are listed, so this is
+/// quick enough to run on every add. A command only counts when the new
+/// directory comes first in `entries`.
+///
+/// # Arguments
+///
+/// * `new_dirs` - Directories about to be added
+/// * `entries` - PATH entries after the add, in priority order
+/// * `trusted` - Directories holding the system's own commands, such as
+///   `TRUSTED_DIRS`
+///
+/// # Returns
+///
+/// One `Shadow` per hidden command, with only the trusted directories it
+/// hides, sorted by command name
+pub fn find_trusted_shadows(
+    new_dirs: &[PathBuf],
+    entries: &[PathBuf],
+    trusted: &[PathBuf],
+) -> Vec<Shadow> {
+    let relevant: Vec<PathBuf> = entries
+        .iter()
+        .filter(|entry| new_dirs.contains(entry) || trusted.contains(entry))
+        .cloned()
+        .collect();
+
+    find_shadows(&relevant)
+        .into_iter()
+        .filter(|shadow| new_dirs.contains(&shadow.winner))
+        .filter_map(|mut shadow| {
+            shadow.shadowed.retain(|dir| trusted.contains(dir));
+            (!shadow.shadowed.is_empty()).then(|| shadow)
+        })
+        .collect()
+}
+
+/// Executes the which command to show which PATH entries provide a command
+///
+/// Exits with status 1 if no executable copy is found.
+///
+/// # Arguments
+///
+/// * `command` - The command name to look up
+///
+/// # Example
+///
+/// ```no_run
+/// # use pathmaster::commands;
+/// commands::which::execute("gcc");
+/// // Output example:
+/// // gcc is provided by 2 PATH entries, in priority order:
+/// //   [3] /usr/local/bin/gcc (used)
+/// //   [6] /usr/bin/gcc (shadowed)
+/// ```
+pub fn execute(command: &str) {
+    if command.is_empty() || command.contains(std::path::is_separator) {
+        eprintln!("'{}' is not a command name", command);
+        process::exit(1);
+    }
+
+    let matches = find_command(command, &utils::get_path_entries());
+    let executable = matches.iter().filter(|m| m.executable).count();
+
+    if executable == 0 {
+        eprintln!("{} was not found in any PATH entry", command);
+    } else {
+        status!(
+            "{} is provided by {} PATH entr{}, in priority order:",
+            command,
+            executable,
+            if executable == 1 { "y" } else { "ies" }
+        );
+    }
+
+    let mut used = false;
+    for m in &matches {
+        let mut notes = Vec::new();
+        if !m.executable {
+            notes.push("not executable, skipped".to_string());
+        } else if used {
+            notes.push("shadowed".to_string());
+        } else {
+            notes.push("used".to_string());
+            used = true;
+        }
+        if let Some(position) = m.same_as {
+            notes.push(format!("same file as entry {}", position));
+        }
+        println!(
+            "  [{}] {} ({})",
+            m.position,
+            m.file.display(),
+            notes.join("; ")
+        );
+    }
+
+    if executable == 0 {
+        process::exit(1);
+    }
+}
+
+#[cfg(all(test, unix))]
+mod tests {
+    use super::*;
+    use std::os::unix::fs::{symlink, PermissionsExt};
+    use tempfile::TempDir;
+
+    fn write_file(file: &Path, mode: u32) {
+        fs::write(file, "#!/bin/sh\n").unwrap();
+        fs::set_permissions(file, fs::Permissions::from_mode(mode)).unwrap();
+    }
+
+    #[test]
+    fn test_find_command_lists_shadowed_copies() {
+        let temp_dir = TempDir::new().unwrap();
+        let dirs: Vec<PathBuf> = ["local", "usr", "opt", "empty"]
+            .iter()
+            .map(|name| temp_dir.path().join(name))
+            .collect();
+        for dir in &dirs {
+            fs::create_dir(dir).unwrap();
+        }
+        write_file(&dirs[0].join("tool"), 0o755);
+        write_file(&dirs[1].join("tool"), 0o755);
+        write_file(&dirs[2].join("tool"), 0o644);
+        let linked = temp_dir.path().join("linked");
+        symlink(&dirs[1], &linked).unwrap();
+
+        let entries = vec![
+            dirs[3].clone(),
+            dirs[0].clone(),
+            dirs[1].clone(),
+            dirs[2].clone(),
+            linked.clone(),
+        ];
+        let matches = find_command("tool", &entries);
+
+        assert_eq!(
+            matches,
+            vec![
+                CommandMatch {
+                    position: 2,
+                    file: dirs[0].join("tool"),
+                    executable: true,
+                    same_as: None,
+                },
+                CommandMatch {
+                    position: 3,
+                    file: dirs[1].join("tool"),
+                    executable: true,
+                    same_as: None,
+                },
+                CommandMatch {
+                    position: 4,
+                    file: dirs[2].join("tool"),
+                    executable: false,
+                    same_as: None,
+                },
+                CommandMatch {
+                    position: 5,
+                    file: linked.join("tool"),
+                    executable: true,
+                    same_as: Some(3),
+                },
+            ]
+        );
+        assert!(find_command("missing", &entries).is_empty());
+    }
+
+    #[test]
+    fn test_find_shadows() {
+        let temp_dir = TempDir::new().unwrap();
+        let dirs: Vec<PathBuf> = ["first", "second", "third"]
+            .iter()
+            .map(|name| temp_dir.path().join(name))
+            .collect();
+        for dir in &dirs {
+            fs::create_dir(dir).unwrap();
+        }
+        for dir in &dirs {
+            write_file(&dir.join("tool"), 0o755);
+        }
+        write_file(&dirs[0].join("only"), 0o755);
+        write_file(&dirs[0].join("data"), 0o644);
+        write_file(&dirs[1].join("data"), 0o755);
+        // The same file under another name in PATH does not shadow itself
+        symlink(dirs[0].join("only"), dirs[2].join("only")).unwrap();
+        let linked = temp_dir.path().join("linked");
+        symlink(&dirs[0], &linked).unwrap();
+
+        let entries = vec![
+            dirs[0].clone(),
+            linked,
+            dirs[1].clone(),
+            dirs[0].clone(),
+            dirs[2].clone(),
+        ];
+        assert_eq!(
+            find_shadows(&entries),
+            vec![Shadow {
+                command: "tool".to_string(),
+                winner: dirs[0].clone(),
+                shadowed: vec![dirs[1].clone(), dirs[2].clone()],
+            }]
+        );
+    }
+
+    #[test]
+    fn test_find_trusted_shadows() {
+        let temp_dir = TempDir::new().unwrap();
+        let [new, other, system]: [PathBuf; 3] =
+            ["new", "other", "system"].map(|name| temp_dir.path().join(name));
+        for dir in [&new, &other, &system] {
+            fs::create_dir(dir).unwrap();
+        }
+        write_file(&new.join("ls"), 0o755);
+        write_file(&system.join("ls"), 0o755);
+        write_file(&new.join("node"), 0o755);
+        write_file(&other.join("node"), 0o755);
+        write_file(&new.join("rm"), 0o755);
+        write_file(&other.join("rm"), 0o755);
+        write_file(&system.join("rm"), 0o755);
+
+        let trusted = vec![system.clone()];
+        let prepended = vec![new.clone(), other.clone(), system.clone()];
+        assert_eq!(
+            find_trusted_shadows(&[new.clone()], &prepended, &trusted),
+            vec![
+                Shadow {
+                    command: "ls".to_string(),
+                    winner: new.clone(),
+                    shadowed: vec![system.clone()],
+                },
+                Shadow {
+                    command: "rm".to_string(),
+                    winner: new.clone(),
+                    shadowed: vec![system.clone()],
+                },
+            ]
+        );
+
+        // Appended after the system directory, it hides nothing there
+        let appended = vec![other, system, new.clone()];
+        assert!(find_trusted_shadows(&[new], &appended, &trusted).is_empty());
+    }
+}
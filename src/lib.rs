@@ -0,0 +1,434 @@
+//! Pathmaster - A powerful tool for managing your system's PATH environment variable.
+//!
+//! This library exposes the functionality behind the `pathmaster` binary so
+//! that other tools can manage PATH without shelling out:
+//! - Reading the current PATH entries
+//! - Adding and removing directories, persisting the change to the shell
+//!   configuration (or the registry on Windows)
+//! - Planning an add or a removal first, to preview or confirm it before
+//!   anything is written
+//! - Creating backups of PATH in any supported format
+//!
+//! The functions at the crate root are the stable API. The `backup`,
+//! `commands` and `utils` modules hold the underlying implementation used by
+//! the command-line interface.
+//!
+//! # Example
+//!
+//! ```no_run
+//! use pathmaster::{AddOptions, BackupFormat};
+//!
+//! pathmaster::backup(BackupFormat::Json)?;
+//! pathmaster::add("~/.local/bin", &AddOptions { prepend: true, ..Default::default() })?;
+//! for entry in pathmaster::entries() {
+//!     println!("{}", entry.display());
+//! }
+//! # Ok::<(), std::io::Error>(())
+//! ```
+
+pub mod backup;
+pub mod commands;
+pub mod utils;
+
+pub use backup::core::{Backup, StoredBackup};
+pub use backup::BackupFormat;
+pub use commands::add::AddPlan;
+pub use commands::delete::{Occurrence, RemovePlan};
+
+use commands::validator::is_valid_path_entry;
+use std::io;
+use std::path::{Path, PathBuf};
+use utils::path::check_glob;
+use utils::persist;
+
+/// Options controlling how `add` inserts a directory
+#[derive(Debug, Clone, Default)]
+pub struct AddOptions {
+    /// Put the directory at the front of PATH instead of the end
+    pub prepend: bool,
+    /// Edit the machine-wide PATH instead of the user PATH (Windows only)
+    pub system: bool,
+    /// Write the directory to the shell configuration unexpanded, e.g.
+    /// `$HOME/bin`, so the file works on machines with other home directories
+    pub literal: bool,
+    /// Accept a relative directory such as `./bin`, which PATH resolves
+    /// against whatever the working directory happens to be
+    pub allow_relative: bool,
+    /// Re-add a directory that is already in place, dropping any other
+    /// occurrences of it
+    pub force: bool,
+}
+
+/// Options controlling which entries `plan_remove` takes out of PATH
+#[derive(Debug, Clone, Default)]
+pub struct RemoveOptions {
+    /// Match every entry containing one of the directories instead of exact
+    /// paths
+    pub contains: bool,
+    /// Compare exact paths by their real location, so symlinks to a
+    /// directory match it
+    pub resolve_symlinks: bool,
+    /// Which of several entries matching a directory to remove
+    pub occurrence: Occurrence,
+    /// Only remove entries that pathmaster added
+    pub mine_only: bool,
+    /// Edit the machine-wide PATH instead of the user PATH (Windows only)
+    pub system: bool,
+}
+
+/// Returns the PATH entries of the current process, in priority order
+pub fn entries() -> Vec<PathBuf> {
+    utils::get_path_entries()
+}
+
+/// Returns why a saved PATH would leave the user with a broken shell
+///
+/// A PATH is broken when it is empty, or when none of its entries is an
+/// existing directory. Entries that still hold variables or command
+/// substitutions cannot be checked here and count as usable.
+fn saved_path_problem(saved: &[PathBuf]) -> Option<String> {
+    let entries: Vec<&PathBuf> = saved
+        .iter()
+        .filter(|entry| !utils::is_empty_entry(entry))
+        .collect();
+    if entries.is_empty() {
+        return Some("the saved PATH is empty".to_string());
+    }
+
+    let usable = entries.iter().any(|entry| {
+        entry.to_string_lossy().contains(|c| c == '$' || c == '`') || is_valid_path_entry(entry)
+    });
+    if !usable {
+        return Some(format!(
+            "none of the {} saved PATH entries is an existing directory",
+            entries.len()
+        ));
+    }
+    None
+}
+
+/// Makes the given entries the PATH, both now and for new sessions
+///
+/// The current PATH is backed up first, unless `auto_backup` is turned off
+/// in the config file. The entries then become the PATH of the current
+/// process and are saved to the shell configuration (or the registry on
+/// Windows).
+///
+/// What was saved is then read back and checked. If it is empty or has no
+/// existing directory, the change is rolled back to the state before it and
+/// an error is returned, so a bad edit never leaves a broken shell behind.
+///
+/// On macOS, a warning is printed if `path_helper` is likely to undo the
+/// change in login shells; see `utils::path_helper`.
+///
+/// The whole change runs between the `pre_edit_hook` and `post_edit_hook`
+/// from the config file, if set; see `utils::hooks`.
+///
+/// Entries the change takes out of PATH are dropped from the record of
+/// entries pathmaster added; see `utils::managed`.
+///
+/// # Arguments
+/// * `entries` - The complete new list of PATH entries
+/// * `system` - Edit the machine-wide PATH instead of the user PATH (Windows only)
+///
+/// # Returns
+/// * `Ok(Some(PathBuf))` with the location of the backup taken before the change
+/// * `Ok(None)` if automatic backups are turned off
+/// * `Err(io::Error)` if the pre-edit hook, the backup or the configuration
+///   update fails, or with kind `InvalidData` if the change was rolled back
+pub fn apply(entries: &[PathBuf], system: bool) -> io::Result<Option<PathBuf>> {
+    apply_as(entries, entries, system)
+}
+
+/// Like `apply`, but saves `saved` to the configuration instead of `entries`
+///
+/// `saved` holds the same entries in the form they should be written, such
+/// as `$HOME/bin` where `entries` has the expanded directory.
+pub fn apply_as(
+    entries: &[PathBuf],
+    saved: &[PathBuf],
+    system: bool,
+) -> io::Result<Option<PathBuf>> {
+    utils::hooks::with_hooks(&persist::saved_location(system), || {
+        let backup_file = backup::create::backup_before_change()
+            .map_err(|e| io::Error::new(e.kind(), format!("Error creating backup: {}", e)))?;
+
+        let previous = utils::get_path_entries();
+        let previous_saved = persist::load_saved(system)?;
+        utils::set_path_entries(entries);
+
+        persist::save_entries(saved, system).map_err(|e| {
+            io::Error::new(
+                e.kind(),
+                format!("Error updating shell configuration: {}", e),
+            )
+        })?;
+
+        let problem = persist::load_saved(system)
+            .map(|written| saved_path_problem(&written))
+            .unwrap_or_else(|e| Some(format!("the saved PATH cannot be read back: {}", e)));
+        if let Some(problem) = problem {
+            utils::set_path_entries(&previous);
+            persist::revert_save(&previous_saved, system).map_err(|e| {
+                io::Error::new(
+                    e.kind(),
+                    format!(
+                        "Change failed because {}, and rolling it back failed: {}",
+                        problem, e
+                    ),
+                )
+            })?;
+            let restored_from = match &backup_file {
+                Some(file) => format!(" (backup taken before the change: {})", file.display()),
+                None => String::new(),
+            };
+            return Err(io::Error::new(
+                io::ErrorKind::InvalidData,
+                format!(
+                    "Change rolled back because {}; PATH is unchanged{}",
+                    problem, restored_from
+                ),
+            ));
+        }
+
+        utils::path_helper::warn_overrides(&previous, entries);
+        if let Err(e) = utils::managed::forget_removed(entries, system) {
+            eprintln!(
+                "Warning: could not update the record of entries pathmaster added: {}",
+                e
+            );
+        }
+        Ok(backup_file)
+    })
+}
+
+/// Expands a directory given to `add`
+///
+/// # Returns
+/// The directory as PATH holds it, with `~` expanded and with `literal`
+/// environment variables too, and the form written to the shell
+/// configuration: the same directory, or with `literal` the form given, a
+/// leading `~` written as `$HOME`
+pub fn expand_new_dir(dir: &str, literal: bool) -> (PathBuf, PathBuf) {
+    if literal {
+        (
+            utils::path::expand_variables(dir),
+            utils::path::literal_path(dir),
+        )
+    } else {
+        let expanded = utils::expand_path(dir);
+        (expanded.clone(), expanded)
+    }
+}
+
+/// Checks that an expanded directory can be added to PATH
+///
+/// # Returns
+/// * `Ok(())` if the directory can be added
+/// * `Err(io::Error)` with kind `InvalidInput` if the directory is relative
+///   without `allow_relative`
+/// * `Err(io::Error)` with kind `InvalidInput` if the directory does not
+///   exist or is not a directory
+pub fn check_new_dir(dir: &Path, allow_relative: bool) -> io::Result<()> {
+    if !dir.is_absolute() && !allow_relative {
+        return Err(io::Error::new(
+            io::ErrorKind::InvalidInput,
+            format!("'{}' is a relative path", dir.display()),
+        ));
+    }
+    if !is_valid_path_entry(dir) {
+        return Err(io::Error::new(
+            io::ErrorKind::InvalidInput,
+            format!("'{}' is not a valid directory", dir.display()),
+        ));
+    }
+    Ok(())
+}
+
+/// Works out what adding directories does, without changing anything
+///
+/// Directories already in place are left alone; see `commands::add::plan_add`.
+///
+/// # Arguments
+/// * `dirs` - Directories to add, as returned by `expand_new_dir` and checked
+///   with `check_new_dir`
+/// * `options` - Where and how to add the directories
+///
+/// # Returns
+/// * `Ok(AddPlan)` - The PATH after the add, and what it adds
+/// * `Err(io::Error)` with kind `Unsupported` if a literal entry cannot be
+///   written for this shell
+/// * `Err(io::Error)` if PATH cannot be read
+pub fn plan_add(dirs: Vec<(PathBuf, PathBuf)>, options: &AddOptions) -> io::Result<AddPlan> {
+    if options.literal {
+        commands::add::check_literal_support()?;
+    }
+    let current = persist::load_entries(options.system)
+        .map_err(|e| io::Error::new(e.kind(), format!("Error reading PATH: {}", e)))?;
+    Ok(commands::add::plan_add(
+        &current,
+        dirs,
+        options.prepend,
+        options.force,
+    ))
+}
+
+/// Carries out an add plan
+///
+/// The PATH is changed as with `apply_as`, and the added directories are
+/// recorded as added by pathmaster; see `utils::managed`.
+///
+/// # Returns
+/// The same as `apply`
+pub fn apply_add(plan: &AddPlan, system: bool) -> io::Result<Option<PathBuf>> {
+    let backup_file = apply_as(&plan.entries, &plan.saved, system)?;
+    if let Err(e) = utils::managed::record_added(&plan.added, system) {
+        eprintln!("Warning: could not record entries pathmaster added: {}", e);
+    }
+    Ok(backup_file)
+}
+
+/// Adds a directory to PATH and persists the change
+///
+/// # Arguments
+/// * `dir` - The directory to add; `~` is expanded, and with `literal` so are
+///   environment variables
+/// * `options` - Where and how to add the directory
+///
+/// # Returns
+/// * `Ok(())` if the directory was added, or is already in place at the
+///   front or end of PATH
+/// * `Err(io::Error)` with kind `InvalidInput` if the directory does not
+///   exist, or is relative without `allow_relative`
+/// * `Err(io::Error)` with kind `Unsupported` if a literal entry cannot be
+///   written for this shell
+/// * `Err(io::Error)` from `apply` if saving the change fails
+pub fn add(dir: &str, options: &AddOptions) -> io::Result<()> {
+    let (dir, saved) = expand_new_dir(dir, options.literal);
+    check_new_dir(&dir, options.allow_relative)?;
+
+    let plan = plan_add(vec![(dir, saved)], options)?;
+    if !plan.added.is_empty() {
+        apply_add(&plan, options.system)?;
+    }
+    Ok(())
+}
+
+/// Works out which entries removing directories takes out of PATH, without
+/// changing anything
+///
+/// # Arguments
+/// * `directories` - Directories to remove; `~` is expanded, and trailing
+///   separators and `.`/`..` segments are ignored when matching
+/// * `globs` - Also remove every entry matching one of these patterns
+/// * `options` - How to match entries, and which PATH to edit
+///
+/// # Returns
+/// * `Ok(RemovePlan)` - The PATH after the removal, and what it removes
+/// * `Err(io::Error)` with kind `InvalidInput` if a glob pattern is malformed
+/// * `Err(io::Error)` if PATH, or with `mine_only` the record of entries
+///   pathmaster added, cannot be read
+pub fn plan_remove(
+    directories: &[String],
+    globs: &[String],
+    options: &RemoveOptions,
+) -> io::Result<RemovePlan> {
+    for pattern in globs {
+        check_glob(pattern).map_err(|e| {
+            io::Error::new(
+                io::ErrorKind::InvalidInput,
+                format!("Invalid glob pattern '{}': {}", pattern, e),
+            )
+        })?;
+    }
+
+    let current = persist::load_entries(options.system)
+        .map_err(|e| io::Error::new(e.kind(), format!("Error reading PATH: {}", e)))?;
+    let indexes = commands::delete::select_removals(
+        &current,
+        directories,
+        globs,
+        options.contains,
+        options.resolve_symlinks,
+        options.occurrence,
+    );
+
+    let managed = if options.mine_only && !indexes.is_empty() {
+        let managed = utils::managed::load_managed().map_err(|e| {
+            io::Error::new(
+                e.kind(),
+                format!("Error reading the entries pathmaster added: {}", e),
+            )
+        })?;
+        Some(managed)
+    } else {
+        None
+    };
+    let is_mine = |entry: &Path| {
+        managed.as_ref().map_or(true, |managed| {
+            utils::managed::is_managed(managed, entry, options.system)
+        })
+    };
+
+    Ok(commands::delete::plan_removal(current, &indexes, is_mine))
+}
+
+/// Removes every occurrence of a directory from PATH and persists the change
+///
+/// Entries are matched after expanding `~` and normalizing trailing
+/// separators and `.`/`..` segments.
+///
+/// # Returns
+/// * `Ok(())` if at least one entry was removed
+/// * `Err(io::Error)` with kind `NotFound` if the directory is not in PATH
+/// * `Err(io::Error)` from `apply` if saving the change fails
+pub fn remove(dir: &str) -> io::Result<()> {
+    let plan = plan_remove(&[dir.to_string()], &[], &RemoveOptions::default())?;
+    if plan.removed.is_empty() {
+        return Err(io::Error::new(
+            io::ErrorKind::NotFound,
+            format!("'{}' is not in PATH", dir),
+        ));
+    }
+
+    apply(&plan.entries, false).map(|_| ())
+}
+
+/// Backs up the current PATH in the given format
+///
+/// Backups beyond `keep_backups` or older than `max_backup_age` in the
+/// settings are then removed, as after automatic backups.
+///
+/// # Returns
+/// * `Ok(StoredBackup)` describing the written backup
+/// * `Err(io::Error)` if the backup cannot be written
+pub fn backup(format: BackupFormat) -> io::Result<StoredBackup> {
+    let file = backup::core::create_backup_with_format(format)?;
+    backup::create::enforce_retention()?;
+    backup::core::load_backup(&file)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_saved_path_problem() {
+        let temp_dir = tempfile::TempDir::new().unwrap();
+        let missing = temp_dir.path().join("missing");
+
+        assert!(saved_path_problem(&[]).is_some());
+        assert!(saved_path_problem(&[PathBuf::new()]).is_some());
+        assert!(saved_path_problem(&[missing.clone()])
+            .unwrap()
+            .contains("none of the 1"));
+        assert_eq!(
+            saved_path_problem(&[missing.clone(), temp_dir.path().to_path_buf()]),
+            None
+        );
+        assert_eq!(
+            saved_path_problem(&[missing, PathBuf::from("$(brew --prefix)/bin")]),
+            None
+        );
+    }
+}
@@ -8,23 +8,335 @@
 //! - Validating PATH entries
 //! - Flushing invalid entries from PATH
 
-use clap::{command, Parser, Subcommand};
-use commands::validator;
+use clap::{command, ArgGroup, ArgMatches, CommandFactory, FromArgMatches, Parser, Subcommand};
+use pathmaster::commands::move_entry::Target;
+use pathmaster::{backup, commands, utils};
+use std::io::IsTerminal;
+use std::path::PathBuf;
+use std::time::Duration;
 
-mod backup;
-mod commands;
-mod utils;
+// Examples shown at the end of each command's help
+const ADD_EXAMPLES: &str = "\
+Examples:
+  pathmaster add ~/bin ~/.cargo/bin
+  pathmaster add --prepend /opt/tools/bin
+  pathmaster add --append /opt/tools/bin
+  pathmaster add ~/bin --dry-run
+  pathmaster add ~/bin --patch > path.patch
+  pathmaster add --literal '$HOME/bin'
+  pathmaster add --allow-relative node_modules/.bin
+  pathmaster add --prepend --force ~/.cargo/bin
+  pathmaster add --prepend --warn-shadows ~/tools/bin
+  pathmaster add --from-file ~/dotfiles/path-dirs.txt --dry-run";
+
+const DELETE_EXAMPLES: &str = "\
+Examples:
+  pathmaster delete ~/old/bin
+  pathmaster delete --contains node_modules
+  pathmaster delete /usr/local/bin --resolve-symlinks --dry-run
+  pathmaster delete --glob '/opt/*/bin' --glob '/opt/tools-*'
+  pathmaster delete --from-file ~/dotfiles/path-dirs.txt
+  pathmaster delete /opt/tool/bin --first-match";
+
+const LIST_EXAMPLES: &str = "\
+Examples:
+  pathmaster list
+  pathmaster list --invalid-only
+  pathmaster list --json
+  pathmaster list --pid \"$(pgrep -o cron)\"";
+
+const HISTORY_EXAMPLES: &str = "\
+Examples:
+  pathmaster history
+  pathmaster history --since 7d";
+
+const BACKUP_EXAMPLES: &str = "\
+Examples:
+  pathmaster backup create -m \"before installing toolchain X\"
+  pathmaster backup list --since 2024-01-01
+  pathmaster backup diff 20240101 20240115
+  pathmaster backup prune --keep 10
+  pathmaster backup verify --repair";
+
+const RESTORE_EXAMPLES: &str = "\
+Examples:
+  pathmaster restore
+  pathmaster restore 20240115 --dry-run
+  pathmaster restore 20240115 --force
+  pathmaster restore 20240115 --only '/opt/*/bin' --dry-run";
+
+const FLUSH_EXAMPLES: &str = "\
+Examples:
+  pathmaster flush --dry-run
+  pathmaster flush
+  pathmaster flush --aggressive
+  pathmaster flush --mine-only";
+
+const DEDUPE_EXAMPLES: &str = "\
+Examples:
+  pathmaster dedupe
+  pathmaster dedupe --resolve-symlinks --dry-run
+  pathmaster dedupe --keep-last";
+
+const CONSOLIDATE_EXAMPLES: &str = "\
+Examples:
+  pathmaster consolidate --dry-run
+  pathmaster consolidate";
+
+const REORDER_EXAMPLES: &str = "\
+Examples:
+  pathmaster reorder 3,1,2
+  pathmaster reorder";
+
+const MOVE_EXAMPLES: &str = "\
+Examples:
+  pathmaster move ~/bin 1
+  pathmaster move /usr/local/bin --before /usr/bin";
+
+const DIFF_EXAMPLES: &str = "\
+Examples:
+  pathmaster diff
+  pathmaster diff --reorder ~/.local/share/pathmaster/backups/backup_20240115120000.json";
+
+const EXPORT_EXAMPLES: &str = "\
+Examples:
+  pathmaster export > path.json
+  pathmaster export --format yaml";
+
+const IMPORT_EXAMPLES: &str = "\
+Examples:
+  pathmaster import path.json
+  ssh host pathmaster export | pathmaster import --merge";
+
+const CHECK_EXAMPLES: &str = "\
+Examples:
+  pathmaster check
+  pathmaster check --quiet || echo 'PATH needs attention'
+  pathmaster check --fix --dry-run
+  pathmaster check --shadows";
+
+const AUDIT_EXAMPLES: &str = "\
+Examples:
+  pathmaster audit
+  pathmaster audit > /dev/null || echo 'PATH has unsafe directories'";
+
+const DOCTOR_EXAMPLES: &str = "\
+Examples:
+  pathmaster doctor
+  pathmaster --shell zsh doctor
+  pathmaster --quiet doctor || echo 'pathmaster cannot work properly here'";
+
+const CONFIG_EXAMPLES: &str = "\
+Examples:
+  pathmaster config
+  pathmaster --backup-format toml config";
+
+const EDIT_EXAMPLES: &str = "\
+Examples:
+  pathmaster edit
+  EDITOR='code --wait' pathmaster edit
+  pathmaster --profile edit";
+
+const STATUS_EXAMPLES: &str = "\
+Examples:
+  pathmaster status
+  pathmaster status --format json";
+
+const APPLY_EXAMPLES: &str = "\
+Run after a change to update the PATH of the shell you are in:
+  eval \"$(pathmaster apply)\"              (bash, zsh, ksh, sh)
+  pathmaster apply | source                (fish)
+  eval \"`pathmaster apply`\"               (tcsh)
+  eval (pathmaster apply | slurp)          (elvish)
+
+Examples:
+  pathmaster add ~/.cargo/bin && eval \"$(pathmaster apply)\"";
+
+const RUN_EXAMPLES: &str = "\
+Nothing is saved; only the command sees the new PATH. Exits with the
+command's status, or 127 if it is not found.
+
+Examples:
+  pathmaster run --prepend /opt/foo/bin -- mycmd --flag
+  pathmaster run --prepend ~/sdk/bin --append /opt/tools/bin -- make test";
+
+const WHICH_EXAMPLES: &str = "\
+Examples:
+  pathmaster which gcc
+  pathmaster which python3";
+
+const EXPLAIN_EXAMPLES: &str = "\
+Examples:
+  pathmaster explain /usr/local/bin
+  pathmaster explain ~/.cargo/bin";
+
+const SYSTEM_EXAMPLES: &str = "\
+Read-only: system files are shared by all users and need root to edit.
+
+Examples:
+  pathmaster system
+  pathmaster system | grep 'not in PATH'";
+
+const SUMMARY_EXAMPLES: &str = "\
+Examples:
+  pathmaster summary
+  pathmaster summary --json | jq .length";
+
+const UNDO_EXAMPLES: &str = "\
+Examples:
+  pathmaster undo
+  pathmaster undo --list";
+
+const REDO_EXAMPLES: &str = "\
+Examples:
+  pathmaster undo
+  pathmaster redo";
+
+const WATCH_EXAMPLES: &str = "\
+Examples:
+  pathmaster watch
+  pathmaster watch --debounce 1000
+  pathmaster --shell zsh watch";
+
+const COMPLETION_EXAMPLES: &str = "\
+Examples:
+  pathmaster completion bash > ~/.local/share/bash-completion/completions/pathmaster
+  pathmaster completion zsh > \"${fpath[1]}/_pathmaster\"
+  pathmaster completion fish > ~/.config/fish/completions/pathmaster.fish";
+
+const CLEAN_EXAMPLES: &str = "\
+Examples:
+  pathmaster clean --dry-run
+  pathmaster clean
+  pathmaster clean --no-prune --keep-dupes
+  pathmaster clean --fix-separators --dry-run";
+
+const BACKUP_DIFF_EXAMPLES: &str = "\
+Exits with status 1 if the backups differ, and 2 if either is not found.
+
+Examples:
+  pathmaster backup diff 20240101 20240115
+  pathmaster backup diff 20240115-0900 20240115-1730 > /dev/null || echo changed";
+
+const BACKUP_CREATE_EXAMPLES: &str = "\
+Examples:
+  pathmaster backup create
+  pathmaster backup create -m \"before installing toolchain X\"
+  pathmaster restore toolchain";
+
+const BACKUP_LIST_EXAMPLES: &str = "\
+Dates may be given as 2024-01-15, 2024-01-15 14:30 or 20240115143022, and
+ages as 30m, 12h, 7d or 2w before now.
+
+Examples:
+  pathmaster backup list --since 7d
+  pathmaster backup list --since 2024-01-01 --before 2024-02-01
+  pathmaster backup list --json
+  pathmaster backup list --json --full | jq '.[0].entries'";
+
+const PRUNE_EXAMPLES: &str = "\
+Examples:
+  pathmaster backup prune --keep 10
+  pathmaster backup prune --older-than 30d";
+
+const VERIFY_EXAMPLES: &str = "\
+Examples:
+  pathmaster backup verify
+  pathmaster backup verify --repair";
 
 /// CLI configuration and argument parsing for pathmaster
+///
+/// The options on this struct are global: they may be given before or after
+/// the subcommand, e.g. `pathmaster --shell fish add DIR` or
+/// `pathmaster add DIR --shell fish`.
+///
+/// Help lists commands alphabetically rather than in declaration order, so
+/// the text stays stable as commands are added.
 #[derive(Parser)]
-#[command(name = "pathmaster")]
+#[command(name = "pathmaster", next_display_order = None)]
 #[command(version = "0.2.5")]
 #[command(about = "A powerful path management tool", long_about = None)]
 struct Cli {
     /// Control what gets backed up when modifying PATH (default, path, shell, switch)
-    #[arg(long, value_name = "MODE")]
+    #[arg(long, value_name = "MODE", global = true)]
     backup_mode: Option<String>,
 
+    /// Format used when writing new backups (json, toml, text, yaml)
+    #[arg(long, value_name = "FORMAT", global = true)]
+    backup_format: Option<String>,
+
+    /// Timestamp scheme for new backup file names (compact, rfc3339, epoch)
+    #[arg(long, value_name = "SCHEME", global = true)]
+    name_format: Option<String>,
+
+    /// Gzip new backups, adding .gz to their names
+    #[arg(long, global = true)]
+    compress: bool,
+
+    /// After each backup, remove all but this many of the newest backups
+    #[arg(
+        long,
+        value_name = "COUNT",
+        global = true,
+        value_parser = clap::builder::RangedU64ValueParser::<usize>::new().range(1..)
+    )]
+    keep_backups: Option<usize>,
+
+    /// After each backup, remove backups older than this age (e.g. 30d, 2w)
+    #[arg(long, value_name = "AGE", global = true)]
+    max_backup_age: Option<String>,
+
+    /// Directory to read and write backups in for this run, instead of the default
+    #[arg(long, value_name = "DIR", global = true)]
+    backup_dir: Option<String>,
+
+    /// Seconds to wait for another running pathmaster before giving up (0 fails immediately)
+    #[arg(long, value_name = "SECONDS", global = true)]
+    lock_timeout: Option<u64>,
+
+    /// Edit only the shell's main config file, even if PATH is set in a file it sources
+    #[arg(long, global = true)]
+    no_follow_source: bool,
+
+    /// Edit the file login shells read (e.g. ~/.bash_profile, ~/.zprofile)
+    /// instead of the interactive shell config
+    #[arg(long, global = true)]
+    profile: bool,
+
+    /// Edit this file instead of the shell's own config, writing PATH in the
+    /// syntax of the detected shell or --shell
+    #[arg(long, value_name = "FILE", global = true, conflicts_with = "profile")]
+    config_file: Option<String>,
+
+    /// Shell whose configuration is edited, instead of the detected one
+    /// (bash, zsh, fish, tcsh, ksh, elvish, nushell, generic)
+    #[arg(long, value_name = "SHELL", global = true)]
+    shell: Option<String>,
+
+    /// Number of PATH entries to check at once (defaults to the number of CPUs)
+    #[arg(long, value_name = "N", global = true)]
+    jobs: Option<usize>,
+
+    /// Seconds to wait for PATH entries to be checked before giving up, e.g. on a
+    /// hung network mount (waits indefinitely by default)
+    #[arg(long, value_name = "SECONDS", global = true)]
+    timeout: Option<u64>,
+
+    /// Explain decisions on stderr: detected shell, config file, backups
+    /// written and lines replaced
+    #[arg(short, long, global = true)]
+    verbose: bool,
+
+    /// Print only results, without confirmations, headers or backup
+    /// locations; errors still go to stderr and exit statuses are unchanged
+    #[arg(short, long, global = true)]
+    quiet: bool,
+
+    /// Never color output; color is also off when NO_COLOR is set or stdout
+    /// is not a terminal
+    #[arg(long, global = true)]
+    no_color: bool,
+
     #[command(subcommand)]
     command: Commands,
 }
@@ -33,40 +345,521 @@ struct Cli {
 #[derive(Subcommand)]
 enum Commands {
     /// Add directories to the PATH
-    #[command(name = "add", short_flag = 'a')]
+    #[command(name = "add", short_flag = 'a', after_help = ADD_EXAMPLES)]
     Add {
         /// Directories to add
         directories: Vec<String>,
+        /// Add the directories listed in FILE, one per line, or stdin for `-`;
+        /// blank lines and lines starting with # are skipped
+        #[arg(
+            long,
+            value_name = "FILE",
+            alias = "entries-from-file",
+            conflicts_with = "directories"
+        )]
+        from_file: Option<PathBuf>,
+        /// Put the directories at the front of PATH instead of the end
+        #[arg(long)]
+        prepend: bool,
+        /// Put the directories at the end of PATH, overriding `prepend` in the config file
+        #[arg(long, conflicts_with = "prepend")]
+        append: bool,
+        /// Edit the machine-wide PATH instead of the user PATH (Windows only)
+        #[arg(long)]
+        system: bool,
+        /// Write the directories to the shell config unexpanded, e.g. $HOME/bin
+        #[arg(long)]
+        literal: bool,
+        /// Add relative directories such as ./bin as given instead of offering
+        /// to make them absolute
+        #[arg(long)]
+        allow_relative: bool,
+        /// Re-add directories that are already in place, dropping other copies
+        #[arg(long)]
+        force: bool,
+        /// Ask before adding a directory whose commands would hide ones in the
+        /// system directories, such as ls or sudo
+        #[arg(long)]
+        warn_shadows: bool,
+        /// Show the changes that would be made without writing anything
+        #[arg(long)]
+        dry_run: bool,
+        /// Print the change to the shell config as a unified diff instead of making it
+        #[arg(long)]
+        patch: bool,
     },
     /// Delete directories from the PATH
-    #[command(name = "delete", short_flag = 'd', aliases = &["remove"])]
+    #[command(name = "delete", short_flag = 'd', aliases = &["remove"], after_help = DELETE_EXAMPLES)]
     Delete {
         /// Directories to delete
         directories: Vec<String>,
+        /// Also delete every entry matching this glob pattern, e.g. '/opt/*/bin';
+        /// may be repeated
+        #[arg(long, value_name = "PATTERN")]
+        glob: Vec<String>,
+        /// Also delete the directories listed in FILE, one per line, or stdin for
+        /// `-`; blank lines and lines starting with # are skipped
+        #[arg(long, value_name = "FILE")]
+        from_file: Option<PathBuf>,
+        /// Remove every entry containing one of the given substrings
+        #[arg(long)]
+        contains: bool,
+        /// Also remove entries that are symlinks to the given directories
+        #[arg(long)]
+        resolve_symlinks: bool,
+        /// When a directory is in PATH more than once, remove only its
+        /// highest-priority occurrence
+        #[arg(long)]
+        first_match: bool,
+        /// When a directory is in PATH more than once, remove only its
+        /// lowest-priority occurrence
+        #[arg(long, conflicts_with = "first_match")]
+        last_match: bool,
+        /// Only remove entries that pathmaster added, leaving ones added by hand
+        #[arg(long)]
+        mine_only: bool,
+        /// Edit the machine-wide PATH instead of the user PATH (Windows only)
+        #[arg(long)]
+        system: bool,
+        /// Show the changes that would be made without writing anything
+        #[arg(long)]
+        dry_run: bool,
+        /// Print the change to the shell config as a unified diff instead of making it
+        #[arg(long)]
+        patch: bool,
     },
     /// List current PATH entries
-    #[command(name = "list", short_flag = 'l')]
-    List,
+    #[command(name = "list", short_flag = 'l', after_help = LIST_EXAMPLES)]
+    List {
+        /// Only show entries that are not valid directories
+        #[arg(long)]
+        invalid_only: bool,
+        /// Output entries as a JSON array
+        #[arg(long)]
+        json: bool,
+        /// List the PATH of this running process instead, e.g. a daemon (Linux only)
+        #[arg(long, value_name = "PID")]
+        pid: Option<u32>,
+    },
     /// Show backup history
-    #[command(name = "history", short_flag = 'y')]
-    History,
+    #[command(name = "history", short_flag = 'y', after_help = HISTORY_EXAMPLES)]
+    History {
+        /// Show only backups taken on or after this date, or within this age (e.g. 7d)
+        #[arg(long, value_name = "DATE|AGE")]
+        since: Option<String>,
+        /// Show only backups taken before this date, or longer ago than this age
+        #[arg(long, value_name = "DATE|AGE")]
+        before: Option<String>,
+        /// Output the backups as a JSON array
+        #[arg(long)]
+        json: bool,
+        /// Include every PATH entry of each backup in the JSON output
+        #[arg(long, requires = "json")]
+        full: bool,
+    },
+    /// Manage PATH backups
+    #[command(name = "backup", next_display_order = None, after_help = BACKUP_EXAMPLES)]
+    Backup {
+        #[command(subcommand)]
+        command: BackupCommands,
+    },
     /// Restore PATH from a backup
-    #[command(name = "restore", short_flag = 'r')]
+    #[command(name = "restore", short_flag = 'r', after_help = RESTORE_EXAMPLES)]
     Restore {
-        /// Timestamp of the backup to restore
-        #[arg(short, long)]
+        /// Timestamp of the backup to restore, a unique prefix such as 20240115,
+        /// or part of its label
+        #[arg(value_name = "TIMESTAMP|LABEL")]
+        prefix: Option<String>,
+        /// Same as the positional TIMESTAMP argument
+        #[arg(short, long, conflicts_with = "prefix")]
         timestamp: Option<String>,
+        /// Restore only the backup entries matching this glob pattern, e.g.
+        /// '/opt/*/bin', merged into the current PATH; may be repeated
+        #[arg(long, value_name = "PATTERN")]
+        only: Vec<String>,
+        /// Restore the backup even if it does not match its recorded hash or
+        /// looks garbled
+        #[arg(long)]
+        force: bool,
+        /// Show the changes that would be made without writing anything
+        #[arg(long)]
+        dry_run: bool,
+        /// Print the change to the shell config as a unified diff instead of making it
+        #[arg(long)]
+        patch: bool,
     },
     /// Flush non-existing paths from the PATH
-    #[command(name = "flush", short_flag = 'f')]
-    Flush,
+    #[command(name = "flush", short_flag = 'f', after_help = FLUSH_EXAMPLES)]
+    Flush {
+        /// Also remove entries that are not directories or cannot be accessed
+        #[arg(long)]
+        aggressive: bool,
+        /// Only remove entries that pathmaster added, leaving ones added by hand
+        #[arg(long)]
+        mine_only: bool,
+        /// Show the changes that would be made without writing anything
+        #[arg(long)]
+        dry_run: bool,
+        /// Print the change to the shell config as a unified diff instead of making it
+        #[arg(long)]
+        patch: bool,
+    },
+    /// Remove duplicate entries from the PATH
+    #[command(name = "dedupe", after_help = DEDUPE_EXAMPLES)]
+    Dedupe {
+        /// Treat entries that resolve to the same real directory as duplicates
+        #[arg(long)]
+        resolve_symlinks: bool,
+        /// Keep the last occurrence of each entry instead of the first, so later
+        /// appends take effect
+        #[arg(long)]
+        keep_last: bool,
+        /// Show the changes that would be made without writing anything
+        #[arg(long)]
+        dry_run: bool,
+        /// Print the change to the shell config as a unified diff instead of making it
+        #[arg(long)]
+        patch: bool,
+    },
+    /// Remove empty, duplicate and missing entries and trailing slashes in one pass
+    #[command(name = "clean", after_help = CLEAN_EXAMPLES)]
+    Clean {
+        /// Keep entries that do not exist
+        #[arg(long)]
+        no_prune: bool,
+        /// Keep repeated entries
+        #[arg(long)]
+        keep_dupes: bool,
+        /// Keep the last occurrence of each repeated entry instead of the first
+        #[arg(long, conflicts_with = "keep_dupes")]
+        keep_last: bool,
+        /// Instead, collapse empty separators (`::`, leading or trailing `:`) in the
+        /// shell config's PATH assignments
+        #[arg(long, conflicts_with_all = ["no_prune", "keep_dupes", "keep_last"])]
+        fix_separators: bool,
+        /// Show the changes that would be made without writing anything
+        #[arg(long)]
+        dry_run: bool,
+        /// Print the change to the shell config as a unified diff instead of making it
+        #[arg(long)]
+        patch: bool,
+    },
+    /// Merge all PATH declarations in the shell configuration into one
+    #[command(name = "consolidate", after_help = CONSOLIDATE_EXAMPLES)]
+    Consolidate {
+        /// Show the changes that would be made without writing anything
+        #[arg(long)]
+        dry_run: bool,
+        /// Print the change to the shell config as a unified diff instead of making it
+        #[arg(long)]
+        patch: bool,
+    },
+    /// Reorder PATH entries by their current positions
+    #[command(name = "reorder", after_help = REORDER_EXAMPLES)]
+    Reorder {
+        /// New order as 1-based indices (e.g. 3,1,2); prompts when omitted
+        order: Option<String>,
+        /// Show the changes that would be made without writing anything
+        #[arg(long)]
+        dry_run: bool,
+        /// Print the change to the shell config as a unified diff instead of making it
+        #[arg(long)]
+        patch: bool,
+    },
+    /// Move a PATH entry to a new position
+    #[command(name = "move", after_help = MOVE_EXAMPLES)]
+    #[command(group(ArgGroup::new("target").required(true).args(["position", "before", "after"])))]
+    Move {
+        /// Directory to move
+        directory: String,
+        /// New 1-based position (1 is the highest priority)
+        position: Option<usize>,
+        /// Place the directory immediately before this entry
+        #[arg(long, value_name = "ENTRY")]
+        before: Option<String>,
+        /// Place the directory immediately after this entry
+        #[arg(long, value_name = "ENTRY")]
+        after: Option<String>,
+        /// Show the changes that would be made without writing anything
+        #[arg(long)]
+        dry_run: bool,
+        /// Print the change to the shell config as a unified diff instead of making it
+        #[arg(long)]
+        patch: bool,
+    },
+    /// Compare the current PATH against a backup
+    #[command(name = "diff", after_help = DIFF_EXAMPLES)]
+    Diff {
+        /// Backup file to compare against (defaults to the most recent backup)
+        backup: Option<PathBuf>,
+        /// Also report entries whose position changed
+        #[arg(long)]
+        reorder: bool,
+    },
+    /// Write the current PATH as a portable backup to stdout
+    #[command(name = "export", after_help = EXPORT_EXAMPLES)]
+    Export {
+        /// Format of the exported backup (json, toml, text, yaml)
+        #[arg(long, value_name = "FORMAT", default_value = "json")]
+        format: backup::BackupFormat,
+    },
+    /// Apply a backup written by export, read from a file or stdin
+    #[command(name = "import", after_help = IMPORT_EXAMPLES)]
+    Import {
+        /// Backup file to import (reads stdin if omitted or "-")
+        file: Option<PathBuf>,
+        /// Add the imported entries to the current PATH instead of replacing it
+        #[arg(long)]
+        merge: bool,
+        /// Give imported entries precedence over current ones when merging
+        #[arg(long, requires = "merge")]
+        prepend_imported: bool,
+        /// Show the changes that would be made without writing anything
+        #[arg(long)]
+        dry_run: bool,
+        /// Print the change to the shell config as a unified diff instead of making it
+        #[arg(long)]
+        patch: bool,
+    },
     /// Check PATH for invalid directories
-    #[command(name = "check", short_flag = 'c')]
-    Check,
+    #[command(name = "check", short_flag = 'c', after_help = CHECK_EXAMPLES)]
+    Check {
+        /// Collapse entries that differ only by trailing or repeated slashes
+        #[arg(long)]
+        fix: bool,
+        /// Show the changes --fix would make without writing anything
+        #[arg(long, requires = "fix")]
+        dry_run: bool,
+        /// Print the change --fix would make to the shell config as a unified diff
+        #[arg(long, requires = "fix")]
+        patch: bool,
+        /// Also report commands found in more than one PATH directory; slower,
+        /// as every directory is listed
+        #[arg(long)]
+        shadows: bool,
+    },
+    /// Print the effective configuration from ~/.pathmaster/config.toml and options
+    #[command(name = "config", after_help = CONFIG_EXAMPLES)]
+    Config,
+    /// Open the shell config that sets PATH in $VISUAL or $EDITOR, then check it
+    #[command(name = "edit", after_help = EDIT_EXAMPLES)]
+    Edit,
+    /// Flag PATH directories that other users can write to, by severity
+    #[command(name = "audit", after_help = AUDIT_EXAMPLES)]
+    Audit,
+    /// Check that the shell, its config file, the backup directory and PATH are usable
+    #[command(name = "doctor", after_help = DOCTOR_EXAMPLES)]
+    Doctor,
+    /// Print a one-line PATH health summary, cheap enough for shell prompts
+    #[command(name = "status", after_help = STATUS_EXAMPLES)]
+    Status {
+        /// Output format (text, json)
+        #[arg(long, value_name = "FORMAT", default_value = "text")]
+        format: commands::status::StatusFormat,
+    },
+    /// Print a command that sets the current shell's PATH to the configured one
+    #[command(name = "apply", after_help = APPLY_EXAMPLES)]
+    Apply,
+    /// Run a command with directories added to PATH for that command only
+    #[command(name = "run", after_help = RUN_EXAMPLES)]
+    Run {
+        /// Directory to search before the current PATH (repeatable)
+        #[arg(long, value_name = "DIR")]
+        prepend: Vec<String>,
+        /// Directory to search after the current PATH (repeatable)
+        #[arg(long, value_name = "DIR")]
+        append: Vec<String>,
+        /// The command to run, followed by its arguments
+        #[arg(
+            value_name = "COMMAND",
+            required = true,
+            trailing_var_arg = true,
+            allow_hyphen_values = true
+        )]
+        command: Vec<String>,
+    },
+    /// Show which PATH entries provide a command, including shadowed copies
+    #[command(name = "which", after_help = WHICH_EXAMPLES)]
+    Which {
+        /// Command to look up
+        command: String,
+    },
+    /// Explain one PATH entry: position, validity, permissions and shadowed commands
+    #[command(name = "explain", after_help = EXPLAIN_EXAMPLES)]
+    Explain {
+        /// Directory to explain
+        entry: String,
+    },
+    /// Show the PATH entries set by system-wide files such as /etc/profile and /etc/paths.d
+    #[command(name = "system", after_help = SYSTEM_EXAMPLES)]
+    System,
+    /// Show PATH statistics: entry counts, total length, longest and shortest entries
+    #[command(name = "summary", after_help = SUMMARY_EXAMPLES)]
+    Summary {
+        /// Output the statistics as a JSON object
+        #[arg(long)]
+        json: bool,
+    },
+    /// Print a shell completion script
+    #[command(name = "completion", after_help = COMPLETION_EXAMPLES)]
+    Completion {
+        /// Shell to generate completions for (bash, zsh, fish)
+        #[arg(value_name = "SHELL")]
+        shell: String,
+    },
+
+    /// Check the shell config's PATH entries every time the file is saved
+    #[command(name = "watch", after_help = WATCH_EXAMPLES)]
+    Watch {
+        /// Milliseconds the file must be unchanged before it is checked
+        #[arg(long, value_name = "MS", default_value_t = 300)]
+        debounce: u64,
+    },
+
+    /// Reapply the change reverted by the last undo
+    #[command(name = "redo", after_help = REDO_EXAMPLES)]
+    Redo,
+
+    /// Revert the shell config to its state before the last pathmaster change
+    #[command(name = "undo", after_help = UNDO_EXAMPLES)]
+    Undo {
+        /// Show the undo history instead of undoing anything
+        #[arg(long)]
+        list: bool,
+    },
+}
+
+/// Subcommands of the backup command
+#[derive(Subcommand)]
+enum BackupCommands {
+    /// Back up the current PATH now, optionally with a label
+    #[command(name = "create", after_help = BACKUP_CREATE_EXAMPLES)]
+    Create {
+        /// Label describing why the backup was taken
+        #[arg(short, long, value_name = "LABEL")]
+        message: Option<String>,
+    },
+    /// List backups, newest first, optionally only those from a time range
+    #[command(name = "list", after_help = BACKUP_LIST_EXAMPLES)]
+    List {
+        /// Show only backups taken on or after this date, or within this age (e.g. 7d)
+        #[arg(long, value_name = "DATE|AGE")]
+        since: Option<String>,
+        /// Show only backups taken before this date, or longer ago than this age
+        #[arg(long, value_name = "DATE|AGE")]
+        before: Option<String>,
+        /// Output the backups as a JSON array
+        #[arg(long)]
+        json: bool,
+        /// Include every PATH entry of each backup in the JSON output
+        #[arg(long, requires = "json")]
+        full: bool,
+    },
+    /// Compare two backups, showing entries added, removed and moved
+    #[command(name = "diff", after_help = BACKUP_DIFF_EXAMPLES)]
+    Diff {
+        /// Timestamp, or unique prefix, of the earlier backup
+        #[arg(value_name = "OLD")]
+        old: String,
+        /// Timestamp, or unique prefix, of the later backup
+        #[arg(value_name = "NEW")]
+        new: String,
+    },
+    /// Delete old backups (the most recent backup is always kept)
+    #[command(name = "prune", after_help = PRUNE_EXAMPLES)]
+    Prune {
+        /// Number of most recent backups to keep
+        #[arg(long, value_name = "COUNT")]
+        keep: Option<usize>,
+        /// Remove backups older than this age (e.g. 30d, 12h, 2w)
+        #[arg(long, value_name = "AGE")]
+        older_than: Option<String>,
+    },
+    /// Check that every backup can be read, reporting healthy and corrupt files
+    #[command(name = "verify", after_help = VERIFY_EXAMPLES)]
+    Verify {
+        /// Rewrite a clean copy of backups that can be recovered
+        #[arg(long)]
+        repair: bool,
+    },
+}
+
+impl Commands {
+    /// Whether the command was asked to print its change as a patch
+    fn wants_patch(&self) -> bool {
+        matches!(
+            self,
+            Commands::Add { patch: true, .. }
+                | Commands::Delete { patch: true, .. }
+                | Commands::Restore { patch: true, .. }
+                | Commands::Flush { patch: true, .. }
+                | Commands::Clean { patch: true, .. }
+                | Commands::Consolidate { patch: true, .. }
+                | Commands::Reorder { patch: true, .. }
+                | Commands::Move { patch: true, .. }
+                | Commands::Import { patch: true, .. }
+                | Commands::Check { patch: true, .. }
+                | Commands::Dedupe { patch: true, .. }
+        )
+    }
+}
+
+/// Names the subcommand that was run, e.g. `backup create`, for edit hooks
+fn command_name(matches: &ArgMatches) -> String {
+    let mut names = Vec::new();
+    let mut current = matches;
+    while let Some((name, subcommand)) = current.subcommand() {
+        names.push(name);
+        current = subcommand;
+    }
+    names.join(" ")
 }
 
 fn main() {
-    let cli = Cli::parse();
+    let matches = Cli::command().get_matches();
+    let cli = Cli::from_arg_matches(&matches).unwrap_or_else(|e| e.exit());
+
+    if let Err(e) = utils::hooks::set_command_name(&command_name(&matches)) {
+        eprintln!("Error setting command name: {}", e);
+        std::process::exit(1);
+    }
+
+    if cli.verbose {
+        if let Err(e) = utils::log::set_level(utils::log::Level::Debug) {
+            eprintln!("Error setting log level: {}", e);
+            std::process::exit(1);
+        }
+    }
+
+    // A patch is printed alone, so it can be piped to `git apply`
+    let patch = cli.command.wants_patch();
+    if let Err(e) = utils::output::set_quiet(cli.quiet || patch) {
+        eprintln!("Error setting output mode: {}", e);
+        std::process::exit(1);
+    }
+    if let Err(e) = commands::preview::set_patch(patch) {
+        eprintln!("Error setting output mode: {}", e);
+        std::process::exit(1);
+    }
+
+    let color = utils::output::color_wanted(
+        cli.no_color,
+        std::env::var_os("NO_COLOR"),
+        std::io::stdout().is_terminal(),
+    );
+    if let Err(e) = utils::output::set_color(color) {
+        eprintln!("Error setting output color: {}", e);
+        std::process::exit(1);
+    }
+
+    // The config file sets the defaults that command-line options override
+    let mut settings = match utils::settings::load_settings(&utils::settings::settings_path()) {
+        Ok(settings) => settings,
+        Err(e) => {
+            eprintln!("{}", e);
+            std::process::exit(1);
+        }
+    };
 
     // Initialize backup mode if specified
     if let Some(mode) = cli.backup_mode {
@@ -86,25 +879,421 @@ fn main() {
         }
     }
 
+    if let Some(format) = cli.backup_format {
+        match format.parse::<backup::BackupFormat>() {
+            Ok(format) => settings.backup_format = format,
+            Err(e) => {
+                eprintln!("{}", e);
+                std::process::exit(1);
+            }
+        }
+    }
+
+    if let Err(e) = backup::core::set_backup_format(settings.backup_format) {
+        eprintln!("Error setting backup format: {}", e);
+        std::process::exit(1);
+    }
+
+    if let Some(format) = cli.name_format {
+        match format.parse::<backup::NameFormat>() {
+            Ok(format) => settings.backup_name_format = format,
+            Err(e) => {
+                eprintln!("{}", e);
+                std::process::exit(1);
+            }
+        }
+    }
+
+    if let Err(e) = backup::core::set_name_format(settings.backup_name_format) {
+        eprintln!("Error setting backup name format: {}", e);
+        std::process::exit(1);
+    }
+
+    if cli.compress {
+        settings.compress_backups = true;
+    }
+
+    if let Err(e) = backup::core::set_compress(settings.compress_backups) {
+        eprintln!("Error setting backup compression: {}", e);
+        std::process::exit(1);
+    }
+
+    if let Some(keep) = cli.keep_backups {
+        settings.keep_backups = Some(keep);
+    }
+
+    if let Some(age) = cli.max_backup_age {
+        if let Err(e) = backup::prune::parse_age(&age) {
+            eprintln!("{}", e);
+            std::process::exit(1);
+        }
+        settings.max_backup_age = Some(age);
+    }
+
+    if let Some(dir) = &cli.backup_dir {
+        settings.backup_dir = Some(utils::expand_path(dir));
+    }
+
+    if let Some(dir) = &settings.backup_dir {
+        if let Err(e) = backup::core::set_backup_dir(dir.clone()) {
+            eprintln!("Error setting backup directory: {}", e);
+            std::process::exit(1);
+        }
+    }
+
+    if let Some(seconds) = cli.lock_timeout {
+        if let Err(e) = utils::lock::set_lock_timeout(Duration::from_secs(seconds)) {
+            eprintln!("Error setting lock timeout: {}", e);
+            std::process::exit(1);
+        }
+    }
+
+    if cli.no_follow_source {
+        if let Err(e) = utils::shell::source::set_follow_source(false) {
+            eprintln!("Error disabling source following: {}", e);
+            std::process::exit(1);
+        }
+    }
+
+    if cli.profile {
+        if let Err(e) = utils::shell::config::set_login_config(true) {
+            eprintln!("Error selecting the login shell config: {}", e);
+            std::process::exit(1);
+        }
+    }
+
+    if let Some(file) = &cli.config_file {
+        if let Err(e) = utils::shell::config::set_config_file(Some(utils::expand_path(file))) {
+            eprintln!("Error setting config file: {}", e);
+            std::process::exit(1);
+        }
+    }
+
+    if let Some(shell) = cli.shell {
+        match shell.parse::<utils::shell::types::ShellType>() {
+            Ok(shell) => settings.shell = Some(shell),
+            Err(e) => {
+                eprintln!("{}", e);
+                std::process::exit(1);
+            }
+        }
+    }
+
+    if let Some(shell) = &settings.shell {
+        if let Err(e) = utils::shell::factory::set_shell_override(Some(shell.clone())) {
+            eprintln!("Error setting shell: {}", e);
+            std::process::exit(1);
+        }
+    }
+
+    if let Some(jobs) = cli.jobs {
+        if let Err(e) = commands::validator::set_validation_jobs(Some(jobs)) {
+            eprintln!("Error setting validation jobs: {}", e);
+            std::process::exit(1);
+        }
+    }
+
+    if let Some(seconds) = cli.timeout {
+        if let Err(e) =
+            commands::validator::set_validation_timeout(Some(Duration::from_secs(seconds)))
+        {
+            eprintln!("Error setting validation timeout: {}", e);
+            std::process::exit(1);
+        }
+    }
+
+    let prepend_by_default = settings.prepend;
+    let warn_shadows_by_default = settings.warn_shadows;
+    if let Err(e) = utils::settings::set_settings(settings) {
+        eprintln!("Error applying settings: {}", e);
+        std::process::exit(1);
+    }
+
     match &cli.command {
-        Commands::Add { directories } => commands::add::execute(directories),
-        Commands::Delete { directories } => commands::delete::execute(directories),
-        Commands::List => commands::list::execute(),
-        Commands::History => backup::show_history(),
-        Commands::Restore { timestamp } => backup::restore_from_backup(timestamp),
-        Commands::Flush => commands::flush::execute(),
-        Commands::Check => match validator::validate_path() {
-            Ok(validation) => {
-                if validation.existing_dirs.is_empty() && validation.missing_dirs.is_empty() {
-                    println!("All directories in PATH are valid");
-                } else {
-                    println!("Invalid directories in PATH:");
-                    for dir in validation.missing_dirs {
-                        println!("  {}", dir.to_string_lossy());
-                    }
-                }
+        Commands::Add {
+            directories,
+            prepend,
+            append,
+            system,
+            literal,
+            allow_relative,
+            force,
+            warn_shadows,
+            from_file,
+            dry_run,
+            patch,
+        } => commands::add::execute(
+            directories,
+            *prepend || (prepend_by_default && !*append),
+            *system,
+            *literal,
+            *allow_relative,
+            *force,
+            from_file.as_deref(),
+            *warn_shadows || warn_shadows_by_default,
+            *dry_run || *patch,
+        ),
+        Commands::Delete {
+            directories,
+            glob,
+            from_file,
+            contains,
+            resolve_symlinks,
+            first_match,
+            last_match,
+            mine_only,
+            system,
+            dry_run,
+            patch,
+        } => commands::delete::execute(
+            directories,
+            glob,
+            from_file.as_deref(),
+            *contains,
+            *resolve_symlinks,
+            if *first_match {
+                commands::delete::Occurrence::First
+            } else if *last_match {
+                commands::delete::Occurrence::Last
+            } else {
+                commands::delete::Occurrence::All
+            },
+            *mine_only,
+            *system,
+            *dry_run || *patch,
+        ),
+        Commands::List {
+            invalid_only,
+            json,
+            pid,
+        } => commands::list::execute(*invalid_only, *json, *pid),
+        Commands::History {
+            since,
+            before,
+            json,
+            full,
+        } => backup::show_history(since.as_deref(), before.as_deref(), *json, *full),
+        Commands::Backup { command } => match command {
+            BackupCommands::Create { message } => backup::create::execute(message.as_deref()),
+            BackupCommands::List {
+                since,
+                before,
+                json,
+                full,
+            } => backup::show_history(since.as_deref(), before.as_deref(), *json, *full),
+            BackupCommands::Diff { old, new } => backup::compare::execute(old, new),
+            BackupCommands::Prune { keep, older_than } => {
+                backup::prune::execute(*keep, older_than.as_deref())
             }
-            Err(e) => eprintln!("Error: {}", e),
+            BackupCommands::Verify { repair } => backup::verify::execute(*repair),
         },
+        Commands::Restore {
+            prefix,
+            timestamp,
+            only,
+            force,
+            dry_run,
+            patch,
+        } => backup::restore_from_backup(
+            &prefix.clone().or_else(|| timestamp.clone()),
+            only,
+            *dry_run || *patch,
+            *force,
+        ),
+        Commands::Flush {
+            aggressive,
+            mine_only,
+            dry_run,
+            patch,
+        } => commands::flush::execute(*aggressive, *mine_only, *dry_run || *patch),
+        Commands::Clean {
+            no_prune,
+            keep_dupes,
+            keep_last,
+            fix_separators,
+            dry_run,
+            patch,
+        } => {
+            if *fix_separators {
+                commands::clean::fix_separators(*dry_run || *patch)
+            } else {
+                commands::clean::execute(
+                    commands::clean::CleanOptions {
+                        dedupe: !*keep_dupes,
+                        keep_last: *keep_last,
+                        prune: !*no_prune,
+                    },
+                    *dry_run || *patch,
+                )
+            }
+        }
+        Commands::Consolidate { dry_run, patch } => {
+            commands::consolidate::execute(*dry_run || *patch)
+        }
+        Commands::Reorder {
+            order,
+            dry_run,
+            patch,
+        } => commands::reorder::execute(order.as_deref(), *dry_run || *patch),
+        Commands::Move {
+            directory,
+            position,
+            before,
+            after,
+            dry_run,
+            patch,
+        } => {
+            let target = match (position, before, after) {
+                (Some(position), _, _) => Target::Position(*position),
+                (_, Some(before), _) => Target::Before(before.clone()),
+                (_, _, Some(after)) => Target::After(after.clone()),
+                _ => unreachable!("clap requires one move target"),
+            };
+            commands::move_entry::execute(directory, &target, *dry_run || *patch)
+        }
+        Commands::Diff { backup, reorder } => commands::diff::execute(backup.as_deref(), *reorder),
+        Commands::Export { format } => commands::export::execute(*format),
+        Commands::Import {
+            file,
+            merge,
+            prepend_imported,
+            dry_run,
+            patch,
+        } => commands::import::execute(
+            file.as_deref(),
+            *merge,
+            *prepend_imported,
+            *dry_run || *patch,
+        ),
+        Commands::Completion { shell } => commands::completion::execute(shell, &Cli::command()),
+        Commands::Watch { debounce } => commands::watch::execute(Duration::from_millis(*debounce)),
+        Commands::Redo => commands::redo::execute(),
+        Commands::Undo { list } => commands::undo::execute(*list),
+        Commands::Status { format } => commands::status::execute(*format),
+        Commands::Summary { json } => commands::summary::execute(*json),
+        Commands::Apply => commands::apply::execute(),
+        Commands::Run {
+            prepend,
+            append,
+            command,
+        } => commands::run::execute(prepend, append, command),
+        Commands::Which { command } => commands::which::execute(command),
+        Commands::Explain { entry } => commands::explain::execute(entry),
+        Commands::Audit => commands::audit::execute(),
+        Commands::Doctor => commands::doctor::execute(),
+        Commands::System => commands::system::execute(),
+        Commands::Config => commands::config::execute(),
+        Commands::Edit => commands::edit::execute(),
+        Commands::Check {
+            fix,
+            dry_run,
+            shadows,
+            patch,
+        } => commands::check::execute(*fix, *dry_run || *patch, *shadows),
+        Commands::Dedupe {
+            resolve_symlinks,
+            keep_last,
+            dry_run,
+            patch,
+        } => commands::dedupe::execute(*resolve_symlinks, *keep_last, *dry_run || *patch),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use clap::CommandFactory;
+
+    #[test]
+    fn test_global_flags_anywhere() {
+        for args in [
+            vec!["pathmaster", "--shell", "fish", "add", "/foo"],
+            vec!["pathmaster", "add", "--shell", "fish", "/foo"],
+            vec!["pathmaster", "add", "/foo", "--shell", "fish"],
+        ] {
+            let cli = Cli::try_parse_from(&args).unwrap();
+            assert_eq!(cli.shell.as_deref(), Some("fish"));
+            assert!(
+                matches!(cli.command, Commands::Add { ref directories, .. } if directories == &["/foo"])
+            );
+        }
+
+        let cli = Cli::try_parse_from(["pathmaster", "list", "--no-follow-source"]).unwrap();
+        assert!(cli.no_follow_source);
+    }
+
+    /// Returns the command names listed in a help text, in display order
+    fn listed_commands(help: &str) -> Vec<String> {
+        help.lines()
+            .skip_while(|line| !line.starts_with("Commands:"))
+            .skip(1)
+            .take_while(|line| line.starts_with("  "))
+            .filter_map(|line| line.split_whitespace().next())
+            .map(|name| name.trim_end_matches(',').to_string())
+            .collect()
+    }
+
+    #[test]
+    fn test_help_lists_registered_commands() {
+        let mut cli = Cli::command();
+        let help = cli.render_help().to_string();
+        let listed = listed_commands(&help);
+
+        let mut sorted = listed.clone();
+        sorted.sort();
+        assert_eq!(listed, sorted);
+
+        for subcommand in Cli::command().get_subcommands() {
+            assert!(listed.iter().any(|name| name == subcommand.get_name()));
+            assert!(
+                subcommand.get_about().is_some(),
+                "{} has no summary",
+                subcommand.get_name()
+            );
+        }
+    }
+
+    #[test]
+    fn test_commands_have_examples() {
+        let cli = Cli::command();
+        let backup = cli.find_subcommand("backup").unwrap();
+
+        for subcommand in cli.get_subcommands().chain(backup.get_subcommands()) {
+            let examples = subcommand.get_after_help().unwrap().to_string();
+            assert!(
+                examples.contains(subcommand.get_name()),
+                "{} help has no examples",
+                subcommand.get_name()
+            );
+        }
+    }
+
+    #[test]
+    fn test_completions_cover_commands() {
+        let cli = Cli::command();
+        for shell in ["bash", "zsh", "fish"] {
+            let mut script = Vec::new();
+            commands::completion::write_script(&mut script, &shell.parse().unwrap(), &cli).unwrap();
+            let script = String::from_utf8(script).unwrap();
+
+            for subcommand in cli.get_subcommands() {
+                assert!(
+                    script.contains(subcommand.get_name()),
+                    "{} completions are missing {}",
+                    shell,
+                    subcommand.get_name()
+                );
+            }
+            assert!(script.contains("pathmaster_path_entries"));
+        }
+    }
+
+    #[test]
+    fn test_subcommand_help() {
+        let err = Cli::try_parse_from(["pathmaster", "list", "--help"])
+            .err()
+            .unwrap();
+        assert_eq!(err.kind(), clap::error::ErrorKind::DisplayHelp);
+        assert!(err.to_string().contains("--invalid-only"));
     }
 }
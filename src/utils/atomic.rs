@@ -0,0 +1,184 @@
+//! Atomic file replacement for shell configuration edits.
+//!
+//! This module handles:
+//! - Writing new contents to a temporary file next to the target
+//! - Carrying over the target's permissions and ownership
+//! - Renaming the temporary file over the target in a single step
+//!
+//! A crash or full disk mid-write therefore leaves either the old or the new
+//! file in place, never a truncated one.
+
+use std::fs::{self, File, OpenOptions};
+use std::io::{self, Write};
+use std::path::{Path, PathBuf};
+use std::process;
+
+/// Resolves the file that should actually be replaced
+///
+/// If `path` is a symlink (e.g. a dotfile managed in a separate repository),
+/// the link's target is replaced so that the symlink itself is preserved.
+fn resolve_target(path: &Path) -> io::Result<PathBuf> {
+    match fs::symlink_metadata(path) {
+        Ok(meta) if meta.file_type().is_symlink() => fs::canonicalize(path),
+        _ => Ok(path.to_path_buf()),
+    }
+}
+
+/// Creates a new temporary file in `dir` named after `target`
+fn create_temp_file(dir: &Path, target: &Path) -> io::Result<(PathBuf, File)> {
+    let name = target
+        .file_name()
+        .map(|name| name.to_string_lossy().into_owned())
+        .unwrap_or_default();
+
+    for counter in 0..1000 {
+        let temp_path = dir.join(format!(
+            ".{}.pathmaster-{}-{}.tmp",
+            name,
+            process::id(),
+            counter
+        ));
+        match OpenOptions::new()
+            .write(true)
+            .create_new(true)
+            .open(&temp_path)
+        {
+            Ok(file) => return Ok((temp_path, file)),
+            Err(e) if e.kind() == io::ErrorKind::AlreadyExists => continue,
+            Err(e) => return Err(e),
+        }
+    }
+
+    Err(io::Error::new(
+        io::ErrorKind::AlreadyExists,
+        format!("Could not create a temporary file for {}", target.display()),
+    ))
+}
+
+/// Gives the temporary file the same permissions and owner as the original
+fn copy_metadata(original: &Path, temp_path: &Path) -> io::Result<()> {
+    let meta = match fs::metadata(original) {
+        Ok(meta) => meta,
+        Err(e) if e.kind() == io::ErrorKind::NotFound => return Ok(()),
+        Err(e) => return Err(e),
+    };
+
+    fs::set_permissions(temp_path, meta.permissions())?;
+
+    #[cfg(unix)]
+    {
+        use std::os::unix::fs::MetadataExt;
+
+        let temp_meta = fs::metadata(temp_path)?;
+        if temp_meta.uid() != meta.uid() || temp_meta.gid() != meta.gid() {
+            std::os::unix::fs::chown(temp_path, Some(meta.uid()), Some(meta.gid()))?;
+        }
+    }
+
+    Ok(())
+}
+
+/// Atomically replaces the contents of a file
+///
+/// The contents are written and flushed to a temporary file in the same
+/// directory, which is then renamed over `path`. An existing file's
+/// permissions and ownership are kept, and symlinks are followed so the link
+/// itself is not replaced.
+///
+/// # Arguments
+/// * `path` - The file to write
+/// * `contents` - The new file contents
+///
+/// # Returns
+/// * `Ok(())` if the file was replaced
+/// * `Err(io::Error)` if any step fails; the original file is left untouched
+pub fn write_atomic(path: &Path, contents: &[u8]) -> io::Result<()> {
+    let target = resolve_target(path)?;
+    let dir = match target.parent() {
+        Some(parent) if !parent.as_os_str().is_empty() => parent.to_path_buf(),
+        _ => PathBuf::from("."),
+    };
+
+    let (temp_path, mut file) = create_temp_file(&dir, &target)?;
+    let result = file
+        .write_all(contents)
+        .and_then(|_| file.sync_all())
+        .and_then(|_| copy_metadata(&target, &temp_path))
+        .and_then(|_| fs::rename(&temp_path, &target));
+
+    if result.is_err() {
+        let _ = fs::remove_file(&temp_path);
+        return result;
+    }
+
+    // Persist the rename itself; not every platform can sync a directory
+    if let Ok(dir) = File::open(&dir) {
+        let _ = dir.sync_all();
+    }
+
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_write_atomic_replaces_contents() -> io::Result<()> {
+        let temp_dir = TempDir::new()?;
+        let file = temp_dir.path().join(".bashrc");
+        fs::write(&file, "old contents\n")?;
+
+        write_atomic(&file, b"new contents\n")?;
+
+        assert_eq!(fs::read_to_string(&file)?, "new contents\n");
+        // No temporary files are left behind
+        assert_eq!(fs::read_dir(temp_dir.path())?.count(), 1);
+        Ok(())
+    }
+
+    #[test]
+    fn test_write_atomic_creates_missing_file() -> io::Result<()> {
+        let temp_dir = TempDir::new()?;
+        let file = temp_dir.path().join(".profile");
+
+        write_atomic(&file, b"export PATH=\"/usr/bin\"\n")?;
+
+        assert_eq!(fs::read_to_string(&file)?, "export PATH=\"/usr/bin\"\n");
+        Ok(())
+    }
+
+    #[cfg(unix)]
+    #[test]
+    fn test_write_atomic_keeps_permissions() -> io::Result<()> {
+        use std::os::unix::fs::PermissionsExt;
+
+        let temp_dir = TempDir::new()?;
+        let file = temp_dir.path().join(".zshrc");
+        fs::write(&file, "old\n")?;
+        fs::set_permissions(&file, fs::Permissions::from_mode(0o600))?;
+
+        write_atomic(&file, b"new\n")?;
+
+        let mode = fs::metadata(&file)?.permissions().mode() & 0o777;
+        assert_eq!(mode, 0o600);
+        Ok(())
+    }
+
+    #[cfg(unix)]
+    #[test]
+    fn test_write_atomic_follows_symlinks() -> io::Result<()> {
+        let temp_dir = TempDir::new()?;
+        let real = temp_dir.path().join("dotfiles-bashrc");
+        let link = temp_dir.path().join(".bashrc");
+        fs::write(&real, "old\n")?;
+        std::os::unix::fs::symlink(&real, &link)?;
+
+        write_atomic(&link, b"new\n")?;
+
+        assert!(fs::symlink_metadata(&link)?.file_type().is_symlink());
+        assert_eq!(fs::read_to_string(&real)?, "new\n");
+        Ok(())
+    }
+}
@@ -0,0 +1,266 @@
+//! Filesystem access for shell configuration edits.
+//!
+//! This module handles:
+//! - The few file operations the shell handlers need to rewrite a config
+//! - The real implementation, backed by `std::fs` and `utils::atomic`
+//! - An in-memory implementation, so edits can be tested without real files
+//!
+//! Handlers take a `&dyn FileSystem` in `ShellHandler::rewrite_config`;
+//! everything else in pathmaster uses `std::fs` directly.
+
+use crate::utils::atomic;
+use std::fs;
+use std::io;
+use std::path::Path;
+use std::process;
+
+/// The file operations a config edit needs
+pub trait FileSystem {
+    /// Reads a whole file as UTF-8
+    fn read_to_string(&self, path: &Path) -> io::Result<String>;
+
+    /// Creates or truncates a file and writes `contents` to it
+    fn write(&self, path: &Path, contents: &[u8]) -> io::Result<()>;
+
+    /// Renames a file, replacing `to` if it exists
+    fn rename(&self, from: &Path, to: &Path) -> io::Result<()>;
+
+    /// Removes a file
+    fn remove_file(&self, path: &Path) -> io::Result<()>;
+
+    /// Whether a file or directory exists at `path`
+    fn exists(&self, path: &Path) -> bool;
+
+    /// Creates a directory and any missing parents
+    fn create_dir_all(&self, path: &Path) -> io::Result<()>;
+
+    /// Copies a file, replacing `to` if it exists
+    fn copy(&self, from: &Path, to: &Path) -> io::Result<()> {
+        let contents = self.read_to_string(from)?;
+        self.write(to, contents.as_bytes())
+    }
+
+    /// Replaces a file's contents so that it is never left half-written
+    ///
+    /// The contents are written to a temporary file next to `path`, which is
+    /// then renamed over it. If that fails, the temporary file is removed and
+    /// `path` is left as it was.
+    fn write_atomic(&self, path: &Path, contents: &[u8]) -> io::Result<()> {
+        let name = path
+            .file_name()
+            .map(|name| name.to_string_lossy().into_owned())
+            .unwrap_or_default();
+        let temp_path = path.with_file_name(format!(".{}.pathmaster-{}.tmp", name, process::id()));
+
+        let result = self
+            .write(&temp_path, contents)
+            .and_then(|_| self.rename(&temp_path, path));
+        if result.is_err() {
+            let _ = self.remove_file(&temp_path);
+        }
+        result
+    }
+}
+
+/// The filesystem of the machine pathmaster runs on
+#[derive(Debug, Clone, Copy, Default)]
+pub struct RealFileSystem;
+
+impl FileSystem for RealFileSystem {
+    fn read_to_string(&self, path: &Path) -> io::Result<String> {
+        fs::read_to_string(path)
+    }
+
+    fn write(&self, path: &Path, contents: &[u8]) -> io::Result<()> {
+        fs::write(path, contents)
+    }
+
+    fn rename(&self, from: &Path, to: &Path) -> io::Result<()> {
+        fs::rename(from, to)
+    }
+
+    fn remove_file(&self, path: &Path) -> io::Result<()> {
+        fs::remove_file(path)
+    }
+
+    fn exists(&self, path: &Path) -> bool {
+        path.exists()
+    }
+
+    fn create_dir_all(&self, path: &Path) -> io::Result<()> {
+        fs::create_dir_all(path)
+    }
+
+    fn copy(&self, from: &Path, to: &Path) -> io::Result<()> {
+        fs::copy(from, to).map(|_| ())
+    }
+
+    /// Also keeps the file's permissions and ownership, follows symlinks and
+    /// syncs to disk; see `utils::atomic`
+    fn write_atomic(&self, path: &Path, contents: &[u8]) -> io::Result<()> {
+        atomic::write_atomic(path, contents)
+    }
+}
+
+#[cfg(test)]
+pub use memory::MemoryFileSystem;
+
+#[cfg(test)]
+mod memory {
+    use super::FileSystem;
+    use std::cell::{Cell, RefCell};
+    use std::collections::{BTreeMap, BTreeSet};
+    use std::io;
+    use std::path::{Path, PathBuf};
+
+    /// A filesystem held in memory, for tests
+    ///
+    /// Only the directories created with `create_dir_all`, or holding a file
+    /// added with `with_file`, exist; writing anywhere else fails like it would
+    /// on disk.
+    #[derive(Debug, Default)]
+    pub struct MemoryFileSystem {
+        files: RefCell<BTreeMap<PathBuf, Vec<u8>>>,
+        dirs: RefCell<BTreeSet<PathBuf>>,
+        failing_renames: Cell<bool>,
+    }
+
+    impl MemoryFileSystem {
+        /// Creates an empty filesystem
+        pub fn new() -> Self {
+            Self::default()
+        }
+
+        /// Adds a file, and the directories holding it
+        pub fn with_file(self, path: impl Into<PathBuf>, contents: &str) -> Self {
+            let path = path.into();
+            if let Some(parent) = path.parent() {
+                self.create_dir_all(parent).unwrap();
+            }
+            self.files
+                .borrow_mut()
+                .insert(path, contents.as_bytes().to_vec());
+            self
+        }
+
+        /// Makes every later rename fail, as on a full or read-only disk
+        pub fn fail_renames(&self) {
+            self.failing_renames.set(true);
+        }
+
+        /// Returns a file's contents, if it exists
+        pub fn contents(&self, path: &Path) -> Option<String> {
+            self.files
+                .borrow()
+                .get(path)
+                .map(|contents| String::from_utf8_lossy(contents).into_owned())
+        }
+
+        /// Lists every file, sorted
+        pub fn files(&self) -> Vec<PathBuf> {
+            self.files.borrow().keys().cloned().collect()
+        }
+
+        fn not_found(path: &Path) -> io::Error {
+            io::Error::new(
+                io::ErrorKind::NotFound,
+                format!("{} does not exist", path.display()),
+            )
+        }
+    }
+
+    impl FileSystem for MemoryFileSystem {
+        fn read_to_string(&self, path: &Path) -> io::Result<String> {
+            let contents = self
+                .files
+                .borrow()
+                .get(path)
+                .cloned()
+                .ok_or_else(|| Self::not_found(path))?;
+            String::from_utf8(contents).map_err(|e| io::Error::new(io::ErrorKind::InvalidData, e))
+        }
+
+        fn write(&self, path: &Path, contents: &[u8]) -> io::Result<()> {
+            match path.parent() {
+                Some(parent) if !self.dirs.borrow().contains(parent) => {
+                    return Err(Self::not_found(parent))
+                }
+                _ => {}
+            }
+            self.files
+                .borrow_mut()
+                .insert(path.to_path_buf(), contents.to_vec());
+            Ok(())
+        }
+
+        fn rename(&self, from: &Path, to: &Path) -> io::Result<()> {
+            if self.failing_renames.get() {
+                return Err(io::Error::new(
+                    io::ErrorKind::Other,
+                    format!("Cannot rename {}", from.display()),
+                ));
+            }
+            let contents = self
+                .files
+                .borrow_mut()
+                .remove(from)
+                .ok_or_else(|| Self::not_found(from))?;
+            self.write(to, &contents)
+        }
+
+        fn remove_file(&self, path: &Path) -> io::Result<()> {
+            self.files
+                .borrow_mut()
+                .remove(path)
+                .map(|_| ())
+                .ok_or_else(|| Self::not_found(path))
+        }
+
+        fn exists(&self, path: &Path) -> bool {
+            self.files.borrow().contains_key(path) || self.dirs.borrow().contains(path)
+        }
+
+        fn create_dir_all(&self, path: &Path) -> io::Result<()> {
+            let mut dirs = self.dirs.borrow_mut();
+            for ancestor in path.ancestors() {
+                dirs.insert(ancestor.to_path_buf());
+            }
+            Ok(())
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_memory_write_atomic() {
+        let files = MemoryFileSystem::new().with_file("/home/me/.bashrc", "old\n");
+        let rc = Path::new("/home/me/.bashrc");
+
+        files.write_atomic(rc, b"new\n").unwrap();
+        assert_eq!(files.contents(rc).as_deref(), Some("new\n"));
+        assert_eq!(files.files(), vec![rc.to_path_buf()]);
+
+        files.fail_renames();
+        assert!(files.write_atomic(rc, b"newer\n").is_err());
+        assert_eq!(files.contents(rc).as_deref(), Some("new\n"));
+        assert_eq!(files.files(), vec![rc.to_path_buf()]);
+    }
+
+    #[test]
+    fn test_memory_write_needs_directory() {
+        let files = MemoryFileSystem::new();
+        let rc = Path::new("/home/me/.config/fish/config.fish");
+
+        assert_eq!(
+            files.write(rc, b"").unwrap_err().kind(),
+            io::ErrorKind::NotFound
+        );
+        files.create_dir_all(rc.parent().unwrap()).unwrap();
+        files.write(rc, b"").unwrap();
+        assert!(files.exists(rc));
+        assert!(files.exists(Path::new("/home/me/.config")));
+    }
+}
@@ -0,0 +1,207 @@
+//! Commands run around PATH edits.
+//!
+//! This module handles:
+//! - Running `pre_edit_hook` and `post_edit_hook` from the config file
+//!   around every edit pathmaster makes
+//! - Telling them what is being edited through environment variables
+//! - Aborting the edit when the pre-edit hook fails, and only warning when
+//!   the post-edit hook does
+//!
+//! Hooks are off unless configured. Each is run with `sh -c` (`cmd /C` on
+//! Windows) and sees:
+//! - `PATHMASTER_HOOK` - `pre` or `post`
+//! - `PATHMASTER_FILE` - The file being edited, `fish_user_paths` for fish's
+//!   universal variable, or the registry key on Windows
+//! - `PATHMASTER_COMMAND` - The pathmaster command, e.g. `add` or `backup create`
+
+use crate::log_debug;
+use crate::utils::settings;
+use lazy_static::lazy_static;
+use std::fmt;
+use std::io;
+use std::path::Path;
+use std::process::Command;
+use std::sync::Mutex;
+
+lazy_static! {
+    static ref COMMAND_NAME: Mutex<String> = Mutex::new(String::new());
+}
+
+/// When a hook runs
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum Stage {
+    /// Before the edit; failing aborts it
+    Pre,
+    /// After the edit succeeded; failing only warns
+    Post,
+}
+
+impl fmt::Display for Stage {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        match self {
+            Stage::Pre => write!(f, "pre"),
+            Stage::Post => write!(f, "post"),
+        }
+    }
+}
+
+/// Sets the command name passed to hooks
+pub fn set_command_name(name: &str) -> io::Result<()> {
+    let mut command_name = COMMAND_NAME
+        .lock()
+        .map_err(|_| io::Error::new(io::ErrorKind::Other, "Failed to lock command name mutex"))?;
+    *command_name = name.to_string();
+    Ok(())
+}
+
+/// Gets the command name passed to hooks
+pub fn get_command_name() -> io::Result<String> {
+    let command_name = COMMAND_NAME
+        .lock()
+        .map_err(|_| io::Error::new(io::ErrorKind::Other, "Failed to lock command name mutex"))?;
+    Ok(command_name.clone())
+}
+
+/// Builds the command that runs a hook through the system shell
+fn shell_command(hook: &str) -> Command {
+    let mut command = if cfg!(windows) {
+        let mut command = Command::new("cmd");
+        command.arg("/C");
+        command
+    } else {
+        let mut command = Command::new("sh");
+        command.arg("-c");
+        command
+    };
+    command.arg(hook);
+    command
+}
+
+/// Runs one hook and waits for it
+///
+/// Its output goes straight to the terminal.
+///
+/// # Arguments
+/// * `hook` - The shell command to run
+/// * `stage` - Whether it runs before or after the edit
+/// * `file` - The file being edited
+/// * `command_name` - The pathmaster command making the edit
+///
+/// # Returns
+/// * `Ok(())` if the hook exits successfully
+/// * `Err(io::Error)` if it cannot be started or exits with a failure
+pub fn run_hook(hook: &str, stage: Stage, file: &Path, command_name: &str) -> io::Result<()> {
+    log_debug!("Running {}-edit hook: {}", stage, hook);
+    let status = shell_command(hook)
+        .env("PATHMASTER_HOOK", stage.to_string())
+        .env("PATHMASTER_FILE", file)
+        .env("PATHMASTER_COMMAND", command_name)
+        .status()?;
+
+    if status.success() {
+        Ok(())
+    } else {
+        Err(io::Error::new(
+            io::ErrorKind::Other,
+            format!("`{}` exited with {}", hook, status),
+        ))
+    }
+}
+
+/// Makes an edit between the configured hooks
+///
+/// The pre-edit hook runs first, and the edit is not made if it fails. The
+/// post-edit hook runs only once the edit has succeeded; if it fails, a
+/// warning is printed and the edit stands.
+///
+/// # Arguments
+/// * `file` - The file the edit changes, passed to the hooks
+/// * `edit` - Makes the edit
+pub fn with_hooks<T>(file: &Path, edit: impl FnOnce() -> io::Result<T>) -> io::Result<T> {
+    let settings = settings::get_settings()?;
+    let command_name = get_command_name()?;
+
+    if let Some(hook) = &settings.pre_edit_hook {
+        run_hook(hook, Stage::Pre, file, &command_name).map_err(|e| {
+            io::Error::new(
+                e.kind(),
+                format!("Pre-edit hook failed, so nothing was changed: {}", e),
+            )
+        })?;
+    }
+
+    let result = edit()?;
+
+    if let Some(hook) = &settings.post_edit_hook {
+        if let Err(e) = run_hook(hook, Stage::Post, file, &command_name) {
+            eprintln!("Warning: post-edit hook failed: {}", e);
+        }
+    }
+
+    Ok(result)
+}
+
+#[cfg(all(test, unix))]
+mod tests {
+    use super::*;
+    use crate::utils::settings::{set_settings, Settings};
+    use serial_test::serial;
+    use std::fs;
+    use tempfile::TempDir;
+
+    fn with_hook_settings(pre: Option<String>, post: Option<String>) -> io::Result<()> {
+        set_settings(Settings {
+            pre_edit_hook: pre,
+            post_edit_hook: post,
+            ..Default::default()
+        })
+    }
+
+    #[test]
+    #[serial]
+    fn test_hooks_run_around_edit() -> io::Result<()> {
+        let temp_dir = TempDir::new()?;
+        let log = temp_dir.path().join("log");
+        let hook = format!(
+            "echo \"$PATHMASTER_HOOK $PATHMASTER_COMMAND $PATHMASTER_FILE\" >> {}",
+            log.display()
+        );
+        with_hook_settings(Some(hook.clone()), Some(hook))?;
+        set_command_name("add")?;
+
+        let result = with_hooks(Path::new("/home/me/.bashrc"), || {
+            fs::write(temp_dir.path().join("edited"), "")
+        });
+        set_settings(Settings::default())?;
+        set_command_name("")?;
+
+        result?;
+        assert_eq!(
+            fs::read_to_string(&log)?,
+            "pre add /home/me/.bashrc\npost add /home/me/.bashrc\n"
+        );
+        Ok(())
+    }
+
+    #[test]
+    #[serial]
+    fn test_failing_hooks() -> io::Result<()> {
+        let temp_dir = TempDir::new()?;
+        let edited = temp_dir.path().join("edited");
+
+        with_hook_settings(Some("exit 3".to_string()), None)?;
+        let aborted = with_hooks(&edited, || fs::write(&edited, ""));
+        assert!(aborted
+            .unwrap_err()
+            .to_string()
+            .contains("nothing was changed"));
+        assert!(!edited.exists());
+
+        with_hook_settings(None, Some("exit 3".to_string()))?;
+        let warned = with_hooks(&edited, || fs::write(&edited, ""));
+        set_settings(Settings::default())?;
+        assert!(warned.is_ok());
+        assert!(edited.exists());
+        Ok(())
+    }
+}
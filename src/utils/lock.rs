@@ -0,0 +1,195 @@
+//! Advisory locking of shell configuration files.
+//!
+//! This module handles:
+//! - Serializing concurrent pathmaster edits of the same config file
+//! - Waiting up to a configurable timeout for another invocation to finish
+//!
+//! Locks are taken on a separate lock file under `~/.pathmaster/locks`, named
+//! after the config path. The config file itself cannot be locked because
+//! atomic writes replace it with a new file.
+
+use lazy_static::lazy_static;
+use std::fs::{self, File, OpenOptions};
+use std::io;
+use std::path::{Path, PathBuf};
+use std::sync::Mutex;
+use std::thread;
+use std::time::{Duration, Instant};
+
+/// How long to wait for another invocation by default
+const DEFAULT_LOCK_TIMEOUT: Duration = Duration::from_secs(5);
+
+/// Delay between attempts to take a held lock
+const RETRY_INTERVAL: Duration = Duration::from_millis(100);
+
+lazy_static! {
+    static ref LOCK_TIMEOUT: Mutex<Duration> = Mutex::new(DEFAULT_LOCK_TIMEOUT);
+}
+
+/// Sets how long to wait for a lock held by another pathmaster
+pub fn set_lock_timeout(timeout: Duration) -> io::Result<()> {
+    let mut lock_timeout = LOCK_TIMEOUT
+        .lock()
+        .map_err(|_| io::Error::new(io::ErrorKind::Other, "Failed to lock timeout mutex"))?;
+    *lock_timeout = timeout;
+    Ok(())
+}
+
+/// Gets how long to wait for a lock held by another pathmaster
+pub fn get_lock_timeout() -> io::Result<Duration> {
+    let lock_timeout = LOCK_TIMEOUT
+        .lock()
+        .map_err(|_| io::Error::new(io::ErrorKind::Other, "Failed to lock timeout mutex"))?;
+    Ok(*lock_timeout)
+}
+
+/// An exclusive lock on a config file, released when dropped
+#[derive(Debug)]
+pub struct ConfigLock {
+    // Closing the file releases the lock
+    _file: File,
+}
+
+/// Returns the lock file used for a config file
+fn lock_path(config_path: &Path) -> PathBuf {
+    let config_path = fs::canonicalize(config_path).unwrap_or_else(|_| config_path.to_path_buf());
+    let name: String = config_path
+        .to_string_lossy()
+        .chars()
+        .map(|c| {
+            if c == '/' || c == '\\' || c == ':' {
+                '%'
+            } else {
+                c
+            }
+        })
+        .collect();
+
+    let home_dir = dirs_next::home_dir().unwrap_or_else(|| PathBuf::from("/"));
+    home_dir
+        .join(".pathmaster/locks")
+        .join(format!("{}.lock", name))
+}
+
+/// Tries to take an exclusive lock without blocking
+///
+/// # Returns
+/// * `Ok(true)` if the lock was taken
+/// * `Ok(false)` if another process holds it
+#[cfg(unix)]
+fn try_lock(file: &File) -> io::Result<bool> {
+    use std::os::unix::io::AsRawFd;
+
+    // SAFETY: the descriptor is owned by `file` and stays open for the call
+    if unsafe { libc::flock(file.as_raw_fd(), libc::LOCK_EX | libc::LOCK_NB) } == 0 {
+        return Ok(true);
+    }
+
+    let err = io::Error::last_os_error();
+    match err.raw_os_error() {
+        Some(libc::EWOULDBLOCK) | Some(libc::EINTR) => Ok(false),
+        _ => Err(err),
+    }
+}
+
+/// Advisory locking is only implemented on Unix-like systems
+#[cfg(not(unix))]
+fn try_lock(_file: &File) -> io::Result<bool> {
+    Ok(true)
+}
+
+/// Takes the lock for a config file, waiting up to `timeout`
+fn lock_with_timeout(config_path: &Path, timeout: Duration) -> io::Result<ConfigLock> {
+    let path = lock_path(config_path);
+    if let Some(parent) = path.parent() {
+        fs::create_dir_all(parent)?;
+    }
+
+    let file = OpenOptions::new()
+        .read(true)
+        .write(true)
+        .create(true)
+        .open(&path)?;
+
+    let start = Instant::now();
+    loop {
+        if try_lock(&file)? {
+            return Ok(ConfigLock { _file: file });
+        }
+        if start.elapsed() >= timeout {
+            return Err(io::Error::new(
+                io::ErrorKind::WouldBlock,
+                format!(
+                    "another pathmaster is running and editing {} (gave up after {}s; see --lock-timeout)",
+                    config_path.display(),
+                    timeout.as_secs()
+                ),
+            ));
+        }
+        thread::sleep(RETRY_INTERVAL);
+    }
+}
+
+/// Takes an exclusive lock for editing a config file
+///
+/// Waits up to the configured lock timeout if another pathmaster holds it.
+///
+/// # Arguments
+/// * `config_path` - The config file about to be edited
+///
+/// # Returns
+/// * `Ok(ConfigLock)` holding the lock until dropped
+/// * `Err(io::Error)` with kind `WouldBlock` if the lock is still held after the timeout
+pub fn lock_config(config_path: &Path) -> io::Result<ConfigLock> {
+    lock_with_timeout(config_path, get_lock_timeout()?)
+}
+
+#[cfg(all(test, unix))]
+mod tests {
+    use super::*;
+    use serial_test::serial;
+    use std::env;
+    use tempfile::TempDir;
+
+    /// Runs `test` with HOME pointing at a temporary directory
+    fn with_temp_home(test: impl FnOnce(&Path) -> io::Result<()>) -> io::Result<()> {
+        let temp_dir = TempDir::new()?;
+        let original_home = env::var_os("HOME");
+        env::set_var("HOME", temp_dir.path());
+
+        let result = test(temp_dir.path());
+
+        if let Some(home) = original_home {
+            env::set_var("HOME", home);
+        }
+        result
+    }
+
+    #[test]
+    #[serial]
+    fn test_lock_is_exclusive() -> io::Result<()> {
+        with_temp_home(|home| {
+            let config = home.join(".bashrc");
+
+            let first = lock_with_timeout(&config, Duration::ZERO)?;
+            let err = lock_with_timeout(&config, Duration::ZERO).unwrap_err();
+            assert_eq!(err.kind(), io::ErrorKind::WouldBlock);
+            assert!(err.to_string().contains("another pathmaster is running"));
+
+            drop(first);
+            lock_with_timeout(&config, Duration::ZERO)?;
+            assert!(home.join(".pathmaster/locks").is_dir());
+            Ok(())
+        })
+    }
+
+    #[test]
+    #[serial]
+    fn test_locks_are_per_config() -> io::Result<()> {
+        with_temp_home(|home| {
+            let _bash = lock_with_timeout(&home.join(".bashrc"), Duration::ZERO)?;
+            lock_with_timeout(&home.join(".zshrc"), Duration::ZERO)?;
+            Ok(())
+        })
+    }
+}
@@ -0,0 +1,132 @@
+//! Leveled diagnostic logging.
+//!
+//! This module handles:
+//! - The level below which messages are dropped, raised by `--verbose`
+//! - Writing enabled messages to stderr, prefixed with their level
+//! - Showing each message once, as the shell and its config file are looked
+//!   up again by every step of a command
+//!
+//! Commands log through the [`log_debug!`](crate::log_debug) and
+//! [`log_info!`](crate::log_info) macros, so the message is only formatted
+//! when it will be shown. By default only warnings and errors are enabled,
+//! and nothing in pathmaster logs at those levels yet, so output stays quiet.
+
+use lazy_static::lazy_static;
+use std::collections::HashSet;
+use std::fmt;
+use std::io;
+use std::sync::Mutex;
+
+lazy_static! {
+    static ref LEVEL: Mutex<Level> = Mutex::new(Level::Warn);
+    static ref SHOWN: Mutex<HashSet<String>> = Mutex::new(HashSet::new());
+}
+
+/// How important a message is, from most to least
+#[derive(Debug, Clone, Copy, PartialEq, Eq, PartialOrd, Ord)]
+pub enum Level {
+    /// Something failed
+    Error,
+    /// Something looks wrong but work continues
+    Warn,
+    /// A decision or change worth knowing about
+    Info,
+    /// Detail for tracing how a decision was made
+    Debug,
+}
+
+impl fmt::Display for Level {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        match self {
+            Level::Error => write!(f, "error"),
+            Level::Warn => write!(f, "warn"),
+            Level::Info => write!(f, "info"),
+            Level::Debug => write!(f, "debug"),
+        }
+    }
+}
+
+/// Sets the least important level that is still shown
+pub fn set_level(new_level: Level) -> io::Result<()> {
+    let mut level = LEVEL
+        .lock()
+        .map_err(|_| io::Error::new(io::ErrorKind::Other, "Failed to lock log level mutex"))?;
+    *level = new_level;
+    Ok(())
+}
+
+/// Gets the least important level that is still shown
+pub fn get_level() -> io::Result<Level> {
+    let level = LEVEL
+        .lock()
+        .map_err(|_| io::Error::new(io::ErrorKind::Other, "Failed to lock log level mutex"))?;
+    Ok(*level)
+}
+
+/// Returns whether messages at `level` are shown
+pub fn enabled(level: Level) -> bool {
+    get_level().map(|shown| level <= shown).unwrap_or(false)
+}
+
+/// Formats a message as it is written to stderr
+pub fn format_message(level: Level, args: fmt::Arguments) -> String {
+    format!("[{}] {}", level, args)
+}
+
+/// Writes a message to stderr if its level is enabled
+///
+/// A message that was already written is skipped. Use the `log_debug!` and
+/// `log_info!` macros rather than calling this.
+pub fn log(level: Level, args: fmt::Arguments) {
+    if !enabled(level) {
+        return;
+    }
+
+    let message = format_message(level, args);
+    let first = SHOWN
+        .lock()
+        .map(|mut shown| shown.insert(message.clone()))
+        .unwrap_or(true);
+    if first {
+        eprintln!("{}", message);
+    }
+}
+
+/// Logs detail for tracing a decision, shown with `--verbose`
+#[macro_export]
+macro_rules! log_debug {
+    ($($arg:tt)*) => {
+        $crate::utils::log::log($crate::utils::log::Level::Debug, format_args!($($arg)*))
+    };
+}
+
+/// Logs a decision or change, shown with `--verbose`
+#[macro_export]
+macro_rules! log_info {
+    ($($arg:tt)*) => {
+        $crate::utils::log::log($crate::utils::log::Level::Info, format_args!($($arg)*))
+    };
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use serial_test::serial;
+
+    #[test]
+    #[serial]
+    fn test_levels() -> io::Result<()> {
+        assert!(enabled(Level::Error) && enabled(Level::Warn));
+        assert!(!enabled(Level::Info) && !enabled(Level::Debug));
+
+        set_level(Level::Debug)?;
+        assert!(enabled(Level::Info) && enabled(Level::Debug));
+        set_level(Level::Warn)?;
+
+        assert_eq!(
+            format_message(Level::Debug, format_args!("using {}", "zsh")),
+            "[debug] using zsh"
+        );
+        Ok(())
+    }
+}
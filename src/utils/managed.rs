@@ -0,0 +1,196 @@
+//! Tracking of the PATH entries pathmaster added itself.
+//!
+//! This module handles:
+//! - Recording each directory when `add` puts it in PATH
+//! - Forgetting it once a pathmaster edit takes it out again
+//! - Telling managed entries from ones added by hand, for `--mine-only`
+//!
+//! The record is a JSON file at `$XDG_STATE_HOME/pathmaster/managed.json`
+//! (or `~/.pathmaster/managed.json` where the legacy directory is used),
+//! kept beside the shell configuration rather than in it, so hand edits to
+//! the config cannot lose or fake the tags. Entries are compared as by
+//! `utils::path::comparison_key`, so `~/bin` and `/home/me/bin/` are the
+//! same entry.
+
+use crate::backup::core::TIMESTAMP_FORMAT;
+use crate::utils::atomic::write_atomic;
+use crate::utils::path::comparison_key;
+use crate::utils::xdg;
+use chrono::Local;
+use lazy_static::lazy_static;
+use serde::{Deserialize, Serialize};
+use std::collections::HashSet;
+use std::fs;
+use std::io;
+use std::path::{Path, PathBuf};
+use std::sync::Mutex;
+
+lazy_static! {
+    static ref MANAGED_FILE: Mutex<Option<PathBuf>> = Mutex::new(None);
+}
+
+/// A PATH entry that pathmaster added
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+pub struct ManagedEntry {
+    /// The directory, as it was added
+    pub entry: PathBuf,
+    /// When it was added
+    pub added: String,
+    /// Whether it was added to the machine-wide PATH (Windows only)
+    #[serde(default)]
+    pub system: bool,
+}
+
+/// The contents of the tracking file
+#[derive(Debug, Default, Serialize, Deserialize)]
+struct ManagedFile {
+    entries: Vec<ManagedEntry>,
+}
+
+/// Sets a custom tracking file (primarily for testing)
+pub fn set_managed_file(file: PathBuf) -> io::Result<()> {
+    let mut managed_file = MANAGED_FILE
+        .lock()
+        .map_err(|_| io::Error::new(io::ErrorKind::Other, "Failed to lock managed file mutex"))?;
+    *managed_file = Some(file);
+    Ok(())
+}
+
+/// Gets the file recording the entries pathmaster added
+pub fn get_managed_file() -> io::Result<PathBuf> {
+    let managed_file = MANAGED_FILE
+        .lock()
+        .map_err(|_| io::Error::new(io::ErrorKind::Other, "Failed to lock managed file mutex"))?;
+    Ok(managed_file.clone().unwrap_or_else(xdg::managed_file))
+}
+
+/// Reads the entries pathmaster added, oldest first
+///
+/// # Returns
+/// * `Ok(Vec<ManagedEntry>)` - The entries, empty if nothing was recorded yet
+/// * `Err(io::Error)` if the tracking file cannot be read or parsed
+pub fn load_managed() -> io::Result<Vec<ManagedEntry>> {
+    let file = get_managed_file()?;
+    let contents = match fs::read_to_string(&file) {
+        Ok(contents) => contents,
+        Err(e) if e.kind() == io::ErrorKind::NotFound => return Ok(Vec::new()),
+        Err(e) => return Err(e),
+    };
+    let managed: ManagedFile = serde_json::from_str(&contents).map_err(|e| {
+        io::Error::new(
+            io::ErrorKind::InvalidData,
+            format!("Invalid tracking file {}: {}", file.display(), e),
+        )
+    })?;
+    Ok(managed.entries)
+}
+
+/// Replaces the tracking file's contents
+fn save_managed(entries: Vec<ManagedEntry>) -> io::Result<()> {
+    let file = get_managed_file()?;
+    if let Some(parent) = file.parent() {
+        fs::create_dir_all(parent)?;
+    }
+    let json = serde_json::to_string_pretty(&ManagedFile { entries })
+        .map_err(|e| io::Error::new(io::ErrorKind::Other, e))?;
+    write_atomic(&file, json.as_bytes())
+}
+
+/// Returns whether an entry is one pathmaster added
+///
+/// # Arguments
+/// * `managed` - The recorded entries, as returned by `load_managed`
+/// * `entry` - The PATH entry to look up
+/// * `system` - Whether `entry` is in the machine-wide PATH
+pub fn is_managed(managed: &[ManagedEntry], entry: &Path, system: bool) -> bool {
+    let key = comparison_key(entry, false);
+    managed
+        .iter()
+        .any(|known| known.system == system && comparison_key(&known.entry, false) == key)
+}
+
+/// Records directories that pathmaster has just added to PATH
+///
+/// Directories already recorded keep their original time.
+///
+/// # Arguments
+/// * `added` - The directories added
+/// * `system` - Whether they went into the machine-wide PATH
+pub fn record_added(added: &[PathBuf], system: bool) -> io::Result<()> {
+    let mut managed = load_managed()?;
+    let timestamp = Local::now().format(TIMESTAMP_FORMAT).to_string();
+    let before = managed.len();
+    for entry in added {
+        if !is_managed(&managed, entry, system) {
+            managed.push(ManagedEntry {
+                entry: entry.clone(),
+                added: timestamp.clone(),
+                system,
+            });
+        }
+    }
+    if managed.len() == before {
+        return Ok(());
+    }
+    save_managed(managed)
+}
+
+/// Forgets recorded entries that a change took out of PATH
+///
+/// An entry that is still in PATH after the change, for instance because
+/// only a duplicate of it was removed, stays recorded.
+///
+/// # Arguments
+/// * `remaining` - PATH entries after the change
+/// * `system` - Whether the change was to the machine-wide PATH
+pub fn forget_removed(remaining: &[PathBuf], system: bool) -> io::Result<()> {
+    let remaining: HashSet<PathBuf> = remaining
+        .iter()
+        .map(|entry| comparison_key(entry, false))
+        .collect();
+    let managed = load_managed()?;
+    let before = managed.len();
+    let kept: Vec<ManagedEntry> = managed
+        .into_iter()
+        .filter(|known| {
+            known.system != system || remaining.contains(&comparison_key(&known.entry, false))
+        })
+        .collect();
+    if kept.len() == before {
+        return Ok(());
+    }
+    save_managed(kept)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use serial_test::serial;
+    use tempfile::TempDir;
+
+    #[test]
+    #[serial]
+    fn test_record_and_forget() -> io::Result<()> {
+        let temp_dir = TempDir::new()?;
+        set_managed_file(temp_dir.path().join("state/managed.json"))?;
+        assert!(load_managed()?.is_empty());
+
+        let tool = PathBuf::from("/opt/tool/bin");
+        let go = PathBuf::from("/usr/local/go/bin");
+        record_added(&[tool.clone(), go.clone()], false)?;
+        record_added(&[PathBuf::from("/opt/tool/bin/")], false)?;
+
+        let managed = load_managed()?;
+        assert_eq!(managed.len(), 2);
+        assert!(is_managed(&managed, Path::new("/opt/tool/bin/"), false));
+        assert!(!is_managed(&managed, &tool, true));
+        assert!(!is_managed(&managed, Path::new("/usr/bin"), false));
+
+        // Only entries gone from PATH are forgotten
+        forget_removed(&[go.clone(), PathBuf::from("/usr/bin")], false)?;
+        let managed = load_managed()?;
+        assert!(!is_managed(&managed, &tool, false));
+        assert!(is_managed(&managed, &go, false));
+        Ok(())
+    }
+}
@@ -1,6 +1,28 @@
+pub mod atomic;
+pub mod filesystem;
+pub mod hooks;
+pub mod host;
+pub mod lock;
+pub mod log;
+pub mod managed;
+pub mod output;
 pub mod path;
+pub mod path_helper;
 pub mod path_scanner;
+pub mod persist;
+pub mod process;
+pub mod settings;
 pub mod shell;
+pub mod system_files;
+pub mod undo;
+pub mod watch;
+#[cfg(windows)]
+pub mod windows;
+pub mod xdg;
 
-pub use path::{expand_path, get_path_entries, set_path_entries};
+pub use path::{
+    build_path_string, dedupe_entries, dedupe_entries_keeping_last, empty_entry_positions,
+    expand_path, get_path_entries, is_empty_entry, merge_entries, parse_path_entries,
+    set_path_entries,
+};
 pub use shell::update_shell_config;
@@ -0,0 +1,148 @@
+//! Output mode shared by every command.
+//!
+//! This module handles:
+//! - Whether `--quiet` is in effect
+//! - Printing status messages, such as confirmations, headers and backup
+//!   locations, only when it is not
+//! - Whether output is colored, and coloring text when it is
+//!
+//! Commands print their results (entries, matches, diffs, reports) with
+//! `println!` as usual, and everything around them with the
+//! [`status!`](crate::status) macro, so `--quiet` leaves just the results
+//! for scripts. Errors and warnings always go to stderr, and exit statuses do
+//! not depend on the mode.
+//!
+//! Color is off unless stdout is a terminal, `NO_COLOR` is unset and
+//! `--no-color` is not given. JSON output never goes through [`paint`].
+
+use lazy_static::lazy_static;
+use std::ffi::OsString;
+use std::io;
+use std::sync::Mutex;
+
+lazy_static! {
+    static ref QUIET: Mutex<bool> = Mutex::new(false);
+    static ref COLOR: Mutex<bool> = Mutex::new(false);
+}
+
+/// Colors used to mark how healthy an entry is
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum Color {
+    /// A valid entry
+    Green,
+    /// An invalid entry or a problem that breaks lookups
+    Red,
+    /// A duplicate or another entry that works but deserves a look
+    Yellow,
+}
+
+impl Color {
+    /// Returns the ANSI escape sequence that starts this color
+    fn code(&self) -> &'static str {
+        match self {
+            Color::Green => "\x1b[32m",
+            Color::Red => "\x1b[31m",
+            Color::Yellow => "\x1b[33m",
+        }
+    }
+}
+
+/// Sets whether status messages are suppressed
+pub fn set_quiet(quiet: bool) -> io::Result<()> {
+    let mut current = QUIET
+        .lock()
+        .map_err(|_| io::Error::new(io::ErrorKind::Other, "Failed to lock output mode mutex"))?;
+    *current = quiet;
+    Ok(())
+}
+
+/// Returns whether status messages are suppressed
+pub fn is_quiet() -> bool {
+    QUIET.lock().map(|quiet| *quiet).unwrap_or(false)
+}
+
+/// Decides whether output should be colored
+///
+/// # Arguments
+///
+/// * `no_color_flag` - Whether `--no-color` was given
+/// * `no_color_env` - The value of `NO_COLOR`; any non-empty value disables color
+/// * `is_terminal` - Whether stdout is a terminal
+pub fn color_wanted(
+    no_color_flag: bool,
+    no_color_env: Option<OsString>,
+    is_terminal: bool,
+) -> bool {
+    let env_disables = no_color_env.map_or(false, |value| !value.is_empty());
+    is_terminal && !no_color_flag && !env_disables
+}
+
+/// Sets whether output is colored
+pub fn set_color(enabled: bool) -> io::Result<()> {
+    let mut current = COLOR
+        .lock()
+        .map_err(|_| io::Error::new(io::ErrorKind::Other, "Failed to lock output color mutex"))?;
+    *current = enabled;
+    Ok(())
+}
+
+/// Returns whether output is colored
+pub fn color_enabled() -> bool {
+    COLOR.lock().map(|color| *color).unwrap_or(false)
+}
+
+/// Wraps text in a color, or returns it unchanged when color is off
+pub fn paint(text: &str, color: Color) -> String {
+    if color_enabled() {
+        format!("{}{}\x1b[0m", color.code(), text)
+    } else {
+        text.to_string()
+    }
+}
+
+/// Prints a status message to stdout, unless `--quiet` is in effect
+#[macro_export]
+macro_rules! status {
+    ($($arg:tt)*) => {
+        if !$crate::utils::output::is_quiet() {
+            println!($($arg)*);
+        }
+    };
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use serial_test::serial;
+
+    #[test]
+    #[serial]
+    fn test_quiet_mode() -> io::Result<()> {
+        assert!(!is_quiet());
+        set_quiet(true)?;
+        assert!(is_quiet());
+        set_quiet(false)?;
+        assert!(!is_quiet());
+        Ok(())
+    }
+
+    #[test]
+    fn test_color_wanted() {
+        assert!(color_wanted(false, None, true));
+        assert!(color_wanted(false, Some(OsString::new()), true));
+        assert!(!color_wanted(false, Some(OsString::from("1")), true));
+        assert!(!color_wanted(true, None, true));
+        assert!(!color_wanted(false, None, false));
+    }
+
+    #[test]
+    #[serial]
+    fn test_paint() -> io::Result<()> {
+        assert_eq!(paint("/usr/bin", Color::Green), "/usr/bin");
+        set_color(true)?;
+        let painted = paint("/nope", Color::Red);
+        set_color(false)?;
+        assert_eq!(painted, "\x1b[31m/nope\x1b[0m");
+        Ok(())
+    }
+}
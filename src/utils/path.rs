@@ -4,11 +4,19 @@
 //! - Path manipulation and expansion
 //! - Path validation
 //! - PATH environment variable management
+//! - The platform's limit on how long PATH can grow
+//! - Matching entries against glob patterns
+//! - Detecting PATH values that do not survive being split and joined again
 //!
 //! For shell configuration management, see the `shell` module.
 
+use serde::Serialize;
+use std::collections::HashSet;
 use std::env;
-use std::path::PathBuf;
+use std::ffi::OsStr;
+use std::fs;
+use std::io;
+use std::path::{Component, Path, PathBuf};
 
 /// Expands a path string, resolving home directory (~) and environment variables.
 ///
@@ -30,6 +38,42 @@ pub fn expand_path(path: &str) -> PathBuf {
     PathBuf::from(expanded.to_string())
 }
 
+/// Returns the unexpanded form of a path to write to shell configuration
+///
+/// Variables are kept as written. A leading `~` becomes `$HOME`, because
+/// shells do not expand `~` inside the quoted PATH values pathmaster writes.
+///
+/// # Example
+/// ```rust
+/// # use pathmaster::utils::path::literal_path;
+/// # use std::path::PathBuf;
+/// assert_eq!(literal_path("~/bin"), PathBuf::from("$HOME/bin"));
+/// assert_eq!(literal_path("$XDG_DATA_HOME/bin"), PathBuf::from("$XDG_DATA_HOME/bin"));
+/// ```
+pub fn literal_path(path: &str) -> PathBuf {
+    match path.strip_prefix('~') {
+        Some(rest) if rest.is_empty() || rest.starts_with('/') => {
+            PathBuf::from(format!("$HOME{}", rest))
+        }
+        _ => PathBuf::from(path),
+    }
+}
+
+/// Expands `~` and environment variables in a literal path
+///
+/// This gives the directory a literal entry such as `$HOME/bin` refers to.
+/// If a variable is not set, only `~` is expanded and the variable is kept.
+///
+/// # Example
+/// ```rust
+/// # use pathmaster::utils::path::{expand_path, expand_variables};
+/// assert_eq!(expand_variables("$HOME/bin"), expand_path("~/bin"));
+/// ```
+pub fn expand_variables(path: &str) -> PathBuf {
+    let expanded = shellexpand::full(path).unwrap_or_else(|_| shellexpand::tilde(path));
+    PathBuf::from(expanded.to_string())
+}
+
 /// Gets the current PATH entries as a vector of PathBuf.
 ///
 /// # Returns
@@ -43,10 +87,130 @@ pub fn expand_path(path: &str) -> PathBuf {
 /// Gets the current PATH entries as a vector of PathBuf.
 pub fn get_path_entries() -> Vec<PathBuf> {
     env::var_os("PATH")
-        .map(|paths| env::split_paths(&paths).collect())
+        .map(|paths| parse_path_entries(&paths))
         .unwrap_or_default()
 }
 
+/// Splits a PATH value into its entries.
+///
+/// Entries are separated by the platform's PATH separator (`:` on Unix,
+/// `;` on Windows). Empty entries are kept, so a PATH captured elsewhere,
+/// such as in a backup, can be inspected exactly as the shell would see it.
+///
+/// # Arguments
+/// * `path_var` - A PATH value
+///
+/// # Example
+/// ```rust
+/// # use pathmaster::utils;
+/// # use std::path::PathBuf;
+/// # #[cfg(unix)]
+/// assert_eq!(
+///     utils::parse_path_entries("/usr/bin:/bin"),
+///     vec![PathBuf::from("/usr/bin"), PathBuf::from("/bin")]
+/// );
+/// ```
+pub fn parse_path_entries<S: AsRef<OsStr> + ?Sized>(path_var: &S) -> Vec<PathBuf> {
+    env::split_paths(path_var).collect()
+}
+
+/// Joins PATH entries into a PATH value.
+///
+/// Entries are separated by the platform's PATH separator. Whitespace around
+/// each entry is trimmed and entries left empty are skipped, so the result
+/// never asks the shell to search the current directory by accident.
+///
+/// # Arguments
+/// * `entries` - PATH entries in priority order
+///
+/// # Example
+/// ```rust
+/// # use pathmaster::utils;
+/// # use std::path::PathBuf;
+/// let entries = vec![PathBuf::from("/usr/bin "), PathBuf::new(), PathBuf::from("/bin")];
+/// # #[cfg(unix)]
+/// assert_eq!(utils::build_path_string(&entries), "/usr/bin:/bin");
+/// ```
+pub fn build_path_string(entries: &[PathBuf]) -> String {
+    let separator = if cfg!(windows) { ";" } else { ":" };
+    entries
+        .iter()
+        .map(|entry| entry.to_string_lossy().trim().to_string())
+        .filter(|entry| !entry.is_empty())
+        .collect::<Vec<_>>()
+        .join(separator)
+}
+
+/// Returns whether a PATH entry is empty or only whitespace.
+///
+/// Empty entries come from a leading, trailing or doubled separator in PATH.
+/// Shells treat them as the current directory, so any program in whatever
+/// directory the user happens to be in can shadow a system command.
+///
+/// # Example
+/// ```rust
+/// # use pathmaster::utils;
+/// # use std::path::Path;
+/// assert!(utils::is_empty_entry(Path::new("")));
+/// assert!(utils::is_empty_entry(Path::new("  ")));
+/// assert!(!utils::is_empty_entry(Path::new("/usr/bin")));
+/// ```
+pub fn is_empty_entry(entry: &Path) -> bool {
+    entry.to_string_lossy().trim().is_empty()
+}
+
+/// Collapses repeated separators in an entry and removes trailing ones.
+///
+/// The shell looks up `/usr/bin`, `/usr/bin/` and `/usr//bin` in the same
+/// directory, so this is the form to keep when they appear together. The root
+/// is left alone, and on Windows so is the leading `\\` of a UNC path.
+///
+/// # Example
+/// ```rust
+/// # use pathmaster::utils::path::collapse_separators;
+/// # use std::path::{Path, PathBuf};
+/// # #[cfg(unix)]
+/// assert_eq!(collapse_separators(Path::new("/usr//bin/")), PathBuf::from("/usr/bin"));
+/// ```
+pub fn collapse_separators(entry: &Path) -> PathBuf {
+    let text = match entry.to_str() {
+        Some(text) => text,
+        None => return entry.to_path_buf(),
+    };
+
+    let mut collapsed = String::with_capacity(text.len());
+    let mut previous_separator = false;
+    for (index, c) in text.chars().enumerate() {
+        let separator = std::path::is_separator(c);
+        if separator && previous_separator && !(cfg!(windows) && index == 1) {
+            continue;
+        }
+        collapsed.push(c);
+        previous_separator = separator;
+    }
+
+    let trimmed = collapsed.trim_end_matches(std::path::is_separator);
+    if trimmed.is_empty() {
+        collapsed.truncate(1);
+    } else {
+        collapsed.truncate(trimmed.len());
+    }
+    PathBuf::from(collapsed)
+}
+
+/// Returns the positions of empty PATH entries, counting from 1.
+///
+/// # Arguments
+/// * `entries` - PATH entries in priority order
+pub fn empty_entry_positions(entries: &[PathBuf]) -> Vec<usize> {
+    entries
+        .iter()
+        .enumerate()
+        .filter(|(_, entry)| is_empty_entry(entry))
+        .map(|(index, _)| index + 1)
+        .collect()
+}
+
 /// Sets the PATH environment variable to the provided entries.
 ///
 /// # Arguments
@@ -66,6 +230,469 @@ pub fn set_path_entries(entries: &[PathBuf]) {
     }
 }
 
+/// Normalizes a path string for comparison and matching.
+///
+/// Expands a leading `~` and environment variables, then resolves `.` and
+/// `..` segments, repeated separators and trailing separators. When
+/// `resolve_symlinks` is set, the path is additionally canonicalized so that
+/// symlinked aliases of the same directory compare equal; this requires the
+/// path to exist.
+///
+/// # Arguments
+/// * `path` - The path string to normalize
+/// * `resolve_symlinks` - Whether to resolve symlinks to their real location
+///
+/// # Returns
+/// * `Ok(PathBuf)` - The normalized path
+/// * `Err(io::Error)` - If an environment variable is undefined, or symlink
+///   resolution was requested and the path cannot be resolved
+///
+/// # Example
+/// ```rust
+/// # use pathmaster::utils;
+/// # use std::path::PathBuf;
+/// let normalized = utils::path::normalize_path("/usr/local/../bin/", false).unwrap();
+/// assert_eq!(normalized, PathBuf::from("/usr/bin"));
+/// ```
+pub fn normalize_path(path: &str, resolve_symlinks: bool) -> io::Result<PathBuf> {
+    let expanded =
+        shellexpand::full(path).map_err(|e| io::Error::new(io::ErrorKind::InvalidInput, e))?;
+    let expanded = PathBuf::from(expanded.as_ref());
+
+    if resolve_symlinks {
+        return fs::canonicalize(&expanded);
+    }
+
+    let mut normalized = PathBuf::new();
+    for component in expanded.components() {
+        match component {
+            Component::CurDir => {}
+            Component::ParentDir => match normalized.components().next_back() {
+                Some(Component::Normal(_)) => {
+                    normalized.pop();
+                }
+                // `..` at the root stays at the root
+                Some(Component::RootDir) | Some(Component::Prefix(_)) => {}
+                _ => normalized.push(".."),
+            },
+            other => normalized.push(other.as_os_str()),
+        }
+    }
+
+    if normalized.as_os_str().is_empty() {
+        normalized.push(".");
+    }
+
+    Ok(normalized)
+}
+
+/// Computes the key used to compare PATH entries.
+///
+/// Falls back to lexical normalization when symlinks cannot be resolved
+/// (for example because the directory does not exist), and to the raw entry
+/// when the entry references an undefined variable.
+pub fn comparison_key(entry: &Path, resolve_symlinks: bool) -> PathBuf {
+    let entry = entry.to_string_lossy();
+    normalize_path(&entry, resolve_symlinks)
+        .or_else(|_| normalize_path(&entry, false))
+        .unwrap_or_else(|_| PathBuf::from(entry.as_ref()))
+}
+
+/// Removes duplicate PATH entries, keeping the first occurrence of each.
+///
+/// Entries are normalized before comparison (tilde and variable expansion,
+/// `.`/`..` and trailing separator removal, and optionally symlink
+/// resolution), but the surviving entries keep their original form.
+///
+/// # Arguments
+/// * `entries` - PATH entries in priority order
+/// * `resolve_symlinks` - Treat entries resolving to the same real directory as duplicates
+///
+/// # Returns
+/// * `(Vec<PathBuf>, usize)` - The deduplicated entries and the number removed
+///
+/// # Example
+/// ```rust
+/// # use pathmaster::utils;
+/// # use std::path::PathBuf;
+/// let entries = vec![PathBuf::from("/usr/bin"), PathBuf::from("/usr/bin/")];
+/// let (deduped, removed) = utils::dedupe_entries(&entries, false);
+/// assert_eq!(deduped, vec![PathBuf::from("/usr/bin")]);
+/// assert_eq!(removed, 1);
+/// ```
+pub fn dedupe_entries(entries: &[PathBuf], resolve_symlinks: bool) -> (Vec<PathBuf>, usize) {
+    let mut seen = HashSet::new();
+    let deduped: Vec<PathBuf> = entries
+        .iter()
+        .filter(|entry| seen.insert(comparison_key(entry, resolve_symlinks)))
+        .cloned()
+        .collect();
+
+    let removed = entries.len() - deduped.len();
+    (deduped, removed)
+}
+
+/// Removes duplicate PATH entries, keeping the last occurrence of each.
+///
+/// Entries are compared as by [`dedupe_entries`]. Which occurrence survives
+/// decides which binary a command runs, since the first match in PATH wins;
+/// keeping the last one in its place lets an entry appended later take
+/// effect there.
+///
+/// # Arguments
+/// * `entries` - PATH entries in priority order
+/// * `resolve_symlinks` - Treat entries resolving to the same real directory as duplicates
+///
+/// # Returns
+/// * `(Vec<PathBuf>, usize)` - The deduplicated entries and the number removed
+///
+/// # Example
+/// ```rust
+/// # use pathmaster::utils;
+/// # use std::path::PathBuf;
+/// let entries = vec![
+///     PathBuf::from("/usr/bin"),
+///     PathBuf::from("/bin"),
+///     PathBuf::from("/usr/bin/"),
+/// ];
+/// let (deduped, removed) = utils::dedupe_entries_keeping_last(&entries, false);
+/// assert_eq!(deduped, vec![PathBuf::from("/bin"), PathBuf::from("/usr/bin/")]);
+/// assert_eq!(removed, 1);
+/// ```
+pub fn dedupe_entries_keeping_last(
+    entries: &[PathBuf],
+    resolve_symlinks: bool,
+) -> (Vec<PathBuf>, usize) {
+    let reversed: Vec<PathBuf> = entries.iter().rev().cloned().collect();
+    let (mut deduped, removed) = dedupe_entries(&reversed, resolve_symlinks);
+    deduped.reverse();
+    (deduped, removed)
+}
+
+/// Combines two lists of PATH entries into one.
+///
+/// Duplicates are removed as by [`dedupe_entries`], keeping the
+/// highest-priority occurrence of each entry. The order within each list is
+/// preserved.
+///
+/// # Arguments
+/// * `base` - The entries being merged into, such as the current PATH
+/// * `incoming` - The entries being merged in, such as an imported backup
+/// * `prepend_incoming` - Put the incoming entries first, giving them
+///   precedence; otherwise they follow the base entries
+///
+/// # Example
+/// ```rust
+/// # use pathmaster::utils;
+/// # use std::path::PathBuf;
+/// let base = vec![PathBuf::from("/usr/bin"), PathBuf::from("/bin")];
+/// let incoming = vec![PathBuf::from("/opt/bin"), PathBuf::from("/usr/bin")];
+/// assert_eq!(
+///     utils::merge_entries(&base, &incoming, true),
+///     vec![PathBuf::from("/opt/bin"), PathBuf::from("/usr/bin"), PathBuf::from("/bin")]
+/// );
+/// ```
+pub fn merge_entries(
+    base: &[PathBuf],
+    incoming: &[PathBuf],
+    prepend_incoming: bool,
+) -> Vec<PathBuf> {
+    let combined: Vec<PathBuf> = if prepend_incoming {
+        incoming.iter().chain(base).cloned().collect()
+    } else {
+        base.iter().chain(incoming).cloned().collect()
+    };
+
+    dedupe_entries(&combined, false).0
+}
+
+/// Percentage of the platform limit at which PATH is reported as too long
+const LENGTH_WARNING_PERCENT: usize = 75;
+
+/// Returns the longest PATH value, in bytes, that new processes accept
+///
+/// On Linux every environment string, `PATH=` included, is limited to
+/// `MAX_ARG_STRLEN` (128 KiB), and `exec` fails beyond it. On Windows a
+/// variable holds at most 32767 characters. Other Unix systems have no limit
+/// per string, but arguments and environment together must fit in
+/// `ARG_MAX`.
+pub fn path_length_limit() -> usize {
+    if cfg!(target_os = "linux") {
+        128 * 1024 - "PATH=".len() - 1
+    } else if cfg!(windows) {
+        32767
+    } else {
+        arg_max()
+    }
+}
+
+/// Returns `ARG_MAX`, or the POSIX minimum for it if it is unknown
+#[cfg(unix)]
+fn arg_max() -> usize {
+    // SAFETY: sysconf only reads a system constant
+    let value = unsafe { libc::sysconf(libc::_SC_ARG_MAX) };
+    if value > 0 {
+        value as usize
+    } else {
+        4096
+    }
+}
+
+#[cfg(not(unix))]
+fn arg_max() -> usize {
+    32767
+}
+
+/// A PATH long enough that commands may soon fail to start
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+pub struct LengthWarning {
+    /// Length of the PATH string in bytes
+    pub length: usize,
+    /// Longest PATH string the platform accepts, in bytes
+    pub limit: usize,
+}
+
+impl LengthWarning {
+    /// Returns how much of the limit is used, in percent
+    pub fn percent(&self) -> usize {
+        self.length * 100 / self.limit.max(1)
+    }
+}
+
+/// Returns a warning if a PATH string is close to the platform limit
+///
+/// # Arguments
+/// * `length` - Length of the PATH string in bytes
+/// * `limit` - The platform limit, from `path_length_limit`
+///
+/// # Returns
+/// * `Some(LengthWarning)` once `length` reaches 75% of `limit`
+/// * `None` otherwise
+pub fn length_warning(length: usize, limit: usize) -> Option<LengthWarning> {
+    if length * 100 >= limit * LENGTH_WARNING_PERCENT {
+        Some(LengthWarning { length, limit })
+    } else {
+        None
+    }
+}
+
+/// A way a PATH value fails to survive being split into entries and joined
+/// again, which pathmaster does whenever it saves PATH
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum SplitAnomaly {
+    /// Joining the entries again gives a different value, e.g. because
+    /// Windows drops the quotes around an entry; holds the rejoined value, or
+    /// `None` if an entry contains the separator and cannot be joined at all
+    RoundTrip(Option<String>),
+    /// The entry at this position, counting from 1, has whitespace around it,
+    /// which is dropped when PATH is saved
+    Whitespace(usize, PathBuf),
+    /// The entry at this position starts or ends with a quote, which the
+    /// shell takes as part of the directory name
+    Quoted(usize, PathBuf),
+    /// The entries from this position on are the pieces of one existing
+    /// directory whose name contains the separator; holds that directory
+    SeparatorInName(usize, PathBuf),
+}
+
+/// Finds the parts of a PATH value that splitting and joining would change
+///
+/// Directory names containing the separator cannot be put in PATH at all;
+/// they are found by rejoining up to three neighbouring entries, the first
+/// of which is not a directory, and checking whether the result is one.
+///
+/// # Arguments
+/// * `path_var` - A PATH value
+/// * `is_dir` - Tells whether a path is an existing directory
+pub fn split_anomalies<F>(path_var: &OsStr, mut is_dir: F) -> Vec<SplitAnomaly>
+where
+    F: FnMut(&Path) -> bool,
+{
+    let entries = parse_path_entries(path_var);
+    let mut anomalies = Vec::new();
+
+    match env::join_paths(&entries) {
+        Ok(joined) if joined == path_var => {}
+        Ok(joined) => anomalies.push(SplitAnomaly::RoundTrip(Some(
+            joined.to_string_lossy().into_owned(),
+        ))),
+        Err(_) => anomalies.push(SplitAnomaly::RoundTrip(None)),
+    }
+
+    let separator = if cfg!(windows) { ";" } else { ":" };
+    for (index, entry) in entries.iter().enumerate() {
+        let text = entry.to_string_lossy();
+        let trimmed = text.trim();
+        if trimmed.is_empty() {
+            continue;
+        }
+        if trimmed.len() != text.len() {
+            anomalies.push(SplitAnomaly::Whitespace(index + 1, entry.clone()));
+        }
+        if [trimmed.chars().next(), trimmed.chars().last()]
+            .iter()
+            .any(|c| matches!(c, Some('"') | Some('\'')))
+        {
+            anomalies.push(SplitAnomaly::Quoted(index + 1, entry.clone()));
+        }
+
+        if is_dir(entry) {
+            continue;
+        }
+        let mut joined = text.to_string();
+        for next in entries.iter().skip(index + 1).take(2) {
+            joined.push_str(separator);
+            joined.push_str(&next.to_string_lossy());
+            if is_dir(Path::new(&joined)) {
+                anomalies.push(SplitAnomaly::SeparatorInName(
+                    index + 1,
+                    PathBuf::from(&joined),
+                ));
+                break;
+            }
+        }
+    }
+
+    anomalies
+}
+
+/// Reads the character class at the start of `pattern`, which begins with `[`
+///
+/// # Arguments
+/// * `pattern` - The rest of the pattern, starting at the `[`
+/// * `c` - The character to test against the class, if any
+///
+/// # Returns
+/// * `Ok((matched, len))` - Whether `c` is in the class, and how many
+///   characters of the pattern the class takes up
+/// * `Err(String)` if the class is empty or not closed
+fn glob_class(pattern: &[char], c: Option<char>) -> Result<(bool, usize), String> {
+    let unclosed = || "unclosed character class".to_string();
+    let mut i = 1;
+    let negated = matches!(pattern.get(i), Some('^') | Some('!'));
+    if negated {
+        i += 1;
+    }
+
+    let mut matched = false;
+    let mut first = true;
+    loop {
+        match pattern.get(i) {
+            None => return Err(unclosed()),
+            Some(']') if !first => break,
+            Some(']') => return Err("empty character class".to_string()),
+            _ => {}
+        }
+        first = false;
+
+        let bound = |i: &mut usize| -> Result<char, String> {
+            let mut ch = *pattern.get(*i).ok_or_else(unclosed)?;
+            if ch == '\\' && !cfg!(windows) {
+                *i += 1;
+                ch = *pattern.get(*i).ok_or_else(unclosed)?;
+            }
+            *i += 1;
+            Ok(ch)
+        };
+        let low = bound(&mut i)?;
+        let high = if pattern.get(i) == Some(&'-') && pattern.get(i + 1) != Some(&']') {
+            i += 1;
+            bound(&mut i)?
+        } else {
+            low
+        };
+        if c.map_or(false, |c| low <= c && c <= high) {
+            matched = true;
+        }
+    }
+
+    Ok((matched != negated, i + 1))
+}
+
+/// Matches `text` against `pattern`, both split into characters
+fn glob_from(pattern: &[char], text: &[char]) -> Result<bool, String> {
+    let first = match pattern.first() {
+        Some(&first) => first,
+        None => return Ok(text.is_empty()),
+    };
+
+    match first {
+        '*' => {
+            for split in 0..=text.len() {
+                if glob_from(&pattern[1..], &text[split..])? {
+                    return Ok(true);
+                }
+                if split < text.len() && std::path::is_separator(text[split]) {
+                    break;
+                }
+            }
+            Ok(false)
+        }
+        '?' => match text.first() {
+            Some(&c) if !std::path::is_separator(c) => glob_from(&pattern[1..], &text[1..]),
+            _ => Ok(false),
+        },
+        '[' => {
+            let (matched, len) = glob_class(pattern, text.first().copied())?;
+            Ok(matched && glob_from(&pattern[len..], &text[1..])?)
+        }
+        '\\' if !cfg!(windows) => match pattern.get(1) {
+            None => Err("trailing backslash".to_string()),
+            Some(&c) => Ok(text.first() == Some(&c) && glob_from(&pattern[2..], &text[1..])?),
+        },
+        c => Ok(text.first() == Some(&c) && glob_from(&pattern[1..], &text[1..])?),
+    }
+}
+
+/// Checks that a glob pattern is well formed
+///
+/// # Returns
+/// * `Ok(())` if the pattern can be used with [`glob_match`]
+/// * `Err(String)` describing the problem otherwise
+pub fn check_glob(pattern: &str) -> Result<(), String> {
+    let chars: Vec<char> = pattern.chars().collect();
+    let mut i = 0;
+    while i < chars.len() {
+        match chars[i] {
+            '[' => i += glob_class(&chars[i..], None)?.1,
+            '\\' if !cfg!(windows) && i + 1 == chars.len() => {
+                return Err("trailing backslash".to_string())
+            }
+            '\\' if !cfg!(windows) => i += 2,
+            _ => i += 1,
+        }
+    }
+    Ok(())
+}
+
+/// Matches a PATH entry against a shell-style glob pattern
+///
+/// The whole entry must match. `*` matches any run of characters and `?` any
+/// single character, except path separators; `[abc]`, `[a-z]` and `[^a-z]`
+/// match one character from, or not from, a set; outside Windows a backslash
+/// makes the next character literal. So `/opt/*/bin` matches `/opt/go/bin`
+/// but not `/opt/go/libexec/bin`.
+///
+/// # Returns
+/// * `Ok(bool)` - Whether the entry matches
+/// * `Err(String)` if the pattern is malformed, see [`check_glob`]
+pub fn glob_match(pattern: &str, entry: &Path) -> Result<bool, String> {
+    check_glob(pattern)?;
+    let pattern: Vec<char> = pattern.chars().collect();
+    let text: Vec<char> = entry.to_string_lossy().chars().collect();
+    glob_from(&pattern, &text)
+}
+
+/// Determines whether a PATH entry matches any of the glob patterns
+///
+/// Patterns are checked with `check_glob` before this is called, so a
+/// malformed one simply does not match.
+pub fn matches_any_glob(entry: &Path, globs: &[String]) -> bool {
+    globs
+        .iter()
+        .any(|pattern| glob_match(pattern, entry).unwrap_or(false))
+}
+
 #[cfg(test)]
 mod tests {
     use super::*;
@@ -80,6 +707,26 @@ mod tests {
         assert_eq!(expanded, home.join("test"));
     }
 
+    #[cfg(unix)]
+    #[test]
+    fn test_collapse_separators() {
+        for (entry, expected) in [
+            ("/usr/bin/", "/usr/bin"),
+            ("/usr//bin", "/usr/bin"),
+            ("//usr///bin//", "/usr/bin"),
+            ("/usr/bin", "/usr/bin"),
+            ("///", "/"),
+            ("bin/", "bin"),
+        ] {
+            assert_eq!(
+                collapse_separators(Path::new(entry)),
+                PathBuf::from(expected),
+                "{}",
+                entry
+            );
+        }
+    }
+
     #[test]
     fn test_is_valid_path_entry() {
         let temp_dir = TempDir::new().unwrap();
@@ -109,4 +756,272 @@ mod tests {
             env::set_var("PATH", path);
         }
     }
+
+    #[cfg(unix)]
+    #[test]
+    fn test_parse_path_entries() {
+        assert_eq!(
+            parse_path_entries("/usr/local/bin:/usr/bin"),
+            vec![PathBuf::from("/usr/local/bin"), PathBuf::from("/usr/bin")]
+        );
+        assert_eq!(
+            parse_path_entries("/usr/bin::/bin"),
+            vec![
+                PathBuf::from("/usr/bin"),
+                PathBuf::new(),
+                PathBuf::from("/bin")
+            ]
+        );
+        assert_eq!(
+            parse_path_entries("/usr/bin"),
+            vec![PathBuf::from("/usr/bin")]
+        );
+    }
+
+    #[cfg(unix)]
+    #[test]
+    fn test_build_path_string_round_trips() {
+        let entries = parse_path_entries(" /usr/local/bin::/usr/bin :/bin:");
+        let built = build_path_string(&entries);
+        assert_eq!(built, "/usr/local/bin:/usr/bin:/bin");
+
+        // Normalized input survives a round trip unchanged
+        assert_eq!(build_path_string(&parse_path_entries(&built)), built);
+        assert_eq!(build_path_string(&[]), "");
+    }
+
+    #[cfg(unix)]
+    #[test]
+    fn test_empty_entry_positions() {
+        let cases = [
+            (":/usr/bin", vec![1]),
+            ("/usr/bin::/bin", vec![2]),
+            ("/usr/bin:/bin:", vec![3]),
+            ("/usr/bin: :/bin", vec![2]),
+            ("/usr/bin:/bin", vec![]),
+        ];
+
+        for (path, expected) in cases {
+            let entries = parse_path_entries(path);
+            assert_eq!(empty_entry_positions(&entries), expected, "PATH {}", path);
+        }
+    }
+
+    #[test]
+    fn test_dedupe_entries() {
+        let home = dirs_next::home_dir().unwrap();
+        let entries = vec![
+            PathBuf::from("/usr/bin"),
+            PathBuf::from("/bin"),
+            PathBuf::from("/usr/bin/"),
+            PathBuf::from("~/bin"),
+            home.join("bin"),
+            PathBuf::from("/bin"),
+        ];
+
+        let (deduped, removed) = dedupe_entries(&entries, false);
+        assert_eq!(
+            deduped,
+            vec![
+                PathBuf::from("/usr/bin"),
+                PathBuf::from("/bin"),
+                PathBuf::from("~/bin")
+            ]
+        );
+        assert_eq!(removed, 3);
+
+        let (deduped, removed) = dedupe_entries_keeping_last(&entries, false);
+        assert_eq!(
+            deduped,
+            vec![
+                PathBuf::from("/usr/bin/"),
+                home.join("bin"),
+                PathBuf::from("/bin")
+            ]
+        );
+        assert_eq!(removed, 3);
+    }
+
+    fn paths(entries: &[&str]) -> Vec<PathBuf> {
+        entries.iter().map(PathBuf::from).collect()
+    }
+
+    #[test]
+    fn test_length_warning() {
+        // A synthetic PATH of 1000 entries, each 100 bytes with its separator
+        let entry = format!("/{}", "d".repeat(98));
+        let entries = vec![PathBuf::from(&entry); 1000];
+        let length = build_path_string(&entries).len();
+        assert_eq!(length, 99_999);
+
+        assert_eq!(length_warning(length, 200_000), None);
+        let warning = length_warning(length, 131_066).unwrap();
+        assert_eq!(warning.percent(), 76);
+        assert!(length_warning(length, 100_000).is_some());
+        assert!(path_length_limit() >= 4096);
+    }
+
+    #[test]
+    fn test_merge_entries_precedence() {
+        let base = paths(&["/usr/bin", "/bin"]);
+        let incoming = paths(&["/opt/bin", "/usr/bin/"]);
+
+        assert_eq!(
+            merge_entries(&base, &incoming, false),
+            paths(&["/usr/bin", "/bin", "/opt/bin"])
+        );
+        assert_eq!(
+            merge_entries(&base, &incoming, true),
+            paths(&["/opt/bin", "/usr/bin/", "/bin"])
+        );
+    }
+
+    #[test]
+    fn test_merge_entries_dedupes_and_keeps_order() {
+        let base = paths(&["/a", "/b", "/a", "/c"]);
+        let incoming = paths(&["/d", "/c", "/e", "/d"]);
+
+        assert_eq!(
+            merge_entries(&base, &incoming, false),
+            paths(&["/a", "/b", "/c", "/d", "/e"])
+        );
+        assert_eq!(
+            merge_entries(&base, &incoming, true),
+            paths(&["/d", "/c", "/e", "/a", "/b"])
+        );
+        assert_eq!(
+            merge_entries(&[], &incoming, false),
+            paths(&["/d", "/c", "/e"])
+        );
+        assert_eq!(merge_entries(&base, &[], true), paths(&["/a", "/b", "/c"]));
+    }
+
+    #[test]
+    fn test_dedupe_keeps_root() {
+        let entries = vec![PathBuf::from("/"), PathBuf::from("//")];
+        let (deduped, removed) = dedupe_entries(&entries, false);
+        assert_eq!(deduped, vec![PathBuf::from("/")]);
+        assert_eq!(removed, 1);
+    }
+
+    #[test]
+    fn test_normalize_path_lexical() {
+        let cases = [
+            ("/usr/local/../bin/", "/usr/bin"),
+            ("/usr/./bin", "/usr/bin"),
+            ("/usr//bin", "/usr/bin"),
+            ("/../bin", "/bin"),
+            ("../bin", "../bin"),
+            ("./bin/..", "."),
+        ];
+
+        for (input, expected) in cases {
+            assert_eq!(
+                normalize_path(input, false).unwrap(),
+                PathBuf::from(expected),
+                "normalizing {}",
+                input
+            );
+        }
+    }
+
+    #[test]
+    fn test_normalize_path_expands_variables() {
+        let home = dirs_next::home_dir().unwrap();
+        assert_eq!(normalize_path("~/bin", false).unwrap(), home.join("bin"));
+
+        env::set_var("PATHMASTER_TEST_DIR", "/opt/tool");
+        assert_eq!(
+            normalize_path("$PATHMASTER_TEST_DIR/bin", false).unwrap(),
+            PathBuf::from("/opt/tool/bin")
+        );
+        assert!(normalize_path("$PATHMASTER_UNDEFINED_VAR/bin", false).is_err());
+    }
+
+    #[cfg(unix)]
+    #[test]
+    fn test_split_anomalies() {
+        let temp_dir = TempDir::new().unwrap();
+        let odd = temp_dir.path().join("tools:v2");
+        std::fs::create_dir(&odd).unwrap();
+
+        // A malformed PATH: a directory with the separator in its name, a
+        // padded entry and a quoted one
+        let path_var = format!("/usr/bin:{}: /opt/bin :\"/opt/quoted\"", odd.display());
+        let anomalies = split_anomalies(OsStr::new(&path_var), |dir| dir.is_dir());
+        assert_eq!(
+            anomalies,
+            vec![
+                SplitAnomaly::SeparatorInName(2, odd.clone()),
+                SplitAnomaly::Whitespace(4, PathBuf::from(" /opt/bin ")),
+                SplitAnomaly::Quoted(5, PathBuf::from("\"/opt/quoted\"")),
+            ]
+        );
+
+        // Splitting and joining round-trips on Unix, empty entries included
+        assert!(split_anomalies(OsStr::new("/usr/bin::/bin"), |_| true).is_empty());
+    }
+
+    #[test]
+    fn test_glob_match() {
+        let matches = |pattern: &str, entry: &str| glob_match(pattern, Path::new(entry)).unwrap();
+
+        assert!(matches("/opt/*/bin", "/opt/go/bin"));
+        assert!(!matches("/opt/*/bin", "/opt/go/libexec/bin"));
+        assert!(!matches("/opt/*/bin", "/opt/go/bin/extra"));
+        assert!(matches("/opt/*", "/opt/"));
+        assert!(matches("/usr/local/?in", "/usr/local/bin"));
+        assert!(!matches("/usr/?", "/usr//"));
+        assert!(matches("/opt/tool-[0-9]*/bin", "/opt/tool-12/bin"));
+        assert!(!matches("/opt/tool-[0-9]*/bin", "/opt/tool-x/bin"));
+        assert!(matches("/opt/[^a-m]*", "/opt/zig"));
+        assert!(!matches("/opt/[!a-m]*", "/opt/go"));
+        assert!(matches("/usr/bin", "/usr/bin"));
+        assert!(!matches("/usr/bin", "/usr/bin/"));
+    }
+
+    #[cfg(unix)]
+    #[test]
+    fn test_matches_any_glob() {
+        let globs = vec!["/opt/*/bin".to_string(), "/usr/local/go*".to_string()];
+        assert!(matches_any_glob(Path::new("/opt/node/bin"), &globs));
+        assert!(matches_any_glob(Path::new("/usr/local/go1.22"), &globs));
+        assert!(!matches_any_glob(Path::new("/opt/node/lib/bin"), &globs));
+        assert!(!matches_any_glob(Path::new("/usr/bin"), &globs));
+        assert!(!matches_any_glob(Path::new("/usr/bin"), &[]));
+    }
+
+    #[test]
+    fn test_malformed_globs() {
+        assert!(check_glob("/opt/[a-z").is_err());
+        assert!(check_glob("/opt/[]").is_err());
+        assert!(glob_match("/opt/[", Path::new("/usr/bin")).is_err());
+        assert!(check_glob("/opt/*/bin").is_ok());
+        #[cfg(unix)]
+        {
+            assert!(check_glob("/opt/\\").is_err());
+            assert!(glob_match("/opt/\\*", Path::new("/opt/*")).unwrap());
+            assert!(!glob_match("/opt/\\*", Path::new("/opt/go")).unwrap());
+        }
+    }
+
+    #[cfg(unix)]
+    #[test]
+    fn test_symlinked_duplicates() {
+        let temp_dir = TempDir::new().unwrap();
+        let real = temp_dir.path().join("real");
+        let link = temp_dir.path().join("link");
+        std::fs::create_dir(&real).unwrap();
+        std::os::unix::fs::symlink(&real, &link).unwrap();
+
+        let entries = vec![real.clone(), link.clone()];
+
+        let (kept, removed) = dedupe_entries(&entries, false);
+        assert_eq!(kept, entries);
+        assert_eq!(removed, 0);
+
+        let (kept, removed) = dedupe_entries(&entries, true);
+        assert_eq!(kept, vec![real]);
+        assert_eq!(removed, 1);
+    }
 }
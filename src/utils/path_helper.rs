@@ -0,0 +1,258 @@
+//! Awareness of macOS's `path_helper`.
+//!
+//! This module handles:
+//! - Detecting whether `path_helper` rebuilds PATH on this system
+//! - Reading the directories it takes from `/etc/paths` and `/etc/paths.d`
+//! - Warning when a change is likely to be undone by it
+//!
+//! `path_helper` is run from `/etc/profile` and `/etc/zprofile` for login
+//! shells. It puts the directories listed in those files first, in file
+//! order, and keeps the rest of PATH after them, so a directory removed by
+//! pathmaster can come back and reordered ones can be put back in place.
+
+use crate::utils::system_files::{candidate_files, parse_contributions, SystemFileKind};
+use std::fs;
+use std::path::{Path, PathBuf};
+
+/// Location of `path_helper` on macOS
+pub const PATH_HELPER: &str = "/usr/libexec/path_helper";
+
+/// A directory `path_helper` adds to PATH
+#[derive(Debug, Clone, PartialEq)]
+pub struct HelperEntry {
+    /// The directory
+    pub entry: PathBuf,
+    /// The file listing it
+    pub file: PathBuf,
+}
+
+/// A way `path_helper` may undo a change
+#[derive(Debug, Clone, PartialEq)]
+pub enum Override {
+    /// A removed directory that it adds back
+    Restored(HelperEntry),
+    /// Directories it lists, now in a different order from its own; it puts
+    /// them back in file order
+    Reordered(Vec<PathBuf>),
+}
+
+/// Whether `path_helper` rebuilds PATH on this system
+pub fn is_active() -> bool {
+    cfg!(target_os = "macos") && Path::new(PATH_HELPER).exists()
+}
+
+/// Reads the directories `path_helper` adds, in the order it adds them
+///
+/// A directory listed more than once keeps its first place.
+///
+/// # Arguments
+/// * `root` - Directory standing for `/`
+pub fn helper_entries(root: &Path) -> Vec<HelperEntry> {
+    let mut entries: Vec<HelperEntry> = Vec::new();
+    for (file, kind) in candidate_files(root) {
+        if kind != SystemFileKind::PathList {
+            continue;
+        }
+        let content = match fs::read_to_string(&file) {
+            Ok(content) => content,
+            Err(_) => continue,
+        };
+        for contribution in parse_contributions(&content, kind) {
+            for entry in contribution.entries {
+                if !entries.iter().any(|known| known.entry == entry) {
+                    entries.push(HelperEntry {
+                        entry,
+                        file: file.clone(),
+                    });
+                }
+            }
+        }
+    }
+    entries
+}
+
+/// Finds the parts of a change that `path_helper` may undo
+///
+/// Only what the change did is reported: directories it removed that
+/// `path_helper` lists, and a reordering of listed directories that were in
+/// file order before the change.
+///
+/// # Arguments
+/// * `previous` - PATH entries before the change
+/// * `new` - PATH entries after the change
+/// * `helper` - Directories `path_helper` adds, as returned by `helper_entries`
+pub fn find_overrides(
+    previous: &[PathBuf],
+    new: &[PathBuf],
+    helper: &[HelperEntry],
+) -> Vec<Override> {
+    let mut overrides: Vec<Override> = helper
+        .iter()
+        .filter(|listed| previous.contains(&listed.entry) && !new.contains(&listed.entry))
+        .cloned()
+        .map(Override::Restored)
+        .collect();
+
+    // The listed directories in the order `entries` has them
+    let listed_order = |entries: &[PathBuf]| -> Vec<PathBuf> {
+        let mut order: Vec<PathBuf> = Vec::new();
+        for entry in entries {
+            if helper.iter().any(|listed| listed.entry == *entry) && !order.contains(entry) {
+                order.push(entry.clone());
+            }
+        }
+        order
+    };
+    let file_order = |order: &[PathBuf]| -> Vec<PathBuf> {
+        helper
+            .iter()
+            .map(|listed| listed.entry.clone())
+            .filter(|entry| order.contains(entry))
+            .collect()
+    };
+
+    let before = listed_order(previous);
+    let after = listed_order(new);
+    if after != file_order(&after) && before == file_order(&before) {
+        overrides.push(Override::Reordered(after));
+    }
+
+    overrides
+}
+
+/// Warns on macOS when `path_helper` may undo a change
+///
+/// Does nothing elsewhere, or when the change is safe from it.
+///
+/// # Arguments
+/// * `previous` - PATH entries before the change
+/// * `new` - PATH entries after the change
+pub fn warn_overrides(previous: &[PathBuf], new: &[PathBuf]) {
+    if !is_active() {
+        return;
+    }
+
+    let overrides = find_overrides(previous, new, &helper_entries(Path::new("/")));
+    if overrides.is_empty() {
+        return;
+    }
+
+    eprintln!("Warning: macOS path_helper rebuilds PATH in login shells and may undo this change:");
+    for found in &overrides {
+        match found {
+            Override::Restored(listed) => eprintln!(
+                "  {} will be added back from {}",
+                listed.entry.display(),
+                listed.file.display()
+            ),
+            Override::Reordered(order) => {
+                let order: Vec<String> = order
+                    .iter()
+                    .map(|entry| entry.display().to_string())
+                    .collect();
+                eprintln!(
+                    "  {} will be put back in the order of /etc/paths",
+                    order.join(", ")
+                );
+            }
+        }
+    }
+    eprintln!(
+        "To make it stick, edit /etc/paths or the file in /etc/paths.d (needs sudo), or keep PATH in ~/.zshrc or ~/.bash_profile, which run after path_helper. See `pathmaster system`."
+    );
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::io;
+    use tempfile::TempDir;
+
+    fn paths(entries: &[&str]) -> Vec<PathBuf> {
+        entries.iter().map(PathBuf::from).collect()
+    }
+
+    fn listed(entry: &str, file: &str) -> HelperEntry {
+        HelperEntry {
+            entry: PathBuf::from(entry),
+            file: PathBuf::from(file),
+        }
+    }
+
+    #[test]
+    fn test_helper_entries() -> io::Result<()> {
+        let root = TempDir::new()?;
+        let etc = root.path().join("etc");
+        fs::create_dir_all(etc.join("paths.d"))?;
+        fs::write(etc.join("paths"), "/usr/local/bin\n/usr/bin\n/bin\n")?;
+        fs::write(etc.join("paths.d/go"), "/usr/local/go/bin\n/usr/bin\n")?;
+        fs::write(etc.join("profile"), "PATH=/opt/ignored/bin\n")?;
+
+        let entries = helper_entries(root.path());
+        let found: Vec<(&Path, &Path)> = entries
+            .iter()
+            .map(|listed| (listed.entry.as_path(), listed.file.as_path()))
+            .collect();
+        let (paths_file, go_file) = (etc.join("paths"), etc.join("paths.d/go"));
+        assert_eq!(
+            found,
+            vec![
+                (Path::new("/usr/local/bin"), paths_file.as_path()),
+                (Path::new("/usr/bin"), paths_file.as_path()),
+                (Path::new("/bin"), paths_file.as_path()),
+                (Path::new("/usr/local/go/bin"), go_file.as_path()),
+            ]
+        );
+        Ok(())
+    }
+
+    #[test]
+    fn test_find_overrides() {
+        let helper = vec![
+            listed("/usr/local/bin", "/etc/paths"),
+            listed("/usr/bin", "/etc/paths"),
+            listed("/usr/local/go/bin", "/etc/paths.d/go"),
+        ];
+        let previous = paths(&[
+            "/usr/local/bin",
+            "/usr/bin",
+            "/usr/local/go/bin",
+            "/opt/bin",
+        ]);
+
+        // Removing a directory path_helper lists
+        let new = paths(&["/usr/local/bin", "/usr/bin", "/opt/bin"]);
+        assert_eq!(
+            find_overrides(&previous, &new, &helper),
+            vec![Override::Restored(listed(
+                "/usr/local/go/bin",
+                "/etc/paths.d/go"
+            ))]
+        );
+
+        // Swapping two of them
+        let new = paths(&[
+            "/usr/bin",
+            "/usr/local/bin",
+            "/usr/local/go/bin",
+            "/opt/bin",
+        ]);
+        assert_eq!(
+            find_overrides(&previous, &new, &helper),
+            vec![Override::Reordered(paths(&[
+                "/usr/bin",
+                "/usr/local/bin",
+                "/usr/local/go/bin"
+            ]))]
+        );
+
+        // Changes that leave them alone
+        let new = paths(&[
+            "/home/me/bin",
+            "/usr/local/bin",
+            "/usr/bin",
+            "/usr/local/go/bin",
+        ]);
+        assert!(find_overrides(&previous, &new, &helper).is_empty());
+    }
+}
@@ -0,0 +1,219 @@
+//! Persistent PATH storage for the current platform.
+//!
+//! This module handles:
+//! - Loading the PATH entries that a command should edit
+//! - Saving edited entries to the shell configuration on Unix-like systems
+//! - Saving edited entries to the registry on Windows
+//! - Reading back what was saved, and putting it back if a change must be
+//!   rolled back
+
+use std::io;
+use std::path::PathBuf;
+
+/// Loads the PATH entries that a mutating command should start from
+///
+/// On Windows this is the user or system PATH from the registry, so that
+/// entries from the other hive are not copied over on save. Elsewhere it is
+/// the PATH of the current process, followed by any entries the shell
+/// configuration adds that the current session has not picked up yet; since
+/// saving rewrites every PATH declaration, those would otherwise be lost.
+///
+/// # Arguments
+///
+/// * `system` - Use the machine-wide PATH (Windows only)
+pub fn load_entries(system: bool) -> io::Result<Vec<PathBuf>> {
+    #[cfg(windows)]
+    {
+        super::windows::read_path_entries(system)
+    }
+
+    #[cfg(not(windows))]
+    {
+        check_scope(system)?;
+        Ok(with_config_entries(
+            super::get_path_entries(),
+            super::shell::config_entries()?,
+        ))
+    }
+}
+
+/// Saves PATH entries so they persist into new sessions
+///
+/// # Arguments
+///
+/// * `entries` - The PATH entries to save
+/// * `system` - Write the machine-wide PATH (Windows only)
+pub fn save_entries(entries: &[PathBuf], system: bool) -> io::Result<()> {
+    #[cfg(windows)]
+    {
+        super::windows::write_path_entries(entries, system)
+    }
+
+    #[cfg(not(windows))]
+    {
+        check_scope(system)?;
+        let entries = with_literal_entries(entries, &super::shell::config_literals()?);
+        super::update_shell_config(&entries)
+    }
+}
+
+/// Returns where `save_entries` writes PATH
+///
+/// This is the shell configuration file on Unix-like systems, or
+/// `fish_user_paths` when fish's universal variable is set instead, and the
+/// registry key holding the environment on Windows.
+///
+/// # Arguments
+///
+/// * `system` - The machine-wide PATH (Windows only)
+pub fn saved_location(system: bool) -> PathBuf {
+    #[cfg(windows)]
+    {
+        super::windows::environment_key_name(system)
+    }
+
+    #[cfg(not(windows))]
+    {
+        let _ = system;
+        if super::shell::saves_externally().unwrap_or(false) {
+            return PathBuf::from("fish_user_paths");
+        }
+        super::shell::factory::get_shell_handler().target_config_path()
+    }
+}
+
+/// Loads the PATH entries as saved, expanded
+///
+/// On Windows this is the user or system PATH from the registry; elsewhere
+/// the entries the shell configuration declares. Used to check what a change
+/// actually wrote.
+///
+/// # Arguments
+///
+/// * `system` - Use the machine-wide PATH (Windows only)
+pub fn load_saved(system: bool) -> io::Result<Vec<PathBuf>> {
+    #[cfg(windows)]
+    {
+        super::windows::read_path_entries(system)
+    }
+
+    #[cfg(not(windows))]
+    {
+        check_scope(system)?;
+        Ok(super::shell::config_entries()?
+            .iter()
+            .map(|entry| super::path::expand_variables(&entry.to_string_lossy()))
+            .collect())
+    }
+}
+
+/// Puts the saved PATH back the way it was before the last `save_entries`
+///
+/// On Unix-like systems the shell configuration, or fish's universal
+/// `fish_user_paths`, is restored from the undo snapshot taken while saving,
+/// and that snapshot is dropped.
+///
+/// # Arguments
+///
+/// * `previous` - The saved entries before the change, written back on Windows
+/// * `system` - Write the machine-wide PATH (Windows only)
+pub fn revert_save(previous: &[PathBuf], system: bool) -> io::Result<()> {
+    #[cfg(windows)]
+    {
+        super::windows::write_path_entries(previous, system)
+    }
+
+    #[cfg(not(windows))]
+    {
+        let _ = previous;
+        check_scope(system)?;
+        super::undo::revert_last().map(|_| ())
+    }
+}
+
+/// Writes entries back in the unexpanded form the configuration used
+///
+/// An entry the configuration wrote as e.g. `$HOME/bin` reaches pathmaster
+/// expanded; saving it expanded would tie the file to this machine.
+#[cfg(not(windows))]
+fn with_literal_entries(entries: &[PathBuf], literals: &[String]) -> Vec<PathBuf> {
+    entries
+        .iter()
+        .map(|entry| {
+            literals
+                .iter()
+                .find(|literal| super::path::expand_variables(literal) == *entry)
+                .map_or_else(|| entry.clone(), PathBuf::from)
+        })
+        .collect()
+}
+
+/// Appends configuration entries missing from the session PATH
+///
+/// Entries that still contain unexpanded variables or command substitutions
+/// cannot be resolved here and are left out.
+#[cfg(not(windows))]
+fn with_config_entries(mut entries: Vec<PathBuf>, config: Vec<PathBuf>) -> Vec<PathBuf> {
+    for entry in config {
+        let unresolved = entry.to_string_lossy().contains(|c| c == '$' || c == '`');
+        if !unresolved && !entries.contains(&entry) {
+            entries.push(entry);
+        }
+    }
+    entries
+}
+
+/// Rejects the system scope on platforms without a system PATH backend
+#[cfg(not(windows))]
+fn check_scope(system: bool) -> io::Result<()> {
+    if system {
+        return Err(io::Error::new(
+            io::ErrorKind::Unsupported,
+            "--system is only supported on Windows",
+        ));
+    }
+    Ok(())
+}
+
+#[cfg(all(test, not(windows)))]
+mod tests {
+    use super::*;
+    use std::env;
+
+    #[test]
+    fn test_system_scope_rejected() {
+        let err = load_entries(true).unwrap_err();
+        assert_eq!(err.kind(), io::ErrorKind::Unsupported);
+    }
+
+    #[test]
+    fn test_with_literal_entries() {
+        let home = env::var("HOME").unwrap();
+        let entries = vec![
+            PathBuf::from("/usr/bin"),
+            PathBuf::from(format!("{}/bin", home)),
+        ];
+        assert_eq!(
+            with_literal_entries(&entries, &[String::from("$HOME/bin")]),
+            vec![PathBuf::from("/usr/bin"), PathBuf::from("$HOME/bin")]
+        );
+    }
+
+    #[test]
+    fn test_with_config_entries() {
+        let session = vec![PathBuf::from("/usr/bin"), PathBuf::from("/bin")];
+        let config = vec![
+            PathBuf::from("/bin"),
+            PathBuf::from("/opt/foo/bin"),
+            PathBuf::from("$(brew --prefix)/bin"),
+        ];
+        assert_eq!(
+            with_config_entries(session, config),
+            vec![
+                PathBuf::from("/usr/bin"),
+                PathBuf::from("/bin"),
+                PathBuf::from("/opt/foo/bin")
+            ]
+        );
+    }
+}
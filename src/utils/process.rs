@@ -0,0 +1,96 @@
+//! Reading PATH from other running processes.
+//!
+//! This module handles:
+//! - Reading a process's environment from `/proc/<pid>/environ` on Linux
+//! - Finding PATH in it and splitting it into entries
+//! - Explaining why it cannot be read, e.g. because the process belongs to
+//!   another user
+//!
+//! `/proc/<pid>/environ` holds the environment the process started with;
+//! changes it made to its own environment afterwards are not shown.
+
+use std::io;
+use std::path::PathBuf;
+
+/// Finds the value of PATH in a NUL-separated environment block
+#[cfg(target_os = "linux")]
+pub fn environ_path(environ: &[u8]) -> Option<std::ffi::OsString> {
+    use std::ffi::OsStr;
+    use std::os::unix::ffi::OsStrExt;
+
+    environ
+        .split(|&b| b == 0)
+        .find_map(|variable| variable.strip_prefix(b"PATH="))
+        .map(|value| OsStr::from_bytes(value).to_os_string())
+}
+
+/// Reads the PATH entries of a running process
+///
+/// # Arguments
+/// * `pid` - The process id
+///
+/// # Returns
+/// * `Ok(Vec<PathBuf>)` - The process's PATH entries, in priority order
+/// * `Err(io::Error)` with kind `NotFound` if there is no such process or it
+///   has no PATH, `PermissionDenied` if it belongs to another user, or any
+///   other error reading its environment
+#[cfg(target_os = "linux")]
+pub fn process_path_entries(pid: u32) -> io::Result<Vec<PathBuf>> {
+    let file = format!("/proc/{}/environ", pid);
+    let environ = std::fs::read(&file).map_err(|e| match e.kind() {
+        io::ErrorKind::NotFound => {
+            io::Error::new(e.kind(), format!("No process with id {} is running", pid))
+        }
+        io::ErrorKind::PermissionDenied => io::Error::new(
+            e.kind(),
+            format!(
+                "Permission denied reading the environment of process {}; it likely belongs to another user, so run pathmaster as that user or with sudo",
+                pid
+            ),
+        ),
+        _ => io::Error::new(e.kind(), format!("Cannot read {}: {}", file, e)),
+    })?;
+
+    match environ_path(&environ) {
+        Some(path) => Ok(crate::utils::parse_path_entries(&path)),
+        None => Err(io::Error::new(
+            io::ErrorKind::NotFound,
+            format!("Process {} was started without PATH set", pid),
+        )),
+    }
+}
+
+/// Reads the PATH entries of a running process
+///
+/// Only supported on Linux, where `/proc` exposes other processes'
+/// environments.
+#[cfg(not(target_os = "linux"))]
+pub fn process_path_entries(_pid: u32) -> io::Result<Vec<PathBuf>> {
+    Err(io::Error::new(
+        io::ErrorKind::Unsupported,
+        "Reading another process's PATH is only supported on Linux",
+    ))
+}
+
+#[cfg(all(test, target_os = "linux"))]
+mod tests {
+    use super::*;
+    use std::ffi::OsString;
+
+    #[test]
+    fn test_environ_path() {
+        let environ = b"HOME=/home/me\0MANPATH=/usr/share/man\0PATH=/usr/bin:/bin\0LANG=C\0";
+        assert_eq!(environ_path(environ), Some(OsString::from("/usr/bin:/bin")));
+        assert_eq!(environ_path(b"HOME=/home/me\0"), None);
+        assert_eq!(environ_path(b""), None);
+    }
+
+    #[test]
+    fn test_process_path_entries() {
+        assert!(process_path_entries(std::process::id()).is_ok());
+        assert_eq!(
+            process_path_entries(u32::MAX).unwrap_err().kind(),
+            io::ErrorKind::NotFound
+        );
+    }
+}
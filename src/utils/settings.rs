@@ -0,0 +1,249 @@
+//! User defaults loaded from `~/.pathmaster/config.toml`.
+//!
+//! This module handles:
+//! - Reading and validating the config file
+//! - Built-in defaults for every setting, used when the file or a key is missing
+//! - The effective settings for this run, after command-line overrides
+//!
+//! Example file:
+//!
+//! ```toml
+//! backup_format = "toml"
+//! backup_name_format = "epoch"
+//! compress_backups = true
+//! backup_dir = "~/dotfiles/pathmaster-backups"
+//! auto_backup = true
+//! keep_backups = 20
+//! max_backup_age = "30d"
+//! shell = "zsh"
+//! prepend = true
+//! warn_shadows = true
+//! post_edit_hook = "cd ~/dotfiles && git add \"$PATHMASTER_FILE\""
+//! ```
+
+use crate::backup::prune::parse_age;
+use crate::backup::{BackupFormat, NameFormat};
+use crate::log_debug;
+use crate::utils::path::expand_path;
+use crate::utils::shell::types::ShellType;
+use lazy_static::lazy_static;
+use serde::Deserialize;
+use std::fs;
+use std::io;
+use std::path::{Path, PathBuf};
+use std::sync::Mutex;
+
+lazy_static! {
+    static ref SETTINGS: Mutex<Settings> = Mutex::new(Settings::default());
+}
+
+/// Defaults for options that would otherwise be passed on every run
+#[derive(Debug, Clone, PartialEq)]
+pub struct Settings {
+    /// Format used when writing new backups
+    pub backup_format: BackupFormat,
+    /// Scheme for the timestamp in new backup file names
+    pub backup_name_format: NameFormat,
+    /// Gzip new backups, adding `.gz` to their names
+    pub compress_backups: bool,
+    /// Directory backups are written to, instead of the default one
+    pub backup_dir: Option<PathBuf>,
+    /// Back up PATH before every change
+    pub auto_backup: bool,
+    /// Number of newest backups kept after each automatic backup
+    pub keep_backups: Option<usize>,
+    /// Age beyond which backups are removed after each automatic backup,
+    /// e.g. `30d`
+    pub max_backup_age: Option<String>,
+    /// Shell whose configuration is edited, instead of the detected one
+    pub shell: Option<ShellType>,
+    /// Add directories to the front of PATH by default
+    pub prepend: bool,
+    /// Ask before adding a directory that hides system commands
+    pub warn_shadows: bool,
+    /// Shell command run before every edit; the edit is abandoned if it fails
+    pub pre_edit_hook: Option<String>,
+    /// Shell command run after every successful edit
+    pub post_edit_hook: Option<String>,
+}
+
+impl Default for Settings {
+    fn default() -> Self {
+        Self {
+            backup_format: BackupFormat::default(),
+            backup_name_format: NameFormat::default(),
+            compress_backups: false,
+            backup_dir: None,
+            auto_backup: true,
+            keep_backups: None,
+            max_backup_age: None,
+            shell: None,
+            prepend: false,
+            warn_shadows: false,
+            pre_edit_hook: None,
+            post_edit_hook: None,
+        }
+    }
+}
+
+/// The config file as written, before validation
+#[derive(Debug, Default, Deserialize)]
+#[serde(deny_unknown_fields)]
+struct SettingsFile {
+    backup_format: Option<String>,
+    backup_name_format: Option<String>,
+    compress_backups: Option<bool>,
+    backup_dir: Option<String>,
+    auto_backup: Option<bool>,
+    keep_backups: Option<usize>,
+    max_backup_age: Option<String>,
+    shell: Option<String>,
+    prepend: Option<bool>,
+    warn_shadows: Option<bool>,
+    pre_edit_hook: Option<String>,
+    post_edit_hook: Option<String>,
+}
+
+/// Returns the location of the config file
+pub fn settings_path() -> PathBuf {
+    let home_dir = dirs_next::home_dir().unwrap_or_else(|| PathBuf::from("/"));
+    home_dir.join(".pathmaster/config.toml")
+}
+
+/// Parses the contents of a config file
+///
+/// Keys that are not present keep their built-in defaults.
+///
+/// # Returns
+/// * `Ok(Settings)` - The settings described by the file
+/// * `Err(io::Error)` with kind `InvalidData` if the file is not valid TOML,
+///   has an unknown key or has an invalid value
+pub fn parse_settings(content: &str) -> io::Result<Settings> {
+    let invalid = |message: String| io::Error::new(io::ErrorKind::InvalidData, message);
+    let file: SettingsFile = toml::from_str(content).map_err(|e| invalid(e.to_string()))?;
+    let mut settings = Settings::default();
+
+    if let Some(format) = file.backup_format {
+        settings.backup_format = format.parse().map_err(invalid)?;
+    }
+    if let Some(format) = file.backup_name_format {
+        settings.backup_name_format = format.parse().map_err(invalid)?;
+    }
+    if let Some(dir) = file.backup_dir {
+        settings.backup_dir = Some(expand_path(&dir));
+    }
+    if let Some(age) = file.max_backup_age {
+        parse_age(&age).map_err(invalid)?;
+        settings.max_backup_age = Some(age);
+    }
+    if let Some(shell) = file.shell {
+        settings.shell = Some(shell.parse().map_err(invalid)?);
+    }
+    if file.keep_backups == Some(0) {
+        // Keeping none would delete the backup each command has just taken
+        return Err(invalid("keep_backups must be at least 1".to_string()));
+    }
+    settings.compress_backups = file.compress_backups.unwrap_or(settings.compress_backups);
+    settings.auto_backup = file.auto_backup.unwrap_or(settings.auto_backup);
+    settings.keep_backups = file.keep_backups;
+    settings.prepend = file.prepend.unwrap_or(settings.prepend);
+    settings.warn_shadows = file.warn_shadows.unwrap_or(settings.warn_shadows);
+    settings.pre_edit_hook = file.pre_edit_hook;
+    settings.post_edit_hook = file.post_edit_hook;
+
+    Ok(settings)
+}
+
+/// Loads settings from a config file
+///
+/// # Returns
+/// * `Ok(Settings)` - The file's settings, or the defaults if it does not exist
+/// * `Err(io::Error)` if the file cannot be read or is invalid
+pub fn load_settings(file: &Path) -> io::Result<Settings> {
+    match fs::read_to_string(file) {
+        Ok(content) => {
+            log_debug!("Reading settings from {}", file.display());
+            parse_settings(&content).map_err(|e| {
+                io::Error::new(
+                    e.kind(),
+                    format!("Invalid config file {}: {}", file.display(), e),
+                )
+            })
+        }
+        Err(e) if e.kind() == io::ErrorKind::NotFound => {
+            log_debug!("{} does not exist; using built-in defaults", file.display());
+            Ok(Settings::default())
+        }
+        Err(e) => Err(e),
+    }
+}
+
+/// Sets the effective settings for this run
+pub fn set_settings(new_settings: Settings) -> io::Result<()> {
+    let mut settings = SETTINGS
+        .lock()
+        .map_err(|_| io::Error::new(io::ErrorKind::Other, "Failed to lock settings mutex"))?;
+    *settings = new_settings;
+    Ok(())
+}
+
+/// Gets the effective settings for this run
+pub fn get_settings() -> io::Result<Settings> {
+    let settings = SETTINGS
+        .lock()
+        .map_err(|_| io::Error::new(io::ErrorKind::Other, "Failed to lock settings mutex"))?;
+    Ok(settings.clone())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_parse_settings() -> io::Result<()> {
+        let settings = parse_settings(
+            "backup_format = \"toml\"\nbackup_name_format = \"rfc3339\"\ncompress_backups = true\nbackup_dir = \"/srv/backups\"\nauto_backup = false\n\
+             keep_backups = 5\n\
+             max_backup_age = \"2w\"\nshell = \"fish\"\nprepend = true\nwarn_shadows = true\n\
+             pre_edit_hook = \"test -w \\\"$PATHMASTER_FILE\\\"\"\n",
+        )?;
+        assert_eq!(
+            settings,
+            Settings {
+                backup_format: BackupFormat::Toml,
+                backup_name_format: NameFormat::Rfc3339,
+                compress_backups: true,
+                backup_dir: Some(PathBuf::from("/srv/backups")),
+                auto_backup: false,
+                keep_backups: Some(5),
+                max_backup_age: Some("2w".to_string()),
+                shell: Some(ShellType::Fish),
+                prepend: true,
+                warn_shadows: true,
+                pre_edit_hook: Some("test -w \"$PATHMASTER_FILE\"".to_string()),
+                post_edit_hook: None,
+            }
+        );
+
+        assert_eq!(parse_settings("")?, Settings::default());
+        assert!(parse_settings("backup_format = \"xml\"").is_err());
+        assert!(parse_settings("backup_name_format = \"iso\"").is_err());
+        assert!(parse_settings("max_backup_age = \"soon\"").is_err());
+        assert!(parse_settings("keep_backups = 0").is_err());
+        assert!(parse_settings("colour = true").is_err());
+        Ok(())
+    }
+
+    #[test]
+    fn test_missing_file_uses_defaults() -> io::Result<()> {
+        let temp_dir = TempDir::new()?;
+        let file = temp_dir.path().join("config.toml");
+        assert_eq!(load_settings(&file)?, Settings::default());
+
+        fs::write(&file, "keep_backups = \"many\"")?;
+        let err = load_settings(&file).unwrap_err();
+        assert!(err.to_string().contains("Invalid config file"));
+        Ok(())
+    }
+}
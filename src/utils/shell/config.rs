@@ -0,0 +1,272 @@
+//! Shell configuration file resolution.
+//!
+//! This module determines which rc file pathmaster should edit for each
+//! supported shell, honouring the shell-specific environment variables
+//! (`ZDOTDIR` for zsh, `XDG_CONFIG_HOME` for fish, elvish and nushell) that
+//! relocate them.
+//!
+//! By default the file read by interactive shells is edited. With the global
+//! `--profile` switch, the file read by login shells is edited instead, and
+//! `--config-file` names the file outright, for any shell.
+
+use super::types::ShellType;
+use crate::log_debug;
+use lazy_static::lazy_static;
+use std::env;
+use std::io;
+use std::path::PathBuf;
+use std::sync::Mutex;
+
+lazy_static! {
+    static ref LOGIN_CONFIG: Mutex<bool> = Mutex::new(false);
+    static ref CONFIG_FILE: Mutex<Option<PathBuf>> = Mutex::new(None);
+}
+
+/// Sets whether edits go to the login shell config instead of the interactive one
+pub fn set_login_config(login: bool) -> io::Result<()> {
+    let mut login_config = LOGIN_CONFIG
+        .lock()
+        .map_err(|_| io::Error::new(io::ErrorKind::Other, "Failed to lock login config mutex"))?;
+    *login_config = login;
+    Ok(())
+}
+
+/// Gets whether edits go to the login shell config instead of the interactive one
+pub fn get_login_config() -> io::Result<bool> {
+    let login_config = LOGIN_CONFIG
+        .lock()
+        .map_err(|_| io::Error::new(io::ErrorKind::Other, "Failed to lock login config mutex"))?;
+    Ok(*login_config)
+}
+
+/// Sets a file to edit for every shell, instead of the one resolved for it
+pub fn set_config_file(file: Option<PathBuf>) -> io::Result<()> {
+    let mut config_file = CONFIG_FILE
+        .lock()
+        .map_err(|_| io::Error::new(io::ErrorKind::Other, "Failed to lock config file mutex"))?;
+    *config_file = file;
+    Ok(())
+}
+
+/// Gets the file given with `--config-file`, if any
+pub fn get_config_file() -> io::Result<Option<PathBuf>> {
+    let config_file = CONFIG_FILE
+        .lock()
+        .map_err(|_| io::Error::new(io::ErrorKind::Other, "Failed to lock config file mutex"))?;
+    Ok(config_file.clone())
+}
+
+/// Describes which kind of config file is being edited, for messages
+pub fn config_scope() -> &'static str {
+    if get_config_file().ok().flatten().is_some() {
+        "config file given with --config-file"
+    } else if get_login_config().unwrap_or(false) {
+        "login shell config"
+    } else {
+        "interactive shell config"
+    }
+}
+
+/// Returns the user's home directory, falling back to `/`
+fn home_dir() -> PathBuf {
+    dirs_next::home_dir().unwrap_or_else(|| PathBuf::from("/"))
+}
+
+/// Returns a directory from an environment variable if it is set and non-empty
+fn env_dir(name: &str) -> Option<PathBuf> {
+    env::var_os(name)
+        .filter(|value| !value.is_empty())
+        .map(PathBuf::from)
+}
+
+/// Resolves the canonical rc file to edit for a shell
+///
+/// This is the file given with `--config-file` if there is one, whatever the
+/// shell; the shell then only decides the syntax. Otherwise it is the login
+/// shell config when `--profile` was given (see [`login_config_file`]), and
+/// the interactive one otherwise. The preferred
+/// path is returned even when the file does not exist yet so callers can
+/// create it.
+///
+/// # Arguments
+/// * `shell` - The shell whose configuration file should be resolved
+///
+/// # Returns
+/// * `(PathBuf, bool)` - The config file path and whether it already exists
+pub fn config_file(shell: &ShellType) -> (PathBuf, bool) {
+    let path = if let Some(file) = get_config_file().ok().flatten() {
+        file
+    } else if get_login_config().unwrap_or(false) {
+        login_config_file(shell)
+    } else {
+        interactive_config_file(shell)
+    };
+
+    let exists = path.exists();
+    log_debug!(
+        "{} config file is {} ({})",
+        shell,
+        path.display(),
+        if exists { "exists" } else { "not created yet" }
+    );
+    (path, exists)
+}
+
+/// Returns the file interactive shells read
+fn interactive_config_file(shell: &ShellType) -> PathBuf {
+    match shell {
+        ShellType::Bash => home_dir().join(".bashrc"),
+        ShellType::Zsh => env_dir("ZDOTDIR").unwrap_or_else(home_dir).join(".zshrc"),
+        ShellType::Fish => env_dir("XDG_CONFIG_HOME")
+            .unwrap_or_else(|| home_dir().join(".config"))
+            .join("fish/config.fish"),
+        ShellType::Ksh => home_dir().join(".kshrc"),
+        ShellType::Tcsh => home_dir().join(".tcshrc"),
+        ShellType::Elvish => env_dir("XDG_CONFIG_HOME")
+            .unwrap_or_else(|| home_dir().join(".config"))
+            .join("elvish/rc.elv"),
+        // Nushell sets up the environment, including PATH, in env.nu
+        ShellType::Nushell => env_dir("XDG_CONFIG_HOME")
+            .or_else(dirs_next::config_dir)
+            .unwrap_or_else(|| home_dir().join(".config"))
+            .join("nushell/env.nu"),
+        ShellType::Generic => home_dir().join(".profile"),
+    }
+}
+
+/// Returns the file login shells read
+///
+/// Bash reads the first of `.bash_profile`, `.bash_login` and `.profile`
+/// that exists, so that one is chosen, defaulting to `.bash_profile`. Fish
+/// and elvish read the same file for login and interactive shells.
+pub fn login_config_file(shell: &ShellType) -> PathBuf {
+    match shell {
+        ShellType::Bash => {
+            let home = home_dir();
+            [".bash_profile", ".bash_login", ".profile"]
+                .iter()
+                .map(|name| home.join(name))
+                .find(|path| path.exists())
+                .unwrap_or_else(|| home.join(".bash_profile"))
+        }
+        ShellType::Zsh => env_dir("ZDOTDIR")
+            .unwrap_or_else(home_dir)
+            .join(".zprofile"),
+        ShellType::Ksh | ShellType::Generic => home_dir().join(".profile"),
+        ShellType::Tcsh => home_dir().join(".login"),
+        ShellType::Nushell => env_dir("XDG_CONFIG_HOME")
+            .or_else(dirs_next::config_dir)
+            .unwrap_or_else(|| home_dir().join(".config"))
+            .join("nushell/login.nu"),
+        ShellType::Fish | ShellType::Elvish => interactive_config_file(shell),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use serial_test::serial;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[test]
+    #[serial]
+    fn test_config_file_defaults() {
+        let temp_dir = TempDir::new().unwrap();
+        let original_home = env::var_os("HOME");
+        env::set_var("HOME", temp_dir.path());
+        env::remove_var("ZDOTDIR");
+        env::remove_var("XDG_CONFIG_HOME");
+
+        fs::write(temp_dir.path().join(".bashrc"), "").unwrap();
+
+        let bash = config_file(&ShellType::Bash);
+        let zsh = config_file(&ShellType::Zsh);
+        let fish = config_file(&ShellType::Fish);
+        let tcsh = config_file(&ShellType::Tcsh);
+        let elvish = config_file(&ShellType::Elvish);
+
+        if let Some(home) = original_home {
+            env::set_var("HOME", home);
+        }
+
+        assert_eq!(bash, (temp_dir.path().join(".bashrc"), true));
+        assert_eq!(zsh, (temp_dir.path().join(".zshrc"), false));
+        assert_eq!(
+            fish,
+            (temp_dir.path().join(".config/fish/config.fish"), false)
+        );
+        assert_eq!(tcsh, (temp_dir.path().join(".tcshrc"), false));
+        assert_eq!(
+            elvish,
+            (temp_dir.path().join(".config/elvish/rc.elv"), false)
+        );
+    }
+
+    #[test]
+    #[serial]
+    fn test_login_config_file() {
+        let temp_dir = TempDir::new().unwrap();
+        let original_home = env::var_os("HOME");
+        env::set_var("HOME", temp_dir.path());
+        env::remove_var("ZDOTDIR");
+
+        let bash_default = login_config_file(&ShellType::Bash);
+        fs::write(temp_dir.path().join(".profile"), "").unwrap();
+        let bash_existing = login_config_file(&ShellType::Bash);
+
+        set_login_config(true).unwrap();
+        let zsh = config_file(&ShellType::Zsh);
+        let tcsh = config_file(&ShellType::Tcsh);
+        set_login_config(false).unwrap();
+        let zsh_interactive = config_file(&ShellType::Zsh);
+
+        if let Some(home) = original_home {
+            env::set_var("HOME", home);
+        }
+
+        assert_eq!(bash_default, temp_dir.path().join(".bash_profile"));
+        assert_eq!(bash_existing, temp_dir.path().join(".profile"));
+        assert_eq!(zsh.0, temp_dir.path().join(".zprofile"));
+        assert_eq!(tcsh.0, temp_dir.path().join(".login"));
+        assert_eq!(zsh_interactive.0, temp_dir.path().join(".zshrc"));
+    }
+
+    #[test]
+    #[serial]
+    fn test_config_file_given() {
+        let temp_dir = TempDir::new().unwrap();
+        let file = temp_dir.path().join("myshellrc");
+
+        set_config_file(Some(file.clone())).unwrap();
+        set_login_config(true).unwrap();
+        let bash = config_file(&ShellType::Bash);
+        let fish = config_file(&ShellType::Fish);
+        let scope = config_scope();
+        set_login_config(false).unwrap();
+        set_config_file(None).unwrap();
+
+        assert_eq!(bash, (file.clone(), false));
+        assert_eq!(fish, (file, false));
+        assert_eq!(scope, "config file given with --config-file");
+    }
+
+    #[test]
+    #[serial]
+    fn test_config_file_respects_env_overrides() {
+        let temp_dir = TempDir::new().unwrap();
+        env::set_var("ZDOTDIR", temp_dir.path().join("zsh"));
+        env::set_var("XDG_CONFIG_HOME", temp_dir.path().join("xdg"));
+
+        let zsh = config_file(&ShellType::Zsh);
+        let fish = config_file(&ShellType::Fish);
+        let nushell = config_file(&ShellType::Nushell);
+
+        env::remove_var("ZDOTDIR");
+        env::remove_var("XDG_CONFIG_HOME");
+
+        assert_eq!(zsh.0, temp_dir.path().join("zsh/.zshrc"));
+        assert_eq!(fish.0, temp_dir.path().join("xdg/fish/config.fish"));
+        assert_eq!(nushell.0, temp_dir.path().join("xdg/nushell/env.nu"));
+    }
+}
@@ -0,0 +1,331 @@
+//! In-place editing of PATH declarations in shell configuration files.
+//!
+//! This module handles:
+//! - Splitting trailing `#` comments off configuration lines
+//! - Grouping lines into statements for languages whose lists and groups span
+//!   several lines, such as Elvish and Nushell
+//! - Replacing a config's PATH declarations with a single new block
+//! - Keeping the comments that annotate those declarations
+//!
+//! Comments directly above a declaration and comments on the same line as it
+//! are treated as belonging to it. They are carried into the rewritten block,
+//! while the `# Updated by pathmaster` header from a previous run is replaced.
+
+use crate::utils::shell::types::PathModification;
+
+/// Prefix of the header line written above every generated PATH block
+const PATHMASTER_HEADER: &str = "# Updated by pathmaster";
+
+/// Splits a trailing comment off a line of shell code
+///
+/// A `#` starts a comment only outside quotes and at the start of a word, so
+/// `${#array}` or `foo#bar` are left alone.
+///
+/// # Returns
+/// * `(code, Some(comment))` with trailing whitespace removed from `code` and
+///   the comment including its leading `#`
+/// * `(line, None)` if the line has no comment
+pub fn split_inline_comment(line: &str) -> (&str, Option<&str>) {
+    let mut quote = None;
+    let mut escaped = false;
+    let mut word_start = true;
+
+    for (i, c) in line.char_indices() {
+        if escaped {
+            escaped = false;
+            word_start = false;
+            continue;
+        }
+        match (c, quote) {
+            ('\\', q) if q != Some('\'') => escaped = true,
+            ('\'' | '"', None) => quote = Some(c),
+            (c, Some(q)) if c == q => quote = None,
+            ('#', None) if word_start => return (line[..i].trim_end(), Some(&line[i..])),
+            _ => {}
+        }
+        word_start = c.is_whitespace();
+    }
+
+    (line, None)
+}
+
+/// What decides where a statement ends in a shell language
+pub struct StatementSyntax {
+    /// Splits a trailing comment off a line, e.g. `split_inline_comment`
+    pub split_comment: fn(&str) -> (&str, Option<&str>),
+    /// Characters opening a list or group that continues the statement
+    pub open: &'static [char],
+    /// Characters closing one
+    pub close: &'static [char],
+    /// Characters that quote a string
+    pub quotes: &'static [char],
+    /// The quote inside which `\` escapes the next character, if any
+    pub escaping_quote: Option<char>,
+}
+
+/// Returns how many more groups a line of code opens than it closes,
+/// outside quotes
+fn bracket_balance(code: &str, syntax: &StatementSyntax) -> i32 {
+    let mut balance = 0;
+    let mut quote = None;
+    let mut escaped = false;
+
+    for c in code.chars() {
+        if escaped {
+            escaped = false;
+            continue;
+        }
+        match quote {
+            Some(q) if c == '\\' && Some(q) == syntax.escaping_quote => escaped = true,
+            Some(q) if c == q => quote = None,
+            Some(_) => {}
+            None if syntax.quotes.contains(&c) => quote = Some(c),
+            None if syntax.open.contains(&c) => balance += 1,
+            None if syntax.close.contains(&c) => balance -= 1,
+            None => {}
+        }
+    }
+
+    balance
+}
+
+/// Groups physical lines into statements, joining lines while a list or
+/// group is open
+///
+/// # Returns
+/// The zero-based index of each physical line in a statement along with the
+/// joined statement text, without comments
+pub fn statements(content: &str, syntax: &StatementSyntax) -> Vec<(Vec<usize>, String)> {
+    let mut statements = Vec::new();
+    let mut indices = Vec::new();
+    let mut joined = String::new();
+    let mut depth: i32 = 0;
+
+    for (idx, line) in content.lines().enumerate() {
+        let (code, _) = (syntax.split_comment)(line);
+        indices.push(idx);
+        joined.push_str(code.trim());
+        joined.push(' ');
+        depth += bracket_balance(code, syntax);
+        if depth <= 0 {
+            depth = 0;
+            statements.push((
+                std::mem::take(&mut indices),
+                std::mem::take(&mut joined).trim_end().to_string(),
+            ));
+        }
+    }
+
+    if !indices.is_empty() {
+        statements.push((indices, joined.trim_end().to_string()));
+    }
+
+    statements
+}
+
+/// Returns true if a line consists only of a comment
+fn is_comment(line: &str) -> bool {
+    line.trim_start().starts_with('#')
+}
+
+/// Returns true if a line is the header of a block written by pathmaster
+fn is_pathmaster_header(line: &str) -> bool {
+    line.trim_start().starts_with(PATHMASTER_HEADER)
+}
+
+/// Replaces every PATH declaration in a config with a new block
+///
+/// The new block takes the place of the first declaration; the others are
+/// removed. Comment lines directly above any declaration are moved into the
+/// block ahead of `new_config`, and comments on the declaration lines
+/// themselves are appended to its last line. If there are no declarations,
+/// `new_config` is appended to the end of the content.
+///
+/// # Arguments
+/// * `content` - The current configuration file content
+/// * `modifications` - The PATH declarations found in `content`
+/// * `new_config` - The formatted PATH block, as returned by `format_path_export`
+///
+/// # Returns
+/// The updated configuration content
+pub fn replace_path_declarations(
+    content: &str,
+    modifications: &[PathModification],
+    new_config: &str,
+) -> String {
+    let lines: Vec<&str> = content.lines().collect();
+
+    let mut declarations: Vec<usize> = modifications
+        .iter()
+        .map(|modification| modification.line_number - 1)
+        .filter(|&idx| idx < lines.len())
+        .collect();
+    declarations.sort_unstable();
+    declarations.dedup();
+
+    let first = match declarations.first() {
+        Some(&first) => first,
+        None => return content.to_string() + new_config,
+    };
+
+    let mut removed = vec![false; lines.len()];
+    let mut kept_comments = Vec::new();
+    let mut inline_comments: Vec<&str> = Vec::new();
+    let mut insert_at = first;
+
+    for &idx in &declarations {
+        removed[idx] = true;
+
+        let (code, comment) = split_inline_comment(lines[idx]);
+        if let Some(comment) = comment.filter(|_| !code.trim().is_empty()) {
+            if !inline_comments.contains(&comment) {
+                inline_comments.push(comment);
+            }
+        }
+
+        // Claim the comment lines directly above this declaration
+        let mut start = idx;
+        while start > 0 && is_comment(lines[start - 1]) && !removed[start - 1] {
+            start -= 1;
+        }
+        if idx == first {
+            insert_at = start;
+        }
+        for comment_idx in start..idx {
+            removed[comment_idx] = true;
+            if !is_pathmaster_header(lines[comment_idx]) {
+                kept_comments.push(lines[comment_idx]);
+            }
+        }
+    }
+
+    let mut block: Vec<String> = kept_comments.iter().map(|line| line.to_string()).collect();
+    block.extend(
+        new_config
+            .trim_start_matches('\n')
+            .lines()
+            .map(str::to_string),
+    );
+    if !inline_comments.is_empty() {
+        if let Some(last) = block.last_mut() {
+            last.push_str("  ");
+            last.push_str(&inline_comments.join("  "));
+        }
+    }
+
+    let mut updated: Vec<String> = Vec::with_capacity(lines.len() + block.len());
+    for (idx, line) in lines.iter().enumerate() {
+        if idx == insert_at {
+            updated.append(&mut block);
+        }
+        if !removed[idx] {
+            updated.push(line.to_string());
+        }
+    }
+
+    updated.join("\n")
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::utils::shell::types::ModificationType;
+
+    #[test]
+    fn test_statements_join_open_groups() {
+        let syntax = StatementSyntax {
+            split_comment: split_inline_comment,
+            open: &['[', '('],
+            close: &[']', ')'],
+            quotes: &['\'', '"'],
+            escaping_quote: Some('"'),
+        };
+        let content = "$env.PATH = [ # list\n  '/opt/[bin'\n  \"/a\\\"]\"\n]\nlet x = 1\n";
+        assert_eq!(
+            statements(content, &syntax),
+            vec![
+                (
+                    vec![0, 1, 2, 3],
+                    "$env.PATH = [ '/opt/[bin' \"/a\\\"]\" ]".to_string()
+                ),
+                (vec![4], "let x = 1".to_string()),
+            ]
+        );
+    }
+
+    fn declarations(content: &str) -> Vec<PathModification> {
+        content
+            .lines()
+            .enumerate()
+            .filter(|(_, line)| line.contains("PATH="))
+            .map(|(idx, line)| PathModification {
+                line_number: idx + 1,
+                content: line.to_string(),
+                modification_type: ModificationType::Assignment,
+            })
+            .collect()
+    }
+
+    const NEW_CONFIG: &str =
+        "\n# Updated by pathmaster on 2024-01-01 12:00:00\nexport PATH=\"/opt/bin:/usr/bin\"\n";
+
+    #[test]
+    fn test_split_inline_comment() {
+        assert_eq!(
+            split_inline_comment("export PATH=\"/usr/bin\"  # system tools"),
+            ("export PATH=\"/usr/bin\"", Some("# system tools"))
+        );
+        assert_eq!(
+            split_inline_comment("export PATH=\"/opt/#tools:/usr/bin\""),
+            ("export PATH=\"/opt/#tools:/usr/bin\"", None)
+        );
+        assert_eq!(
+            split_inline_comment("echo ${#PATH}"),
+            ("echo ${#PATH}", None)
+        );
+        assert_eq!(
+            split_inline_comment("echo \\# not a comment"),
+            ("echo \\# not a comment", None)
+        );
+    }
+
+    #[test]
+    fn test_inline_comment_survives() {
+        let content = "alias ll='ls -l'\nexport PATH=\"/usr/bin\"  # keep brew last\n";
+        let updated = replace_path_declarations(content, &declarations(content), NEW_CONFIG);
+        assert_eq!(
+            updated,
+            "alias ll='ls -l'\n# Updated by pathmaster on 2024-01-01 12:00:00\nexport PATH=\"/opt/bin:/usr/bin\"  # keep brew last"
+        );
+    }
+
+    #[test]
+    fn test_preceding_comments_move_with_the_block() {
+        let content = "# Tools\nexport PATH=\"/usr/bin\"\nalias ll='ls -l'\n# Needed for the vendor SDK\nexport PATH=\"$PATH:/opt/sdk/bin\"\n";
+        let updated = replace_path_declarations(content, &declarations(content), NEW_CONFIG);
+        assert_eq!(
+            updated,
+            "# Tools\n# Needed for the vendor SDK\n# Updated by pathmaster on 2024-01-01 12:00:00\nexport PATH=\"/opt/bin:/usr/bin\"\nalias ll='ls -l'"
+        );
+    }
+
+    #[test]
+    fn test_rewrite_is_stable() {
+        let content = "# Why these dirs\n# Updated by pathmaster on 2023-06-01 09:00:00\nexport PATH=\"/usr/bin\" # note\n";
+        let once = replace_path_declarations(content, &declarations(content), NEW_CONFIG);
+        let twice = replace_path_declarations(&once, &declarations(&once), NEW_CONFIG);
+        assert_eq!(once, twice);
+        assert_eq!(once.matches("# Updated by pathmaster").count(), 1);
+        assert!(once.starts_with("# Why these dirs\n"));
+        assert!(once.ends_with("/usr/bin\"  # note"));
+    }
+
+    #[test]
+    fn test_no_declarations_appends() {
+        let content = "alias ll='ls -l'\n";
+        assert_eq!(
+            replace_path_declarations(content, &[], NEW_CONFIG),
+            format!("{}{}", content, NEW_CONFIG)
+        );
+    }
+}
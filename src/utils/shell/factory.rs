@@ -1,18 +1,316 @@
 use super::handlers::ShellHandler;
 use super::handlers::{
-    BashHandler, FishHandler, GenericHandler, KshHandler, TcshHandler, ZshHandler,
+    BashHandler, ElvishHandler, FishHandler, GenericHandler, KshHandler, NushellHandler,
+    TcshHandler, ZshHandler,
 };
+use super::types::ShellType;
+use crate::log_debug;
+use lazy_static::lazy_static;
 use std::env;
+#[cfg(target_os = "linux")]
+use std::fs;
+use std::io;
+#[cfg(all(unix, not(target_os = "linux")))]
+use std::process::Command;
+use std::sync::Mutex;
 
-pub fn get_shell_handler() -> Box<dyn ShellHandler> {
+lazy_static! {
+    static ref SHELL_OVERRIDE: Mutex<Option<ShellType>> = Mutex::new(None);
+}
+
+/// Sets the shell to use instead of the detected one, or clears it with `None`
+pub fn set_shell_override(shell: Option<ShellType>) -> io::Result<()> {
+    let mut shell_override = SHELL_OVERRIDE
+        .lock()
+        .map_err(|_| io::Error::new(io::ErrorKind::Other, "Failed to lock shell override mutex"))?;
+    *shell_override = shell;
+    Ok(())
+}
+
+/// Gets the shell set with `--shell`, if any
+pub fn get_shell_override() -> io::Result<Option<ShellType>> {
+    let shell_override = SHELL_OVERRIDE
+        .lock()
+        .map_err(|_| io::Error::new(io::ErrorKind::Other, "Failed to lock shell override mutex"))?;
+    Ok(shell_override.clone())
+}
+
+/// Returns the shell whose configuration pathmaster works with
+///
+/// This is the `--shell` override when one was given, and the detected
+/// shell otherwise. Commands should use this rather than calling
+/// [`detect_shell_type`] directly.
+pub fn resolved_shell_type() -> ShellType {
+    match get_shell_override() {
+        Ok(Some(shell)) => {
+            log_debug!(
+                "Using {} as configured instead of detecting the shell",
+                shell
+            );
+            shell
+        }
+        _ => detect_shell_type(),
+    }
+}
+
+/// Maps a shell path or process name to a shell type
+pub fn shell_type_from_name(name: &str) -> ShellType {
+    // Nushell's binary is just `nu`, too short to search for as a substring
+    let base = name
+        .rsplit(|c| c == '/' || c == '\\')
+        .next()
+        .unwrap_or(name)
+        .trim_start_matches('-');
+    if base == "nu" || base == "nu.exe" {
+        return ShellType::Nushell;
+    }
+
+    match name {
+        s if s.contains("elvish") => ShellType::Elvish,
+        s if s.contains("zsh") => ShellType::Zsh,
+        s if s.contains("bash") => ShellType::Bash,
+        s if s.contains("fish") => ShellType::Fish,
+        s if s.contains("tcsh") || s.contains("csh") => ShellType::Tcsh,
+        s if s.contains("ksh") => ShellType::Ksh,
+        _ => ShellType::Generic,
+    }
+}
+
+/// How many ancestors of pathmaster are inspected when looking for a shell
+const MAX_ANCESTOR_DEPTH: usize = 16;
+
+/// Detects the user's shell
+///
+/// The `SHELL` environment variable is tried first. When it is unset or
+/// names a generic shell such as `/bin/sh`, the process tree is inspected
+/// instead, which recovers the real shell when pathmaster is run from a
+/// script, a subshell or a tool such as make.
+pub fn detect_shell_type() -> ShellType {
     let shell = env::var("SHELL").unwrap_or_default();
 
-    match shell.as_str() {
-        s if s.contains("zsh") => Box::new(ZshHandler::new()),
-        s if s.contains("bash") => Box::new(BashHandler::new()),
-        s if s.contains("fish") => Box::new(FishHandler::new()),
-        s if s.contains("tcsh") || s.contains("csh") => Box::new(TcshHandler::new()),
-        s if s.contains("ksh") => Box::new(KshHandler::new()),
-        _ => Box::new(GenericHandler::new()),
+    match shell_type_from_name(&shell) {
+        ShellType::Generic => {
+            let shell_type =
+                shell_from_process_tree(MAX_ANCESTOR_DEPTH).unwrap_or(ShellType::Generic);
+            log_debug!(
+                "SHELL={:?} is not a specific shell; detected {} from the process tree",
+                shell,
+                shell_type
+            );
+            shell_type
+        }
+        shell_type => {
+            log_debug!("Detected {} from SHELL={}", shell_type, shell);
+            shell_type
+        }
+    }
+}
+
+/// Finds the nearest ancestor of pathmaster that is a known shell
+///
+/// Starts at the parent process and walks up at most `max_depth` levels,
+/// stopping early at the root of the tree or on a cycle in malformed process
+/// data.
+///
+/// # Returns
+/// * `Some(ShellType)` of the nearest recognizable shell
+/// * `None` if no ancestor within `max_depth` is a known shell
+#[cfg(unix)]
+pub fn shell_from_process_tree(max_depth: usize) -> Option<ShellType> {
+    nearest_shell(
+        std::os::unix::process::parent_id(),
+        max_depth,
+        process_name,
+        parent_pid,
+    )
+}
+
+/// Process information is not available on this platform
+#[cfg(not(unix))]
+pub fn shell_from_process_tree(_max_depth: usize) -> Option<ShellType> {
+    None
+}
+
+/// Walks up a process tree from `start` looking for a known shell
+#[cfg_attr(not(unix), allow(dead_code))]
+fn nearest_shell(
+    start: u32,
+    max_depth: usize,
+    name_of: impl Fn(u32) -> Option<String>,
+    parent_of: impl Fn(u32) -> Option<u32>,
+) -> Option<ShellType> {
+    let mut visited = Vec::new();
+    let mut pid = start;
+
+    for _ in 0..max_depth {
+        if pid == 0 || visited.contains(&pid) {
+            return None;
+        }
+        visited.push(pid);
+
+        if let Some(name) = name_of(pid) {
+            match shell_type_from_name(&name) {
+                ShellType::Generic => {}
+                shell_type => return Some(shell_type),
+            }
+        }
+        pid = parent_of(pid)?;
+    }
+
+    None
+}
+
+/// Reads the parent process id of a process from procfs
+#[cfg(target_os = "linux")]
+fn parent_pid(pid: u32) -> Option<u32> {
+    let stat = fs::read_to_string(format!("/proc/{}/stat", pid)).ok()?;
+    // The command name may contain spaces and parentheses, so skip past its
+    // closing parenthesis; the state and parent id follow
+    let fields = &stat[stat.rfind(')')? + 1..];
+    fields.split_whitespace().nth(1)?.parse().ok()
+}
+
+/// Reads the parent process id of a process using `ps`
+#[cfg(all(unix, not(target_os = "linux")))]
+fn parent_pid(pid: u32) -> Option<u32> {
+    let output = Command::new("ps")
+        .args(["-p", &pid.to_string(), "-o", "ppid="])
+        .output()
+        .ok()?;
+    if !output.status.success() {
+        return None;
+    }
+    String::from_utf8_lossy(&output.stdout).trim().parse().ok()
+}
+
+/// Reads the command name of a process from procfs
+#[cfg(target_os = "linux")]
+fn process_name(pid: u32) -> Option<String> {
+    let name = fs::read_to_string(format!("/proc/{}/comm", pid)).ok()?;
+    let name = name.trim();
+    (!name.is_empty()).then(|| name.to_string())
+}
+
+/// Reads the command name of a process using `ps`
+#[cfg(all(unix, not(target_os = "linux")))]
+fn process_name(pid: u32) -> Option<String> {
+    let output = Command::new("ps")
+        .args(["-p", &pid.to_string(), "-o", "comm="])
+        .output()
+        .ok()?;
+    if !output.status.success() {
+        return None;
+    }
+    let name = String::from_utf8_lossy(&output.stdout).trim().to_string();
+    (!name.is_empty()).then_some(name)
+}
+
+/// Returns the handler responsible for the given shell's configuration
+pub fn get_handler_for(shell: &ShellType) -> Box<dyn ShellHandler> {
+    match shell {
+        ShellType::Zsh => Box::new(ZshHandler::new()),
+        ShellType::Bash => Box::new(BashHandler::new()),
+        ShellType::Fish => Box::new(FishHandler::new()),
+        ShellType::Tcsh => Box::new(TcshHandler::new()),
+        ShellType::Ksh => Box::new(KshHandler::new()),
+        ShellType::Elvish => Box::new(ElvishHandler::new()),
+        ShellType::Nushell => Box::new(NushellHandler::new()),
+        ShellType::Generic => Box::new(GenericHandler::new()),
+    }
+}
+
+pub fn get_shell_handler() -> Box<dyn ShellHandler> {
+    get_handler_for(&resolved_shell_type())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use serial_test::serial;
+
+    #[test]
+    #[serial]
+    fn test_shell_override() {
+        set_shell_override(Some(ShellType::Fish)).unwrap();
+        assert_eq!(resolved_shell_type(), ShellType::Fish);
+        assert_eq!(get_shell_handler().get_shell_type(), ShellType::Fish);
+
+        set_shell_override(None).unwrap();
+        assert_eq!(resolved_shell_type(), detect_shell_type());
+    }
+
+    #[test]
+    fn test_shell_type_parsing() {
+        assert_eq!("Zsh".parse::<ShellType>(), Ok(ShellType::Zsh));
+        assert_eq!("nu".parse::<ShellType>(), Ok(ShellType::Nushell));
+        let err = "powershell".parse::<ShellType>().unwrap_err();
+        assert!(err.contains("Supported shells are: bash, zsh"));
+    }
+
+    #[test]
+    fn test_shell_type_from_name() {
+        assert_eq!(shell_type_from_name("/usr/bin/zsh"), ShellType::Zsh);
+        assert_eq!(shell_type_from_name("-bash"), ShellType::Bash);
+        assert_eq!(shell_type_from_name("/bin/tcsh"), ShellType::Tcsh);
+        assert_eq!(shell_type_from_name("/usr/bin/elvish"), ShellType::Elvish);
+        assert_eq!(
+            shell_type_from_name("/opt/homebrew/bin/nu"),
+            ShellType::Nushell
+        );
+        assert_eq!(shell_type_from_name("nu"), ShellType::Nushell);
+        assert_eq!(
+            shell_type_from_name("/usr/bin/gnu-tool"),
+            ShellType::Generic
+        );
+        assert_eq!(shell_type_from_name("/bin/sh"), ShellType::Generic);
+        assert_eq!(shell_type_from_name(""), ShellType::Generic);
+    }
+
+    #[test]
+    fn test_nearest_shell() {
+        // 40 (make) -> 30 (sh) -> 20 (zsh) -> 10 (login) -> 1 (init)
+        let names = |pid| {
+            Some(String::from(match pid {
+                40 => "make",
+                30 => "sh",
+                20 => "zsh",
+                10 => "login",
+                _ => "init",
+            }))
+        };
+        let parents = |pid| match pid {
+            40 => Some(30),
+            30 => Some(20),
+            20 => Some(10),
+            10 => Some(1),
+            _ => Some(0),
+        };
+
+        assert_eq!(nearest_shell(40, 16, names, parents), Some(ShellType::Zsh));
+        assert_eq!(nearest_shell(40, 2, names, parents), None);
+        assert_eq!(nearest_shell(10, 16, names, parents), None);
+    }
+
+    #[test]
+    fn test_nearest_shell_stops_on_cycles() {
+        let names = |_| Some(String::from("make"));
+        let parents = |pid| Some(if pid == 5 { 6 } else { 5 });
+        assert_eq!(nearest_shell(5, usize::MAX, names, parents), None);
+    }
+
+    #[cfg(target_os = "linux")]
+    #[test]
+    fn test_parent_pid_reads_procfs() {
+        assert_eq!(
+            parent_pid(std::process::id()),
+            Some(std::os::unix::process::parent_id())
+        );
+    }
+
+    #[cfg(target_os = "linux")]
+    #[test]
+    fn test_process_name_reads_procfs() {
+        let name = process_name(std::process::id());
+        assert!(name.is_some());
     }
 }
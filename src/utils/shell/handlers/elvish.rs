@@ -0,0 +1,264 @@
+use super::ShellHandler;
+use crate::utils::shell::config::config_file;
+use crate::utils::shell::edit::{
+    replace_path_declarations, split_inline_comment, statements, StatementSyntax,
+};
+use crate::utils::shell::types::{ModificationType, PathModification, ShellType};
+use chrono::Local;
+use std::path::PathBuf;
+
+/// Statements continue while a `[` list is open
+const SYNTAX: StatementSyntax = StatementSyntax {
+    split_comment: split_inline_comment,
+    open: &['['],
+    close: &[']'],
+    quotes: &['\'', '"'],
+    escaping_quote: None,
+};
+
+pub struct ElvishHandler {
+    config_path: PathBuf,
+}
+
+/// A PATH statement in an Elvish config
+enum PathStatement {
+    /// `set paths = [...]`, with the words of the list; `None` marks a
+    /// `$@paths` splice of the current entries
+    Paths(Vec<Option<String>>),
+    /// `set E:PATH = ...` or `set-env PATH ...`, with the colon-separated value
+    EnvPath(String),
+}
+
+impl ElvishHandler {
+    pub fn new() -> Self {
+        Self {
+            config_path: config_file(&ShellType::Elvish).0,
+        }
+    }
+
+    /// Recognizes a statement that modifies PATH
+    fn path_statement(statement: &str) -> Option<PathStatement> {
+        if let Some(rest) = statement.strip_prefix("set-env ") {
+            let rest = rest.trim_start().strip_prefix("PATH")?;
+            return Some(PathStatement::EnvPath(unquote(rest.trim())));
+        }
+
+        let rest = statement.strip_prefix("set ")?.trim_start();
+        if let Some(value) = rest.strip_prefix("E:PATH") {
+            let value = value.trim_start().strip_prefix('=')?;
+            return Some(PathStatement::EnvPath(unquote(value.trim())));
+        }
+
+        let value = rest.strip_prefix("paths")?.trim_start().strip_prefix('=')?;
+        let list = value.trim().strip_prefix('[')?;
+        let list = list.rsplit_once(']').map_or(list, |(list, _)| list);
+        Some(PathStatement::Paths(split_words(list)))
+    }
+}
+
+/// Splits an Elvish list body into words, removing quotes
+///
+/// Single-quoted words use `''` for a literal quote. An unquoted `$`
+/// variable such as `$@paths` is returned as `None`.
+fn split_words(list: &str) -> Vec<Option<String>> {
+    let mut words = Vec::new();
+    let mut chars = list.chars().peekable();
+
+    while let Some(&c) = chars.peek() {
+        if c.is_whitespace() {
+            chars.next();
+            continue;
+        }
+
+        let mut word = String::new();
+        let quoted = c == '\'' || c == '"';
+        if quoted {
+            chars.next();
+            while let Some(next) = chars.next() {
+                if next == c {
+                    if c == '\'' && chars.peek() == Some(&'\'') {
+                        chars.next();
+                        word.push('\'');
+                        continue;
+                    }
+                    break;
+                }
+                if c == '"' && next == '\\' {
+                    if let Some(escaped) = chars.next() {
+                        word.push(escaped);
+                    }
+                    continue;
+                }
+                word.push(next);
+            }
+        } else {
+            while let Some(&next) = chars.peek() {
+                if next.is_whitespace() {
+                    break;
+                }
+                word.push(next);
+                chars.next();
+            }
+        }
+
+        if !quoted && word.starts_with('$') {
+            words.push(None);
+        } else {
+            words.push(Some(word));
+        }
+    }
+
+    words
+}
+
+/// Removes the quotes around an Elvish string
+fn unquote(value: &str) -> String {
+    if let Some(inner) = value.strip_prefix('\'').and_then(|v| v.strip_suffix('\'')) {
+        inner.replace("''", "'")
+    } else {
+        value.trim_matches('"').to_string()
+    }
+}
+
+/// Quotes a path as an Elvish single-quoted string
+fn quote(path: &str) -> String {
+    format!("'{}'", path.replace('\'', "''"))
+}
+
+impl ShellHandler for ElvishHandler {
+    fn get_shell_type(&self) -> ShellType {
+        ShellType::Elvish
+    }
+
+    fn get_config_path(&self) -> PathBuf {
+        self.config_path.clone()
+    }
+
+    fn parse_path_entries(&self, content: &str) -> Vec<PathBuf> {
+        let mut entries: Vec<PathBuf> = Vec::new();
+
+        // Apply statements in order; `$@paths` splices in what came before
+        for (_, statement) in statements(content, &SYNTAX) {
+            match Self::path_statement(&statement) {
+                Some(PathStatement::Paths(words)) => {
+                    let mut updated = Vec::new();
+                    for word in words {
+                        match word {
+                            Some(word) => {
+                                updated.push(PathBuf::from(shellexpand::tilde(&word).to_string()))
+                            }
+                            None => updated.extend(entries.iter().cloned()),
+                        }
+                    }
+                    entries = updated;
+                }
+                Some(PathStatement::EnvPath(value)) => {
+                    entries = value
+                        .split(':')
+                        .filter(|part| !part.is_empty() && !part.starts_with('$'))
+                        .map(|part| PathBuf::from(shellexpand::tilde(part).to_string()))
+                        .collect();
+                }
+                None => {}
+            }
+        }
+
+        entries
+    }
+
+    fn format_path_export(&self, entries: &[PathBuf]) -> String {
+        let paths = entries
+            .iter()
+            .map(|p| quote(&p.to_string_lossy()))
+            .collect::<Vec<_>>()
+            .join(" ");
+
+        format!(
+            "\n# Updated by pathmaster on {}\nset paths = [{}]\n",
+            Local::now().format("%Y-%m-%d %H:%M:%S"),
+            paths
+        )
+    }
+
+    fn detect_path_modifications(&self, content: &str) -> Vec<PathModification> {
+        let lines: Vec<&str> = content.lines().collect();
+        let mut modifications = Vec::new();
+
+        for (indices, statement) in statements(content, &SYNTAX) {
+            if Self::path_statement(&statement).is_none() {
+                continue;
+            }
+
+            // Every physical line of a multi-line list is reported so the
+            // whole statement is replaced together
+            for idx in indices {
+                modifications.push(PathModification {
+                    line_number: idx + 1,
+                    content: lines[idx].to_string(),
+                    modification_type: ModificationType::ElvishPaths,
+                });
+            }
+        }
+
+        modifications
+    }
+
+    fn update_path_in_config(&self, content: &str, entries: &[PathBuf]) -> String {
+        let modifications = self.detect_path_modifications(content);
+        replace_path_declarations(content, &modifications, &self.format_path_export(entries))
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_elvish_path_parsing() {
+        let handler = ElvishHandler::new();
+        let content = r#"
+# Some config
+set paths = [/usr/local/bin /usr/bin]
+set paths = [
+  '/opt/my tools/bin'
+  $@paths
+]
+set E:EDITOR = vim
+"#;
+
+        assert_eq!(
+            handler.parse_path_entries(content),
+            vec![
+                PathBuf::from("/opt/my tools/bin"),
+                PathBuf::from("/usr/local/bin"),
+                PathBuf::from("/usr/bin"),
+            ]
+        );
+        assert_eq!(
+            handler.parse_path_entries("set E:PATH = '/usr/bin:/bin'\n"),
+            vec![PathBuf::from("/usr/bin"), PathBuf::from("/bin")]
+        );
+    }
+
+    #[test]
+    fn test_elvish_path_formatting() {
+        let handler = ElvishHandler::new();
+        let entries = vec![PathBuf::from("/usr/bin"), PathBuf::from("/opt/it's/bin")];
+
+        let formatted = handler.format_path_export(&entries);
+        assert!(formatted.contains("set paths = ['/usr/bin' '/opt/it''s/bin']\n"));
+        assert_eq!(handler.parse_path_entries(&formatted), entries);
+    }
+
+    #[test]
+    fn test_elvish_multiline_update() {
+        let handler = ElvishHandler::new();
+        let content = "use str\nset paths = [\n  /old/path\n  $@paths\n]\nset E:EDITOR = vim\n";
+
+        let updated = handler.update_path_in_config(content, &[PathBuf::from("/usr/bin")]);
+        assert!(!updated.contains("/old/path"));
+        assert!(updated.contains("set paths = ['/usr/bin']"));
+        assert!(updated.starts_with("use str\n"));
+        assert!(updated.ends_with("set E:EDITOR = vim"));
+    }
+}
@@ -1,9 +1,98 @@
 use super::ShellHandler;
+use crate::commands::which;
+use crate::utils;
+use crate::utils::lock::lock_config;
+use crate::utils::shell::config::{self, config_file};
+use crate::utils::shell::edit::replace_path_declarations;
+use crate::utils::shell::read_target_config;
 use crate::utils::shell::types::{ModificationType, PathModification, ShellType};
+use crate::utils::undo;
+use crate::{log_debug, status};
 use chrono::Local;
-use dirs_next;
-use regex::Regex;
+use lazy_static::lazy_static;
+use std::io;
 use std::path::PathBuf;
+use std::process::Command;
+
+/// Starts each line of fish's output that holds a directory, so anything
+/// config.fish prints is ignored
+const ENTRY_MARKER: &str = "pathmaster-entry:";
+
+/// Prints `fish_user_paths` one directory per line, or exits with status 3
+/// when it is not a universal variable
+const READ_USER_PATHS: &str = "set -qU fish_user_paths; or exit 3; \
+    for dir in $fish_user_paths; echo \"pathmaster-entry:$dir\"; end";
+
+/// Sets `fish_user_paths` universally to the script's arguments
+const WRITE_USER_PATHS: &str = "set -U fish_user_paths $argv";
+
+lazy_static! {
+    /// The fish program, looked up in PATH before any command changes it
+    static ref FISH: PathBuf = which::find_command("fish", &utils::get_path_entries())
+        .into_iter()
+        .find(|found| found.executable)
+        .map(|found| found.file)
+        .unwrap_or_else(|| PathBuf::from("fish"));
+}
+
+/// Picks the directories out of the output of `READ_USER_PATHS`
+fn parse_user_paths(output: &str) -> Vec<PathBuf> {
+    output
+        .lines()
+        .filter_map(|line| line.strip_prefix(ENTRY_MARKER))
+        .map(PathBuf::from)
+        .collect()
+}
+
+/// Reads the universal `fish_user_paths` variable by asking fish
+///
+/// Fish stores universal variables in a file of its own that is not safe to
+/// edit as text, so they are only read and written through fish itself.
+///
+/// # Returns
+/// * `Some(entries)` - The directories in the variable, in order
+/// * `None` if the variable is not universal or fish cannot be run
+pub fn universal_user_paths() -> Option<Vec<PathBuf>> {
+    let output = match Command::new(&*FISH).args(["-c", READ_USER_PATHS]).output() {
+        Ok(output) => output,
+        Err(e) => {
+            log_debug!("Cannot run fish to read fish_user_paths: {}", e);
+            return None;
+        }
+    };
+
+    if output.status.success() {
+        Some(parse_user_paths(&String::from_utf8_lossy(&output.stdout)))
+    } else {
+        log_debug!(
+            "fish_user_paths is not a universal variable ({})",
+            output.status
+        );
+        None
+    }
+}
+
+/// Sets the universal `fish_user_paths` variable by asking fish
+///
+/// Running fish sessions pick the change up immediately.
+pub fn set_universal_user_paths(entries: &[PathBuf]) -> io::Result<()> {
+    let output = Command::new(&*FISH)
+        .args(["-c", WRITE_USER_PATHS])
+        .args(entries)
+        .output()?;
+    if output.status.success() {
+        return Ok(());
+    }
+
+    Err(io::Error::new(
+        io::ErrorKind::Other,
+        format!(
+            "fish could not set fish_user_paths ({}): {}",
+            output.status,
+            String::from_utf8_lossy(&output.stderr).trim()
+        ),
+    ))
+}
 
 pub struct FishHandler {
     config_path: PathBuf,
@@ -11,9 +100,63 @@ pub struct FishHandler {
 
 impl FishHandler {
     pub fn new() -> Self {
-        let home_dir = dirs_next::home_dir().unwrap_or_else(|| PathBuf::from("/"));
         Self {
-            config_path: home_dir.join(".config/fish/config.fish"),
+            config_path: config_file(&ShellType::Fish).0,
+        }
+    }
+
+    /// Groups physical lines into logical statements, joining lines that end
+    /// with a `\` continuation. Returns the zero-based index of each physical
+    /// line in the statement along with the joined statement text.
+    fn logical_lines(content: &str) -> Vec<(Vec<usize>, String)> {
+        let mut statements = Vec::new();
+        let mut indices = Vec::new();
+        let mut joined = String::new();
+
+        for (idx, line) in content.lines().enumerate() {
+            indices.push(idx);
+            let trimmed = line.trim_end();
+            if let Some(continued) = trimmed.strip_suffix('\\') {
+                joined.push_str(continued);
+                joined.push(' ');
+            } else {
+                joined.push_str(trimmed);
+                statements.push((std::mem::take(&mut indices), std::mem::take(&mut joined)));
+            }
+        }
+
+        if !indices.is_empty() {
+            statements.push((indices, joined));
+        }
+
+        statements
+    }
+
+    /// Returns the arguments of a PATH statement, or None if the statement
+    /// does not modify PATH. Recognizes `set [flags] PATH ...` (including
+    /// `set -x PATH`, `set -gx PATH` and `set -e PATH`) and `fish_add_path`.
+    fn path_statement_args(statement: &str) -> Option<Vec<String>> {
+        let mut tokens = statement.split_whitespace();
+
+        match tokens.next()? {
+            "fish_add_path" => Some(
+                tokens
+                    .filter(|token| !token.starts_with('-'))
+                    .map(|token| token.trim_matches(|c| c == '"' || c == '\'').to_string())
+                    .collect(),
+            ),
+            "set" => {
+                let mut tokens = tokens.skip_while(|token| token.starts_with('-'));
+                if tokens.next()? != "PATH" {
+                    return None;
+                }
+                Some(
+                    tokens
+                        .map(|token| token.trim_matches(|c| c == '"' || c == '\'').to_string())
+                        .collect(),
+                )
+            }
+            _ => None,
         }
     }
 }
@@ -29,12 +172,15 @@ impl ShellHandler for FishHandler {
 
     fn parse_path_entries(&self, content: &str) -> Vec<PathBuf> {
         let mut entries = Vec::new();
-        let path_regex = Regex::new(r"fish_add_path\s+(.+)$").unwrap();
 
-        for line in content.lines() {
-            if let Some(cap) = path_regex.captures(line.trim()) {
-                if let Some(path) = cap.get(1) {
-                    let expanded = shellexpand::tilde(path.as_str());
+        for (_, statement) in Self::logical_lines(content) {
+            if let Some(args) = Self::path_statement_args(statement.trim()) {
+                for arg in args {
+                    // Skip references to the inherited PATH
+                    if arg.starts_with('$') || arg.is_empty() {
+                        continue;
+                    }
+                    let expanded = shellexpand::tilde(&arg);
                     entries.push(PathBuf::from(expanded.to_string()));
                 }
             }
@@ -44,31 +190,41 @@ impl ShellHandler for FishHandler {
     }
 
     fn format_path_export(&self, entries: &[PathBuf]) -> String {
-        let mut output = String::new();
-        output.push_str("\n# Updated by pathmaster on ");
-        output.push_str(&Local::now().format("%Y-%m-%d %H:%M:%S").to_string());
-        output.push_str("\n");
-
-        // Clear existing PATH
-        output.push_str("set -e PATH\n");
-
-        // Add each path using fish_add_path
-        for entry in entries {
-            output.push_str(&format!("fish_add_path {}\n", entry.display()));
-        }
+        let paths = entries
+            .iter()
+            .map(|p| {
+                let path = p.to_string_lossy();
+                if path.contains(char::is_whitespace) {
+                    format!("'{}'", path)
+                } else {
+                    path.to_string()
+                }
+            })
+            .collect::<Vec<_>>()
+            .join(" ");
 
-        output
+        format!(
+            "\n# Updated by pathmaster on {}\nset -gx PATH {}\n",
+            Local::now().format("%Y-%m-%d %H:%M:%S"),
+            paths
+        )
     }
 
     fn detect_path_modifications(&self, content: &str) -> Vec<PathModification> {
         let mut modifications = Vec::new();
-        let path_regex = Regex::new(r"(fish_add_path|set -gx PATH)").unwrap();
+        let lines: Vec<&str> = content.lines().collect();
 
-        for (idx, line) in content.lines().enumerate() {
-            if path_regex.is_match(line) {
+        for (indices, statement) in Self::logical_lines(content) {
+            if Self::path_statement_args(statement.trim()).is_none() {
+                continue;
+            }
+
+            // Every physical line of a multi-line statement is reported so
+            // the whole block is replaced together
+            for idx in indices {
                 modifications.push(PathModification {
                     line_number: idx + 1,
-                    content: line.to_string(),
+                    content: lines[idx].to_string(),
                     modification_type: ModificationType::FishPath,
                 });
             }
@@ -79,36 +235,121 @@ impl ShellHandler for FishHandler {
 
     fn update_path_in_config(&self, content: &str, entries: &[PathBuf]) -> String {
         let modifications = self.detect_path_modifications(content);
-        let new_path_config = self.format_path_export(entries);
-        
-        // If we found existing PATH modifications, update in place
-        if !modifications.is_empty() {
-            // Sort by line number in descending order to avoid index shifting
-            let mut sorted_mods = modifications.clone();
-            sorted_mods.sort_by(|a, b| b.line_number.cmp(&a.line_number));
-            
-            // First modification is where we'll insert our new config
-            let first_mod = sorted_mods.last().unwrap().line_number - 1;
-            
-            // Convert to lines for manipulation
-            let mut lines: Vec<&str> = content.lines().collect();
-            
-            // Remove all existing PATH declarations
-            for modification in sorted_mods {
-                lines.remove(modification.line_number - 1);
-            }
-            
-            // Insert new config at the position of the first PATH declaration
-            // Remove newline prefix if it exists
-            let new_config = new_path_config.trim_start_matches('\n');
-            for line in new_config.lines().rev() {
-                lines.insert(first_mod, line);
-            }
-            
-            return lines.join("\n");
-        } else {
-            // No existing PATH declarations found, append to end
-            return content.to_string() + &new_path_config;
+        replace_path_declarations(content, &modifications, &self.format_path_export(entries))
+    }
+
+    /// Returns the universal `fish_user_paths` when config.fish does not
+    /// declare PATH itself, as set with `set -U fish_user_paths` or
+    /// `fish_add_path` at the prompt
+    fn external_path_entries(&self, content: &str) -> io::Result<Option<Vec<PathBuf>>> {
+        // A file given with --config-file is always the one edited
+        if config::get_config_file()?.is_some()
+            || !self.detect_path_modifications(content).is_empty()
+        {
+            return Ok(None);
         }
+        Ok(universal_user_paths())
+    }
+
+    /// Saves PATH to `fish_user_paths` when that is what the user relies
+    /// on, and to config.fish otherwise
+    ///
+    /// Fish adds directories inherited from the login environment that are
+    /// not in `fish_user_paths` after it. The variable's previous value is
+    /// recorded so `pathmaster undo` can set it back.
+    fn update_config(&self, entries: &[PathBuf]) -> io::Result<()> {
+        let config_path = self.target_config_path();
+        let lock = lock_config(&config_path)?;
+        let content = read_target_config(self)?;
+        let previous = match self.external_path_entries(&content)? {
+            Some(previous) => previous,
+            None => {
+                drop(lock);
+                return self.update_config_file(entries);
+            }
+        };
+
+        log_debug!(
+            "{} declares no PATH; setting the universal fish_user_paths instead",
+            config_path.display()
+        );
+        undo::record_fish_user_paths(&config_path, &previous)?;
+        set_universal_user_paths(entries)?;
+        status!("Updated PATH in: fish universal variable fish_user_paths");
+        Ok(())
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_fish_path_parsing() {
+        let handler = FishHandler::new();
+        let content = r#"
+# Some config
+set -gx PATH /usr/local/bin $PATH
+set -x PATH ~/bin $PATH
+fish_add_path --prepend /opt/tool/bin
+set -gx EDITOR vim
+"#;
+
+        let entries = handler.parse_path_entries(content);
+        assert_eq!(entries.len(), 3);
+        assert_eq!(entries[0], PathBuf::from("/usr/local/bin"));
+        assert!(entries[1].ends_with("bin"));
+        assert_eq!(entries[2], PathBuf::from("/opt/tool/bin"));
+    }
+
+    #[test]
+    fn test_fish_path_formatting() {
+        let handler = FishHandler::new();
+        let entries = vec![PathBuf::from("/usr/bin"), PathBuf::from("/usr/local/bin")];
+
+        let formatted = handler.format_path_export(&entries);
+        assert!(formatted.contains("set -gx PATH /usr/bin /usr/local/bin\n"));
+        assert!(!formatted.contains("export PATH"));
+    }
+
+    #[test]
+    fn test_parse_user_paths() {
+        let output =
+            "Welcome to fish\npathmaster-entry:/opt/tool/bin\npathmaster-entry:/home/me/my bin\n";
+        assert_eq!(
+            parse_user_paths(output),
+            vec![
+                PathBuf::from("/opt/tool/bin"),
+                PathBuf::from("/home/me/my bin")
+            ]
+        );
+        assert!(parse_user_paths("").is_empty());
+    }
+
+    #[test]
+    fn test_config_declarations_win_over_universal_paths() -> io::Result<()> {
+        let handler = FishHandler::new();
+        let entries = handler.external_path_entries("set -gx PATH /usr/bin $PATH\n")?;
+        assert_eq!(entries, None);
+        Ok(())
+    }
+
+    #[test]
+    fn test_fish_multiline_update() {
+        let handler = FishHandler::new();
+        let content = "# Initial config\nset -gx PATH /usr/bin \\\n    /old/path \\\n    $PATH\nset -gx EDITOR vim\n";
+
+        let entries = handler.parse_path_entries(content);
+        assert_eq!(
+            entries,
+            vec![PathBuf::from("/usr/bin"), PathBuf::from("/old/path")]
+        );
+
+        let updated = handler.update_path_in_config(content, &[PathBuf::from("/usr/bin")]);
+        assert!(!updated.contains("/old/path"));
+        assert!(!updated.contains("$PATH"));
+        assert!(updated.contains("set -gx PATH /usr/bin"));
+        assert!(updated.contains("set -gx EDITOR vim"));
+        assert!(updated.starts_with("# Initial config"));
     }
 }
@@ -1,23 +1,40 @@
 use chrono::Local;
 use std::fs;
 use std::io;
-use std::path::PathBuf;
+use std::path::{Path, PathBuf};
 
 pub mod bash;
+pub mod elvish;
 pub mod fish;
 pub mod generic;
 pub mod ksh;
+pub mod nushell;
 pub mod tcsh;
 pub mod zsh;
 
 pub use bash::BashHandler;
+pub use elvish::ElvishHandler;
 pub use fish::FishHandler;
 pub use generic::GenericHandler;
 pub use ksh::KshHandler;
+pub use nushell::NushellHandler;
 pub use tcsh::TcshHandler;
 pub use zsh::ZshHandler;
 
+use crate::log_debug;
+use crate::status;
+use crate::utils::filesystem::{FileSystem, RealFileSystem};
+use crate::utils::lock::lock_config;
+use crate::utils::shell::config;
+use crate::utils::shell::source;
 use crate::utils::shell::types::*;
+use crate::utils::undo;
+
+/// Names the copy of a config file kept before it is rewritten
+fn config_backup_path(config_path: &Path) -> PathBuf {
+    let timestamp = Local::now().format("%Y%m%d%H%M%S").to_string();
+    config_path.with_extension(format!("bak_{}", timestamp))
+}
 
 #[allow(dead_code)]
 pub trait ShellHandler {
@@ -28,27 +45,187 @@ pub trait ShellHandler {
     fn detect_path_modifications(&self, content: &str) -> Vec<PathModification>;
     fn update_path_in_config(&self, content: &str, entries: &[PathBuf]) -> String;
 
+    /// Returns the file whose PATH declarations are edited
+    ///
+    /// Usually the main config file, unless it sources another file that
+    /// holds the PATH declaration (see `--no-follow-source`). A file given
+    /// with `--config-file` is always edited itself.
+    fn target_config_path(&self) -> PathBuf {
+        if config::get_config_file().ok().flatten().is_some() {
+            return self.get_config_path();
+        }
+        source::declaring_file(&self.get_config_path(), |content| {
+            !self.detect_path_modifications(content).is_empty()
+        })
+    }
+
     fn create_backup(&self) -> io::Result<PathBuf> {
-        let config_path = self.get_config_path();
-        let timestamp = Local::now().format("%Y%m%d%H%M%S").to_string();
-        let backup_path = config_path.with_extension(format!("bak_{}", timestamp));
+        let config_path = self.target_config_path();
+        let backup_path = config_backup_path(&config_path);
 
         fs::copy(&config_path, &backup_path)?;
         Ok(backup_path)
     }
 
+    /// Returns the PATH entries when the shell keeps them outside its
+    /// configuration file, as fish does with universal variables
+    ///
+    /// # Arguments
+    /// * `content` - The configuration file, or nothing if it is missing
+    fn external_path_entries(&self, _content: &str) -> io::Result<Option<Vec<PathBuf>>> {
+        Ok(None)
+    }
+
+    /// Saves PATH entries where the shell reads them from
     fn update_config(&self, entries: &[PathBuf]) -> io::Result<()> {
-        let config_path = self.get_config_path();
-        let backup_path = self.create_backup()?;
-        println!(
-            "Created backup of shell config at: {}",
-            backup_path.display()
+        self.update_config_file(entries)
+    }
+
+    /// Saves PATH entries by rewriting the declarations in the configuration file
+    fn update_config_file(&self, entries: &[PathBuf]) -> io::Result<()> {
+        let config_path = self.target_config_path();
+
+        // Hold the lock for the whole read-modify-write cycle
+        let _lock = lock_config(&config_path)?;
+
+        // Let `pathmaster undo` put the file back the way it was
+        undo::record_snapshot(&config_path)?;
+
+        self.rewrite_config(&RealFileSystem, &config_path, entries)
+    }
+
+    /// Rewrites the PATH declarations in a configuration file
+    ///
+    /// An existing file is first copied next to itself with a timestamped
+    /// `.bak_` extension; a missing one is created, along with its directory.
+    /// The new contents replace the file atomically.
+    ///
+    /// # Arguments
+    /// * `files` - The filesystem holding the file
+    /// * `config_path` - The file to rewrite
+    /// * `entries` - The PATH entries to declare
+    fn rewrite_config(
+        &self,
+        files: &dyn FileSystem,
+        config_path: &Path,
+        entries: &[PathBuf],
+    ) -> io::Result<()> {
+        // A missing config is created rather than treated as an error
+        let content = if files.exists(config_path) {
+            let backup_path = config_backup_path(config_path);
+            files.copy(config_path, &backup_path)?;
+            status!(
+                "Created backup of shell config at: {}",
+                backup_path.display()
+            );
+            files.read_to_string(config_path)?
+        } else {
+            if let Some(parent) = config_path.parent() {
+                files.create_dir_all(parent)?;
+            }
+            String::new()
+        };
+
+        let modifications = self.detect_path_modifications(&content);
+        if modifications.is_empty() {
+            log_debug!(
+                "No PATH declaration in {}; appending one",
+                config_path.display()
+            );
+        }
+        for modification in &modifications {
+            log_debug!(
+                "Replacing PATH declaration at {}:{}: {}",
+                config_path.display(),
+                modification.line_number,
+                modification.content.trim()
+            );
+        }
+        log_debug!(
+            "New PATH declaration: {}",
+            self.format_path_export(entries).trim()
         );
 
-        let content = fs::read_to_string(&config_path)?;
+        // Never write the live file in place, so a crash cannot truncate it
         let updated_content = self.update_path_in_config(&content, entries);
-        fs::write(&config_path, updated_content)?;
+        files.write_atomic(config_path, updated_content.as_bytes())?;
+        status!(
+            "Updated PATH in: {} ({})",
+            config_path.display(),
+            config::config_scope()
+        );
 
         Ok(())
     }
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::utils::filesystem::MemoryFileSystem;
+
+    #[test]
+    fn test_rewrite_config_replaces_every_declaration() {
+        let rc = Path::new("/home/me/.bashrc");
+        let files = MemoryFileSystem::new().with_file(
+            rc,
+            "# rc\nexport PATH=\"/usr/bin\"\nalias ll='ls -l'\nPATH=$PATH:/old/bin\n",
+        );
+
+        BashHandler::new()
+            .rewrite_config(
+                &files,
+                rc,
+                &[PathBuf::from("/usr/bin"), PathBuf::from("/opt/bin")],
+            )
+            .unwrap();
+
+        let updated = files.contents(rc).unwrap();
+        assert!(updated.starts_with("# rc\n"));
+        assert!(updated.contains("export PATH=\"/usr/bin:/opt/bin\"\n"));
+        assert!(updated.contains("alias ll='ls -l'"));
+        assert!(!updated.contains("/old/bin"));
+        assert_eq!(updated.matches("export PATH").count(), 1);
+
+        // The original is kept next to it, and no temporary file is left
+        let others: Vec<PathBuf> = files
+            .files()
+            .into_iter()
+            .filter(|file| file != rc)
+            .collect();
+        assert_eq!(others.len(), 1);
+        assert!(others[0]
+            .to_string_lossy()
+            .starts_with("/home/me/.bashrc.bak_"));
+        assert!(files.contents(&others[0]).unwrap().contains("/old/bin"));
+    }
+
+    #[test]
+    fn test_rewrite_config_creates_missing_file() {
+        let rc = Path::new("/home/me/.config/fish/config.fish");
+        let files = MemoryFileSystem::new();
+
+        FishHandler::new()
+            .rewrite_config(&files, rc, &[PathBuf::from("/usr/bin")])
+            .unwrap();
+
+        assert!(files
+            .contents(rc)
+            .unwrap()
+            .contains("set -gx PATH /usr/bin"));
+        assert_eq!(files.files(), vec![rc.to_path_buf()]);
+    }
+
+    #[test]
+    fn test_rewrite_config_failure_leaves_file() {
+        let rc = Path::new("/home/me/.zshrc");
+        let original = "export PATH=\"/usr/bin\"\n";
+        let files = MemoryFileSystem::new().with_file(rc, original);
+        files.fail_renames();
+
+        let result = ZshHandler::new().rewrite_config(&files, rc, &[PathBuf::from("/opt/bin")]);
+
+        assert!(result.is_err());
+        assert_eq!(files.contents(rc).as_deref(), Some(original));
+    }
+}
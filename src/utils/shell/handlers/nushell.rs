@@ -0,0 +1,321 @@
+use super::ShellHandler;
+use crate::utils::shell::config::config_file;
+use crate::utils::shell::edit::{
+    replace_path_declarations, split_inline_comment, statements, StatementSyntax,
+};
+use crate::utils::shell::types::{ModificationType, PathModification, ShellType};
+use chrono::Local;
+use std::path::PathBuf;
+
+/// Statements continue while a `[` list or `(` group is open
+const SYNTAX: StatementSyntax = StatementSyntax {
+    split_comment: split_inline_comment,
+    open: &['[', '('],
+    close: &[']', ')'],
+    quotes: &['\'', '"', '`'],
+    escaping_quote: Some('"'),
+};
+
+pub struct NushellHandler {
+    config_path: PathBuf,
+}
+
+/// How a PATH statement in a Nushell config changes the entries
+enum PathStatement {
+    /// `$env.PATH = <expr>`, replacing the entries unless the expression
+    /// pipes the current PATH into `prepend`/`append`
+    Assign(String),
+    /// `$env.PATH ++= [...]`
+    Extend(String),
+    /// `path add [--append] ...`
+    Add { words: Vec<String>, append: bool },
+}
+
+impl NushellHandler {
+    pub fn new() -> Self {
+        Self {
+            config_path: config_file(&ShellType::Nushell).0,
+        }
+    }
+
+    /// Recognizes a statement that modifies PATH. Nushell on Windows names
+    /// the variable `Path`, so both spellings are accepted.
+    fn path_statement(statement: &str) -> Option<PathStatement> {
+        if let Some(rest) = statement.strip_prefix("path add ") {
+            let append = rest
+                .split_whitespace()
+                .any(|word| word == "--append" || word == "-a");
+            let words = split_words(rest)
+                .into_iter()
+                .filter(|word| !word.starts_with('-'))
+                .collect();
+            return Some(PathStatement::Add { words, append });
+        }
+
+        // The deprecated `let-env PATH = ...` form behaves like an assignment
+        let rest = statement
+            .strip_prefix("$env.")
+            .or_else(|| statement.strip_prefix("let-env "))?;
+        let rest = rest
+            .strip_prefix("PATH")
+            .or_else(|| rest.strip_prefix("Path"))?
+            .trim_start();
+
+        if let Some(value) = rest.strip_prefix("++=") {
+            Some(PathStatement::Extend(value.trim().to_string()))
+        } else {
+            let value = rest.strip_prefix('=')?;
+            Some(PathStatement::Assign(value.trim().to_string()))
+        }
+    }
+}
+
+/// Splits Nushell words into paths, removing quotes
+///
+/// Handles single-quoted, double-quoted (with backslash escapes) and
+/// backtick-quoted strings, treats commas as separators, and skips
+/// unquoted `$` variables and `(` subexpressions.
+fn split_words(text: &str) -> Vec<String> {
+    let mut words = Vec::new();
+    let mut chars = text.chars().peekable();
+
+    while let Some(&c) = chars.peek() {
+        if c.is_whitespace() || c == ',' || c == '[' || c == ']' {
+            chars.next();
+            continue;
+        }
+
+        let mut word = String::new();
+        match c {
+            '\'' | '`' => {
+                chars.next();
+                for next in chars.by_ref() {
+                    if next == c {
+                        break;
+                    }
+                    word.push(next);
+                }
+            }
+            '"' => {
+                chars.next();
+                while let Some(next) = chars.next() {
+                    match next {
+                        '"' => break,
+                        '\\' => {
+                            if let Some(escaped) = chars.next() {
+                                word.push(escaped);
+                            }
+                        }
+                        _ => word.push(next),
+                    }
+                }
+            }
+            _ => {
+                while let Some(&next) = chars.peek() {
+                    if next.is_whitespace() || next == ',' || next == ']' {
+                        break;
+                    }
+                    word.push(next);
+                    chars.next();
+                }
+                if word.starts_with('$') || word.starts_with('(') {
+                    continue;
+                }
+            }
+        }
+
+        words.push(word);
+    }
+
+    words
+}
+
+/// Converts the entries of a list literal or quoted PATH string
+fn value_entries(value: &str) -> Vec<PathBuf> {
+    let words = split_words(value);
+
+    // A single quoted string is a colon-separated PATH
+    let words = if !value.trim_start().starts_with('[') && words.len() == 1 {
+        words[0].split(':').map(str::to_string).collect()
+    } else {
+        words
+    };
+
+    words
+        .into_iter()
+        .filter(|word| !word.is_empty())
+        .map(|word| PathBuf::from(shellexpand::tilde(&word).to_string()))
+        .collect()
+}
+
+/// Quotes a path as a Nushell string, preferring raw single quotes
+fn quote(path: &str) -> String {
+    if path.contains('\'') {
+        format!("\"{}\"", path.replace('\\', "\\\\").replace('"', "\\\""))
+    } else {
+        format!("'{}'", path)
+    }
+}
+
+impl ShellHandler for NushellHandler {
+    fn get_shell_type(&self) -> ShellType {
+        ShellType::Nushell
+    }
+
+    fn get_config_path(&self) -> PathBuf {
+        self.config_path.clone()
+    }
+
+    fn parse_path_entries(&self, content: &str) -> Vec<PathBuf> {
+        let mut entries: Vec<PathBuf> = Vec::new();
+
+        // Apply statements in order so prepends and appends see the earlier entries
+        for (_, statement) in statements(content, &SYNTAX) {
+            match Self::path_statement(&statement) {
+                Some(PathStatement::Assign(value)) => {
+                    let value = value
+                        .strip_prefix('(')
+                        .and_then(|v| v.strip_suffix(')'))
+                        .unwrap_or(&value);
+                    let mut stages = value.split(" | ").map(str::trim);
+                    let source = stages.next().unwrap_or_default();
+                    let mut updated = if source.starts_with("$env.") {
+                        entries.clone()
+                    } else {
+                        value_entries(source)
+                    };
+
+                    for stage in stages {
+                        if let Some(list) = stage.strip_prefix("prepend ") {
+                            let mut prepended = value_entries(list);
+                            prepended.append(&mut updated);
+                            updated = prepended;
+                        } else if let Some(list) = stage.strip_prefix("append ") {
+                            updated.extend(value_entries(list));
+                        }
+                    }
+
+                    entries = updated;
+                }
+                Some(PathStatement::Extend(value)) => entries.extend(value_entries(&value)),
+                Some(PathStatement::Add { words, append }) => {
+                    let added = words
+                        .iter()
+                        .map(|word| PathBuf::from(shellexpand::tilde(word).to_string()));
+                    if append {
+                        entries.extend(added);
+                    } else {
+                        let mut prepended: Vec<PathBuf> = added.collect();
+                        prepended.append(&mut entries);
+                        entries = prepended;
+                    }
+                }
+                None => {}
+            }
+        }
+
+        entries
+    }
+
+    fn format_path_export(&self, entries: &[PathBuf]) -> String {
+        let paths = entries
+            .iter()
+            .map(|p| quote(&p.to_string_lossy()))
+            .collect::<Vec<_>>()
+            .join(" ");
+
+        format!(
+            "\n# Updated by pathmaster on {}\n$env.PATH = [{}]\n",
+            Local::now().format("%Y-%m-%d %H:%M:%S"),
+            paths
+        )
+    }
+
+    fn detect_path_modifications(&self, content: &str) -> Vec<PathModification> {
+        let lines: Vec<&str> = content.lines().collect();
+        let mut modifications = Vec::new();
+
+        for (indices, statement) in statements(content, &SYNTAX) {
+            if Self::path_statement(&statement).is_none() {
+                continue;
+            }
+
+            // Report every physical line so multi-line lists are replaced whole
+            for idx in indices {
+                modifications.push(PathModification {
+                    line_number: idx + 1,
+                    content: lines[idx].to_string(),
+                    modification_type: ModificationType::NushellEnv,
+                });
+            }
+        }
+
+        modifications
+    }
+
+    fn update_path_in_config(&self, content: &str, entries: &[PathBuf]) -> String {
+        let modifications = self.detect_path_modifications(content);
+        replace_path_declarations(content, &modifications, &self.format_path_export(entries))
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_nushell_path_parsing() {
+        let handler = NushellHandler::new();
+        let content = r#"
+# env.nu
+$env.PATH = ['/usr/bin', '/bin']
+$env.PATH = ($env.PATH | prepend '/opt/tools/bin' | append "/usr/games")
+path add ~/.cargo/bin
+$env.PATH ++= [`/opt/my tools`]
+$env.EDITOR = 'vim'
+"#;
+
+        let home = shellexpand::tilde("~").to_string();
+        assert_eq!(
+            handler.parse_path_entries(content),
+            vec![
+                PathBuf::from(format!("{}/.cargo/bin", home)),
+                PathBuf::from("/opt/tools/bin"),
+                PathBuf::from("/usr/bin"),
+                PathBuf::from("/bin"),
+                PathBuf::from("/usr/games"),
+                PathBuf::from("/opt/my tools"),
+            ]
+        );
+        assert_eq!(
+            handler.parse_path_entries("let-env Path = '/usr/bin:/bin'\n"),
+            vec![PathBuf::from("/usr/bin"), PathBuf::from("/bin")]
+        );
+    }
+
+    #[test]
+    fn test_nushell_path_formatting() {
+        let handler = NushellHandler::new();
+        let entries = vec![PathBuf::from("/usr/bin"), PathBuf::from("/opt/it's/bin")];
+
+        let formatted = handler.format_path_export(&entries);
+        assert!(formatted.contains("$env.PATH = ['/usr/bin' \"/opt/it's/bin\"]\n"));
+        assert_eq!(handler.parse_path_entries(&formatted), entries);
+    }
+
+    #[test]
+    fn test_nushell_multiline_update() {
+        let handler = NushellHandler::new();
+        let content =
+            "$env.EDITOR = 'vim'\n$env.PATH = (\n  $env.PATH\n  | prepend '/old/path'\n)\npath add /other\n";
+
+        let modifications = handler.detect_path_modifications(content);
+        assert_eq!(modifications.len(), 5);
+
+        let updated = handler.update_path_in_config(content, &[PathBuf::from("/usr/bin")]);
+        assert!(!updated.contains("/old/path"));
+        assert!(!updated.contains("path add"));
+        assert!(updated.contains("$env.PATH = ['/usr/bin']"));
+        assert!(updated.starts_with("$env.EDITOR = 'vim'\n"));
+    }
+}
@@ -1,7 +1,8 @@
 use super::ShellHandler;
+use crate::utils::shell::config::config_file;
+use crate::utils::shell::edit::replace_path_declarations;
 use crate::utils::shell::types::{ModificationType, PathModification, ShellType};
 use chrono::Local;
-use dirs_next;
 use regex::Regex;
 use std::path::PathBuf;
 
@@ -11,13 +12,75 @@ pub struct TcshHandler {
 
 impl TcshHandler {
     pub fn new() -> Self {
-        let home_dir = dirs_next::home_dir().unwrap_or_else(|| PathBuf::from("/"));
         Self {
-            config_path: home_dir.join(".tcshrc"),
+            config_path: config_file(&ShellType::Tcsh).0,
         }
     }
 }
 
+/// Splits a tcsh word list into words, honouring single and double quotes
+fn split_words(list: &str) -> Vec<String> {
+    let mut words = Vec::new();
+    let mut current = String::new();
+    let mut quote = None;
+    let mut in_word = false;
+
+    for c in list.chars() {
+        match quote {
+            Some(q) if c == q => quote = None,
+            Some(_) => current.push(c),
+            None if c == '"' || c == '\'' => {
+                quote = Some(c);
+                in_word = true;
+            }
+            None if c.is_whitespace() => {
+                if in_word {
+                    words.push(std::mem::take(&mut current));
+                    in_word = false;
+                }
+            }
+            None => {
+                current.push(c);
+                in_word = true;
+            }
+        }
+    }
+
+    if in_word {
+        words.push(current);
+    }
+
+    words
+}
+
+/// Converts the contents of a `set path = (...)` array into PATH entries
+///
+/// References to the inherited path (`$path`, `$PATH`) are skipped.
+pub fn parse_path_array(list: &str) -> Vec<PathBuf> {
+    split_words(list)
+        .into_iter()
+        .filter(|word| !word.starts_with('$'))
+        .map(|word| PathBuf::from(shellexpand::tilde(&word).to_string()))
+        .collect()
+}
+
+/// Converts PATH entries into the space-separated `set path` array form
+pub fn format_path_array(entries: &[PathBuf]) -> String {
+    let words = entries
+        .iter()
+        .map(|p| {
+            let path = p.to_string_lossy();
+            if path.contains(char::is_whitespace) {
+                format!("'{}'", path)
+            } else {
+                path.to_string()
+            }
+        })
+        .collect::<Vec<_>>();
+
+    format!("({})", words.join(" "))
+}
+
 impl ShellHandler for TcshHandler {
     fn get_shell_type(&self) -> ShellType {
         ShellType::Tcsh
@@ -38,13 +101,11 @@ impl ShellHandler for TcshHandler {
             // Handle setenv PATH ...
             if let Some(cap) = setenv_regex.captures(line) {
                 if let Some(paths) = cap.get(1) {
-                    for path in paths
-                        .as_str()
-                        .split_whitespace()
-                        .next()
-                        .unwrap_or("")
-                        .split(':')
-                    {
+                    let value = split_words(paths.as_str()).into_iter().next();
+                    for path in value.unwrap_or_default().split(':') {
+                        if path.is_empty() || path.starts_with('$') {
+                            continue;
+                        }
                         let expanded = shellexpand::tilde(path);
                         entries.push(PathBuf::from(expanded.to_string()));
                     }
@@ -53,10 +114,7 @@ impl ShellHandler for TcshHandler {
             // Handle set path = (...)
             else if let Some(cap) = set_regex.captures(line) {
                 if let Some(paths) = cap.get(1) {
-                    for path in paths.as_str().split_whitespace() {
-                        let expanded = shellexpand::tilde(path);
-                        entries.push(PathBuf::from(expanded.to_string()));
-                    }
+                    entries.extend(parse_path_array(paths.as_str()));
                 }
             }
         }
@@ -71,9 +129,9 @@ impl ShellHandler for TcshHandler {
             .collect::<Vec<_>>();
 
         format!(
-            "\n# Updated by pathmaster on {}\nset path = ({})\nsetenv PATH {}\n",
+            "\n# Updated by pathmaster on {}\nset path = {}\nsetenv PATH \"{}\"\n",
             Local::now().format("%Y-%m-%d %H:%M:%S"),
-            paths.join(" "),
+            format_path_array(entries),
             paths.join(":")
         )
     }
@@ -97,45 +155,15 @@ impl ShellHandler for TcshHandler {
 
     fn update_path_in_config(&self, content: &str, entries: &[PathBuf]) -> String {
         let modifications = self.detect_path_modifications(content);
-        let new_path_config = self.format_path_export(entries);
-        
-        // If we found existing PATH modifications, update in place
-        if !modifications.is_empty() {
-            // Sort by line number in descending order to avoid index shifting
-            let mut sorted_mods = modifications.clone();
-            sorted_mods.sort_by(|a, b| b.line_number.cmp(&a.line_number));
-            
-            // First modification is where we'll insert our new config
-            let first_mod = sorted_mods.last().unwrap().line_number - 1;
-            
-            // Convert to lines for manipulation
-            let mut lines: Vec<&str> = content.lines().collect();
-            
-            // Remove all existing PATH declarations
-            for modification in sorted_mods {
-                lines.remove(modification.line_number - 1);
-            }
-            
-            // Insert new config at the position of the first PATH declaration
-            // Remove newline prefix if it exists
-            let new_config = new_path_config.trim_start_matches('\n');
-            for line in new_config.lines().rev() {
-                lines.insert(first_mod, line);
-            }
-            
-            return lines.join("\n");
-        } else {
-            // No existing PATH declarations found, append to end
-            return content.to_string() + &new_path_config;
-        }
+        replace_path_declarations(content, &modifications, &self.format_path_export(entries))
     }
 }
 
 #[cfg(test)]
 mod tcsh_tests {
     use super::*;
-    use std::fs;
-    use tempfile::TempDir;
+    use crate::utils::filesystem::MemoryFileSystem;
+    use std::path::Path;
 
     #[test]
     fn test_tcsh_path_parsing() {
@@ -164,8 +192,7 @@ set path = (/usr/bin /usr/local/bin ~/bin)
 
     #[test]
     fn test_tcsh_config_update() {
-        let temp_dir = TempDir::new().unwrap();
-        let config_path = temp_dir.path().join(".tcshrc");
+        let config_path = Path::new("/home/user/.tcshrc");
 
         let initial_content = r#"
 # Initial config
@@ -173,18 +200,66 @@ set path = (/usr/bin /old/path)
 setenv PATH /usr/bin:/old/path
 "#;
 
-        fs::write(&config_path, initial_content).unwrap();
-
-        let mut handler = TcshHandler::new();
-        handler.config_path = config_path.clone();
+        let files = MemoryFileSystem::new().with_file(config_path, initial_content);
+        let handler = TcshHandler::new();
 
         let new_entries = vec![PathBuf::from("/usr/bin"), PathBuf::from("/usr/local/bin")];
 
-        handler.update_config(&new_entries).unwrap();
+        handler
+            .rewrite_config(&files, config_path, &new_entries)
+            .unwrap();
 
-        let updated_content = fs::read_to_string(&config_path).unwrap();
+        let updated_content = files.contents(config_path).unwrap();
         assert!(!updated_content.contains("/old/path"));
         assert!(updated_content.contains("/usr/bin"));
         assert!(updated_content.contains("/usr/local/bin"));
     }
+
+    #[test]
+    fn test_tcsh_path_array_conversion() {
+        let entries = parse_path_array("/usr/bin '/opt/my tools/bin' ~/bin $path");
+        assert_eq!(entries.len(), 3);
+        assert_eq!(entries[0], PathBuf::from("/usr/bin"));
+        assert_eq!(entries[1], PathBuf::from("/opt/my tools/bin"));
+        assert!(entries[2].ends_with("bin"));
+
+        let formatted = format_path_array(&entries[..2]);
+        assert_eq!(formatted, "(/usr/bin '/opt/my tools/bin')");
+        assert_eq!(
+            parse_path_array(formatted.trim_matches(|c| c == '(' || c == ')')),
+            entries[..2]
+        );
+    }
+
+    #[test]
+    fn test_tcsh_array_form_config() {
+        let handler = TcshHandler::new();
+        let content = r#"
+# Array form only
+set path=(/usr/bin /usr/local/bin $path)
+alias ll 'ls -l'
+"#;
+
+        let entries = handler.parse_path_entries(content);
+        assert_eq!(
+            entries,
+            vec![PathBuf::from("/usr/bin"), PathBuf::from("/usr/local/bin")]
+        );
+
+        let updated = handler.update_path_in_config(content, &[PathBuf::from("/opt/bin")]);
+        assert!(updated.contains("set path = (/opt/bin)"));
+        assert!(updated.contains("setenv PATH \"/opt/bin\""));
+        assert!(!updated.contains("set path=("));
+        assert!(updated.contains("alias ll 'ls -l'"));
+    }
+
+    #[test]
+    fn test_tcsh_quoted_setenv() {
+        let handler = TcshHandler::new();
+        let entries = handler.parse_path_entries(r#"setenv PATH "/usr/bin:/bin:$PATH""#);
+        assert_eq!(
+            entries,
+            vec![PathBuf::from("/usr/bin"), PathBuf::from("/bin")]
+        );
+    }
 }
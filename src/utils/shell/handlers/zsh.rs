@@ -1,7 +1,9 @@
 use super::ShellHandler;
+use crate::utils::shell::config::config_file;
+use crate::utils::shell::edit::{replace_path_declarations, split_inline_comment};
+use crate::utils::shell::posix;
 use crate::utils::shell::types::{ModificationType, PathModification, ShellType};
 use chrono::Local;
-use regex::Regex;
 use std::path::PathBuf;
 
 pub struct ZshHandler {
@@ -10,25 +12,41 @@ pub struct ZshHandler {
 
 impl ZshHandler {
     pub fn new() -> Self {
-        let home_dir = dirs_next::home_dir().unwrap_or_else(|| PathBuf::from("/"));
         Self {
-            config_path: home_dir.join(".zshrc"),
+            config_path: config_file(&ShellType::Zsh).0,
         }
     }
 
     fn find_path_arrays(&self, content: &str) -> Vec<PathModification> {
-        let path_array_regex = Regex::new(r"(?m)^path=\((.*?)\)").unwrap();
-
-        path_array_regex
-            .captures_iter(content)
+        content
+            .lines()
             .enumerate()
-            .map(|(idx, cap)| PathModification {
+            .filter(|(_, line)| {
+                let line = line.trim_start();
+                line.starts_with("path=(") || line.starts_with("path+=(")
+            })
+            .map(|(idx, line)| PathModification {
                 line_number: idx + 1,
-                content: cap[0].to_string(),
+                content: line.to_string(),
                 modification_type: ModificationType::ArrayModification,
             })
             .collect()
     }
+
+    /// Expands the words of a `path=(...)` array, with `$path` standing for `current`
+    fn array_entries(array: &str, current: &[PathBuf]) -> Vec<PathBuf> {
+        let words = array.split(')').next().unwrap_or_default();
+        let mut entries = Vec::new();
+
+        for word in words.split_whitespace() {
+            match word.trim_matches(|c| c == '"' || c == '\'') {
+                "$path" | "${path[@]}" => entries.extend(current.iter().cloned()),
+                word => entries.push(PathBuf::from(shellexpand::tilde(word).to_string())),
+            }
+        }
+
+        entries
+    }
 }
 
 impl ShellHandler for ZshHandler {
@@ -43,19 +61,18 @@ impl ShellHandler for ZshHandler {
     fn parse_path_entries(&self, content: &str) -> Vec<PathBuf> {
         let mut entries = Vec::new();
 
-        if let Some(path_array) = content
-            .lines()
-            .find(|line| line.trim().starts_with("path=("))
-        {
-            let paths = path_array
-                .trim()
-                .trim_start_matches("path=(")
-                .trim_end_matches(')')
-                .split_whitespace();
-
-            for path in paths {
-                let expanded = shellexpand::tilde(path);
-                entries.push(PathBuf::from(expanded.to_string()));
+        // Apply array and scalar assignments in order, so appends accumulate
+        for line in content.lines() {
+            let (code, _) = split_inline_comment(line);
+            let code = code.trim();
+
+            if let Some(array) = code.strip_prefix("path+=(") {
+                let added = Self::array_entries(array, &entries);
+                entries.extend(added);
+            } else if let Some(array) = code.strip_prefix("path=(") {
+                entries = Self::array_entries(array, &entries);
+            } else if let Some(value) = posix::assignment_value(line) {
+                entries = posix::apply_assignment(&entries, &value);
             }
         }
 
@@ -78,62 +95,22 @@ impl ShellHandler for ZshHandler {
 
     fn detect_path_modifications(&self, content: &str) -> Vec<PathModification> {
         let mut modifications = self.find_path_arrays(content);
-
-        let path_regex = Regex::new(r"(?m)^export PATH=").unwrap();
-        for (idx, line) in content.lines().enumerate() {
-            if path_regex.is_match(line) {
-                modifications.push(PathModification {
-                    line_number: idx + 1,
-                    content: line.to_string(),
-                    modification_type: ModificationType::Assignment,
-                });
-            }
-        }
-
+        modifications.extend(posix::detect_assignments(content));
+        modifications.sort_by_key(|modification| modification.line_number);
         modifications
     }
 
     fn update_path_in_config(&self, content: &str, entries: &[PathBuf]) -> String {
         let modifications = self.detect_path_modifications(content);
-        let new_path_config = self.format_path_export(entries);
-        
-        // If we found existing PATH modifications, update in place
-        if !modifications.is_empty() {
-            // Sort by line number in descending order to avoid index shifting
-            let mut sorted_mods = modifications.clone();
-            sorted_mods.sort_by(|a, b| b.line_number.cmp(&a.line_number));
-            
-            // First modification is where we'll insert our new config
-            let first_mod = sorted_mods.last().unwrap().line_number - 1;
-            
-            // Convert to lines for manipulation
-            let mut lines: Vec<&str> = content.lines().collect();
-            
-            // Remove all existing PATH declarations
-            for modification in sorted_mods {
-                lines.remove(modification.line_number - 1);
-            }
-            
-            // Insert new config at the position of the first PATH declaration
-            // Remove newline prefix from format_path_export output
-            let new_config = new_path_config.trim_start_matches('\n');
-            for (i, line) in new_config.lines().rev().enumerate() {
-                lines.insert(first_mod, line);
-            }
-            
-            return lines.join("\n");
-        } else {
-            // No existing PATH declarations found, append to end
-            return content.to_string() + &new_path_config;
-        }
+        replace_path_declarations(content, &modifications, &self.format_path_export(entries))
     }
 }
 
 #[cfg(test)]
 mod tests {
     use super::*;
-    use std::fs;
-    use tempfile::TempDir;
+    use crate::utils::filesystem::MemoryFileSystem;
+    use std::path::Path;
 
     #[test]
     fn test_zsh_path_parsing() {
@@ -165,8 +142,7 @@ path=(/usr/bin /usr/local/bin ~/bin)
 
     #[test]
     fn test_zsh_config_update() {
-        let temp_dir = TempDir::new().unwrap();
-        let config_path = temp_dir.path().join(".zshrc");
+        let config_path = Path::new("/home/user/.zshrc");
 
         let initial_content = r#"
 # Initial config
@@ -174,16 +150,16 @@ path=(/usr/bin /old/path)
 export PATH="/another/old/path:$PATH"
 "#;
 
-        fs::write(&config_path, initial_content).unwrap();
-
-        let mut handler = ZshHandler::new();
-        handler.config_path = config_path.clone();
+        let files = MemoryFileSystem::new().with_file(config_path, initial_content);
+        let handler = ZshHandler::new();
 
         let new_entries = vec![PathBuf::from("/usr/bin"), PathBuf::from("/usr/local/bin")];
 
-        handler.update_config(&new_entries).unwrap();
+        handler
+            .rewrite_config(&files, config_path, &new_entries)
+            .unwrap();
 
-        let updated_content = fs::read_to_string(&config_path).unwrap();
+        let updated_content = files.contents(config_path).unwrap();
         assert!(!updated_content.contains("/old/path"));
         assert!(updated_content.contains("/usr/bin"));
         assert!(updated_content.contains("/usr/local/bin"));
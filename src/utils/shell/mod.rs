@@ -1,13 +1,77 @@
+use lazy_static::lazy_static;
+use regex::Regex;
+use std::fs;
 use std::io;
 use std::path::PathBuf;
 
+pub mod config;
+pub mod edit;
 pub mod factory;
 pub mod handlers;
+pub mod posix;
+pub mod source;
 pub mod types;
 
 pub use self::handlers::ShellHandler;
 
+lazy_static! {
+    static ref LITERAL_REGEX: Regex =
+        Regex::new(r#"\$\{?[A-Za-z_][A-Za-z0-9_]*\}?[^\s:"'()\[\]]*"#).unwrap();
+}
+
 pub fn update_shell_config(entries: &[PathBuf]) -> io::Result<()> {
     let handler = factory::get_shell_handler();
     handler.update_config(entries)
 }
+
+/// Reads the file whose PATH declarations a handler edits
+///
+/// A missing file reads as empty.
+pub fn read_target_config<H: ShellHandler + ?Sized>(handler: &H) -> io::Result<String> {
+    match fs::read_to_string(handler.target_config_path()) {
+        Ok(content) => Ok(content),
+        Err(e) if e.kind() == io::ErrorKind::NotFound => Ok(String::new()),
+        Err(e) => Err(e),
+    }
+}
+
+/// Reads the PATH entries contributed by the detected shell's configuration
+///
+/// All PATH declarations in the file are taken into account, so entries added
+/// by several scattered appends are included. A missing file contributes none.
+/// When the shell keeps PATH outside the file, as fish can, those entries
+/// are returned instead.
+pub fn config_entries() -> io::Result<Vec<PathBuf>> {
+    let handler = factory::get_shell_handler();
+    let content = read_target_config(&*handler)?;
+    match handler.external_path_entries(&content)? {
+        Some(entries) => Ok(entries),
+        None => Ok(handler.parse_path_entries(&content)),
+    }
+}
+
+/// Returns whether the detected shell keeps PATH outside its configuration
+/// file, such as in fish's universal `fish_user_paths`
+pub fn saves_externally() -> io::Result<bool> {
+    let handler = factory::get_shell_handler();
+    let content = read_target_config(&*handler)?;
+    Ok(handler.external_path_entries(&content)?.is_some())
+}
+
+/// Reads the paths the detected shell's configuration writes with variables,
+/// such as `$HOME/bin`, as they are written
+///
+/// `$PATH` itself is not included. A missing file contributes none.
+pub fn config_literals() -> io::Result<Vec<String>> {
+    let handler = factory::get_shell_handler();
+    let content = read_target_config(&*handler)?;
+
+    Ok(LITERAL_REGEX
+        .find_iter(&content)
+        .map(|m| m.as_str().to_string())
+        .filter(|word| {
+            let name = word.trim_start_matches("${").trim_start_matches('$');
+            !name.starts_with("PATH") && !name.starts_with("path")
+        })
+        .collect())
+}
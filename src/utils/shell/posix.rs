@@ -0,0 +1,317 @@
+//! PATH assignments in POSIX-style shell configurations (sh, bash, ksh, zsh).
+//!
+//! This module handles:
+//! - Recognizing `PATH=...`, `export PATH=...` and `typeset -x PATH=...` lines
+//! - Evaluating a sequence of assignments, so that `PATH=$PATH:/foo` appends
+//!   to whatever earlier lines set
+//! - Collapsing empty entries out of assignments in place, keeping `$PATH`
+//!   references where they are
+//!
+//! The inherited PATH is unknown when reading a config file, so a reference to
+//! `$PATH` that is not preceded by an assignment contributes no entries.
+
+use crate::utils::shell::edit::split_inline_comment;
+use crate::utils::shell::types::{ModificationType, PathModification};
+use lazy_static::lazy_static;
+use regex::Regex;
+use std::ops::Range;
+use std::path::PathBuf;
+
+lazy_static! {
+    static ref ASSIGNMENT_REGEX: Regex =
+        Regex::new(r"^\s*(?:(?:export|readonly|declare\s+-x|typeset\s+-x)\s+)?PATH=(.*)$").unwrap();
+}
+
+/// Finds where the value assigned to PATH sits on a line
+///
+/// The range leaves out the quotes around the value, a trailing `;` and any
+/// comment.
+fn value_range(line: &str) -> Option<Range<usize>> {
+    let (code, _) = split_inline_comment(line);
+    let captured = ASSIGNMENT_REGEX.captures(code)?.get(1)?;
+    let raw = captured.as_str();
+    let value = raw.trim().trim_end_matches(';').trim_end();
+    let value = value.trim_matches(|c| c == '"' || c == '\'');
+
+    // `value` is a slice of `raw`, so its offset can be recovered
+    let start = captured.start() + (value.as_ptr() as usize - raw.as_ptr() as usize);
+    Some(start..start + value.len())
+}
+
+/// Extracts the value assigned to PATH on a line, without quotes or comments
+///
+/// # Returns
+/// * `Some(String)` with the raw value, e.g. `$PATH:~/bin`
+/// * `None` if the line does not assign PATH
+pub fn assignment_value(line: &str) -> Option<String> {
+    value_range(line).map(|range| line[range].to_string())
+}
+
+/// Removes empty entries from a PATH value
+///
+/// Leading, trailing and doubled `:` separators are dropped, so
+/// `:$PATH::/foo:` becomes `$PATH:/foo`. Colons inside `${...}`, `$(...)`,
+/// backticks or quotes, as in `${PATH:-/usr/bin}` or `$(... | sed 's/::/:/g')`,
+/// are not separators and are left alone, as is a value whose quoting or
+/// nesting does not balance.
+pub fn collapse_separators(value: &str) -> String {
+    let mut parts: Vec<String> = Vec::new();
+    let mut part = String::new();
+    // What closes each quote or expansion the current character is inside
+    let mut open: Vec<char> = Vec::new();
+    let mut previous = None;
+    let mut escaped = false;
+
+    for c in value.chars() {
+        match open.last().copied() {
+            _ if escaped => escaped = false,
+            Some('\'') => {
+                if c == '\'' {
+                    open.pop();
+                }
+            }
+            Some(close) if c == close => {
+                open.pop();
+            }
+            inside => match c {
+                '\\' => escaped = true,
+                '{' | '(' if previous == Some('$') => open.push(if c == '{' { '}' } else { ')' }),
+                '`' | '"' => open.push(c),
+                '\'' if inside != Some('"') => open.push(c),
+                ':' if inside.is_none() => {
+                    parts.push(std::mem::take(&mut part));
+                    previous = Some(c);
+                    continue;
+                }
+                _ => {}
+            },
+        }
+        part.push(c);
+        previous = Some(c);
+    }
+    if !open.is_empty() || escaped {
+        return value.to_string();
+    }
+    parts.push(part);
+
+    parts.retain(|part| !part.is_empty());
+    parts.join(":")
+}
+
+/// Collapses redundant separators in every PATH assignment of a config
+///
+/// Only the assigned values change; quotes, `export`, comments and every
+/// other line are kept as they are, and so are `$PATH` references, so each
+/// assignment still prepends or appends to the PATH it inherits.
+///
+/// # Returns
+/// The updated content, and the number of assignments that changed
+pub fn fix_separators(content: &str) -> (String, usize) {
+    let mut fixed = String::with_capacity(content.len());
+    let mut changed = 0;
+
+    for line in content.split_inclusive('\n') {
+        let text = line.trim_end_matches(['\n', '\r']);
+        match value_range(text) {
+            Some(range) if collapse_separators(&text[range.clone()]) != text[range.clone()] => {
+                fixed.push_str(&text[..range.start]);
+                fixed.push_str(&collapse_separators(&text[range.clone()]));
+                fixed.push_str(&line[range.end..]);
+                changed += 1;
+            }
+            _ => fixed.push_str(line),
+        }
+    }
+
+    (fixed, changed)
+}
+
+/// Evaluates one PATH assignment against the entries set so far
+///
+/// `$PATH` and `${PATH}` expand to `current`; `~` and other environment
+/// variables are expanded where possible.
+///
+/// # Arguments
+/// * `current` - PATH entries before the assignment
+/// * `value` - The assigned value, as returned by `assignment_value`
+///
+/// # Returns
+/// The PATH entries after the assignment
+pub fn apply_assignment(current: &[PathBuf], value: &str) -> Vec<PathBuf> {
+    let mut entries = Vec::new();
+
+    for part in value.split(':') {
+        match part {
+            "$PATH" | "${PATH}" => entries.extend(current.iter().cloned()),
+            "" => {}
+            part => {
+                let expanded = shellexpand::full(part)
+                    .map(|expanded| expanded.to_string())
+                    .unwrap_or_else(|_| shellexpand::tilde(part).to_string());
+                entries.push(PathBuf::from(expanded));
+            }
+        }
+    }
+
+    entries
+}
+
+/// Returns the PATH entries a POSIX-style config file contributes
+///
+/// Every PATH assignment is applied in file order, so entries appended by
+/// several scattered lines are all included.
+///
+/// # Example
+/// ```rust
+/// # use pathmaster::utils::shell::posix;
+/// # use std::path::PathBuf;
+/// let content = "export PATH=/usr/bin\nalias ll='ls -l'\nexport PATH=$PATH:/opt/bin\n";
+/// assert_eq!(
+///     posix::cumulative_entries(content),
+///     vec![PathBuf::from("/usr/bin"), PathBuf::from("/opt/bin")]
+/// );
+/// ```
+pub fn cumulative_entries(content: &str) -> Vec<PathBuf> {
+    content
+        .lines()
+        .filter_map(assignment_value)
+        .fold(Vec::new(), |entries, value| {
+            apply_assignment(&entries, &value)
+        })
+}
+
+/// Finds every line of a POSIX-style config file that assigns PATH
+///
+/// Assignments that reference `$PATH` are reported as additions, the others
+/// as plain assignments.
+pub fn detect_assignments(content: &str) -> Vec<PathModification> {
+    content
+        .lines()
+        .enumerate()
+        .filter_map(|(idx, line)| {
+            let value = assignment_value(line)?;
+            let modification_type = if value.contains("$PATH") || value.contains("${PATH}") {
+                ModificationType::Addition
+            } else {
+                ModificationType::Assignment
+            };
+
+            Some(PathModification {
+                line_number: idx + 1,
+                content: line.to_string(),
+                modification_type,
+            })
+        })
+        .collect()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_assignment_value() {
+        assert_eq!(
+            assignment_value("export PATH=\"$PATH:/opt/bin\"  # vendor tools"),
+            Some(String::from("$PATH:/opt/bin"))
+        );
+        assert_eq!(
+            assignment_value("  typeset -x PATH=/usr/bin"),
+            Some(String::from("/usr/bin"))
+        );
+        assert_eq!(
+            assignment_value("PATH=$PATH:/foo;"),
+            Some(String::from("$PATH:/foo"))
+        );
+        assert_eq!(assignment_value("export MANPATH=/usr/share/man"), None);
+        assert_eq!(assignment_value("# export PATH=/old"), None);
+        assert_eq!(assignment_value("export PATH"), None);
+    }
+
+    #[test]
+    fn test_scattered_appends() {
+        let content = "export PATH=/usr/bin:/bin\n\
+                       export PATH=$PATH:/foo\n\
+                       alias ll='ls -l'\n\
+                       PATH=\"/opt/bin:${PATH}\"\n\
+                       export PATH=$PATH:/bar\n";
+        assert_eq!(
+            cumulative_entries(content),
+            ["/opt/bin", "/usr/bin", "/bin", "/foo", "/bar"]
+                .iter()
+                .map(PathBuf::from)
+                .collect::<Vec<_>>()
+        );
+    }
+
+    #[test]
+    fn test_detect_assignments() {
+        let content = "export PATH=/usr/bin\nexport MANPATH=/usr/share/man\n\nPATH=$PATH:/foo\n";
+        let found = detect_assignments(content);
+        assert_eq!(
+            found.iter().map(|m| m.line_number).collect::<Vec<_>>(),
+            vec![1, 4]
+        );
+        assert_eq!(found[0].modification_type, ModificationType::Assignment);
+        assert_eq!(found[1].modification_type, ModificationType::Addition);
+    }
+
+    #[test]
+    fn test_collapse_separators() {
+        assert_eq!(collapse_separators("$PATH:/foo::/bar:"), "$PATH:/foo:/bar");
+        assert_eq!(collapse_separators(":/foo:${PATH}"), "/foo:${PATH}");
+        assert_eq!(
+            collapse_separators("${PATH:-/usr/bin}::/opt/bin"),
+            "${PATH:-/usr/bin}:/opt/bin"
+        );
+        assert_eq!(collapse_separators("/usr/bin:/bin"), "/usr/bin:/bin");
+
+        // Colons in command substitutions and quotes are not separators
+        let cleanup = r#"$(printf %s "$PATH" | sed 's/::/:/g')"#;
+        assert_eq!(collapse_separators(cleanup), cleanup);
+        assert_eq!(
+            collapse_separators(r#"`echo "a::b"`::$(dirname "$x"):"/opt/my::dir"::"#),
+            r#"`echo "a::b"`:$(dirname "$x"):"/opt/my::dir""#
+        );
+        assert_eq!(collapse_separators(r"/a\:\:b::/c"), r"/a\:\:b:/c");
+
+        // Unbalanced values are left untouched
+        assert_eq!(collapse_separators("$(oops::/bin"), "$(oops::/bin");
+        assert_eq!(collapse_separators("/a::'/b"), "/a::'/b");
+    }
+
+    #[test]
+    fn test_fix_separators() {
+        let content = "# tools\n\
+                       export PATH=$PATH:/foo::/bar:\n\
+                       PATH=\"::/opt/bin:${PATH}\"; # vendor\n\
+                       export MANPATH=/usr/share/man::\n\
+                       export PATH=\"$HOME/bin:$PATH\"\r\n\
+                       PATH=$(printf %s \"$PATH\" | sed 's/::/:/g')\n\
+                       typeset -x PATH='/usr/bin:'";
+        let (fixed, changed) = fix_separators(content);
+        assert_eq!(
+            fixed,
+            "# tools\n\
+             export PATH=$PATH:/foo:/bar\n\
+             PATH=\"/opt/bin:${PATH}\"; # vendor\n\
+             export MANPATH=/usr/share/man::\n\
+             export PATH=\"$HOME/bin:$PATH\"\r\n\
+             PATH=$(printf %s \"$PATH\" | sed 's/::/:/g')\n\
+             typeset -x PATH='/usr/bin'"
+        );
+        assert_eq!(changed, 3);
+
+        // The inherited PATH is still extended the same way
+        assert_eq!(cumulative_entries(&fixed), cumulative_entries(content));
+        assert_eq!(fix_separators(&fixed), (fixed.clone(), 0));
+    }
+
+    #[test]
+    fn test_inherited_path_contributes_nothing() {
+        assert_eq!(
+            cumulative_entries("export PATH=$PATH:/foo\n"),
+            vec![PathBuf::from("/foo")]
+        );
+    }
+}
@@ -0,0 +1,162 @@
+//! Following `source` directives to the file that actually sets PATH.
+//!
+//! This module handles:
+//! - Finding the files a configuration sources with `source` or `.`
+//! - Choosing which file to edit when the PATH declaration lives in one of them
+//! - The global switch that confines edits to the primary rc file
+//!
+//! Only one level of sourcing is followed.
+
+use crate::log_debug;
+use crate::utils::shell::edit::split_inline_comment;
+use lazy_static::lazy_static;
+use std::fs;
+use std::io;
+use std::path::{Path, PathBuf};
+use std::sync::Mutex;
+
+lazy_static! {
+    static ref FOLLOW_SOURCE: Mutex<bool> = Mutex::new(true);
+}
+
+/// Sets whether PATH edits may go to a file sourced by the primary config
+pub fn set_follow_source(follow: bool) -> io::Result<()> {
+    let mut follow_source = FOLLOW_SOURCE
+        .lock()
+        .map_err(|_| io::Error::new(io::ErrorKind::Other, "Failed to lock follow-source mutex"))?;
+    *follow_source = follow;
+    Ok(())
+}
+
+/// Gets whether PATH edits may go to a file sourced by the primary config
+pub fn get_follow_source() -> io::Result<bool> {
+    let follow_source = FOLLOW_SOURCE
+        .lock()
+        .map_err(|_| io::Error::new(io::ErrorKind::Other, "Failed to lock follow-source mutex"))?;
+    Ok(*follow_source)
+}
+
+/// Returns the files sourced by a configuration, in order
+///
+/// Recognizes `source FILE` and `. FILE`, including guarded forms such as
+/// `[ -f ~/.path ] && . ~/.path`. Relative paths are resolved against
+/// `base_dir`, the directory of the configuration file.
+pub fn sourced_files(content: &str, base_dir: &Path) -> Vec<PathBuf> {
+    let mut files = Vec::new();
+
+    for line in content.lines() {
+        let (code, _) = split_inline_comment(line);
+
+        for command in code.split(|c| c == ';' || c == '&' || c == '|') {
+            let mut words = command.split_whitespace();
+            if !matches!(words.next(), Some("source") | Some(".")) {
+                continue;
+            }
+            let file = match words.next() {
+                Some(file) => file,
+                None => continue,
+            };
+
+            let file = file.trim_matches(|c| c == '"' || c == '\'');
+            let expanded = shellexpand::full(file)
+                .map(|expanded| expanded.to_string())
+                .unwrap_or_else(|_| file.to_string());
+            let path = base_dir.join(expanded);
+            if !files.contains(&path) {
+                files.push(path);
+            }
+        }
+    }
+
+    files
+}
+
+/// Finds the file whose PATH declarations should be edited
+///
+/// This is `primary` itself if it declares PATH, if it cannot be read, or if
+/// following sources is disabled. Otherwise it is the first file sourced by
+/// `primary` that declares PATH, falling back to `primary`.
+///
+/// # Arguments
+/// * `primary` - The shell's main configuration file
+/// * `declares_path` - Tells whether a file's content modifies PATH
+pub fn declaring_file(primary: &Path, declares_path: impl Fn(&str) -> bool) -> PathBuf {
+    if !get_follow_source().unwrap_or(true) {
+        log_debug!("Not looking in files sourced by {}", primary.display());
+        return primary.to_path_buf();
+    }
+
+    let content = match fs::read_to_string(primary) {
+        Ok(content) => content,
+        Err(_) => return primary.to_path_buf(),
+    };
+    if declares_path(&content) {
+        return primary.to_path_buf();
+    }
+
+    let base_dir = primary.parent().unwrap_or_else(|| Path::new("."));
+    match sourced_files(&content, base_dir).into_iter().find(|file| {
+        fs::read_to_string(file)
+            .map(|content| declares_path(&content))
+            .unwrap_or(false)
+    }) {
+        Some(file) => {
+            log_debug!(
+                "{} does not set PATH but sources {}, which does",
+                primary.display(),
+                file.display()
+            );
+            file
+        }
+        None => primary.to_path_buf(),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use serial_test::serial;
+    use tempfile::TempDir;
+
+    fn declares_path(content: &str) -> bool {
+        content.contains("PATH=")
+    }
+
+    #[test]
+    fn test_sourced_files() {
+        let base = Path::new("/home/user");
+        let content = "source ~/.aliases\n\
+                       [ -f .path_custom ] && . .path_custom  # custom dirs\n\
+                       echo sourced\n\
+                       # source ~/.disabled\n";
+        let home = shellexpand::tilde("~/.aliases").to_string();
+        assert_eq!(
+            sourced_files(content, base),
+            vec![
+                PathBuf::from(home),
+                PathBuf::from("/home/user/.path_custom")
+            ]
+        );
+    }
+
+    #[test]
+    #[serial]
+    fn test_declaring_file() -> io::Result<()> {
+        let temp_dir = TempDir::new()?;
+        let bashrc = temp_dir.path().join(".bashrc");
+        let custom = temp_dir.path().join(".path_custom");
+        fs::write(&bashrc, "alias ll='ls -l'\n. .path_custom\n")?;
+        fs::write(&custom, "export PATH=\"/opt/bin:$PATH\"\n")?;
+
+        assert_eq!(declaring_file(&bashrc, declares_path), custom);
+
+        set_follow_source(false)?;
+        let confined = declaring_file(&bashrc, declares_path);
+        set_follow_source(true)?;
+        assert_eq!(confined, bashrc);
+
+        fs::write(&bashrc, "export PATH=\"/usr/bin\"\n. .path_custom\n")?;
+        assert_eq!(declaring_file(&bashrc, declares_path), bashrc);
+        Ok(())
+    }
+}
@@ -1,3 +1,6 @@
+use std::fmt;
+use std::str::FromStr;
+
 #[derive(Debug, Clone, PartialEq)]
 pub enum ShellType {
     Zsh,
@@ -5,9 +8,48 @@ pub enum ShellType {
     Fish,
     Tcsh,
     Ksh,
+    Elvish,
+    Nushell,
     Generic,
 }
 
+impl fmt::Display for ShellType {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        let name = match self {
+            ShellType::Zsh => "zsh",
+            ShellType::Bash => "bash",
+            ShellType::Fish => "fish",
+            ShellType::Tcsh => "tcsh",
+            ShellType::Ksh => "ksh",
+            ShellType::Elvish => "elvish",
+            ShellType::Nushell => "nushell",
+            ShellType::Generic => "generic",
+        };
+        write!(f, "{}", name)
+    }
+}
+
+impl FromStr for ShellType {
+    type Err = String;
+
+    fn from_str(s: &str) -> Result<Self, Self::Err> {
+        match s.to_lowercase().as_str() {
+            "zsh" => Ok(ShellType::Zsh),
+            "bash" => Ok(ShellType::Bash),
+            "fish" => Ok(ShellType::Fish),
+            "tcsh" | "csh" => Ok(ShellType::Tcsh),
+            "ksh" => Ok(ShellType::Ksh),
+            "elvish" => Ok(ShellType::Elvish),
+            "nushell" | "nu" => Ok(ShellType::Nushell),
+            "generic" | "sh" => Ok(ShellType::Generic),
+            _ => Err(format!(
+                "Invalid shell: {}. Supported shells are: bash, zsh, fish, tcsh, ksh, elvish, nushell, generic",
+                s
+            )),
+        }
+    }
+}
+
 #[derive(Debug, Clone, PartialEq)]
 pub enum ModificationType {
     Assignment,        // export PATH=...
@@ -15,6 +57,8 @@ pub enum ModificationType {
     ArrayModification, // path=(...) in zsh
     SetEnv,            // setenv PATH ... in tcsh
     FishPath,          // set -gx PATH ... in fish
+    ElvishPaths,       // set paths = [...] in elvish
+    NushellEnv,        // $env.PATH = ... in nushell
 }
 
 #[derive(Debug, Clone)]
@@ -0,0 +1,154 @@
+//! Files under `/etc` that set PATH for every user.
+//!
+//! This module handles:
+//! - Listing those files in the order they are read
+//! - Reading the PATH entries each line of them adds
+//!
+//! Used by `pathmaster system` to report on them and by `path_helper` to see
+//! what macOS puts back into PATH.
+
+use crate::utils::shell::posix;
+use std::fs;
+use std::path::{Path, PathBuf};
+
+/// Shell scripts sourced for every user after `/etc/profile` and
+/// `/etc/profile.d`, relative to the root
+const SYSTEM_SCRIPTS: &[&str] = &[
+    "etc/bash.bashrc",
+    "etc/bashrc",
+    "etc/zshenv",
+    "etc/zsh/zshenv",
+    "etc/zprofile",
+    "etc/zsh/zprofile",
+];
+
+/// How a system file lists PATH entries
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum SystemFileKind {
+    /// `KEY=value` lines, as in `/etc/environment`
+    Environment,
+    /// One directory per line, as in `/etc/paths`
+    PathList,
+    /// A shell script assigning PATH
+    Script,
+}
+
+/// PATH entries added by one line of a system file
+#[derive(Debug, Clone, PartialEq)]
+pub struct Contribution {
+    /// The line, counting from 1
+    pub line_number: usize,
+    /// The entries it adds, in order
+    pub entries: Vec<PathBuf>,
+}
+
+/// Lists the files in a directory, sorted, keeping those `keep` accepts
+fn directory_files(dir: &Path, keep: impl Fn(&Path) -> bool) -> Vec<PathBuf> {
+    let mut files: Vec<PathBuf> = fs::read_dir(dir)
+        .map(|listing| {
+            listing
+                .flatten()
+                .map(|file| file.path())
+                .filter(|file| file.is_file() && keep(file))
+                .collect()
+        })
+        .unwrap_or_default();
+    files.sort();
+    files
+}
+
+/// Lists the system files that may set PATH, in the order they are read
+///
+/// # Arguments
+/// * `root` - Directory standing for `/`, so another system can be inspected
+pub fn candidate_files(root: &Path) -> Vec<(PathBuf, SystemFileKind)> {
+    let mut files = vec![(root.join("etc/environment"), SystemFileKind::Environment)];
+
+    files.push((root.join("etc/paths"), SystemFileKind::PathList));
+    for file in directory_files(&root.join("etc/paths.d"), |_| true) {
+        files.push((file, SystemFileKind::PathList));
+    }
+
+    files.push((root.join("etc/profile"), SystemFileKind::Script));
+    let is_script = |file: &Path| file.extension().map_or(false, |ext| ext == "sh");
+    for file in directory_files(&root.join("etc/profile.d"), is_script) {
+        files.push((file, SystemFileKind::Script));
+    }
+    for script in SYSTEM_SCRIPTS {
+        files.push((root.join(script), SystemFileKind::Script));
+    }
+
+    files
+}
+
+/// Finds the PATH entries each line of a system file adds
+///
+/// A reference to the inherited `$PATH` adds nothing, so `PATH=$PATH:/opt/bin`
+/// contributes only `/opt/bin`.
+///
+/// # Arguments
+/// * `content` - The file's contents
+/// * `kind` - How the file lists entries
+pub fn parse_contributions(content: &str, kind: SystemFileKind) -> Vec<Contribution> {
+    content
+        .lines()
+        .enumerate()
+        .filter_map(|(index, line)| {
+            let entries = match kind {
+                SystemFileKind::PathList => {
+                    let line = line.trim();
+                    if line.is_empty() || line.starts_with('#') {
+                        return None;
+                    }
+                    vec![PathBuf::from(line)]
+                }
+                SystemFileKind::Environment | SystemFileKind::Script => {
+                    posix::apply_assignment(&[], &posix::assignment_value(line)?)
+                }
+            };
+            (!entries.is_empty()).then(|| Contribution {
+                line_number: index + 1,
+                entries,
+            })
+        })
+        .collect()
+}
+
+#[cfg(all(test, unix))]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_parse_contributions() {
+        let environment = "LANG=C\nPATH=\"/usr/local/bin:/usr/bin:/bin\"\n";
+        assert_eq!(
+            parse_contributions(environment, SystemFileKind::Environment),
+            vec![Contribution {
+                line_number: 2,
+                entries: vec![
+                    PathBuf::from("/usr/local/bin"),
+                    PathBuf::from("/usr/bin"),
+                    PathBuf::from("/bin"),
+                ],
+            }]
+        );
+
+        let paths = "# added by the installer\n/opt/tool/bin\n\n/usr/local/go/bin\n";
+        let contributions = parse_contributions(paths, SystemFileKind::PathList);
+        assert_eq!(contributions.len(), 2);
+        assert_eq!(contributions[1].line_number, 4);
+        assert_eq!(
+            contributions[1].entries,
+            vec![PathBuf::from("/usr/local/go/bin")]
+        );
+
+        let script = "if [ -d /opt/go ]; then\n  export PATH=$PATH:/opt/go/bin\nfi\nPATH=$PATH\n";
+        assert_eq!(
+            parse_contributions(script, SystemFileKind::Script),
+            vec![Contribution {
+                line_number: 2,
+                entries: vec![PathBuf::from("/opt/go/bin")],
+            }]
+        );
+    }
+}
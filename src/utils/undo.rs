@@ -0,0 +1,526 @@
+//! Undo and redo snapshots of shell configuration edits.
+//!
+//! This module handles:
+//! - Recording the full contents of a config file before pathmaster edits it
+//! - Restoring the most recent snapshot atomically
+//! - Reapplying undone edits until a new edit is made
+//! - Listing the undo stack
+//!
+//! Edits to fish's universal `fish_user_paths`, which lives outside any
+//! config file, are recorded as the variable's previous value and restored
+//! through fish.
+//!
+//! Snapshots are JSON files under `$XDG_STATE_HOME/pathmaster/undo` (or the
+//! legacy `~/.pathmaster/undo` if it exists), numbered in the order
+//! they were taken. Only the most recent `MAX_SNAPSHOTS` are kept. Undoing an
+//! edit moves the replaced contents to a redo stack in the sibling `redo`
+//! directory, in the same format; any new edit empties it.
+
+use crate::backup::core::TIMESTAMP_FORMAT;
+use crate::utils::atomic::write_atomic;
+use crate::utils::lock::lock_config;
+use crate::utils::shell::handlers::fish;
+use crate::utils::xdg;
+use chrono::Local;
+use lazy_static::lazy_static;
+use serde::{Deserialize, Serialize};
+use std::fs;
+use std::io;
+use std::path::{Path, PathBuf};
+use std::sync::Mutex;
+
+/// How many snapshots are kept before the oldest are discarded
+const MAX_SNAPSHOTS: usize = 50;
+
+lazy_static! {
+    static ref UNDO_DIR: Mutex<Option<PathBuf>> = Mutex::new(None);
+}
+
+/// The state of a config file before a pathmaster edit
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+pub struct Snapshot {
+    /// When the edit was made
+    pub timestamp: String,
+    /// The config file that was edited
+    pub file: PathBuf,
+    /// Contents of the file before the edit, or `None` if it did not exist
+    pub content: Option<String>,
+    /// For an edit to fish's universal `fish_user_paths` instead of `file`,
+    /// the directories it held before the edit
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub fish_user_paths: Option<Vec<PathBuf>>,
+}
+
+impl Snapshot {
+    /// Returns what the snapshot restores: the config file, or
+    /// `fish_user_paths` for an edit to fish's universal variable
+    pub fn location(&self) -> PathBuf {
+        match self.fish_user_paths {
+            Some(_) => PathBuf::from("fish_user_paths"),
+            None => self.file.clone(),
+        }
+    }
+}
+
+/// A snapshot stored in the undo directory
+#[derive(Debug)]
+pub struct StoredSnapshot {
+    /// File the snapshot is stored in
+    pub path: PathBuf,
+    /// The recorded state
+    pub snapshot: Snapshot,
+}
+
+/// Sets a custom undo directory (primarily for testing)
+pub fn set_undo_dir(dir: PathBuf) -> io::Result<()> {
+    let mut undo_dir = UNDO_DIR
+        .lock()
+        .map_err(|_| io::Error::new(io::ErrorKind::Other, "Failed to lock undo directory mutex"))?;
+    *undo_dir = Some(dir);
+    Ok(())
+}
+
+/// Gets the directory where undo snapshots are stored
+pub fn get_undo_dir() -> io::Result<PathBuf> {
+    let undo_dir = UNDO_DIR
+        .lock()
+        .map_err(|_| io::Error::new(io::ErrorKind::Other, "Failed to lock undo directory mutex"))?;
+
+    Ok(undo_dir.clone().unwrap_or_else(xdg::undo_dir))
+}
+
+/// Gets the directory where redo snapshots are stored
+///
+/// This is the `redo` directory next to the undo directory.
+pub fn get_redo_dir() -> io::Result<PathBuf> {
+    let undo_dir = get_undo_dir()?;
+    Ok(undo_dir
+        .parent()
+        .map_or_else(|| PathBuf::from("redo"), |parent| parent.join("redo")))
+}
+
+/// Returns the sequence number encoded in a snapshot file name
+fn sequence(path: &Path) -> Option<u64> {
+    if path.extension()? != "json" {
+        return None;
+    }
+    path.file_stem()?.to_str()?.parse().ok()
+}
+
+/// Lists the snapshots in the undo directory, most recent first
+///
+/// Snapshots that cannot be read are skipped with a warning.
+///
+/// # Returns
+/// * `Ok(Vec<StoredSnapshot>)` - The snapshots, empty if there are none
+/// * `Err(io::Error)` if the directory cannot be read
+pub fn list_snapshots() -> io::Result<Vec<StoredSnapshot>> {
+    stack(&get_undo_dir()?)
+}
+
+/// Lists the snapshots in the redo directory, most recent first
+pub fn list_redo_snapshots() -> io::Result<Vec<StoredSnapshot>> {
+    stack(&get_redo_dir()?)
+}
+
+/// Lists the snapshot files in `dir` by their names alone, most recent first
+fn numbered(dir: &Path) -> io::Result<Vec<(u64, PathBuf)>> {
+    let entries = match fs::read_dir(dir) {
+        Ok(entries) => entries,
+        Err(e) if e.kind() == io::ErrorKind::NotFound => return Ok(Vec::new()),
+        Err(e) => return Err(e),
+    };
+
+    let mut numbered = Vec::new();
+    for entry in entries.flatten() {
+        let path = entry.path();
+        if let Some(sequence) = sequence(&path) {
+            numbered.push((sequence, path));
+        }
+    }
+    numbered.sort_by(|a, b| b.0.cmp(&a.0));
+    Ok(numbered)
+}
+
+/// Reads one stored snapshot
+fn read_snapshot(path: &Path) -> io::Result<Snapshot> {
+    let contents = fs::read_to_string(path)?;
+    serde_json::from_str(&contents).map_err(|e| {
+        io::Error::new(
+            io::ErrorKind::InvalidData,
+            format!("Invalid undo snapshot {}: {}", path.display(), e),
+        )
+    })
+}
+
+/// Reads the snapshots in `dir`, most recent first, skipping unreadable ones
+///
+/// Stops after `limit` snapshots have been read, so popping the stack does
+/// not parse all of it. With `warn`, each skipped snapshot is reported.
+fn readable(dir: &Path, limit: usize, warn: bool) -> io::Result<Vec<StoredSnapshot>> {
+    let mut stored = Vec::new();
+    for (_, path) in numbered(dir)? {
+        if stored.len() == limit {
+            break;
+        }
+        match read_snapshot(&path) {
+            Ok(snapshot) => stored.push(StoredSnapshot { path, snapshot }),
+            Err(e) if warn => eprintln!(
+                "Warning: skipping undo snapshot {}: {}. Delete it if it is no longer needed.",
+                path.display(),
+                e
+            ),
+            Err(_) => {}
+        }
+    }
+    Ok(stored)
+}
+
+/// Reads the snapshots stored in `dir`, most recent first
+fn stack(dir: &Path) -> io::Result<Vec<StoredSnapshot>> {
+    readable(dir, usize::MAX, true)
+}
+
+/// Reads the most recent readable snapshot in `dir`
+fn top(dir: &Path, warn: bool) -> io::Result<Option<StoredSnapshot>> {
+    Ok(readable(dir, 1, warn)?.into_iter().next())
+}
+
+/// Returns the snapshot `undo_last` would restore, without restoring it
+pub fn next_undo() -> io::Result<Option<StoredSnapshot>> {
+    top(&get_undo_dir()?, false)
+}
+
+/// Returns the snapshot `redo_last` would reapply, without reapplying it
+pub fn next_redo() -> io::Result<Option<StoredSnapshot>> {
+    top(&get_redo_dir()?, false)
+}
+
+/// Captures the current state of a config file
+fn capture(file: &Path) -> io::Result<Snapshot> {
+    let content = match fs::read_to_string(file) {
+        Ok(content) => Some(content),
+        Err(e) if e.kind() == io::ErrorKind::NotFound => None,
+        Err(e) => return Err(e),
+    };
+
+    Ok(Snapshot {
+        timestamp: Local::now().format(TIMESTAMP_FORMAT).to_string(),
+        file: file.to_path_buf(),
+        content,
+        fish_user_paths: None,
+    })
+}
+
+/// Captures the value of fish's universal `fish_user_paths`
+///
+/// # Arguments
+/// * `config` - fish's config file, which the edit is locked on
+/// * `fish_user_paths` - The directories in the variable
+fn capture_fish_user_paths(config: &Path, fish_user_paths: Vec<PathBuf>) -> Snapshot {
+    Snapshot {
+        timestamp: Local::now().format(TIMESTAMP_FORMAT).to_string(),
+        file: config.to_path_buf(),
+        content: None,
+        fish_user_paths: Some(fish_user_paths),
+    }
+}
+
+/// Captures the current state of whatever a snapshot restores
+fn recapture(snapshot: &Snapshot) -> io::Result<Snapshot> {
+    match snapshot.fish_user_paths {
+        Some(_) => Ok(capture_fish_user_paths(
+            &snapshot.file,
+            fish::universal_user_paths().unwrap_or_default(),
+        )),
+        None => capture(&snapshot.file),
+    }
+}
+
+/// Pushes a snapshot onto the stack in `dir`, discarding the oldest
+/// snapshots once more than `MAX_SNAPSHOTS` exist
+///
+/// Only the file names are looked at, so an unreadable snapshot does not
+/// stop new edits from being recorded.
+fn push(dir: &Path, snapshot: &Snapshot) -> io::Result<PathBuf> {
+    fs::create_dir_all(dir)?;
+
+    let existing = numbered(dir)?;
+    let next = existing.first().map_or(1, |(sequence, _)| sequence + 1);
+    let path = dir.join(format!("{:06}.json", next));
+    let json = serde_json::to_string_pretty(snapshot)
+        .map_err(|e| io::Error::new(io::ErrorKind::Other, e))?;
+    write_atomic(&path, json.as_bytes())?;
+
+    for (_, stale) in existing.iter().skip(MAX_SNAPSHOTS - 1) {
+        fs::remove_file(stale)?;
+    }
+
+    Ok(path)
+}
+
+/// Removes every snapshot from the stack in `dir`
+fn clear(dir: &Path) -> io::Result<()> {
+    for (_, path) in numbered(dir)? {
+        fs::remove_file(&path)?;
+    }
+    Ok(())
+}
+
+/// Records the current state of a config file before it is edited
+///
+/// A new edit makes the undone edits unreachable, so the redo stack is
+/// emptied.
+///
+/// # Arguments
+/// * `file` - The config file about to be edited
+///
+/// # Returns
+/// * `Ok(PathBuf)` - The file the snapshot was stored in
+/// * `Err(io::Error)` if the config cannot be read or the snapshot written
+pub fn record_snapshot(file: &Path) -> io::Result<PathBuf> {
+    let path = push(&get_undo_dir()?, &capture(file)?)?;
+    clear(&get_redo_dir()?)?;
+    Ok(path)
+}
+
+/// Records the value of fish's universal `fish_user_paths` before it is set
+///
+/// Like `record_snapshot`, this empties the redo stack.
+///
+/// # Arguments
+/// * `config` - fish's config file, which the edit is locked on
+/// * `previous` - The directories the variable holds now
+pub fn record_fish_user_paths(config: &Path, previous: &[PathBuf]) -> io::Result<PathBuf> {
+    let path = push(
+        &get_undo_dir()?,
+        &capture_fish_user_paths(config, previous.to_vec()),
+    )?;
+    clear(&get_redo_dir()?)?;
+    Ok(path)
+}
+
+/// Puts a config file back into the state recorded in a snapshot
+///
+/// A file that did not exist when the snapshot was taken is removed. The
+/// caller must hold the config lock.
+fn restore(snapshot: &Snapshot) -> io::Result<()> {
+    if let Some(fish_user_paths) = &snapshot.fish_user_paths {
+        return fish::set_universal_user_paths(fish_user_paths);
+    }
+    match &snapshot.content {
+        Some(content) => write_atomic(&snapshot.file, content.as_bytes()),
+        None => match fs::remove_file(&snapshot.file) {
+            Err(e) if e.kind() != io::ErrorKind::NotFound => Err(e),
+            _ => Ok(()),
+        },
+    }
+}
+
+/// Pops the most recent snapshot from `from` and restores it, pushing the
+/// state it replaces onto `to`
+fn step(from: &Path, to: &Path) -> io::Result<Option<Snapshot>> {
+    let stored = match top(from, true)? {
+        Some(stored) => stored,
+        None => return Ok(None),
+    };
+
+    let _lock = lock_config(&stored.snapshot.file)?;
+    push(to, &recapture(&stored.snapshot)?)?;
+    restore(&stored.snapshot)?;
+    fs::remove_file(&stored.path)?;
+    Ok(Some(stored.snapshot))
+}
+
+/// Reverts the most recent pathmaster edit
+///
+/// The reverted contents are kept on the redo stack.
+///
+/// # Returns
+/// * `Ok(Some(Snapshot))` - The snapshot that was restored and removed from the stack
+/// * `Ok(None)` - There was nothing to undo
+/// * `Err(io::Error)` if the snapshot cannot be read or restored
+pub fn undo_last() -> io::Result<Option<Snapshot>> {
+    step(&get_undo_dir()?, &get_redo_dir()?)
+}
+
+/// Reverts the most recent pathmaster edit without keeping it for redo
+///
+/// Used to roll back an edit that left PATH broken, which should not be
+/// reapplied.
+///
+/// # Returns
+/// * `Ok(Some(Snapshot))` - The snapshot that was restored and removed from the stack
+/// * `Ok(None)` - There was nothing to revert
+/// * `Err(io::Error)` if the snapshot cannot be read or restored
+pub fn revert_last() -> io::Result<Option<Snapshot>> {
+    let stored = match top(&get_undo_dir()?, true)? {
+        Some(stored) => stored,
+        None => return Ok(None),
+    };
+
+    let _lock = lock_config(&stored.snapshot.file)?;
+    restore(&stored.snapshot)?;
+    fs::remove_file(&stored.path)?;
+    Ok(Some(stored.snapshot))
+}
+
+/// Reapplies the most recently undone edit
+///
+/// The contents it replaces go back on the undo stack, so the edit can be
+/// undone again.
+///
+/// # Returns
+/// * `Ok(Some(Snapshot))` - The snapshot that was reapplied
+/// * `Ok(None)` - There was nothing to redo
+/// * `Err(io::Error)` if the snapshot cannot be read or restored
+pub fn redo_last() -> io::Result<Option<Snapshot>> {
+    step(&get_redo_dir()?, &get_undo_dir()?)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use serial_test::serial;
+    use tempfile::TempDir;
+
+    #[test]
+    #[serial]
+    fn test_undo_steps_back_through_history() -> io::Result<()> {
+        let temp_dir = TempDir::new()?;
+        set_undo_dir(temp_dir.path().join("undo"))?;
+        let config = temp_dir.path().join(".bashrc");
+
+        // First edit creates the file, later edits change it
+        record_snapshot(&config)?;
+        fs::write(&config, "export PATH=\"/one\"\n")?;
+        record_snapshot(&config)?;
+        fs::write(&config, "export PATH=\"/two\"\n")?;
+
+        let listed = list_snapshots()?;
+        assert_eq!(listed.len(), 2);
+        assert_eq!(
+            listed[0].snapshot.content.as_deref(),
+            Some("export PATH=\"/one\"\n")
+        );
+
+        undo_last()?;
+        assert_eq!(fs::read_to_string(&config)?, "export PATH=\"/one\"\n");
+        undo_last()?;
+        assert!(!config.exists());
+        assert!(undo_last()?.is_none());
+        Ok(())
+    }
+
+    #[test]
+    #[serial]
+    fn test_redo_reapplies_until_next_edit() -> io::Result<()> {
+        let temp_dir = TempDir::new()?;
+        set_undo_dir(temp_dir.path().join("undo"))?;
+        let config = temp_dir.path().join(".bashrc");
+
+        fs::write(&config, "export PATH=\"/one\"\n")?;
+        record_snapshot(&config)?;
+        fs::write(&config, "export PATH=\"/two\"\n")?;
+
+        assert!(redo_last()?.is_none());
+        undo_last()?;
+        assert_eq!(fs::read_to_string(&config)?, "export PATH=\"/one\"\n");
+        redo_last()?;
+        assert_eq!(fs::read_to_string(&config)?, "export PATH=\"/two\"\n");
+
+        // Redone edits can be undone again
+        undo_last()?;
+        assert_eq!(fs::read_to_string(&config)?, "export PATH=\"/one\"\n");
+
+        // A new edit discards what could have been redone
+        record_snapshot(&config)?;
+        fs::write(&config, "export PATH=\"/three\"\n")?;
+        assert!(list_redo_snapshots()?.is_empty());
+        assert!(redo_last()?.is_none());
+        assert_eq!(fs::read_to_string(&config)?, "export PATH=\"/three\"\n");
+        Ok(())
+    }
+
+    #[test]
+    #[serial]
+    fn test_revert_last_is_not_redoable() -> io::Result<()> {
+        let temp_dir = TempDir::new()?;
+        set_undo_dir(temp_dir.path().join("undo"))?;
+        let config = temp_dir.path().join(".bashrc");
+
+        fs::write(&config, "export PATH=\"/one\"\n")?;
+        record_snapshot(&config)?;
+        fs::write(&config, "export PATH=\"\"\n")?;
+
+        assert!(revert_last()?.is_some());
+        assert_eq!(fs::read_to_string(&config)?, "export PATH=\"/one\"\n");
+        assert!(list_snapshots()?.is_empty());
+        assert!(redo_last()?.is_none());
+        Ok(())
+    }
+
+    #[test]
+    #[serial]
+    fn test_unreadable_snapshot_is_skipped() -> io::Result<()> {
+        let temp_dir = TempDir::new()?;
+        let undo_dir = temp_dir.path().join("undo");
+        set_undo_dir(undo_dir.clone())?;
+        let config = temp_dir.path().join(".bashrc");
+
+        fs::write(&config, "export PATH=\"/one\"\n")?;
+        record_snapshot(&config)?;
+        fs::write(undo_dir.join("000002.json"), "{ truncated")?;
+
+        // New edits are still recorded, after the unreadable snapshot
+        fs::write(&config, "export PATH=\"/two\"\n")?;
+        assert_eq!(record_snapshot(&config)?, undo_dir.join("000003.json"));
+        fs::write(&config, "export PATH=\"/three\"\n")?;
+
+        undo_last()?;
+        assert_eq!(fs::read_to_string(&config)?, "export PATH=\"/two\"\n");
+        undo_last()?;
+        assert_eq!(fs::read_to_string(&config)?, "export PATH=\"/one\"\n");
+        assert!(next_undo()?.is_none());
+        Ok(())
+    }
+
+    #[test]
+    fn test_fish_user_paths_snapshot() -> io::Result<()> {
+        let config = Path::new("/home/me/.config/fish/config.fish");
+        let snapshot = capture_fish_user_paths(config, vec![PathBuf::from("/opt/tool/bin")]);
+        assert_eq!(snapshot.location(), PathBuf::from("fish_user_paths"));
+
+        let json = serde_json::to_string(&snapshot)?;
+        assert_eq!(serde_json::from_str::<Snapshot>(&json)?, snapshot);
+
+        // Snapshots of files, including ones written before universal
+        // variables were recorded, have no fish_user_paths
+        let file = r#"{"timestamp":"20240101120000","file":"/home/me/.bashrc","content":null}"#;
+        let snapshot: Snapshot = serde_json::from_str(file)?;
+        assert_eq!(snapshot.fish_user_paths, None);
+        assert_eq!(snapshot.location(), PathBuf::from("/home/me/.bashrc"));
+        Ok(())
+    }
+
+    #[test]
+    #[serial]
+    fn test_old_snapshots_are_discarded() -> io::Result<()> {
+        let temp_dir = TempDir::new()?;
+        set_undo_dir(temp_dir.path().join("undo"))?;
+        let config = temp_dir.path().join(".bashrc");
+
+        for i in 0..MAX_SNAPSHOTS + 3 {
+            fs::write(&config, format!("# edit {}\n", i))?;
+            record_snapshot(&config)?;
+        }
+
+        let listed = list_snapshots()?;
+        assert_eq!(listed.len(), MAX_SNAPSHOTS);
+        assert_eq!(
+            listed[0].snapshot.content,
+            Some(format!("# edit {}\n", MAX_SNAPSHOTS + 2))
+        );
+        Ok(())
+    }
+}
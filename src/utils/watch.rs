@@ -0,0 +1,287 @@
+//! Change notifications for a single file.
+//!
+//! This module handles:
+//! - Waiting for a file to be written, replaced or removed
+//! - Coalescing the bursts of events produced by a single save
+//! - Stopping cleanly when the user presses Ctrl-C
+//!
+//! On Linux the file's directory is watched with inotify, so editors that save
+//! by writing a new file and renaming it over the old one are still noticed.
+//! Other platforms poll the file's modification time and size.
+
+use std::io;
+use std::path::{Path, PathBuf};
+use std::sync::atomic::{AtomicBool, Ordering};
+use std::time::Duration;
+
+/// How long to wait for events before checking for an interrupt
+const TICK: Duration = Duration::from_millis(250);
+
+static INTERRUPTED: AtomicBool = AtomicBool::new(false);
+
+#[cfg(unix)]
+extern "C" fn on_interrupt(_signal: libc::c_int) {
+    INTERRUPTED.store(true, Ordering::SeqCst);
+}
+
+/// Makes Ctrl-C stop a watch instead of killing the process
+///
+/// After this is called, `FileWatcher::wait_for_change` returns `Ok(false)`
+/// once SIGINT is received. On platforms without signals, Ctrl-C keeps its
+/// default behaviour.
+pub fn install_interrupt_handler() -> io::Result<()> {
+    #[cfg(unix)]
+    {
+        // SAFETY: the handler only stores to an atomic, which is async-signal-safe
+        let previous = unsafe {
+            libc::signal(
+                libc::SIGINT,
+                on_interrupt as extern "C" fn(libc::c_int) as libc::sighandler_t,
+            )
+        };
+        if previous == libc::SIG_ERR {
+            return Err(io::Error::last_os_error());
+        }
+    }
+    Ok(())
+}
+
+/// Returns whether SIGINT has been received
+pub fn interrupted() -> bool {
+    INTERRUPTED.load(Ordering::SeqCst)
+}
+
+/// Watches one file for changes
+pub struct FileWatcher {
+    file: PathBuf,
+    events: platform::Events,
+}
+
+impl FileWatcher {
+    /// Starts watching `file`, which does not need to exist yet
+    pub fn new(file: &Path) -> io::Result<Self> {
+        Ok(Self {
+            file: file.to_path_buf(),
+            events: platform::Events::new(file)?,
+        })
+    }
+
+    /// Returns the watched file
+    pub fn file(&self) -> &Path {
+        &self.file
+    }
+
+    /// Blocks until the file changes
+    ///
+    /// Once a change is seen, further events are absorbed until none arrive
+    /// for `debounce`, so a save that touches the file several times is
+    /// reported once.
+    ///
+    /// # Returns
+    /// * `Ok(true)` - The file changed
+    /// * `Ok(false)` - The watch was interrupted by SIGINT
+    /// * `Err(io::Error)` if the file cannot be watched
+    pub fn wait_for_change(&mut self, debounce: Duration) -> io::Result<bool> {
+        loop {
+            if interrupted() {
+                return Ok(false);
+            }
+            if self.events.poll(TICK)? {
+                break;
+            }
+        }
+
+        while self.events.poll(debounce)? {
+            if interrupted() {
+                return Ok(false);
+            }
+        }
+
+        Ok(!interrupted())
+    }
+}
+
+#[cfg(target_os = "linux")]
+mod platform {
+    use std::ffi::{CString, OsString};
+    use std::io;
+    use std::mem;
+    use std::os::unix::ffi::{OsStrExt, OsStringExt};
+    use std::os::unix::io::RawFd;
+    use std::path::Path;
+    use std::time::Duration;
+
+    /// Events that can mean the watched file was changed
+    const MASK: u32 = libc::IN_MODIFY
+        | libc::IN_CLOSE_WRITE
+        | libc::IN_CREATE
+        | libc::IN_DELETE
+        | libc::IN_MOVED_FROM
+        | libc::IN_MOVED_TO;
+
+    /// An inotify watch on the file's directory
+    pub struct Events {
+        fd: RawFd,
+        name: OsString,
+    }
+
+    impl Events {
+        pub fn new(file: &Path) -> io::Result<Self> {
+            let dir = match file.parent() {
+                Some(dir) if !dir.as_os_str().is_empty() => dir,
+                _ => Path::new("."),
+            };
+            let name = file.file_name().map(OsString::from).ok_or_else(|| {
+                io::Error::new(
+                    io::ErrorKind::InvalidInput,
+                    format!("Cannot watch {}: not a file", file.display()),
+                )
+            })?;
+            let dir = CString::new(dir.as_os_str().as_bytes())
+                .map_err(|e| io::Error::new(io::ErrorKind::InvalidInput, e))?;
+
+            // SAFETY: plain syscalls; the descriptor is owned by `Events`
+            let fd = unsafe { libc::inotify_init1(libc::IN_NONBLOCK | libc::IN_CLOEXEC) };
+            if fd < 0 {
+                return Err(io::Error::last_os_error());
+            }
+            let events = Self { fd, name };
+            if unsafe { libc::inotify_add_watch(fd, dir.as_ptr(), MASK) } < 0 {
+                return Err(io::Error::last_os_error());
+            }
+
+            Ok(events)
+        }
+
+        /// Waits up to `timeout` for events, returning whether any of them
+        /// concern the watched file
+        pub fn poll(&mut self, timeout: Duration) -> io::Result<bool> {
+            let mut pollfd = libc::pollfd {
+                fd: self.fd,
+                events: libc::POLLIN,
+                revents: 0,
+            };
+            let millis = timeout.as_millis().min(libc::c_int::MAX as u128) as libc::c_int;
+
+            // SAFETY: `pollfd` is a valid array of one element
+            if unsafe { libc::poll(&mut pollfd, 1, millis) } < 0 {
+                let err = io::Error::last_os_error();
+                return match err.kind() {
+                    io::ErrorKind::Interrupted => Ok(false),
+                    _ => Err(err),
+                };
+            }
+
+            let mut changed = false;
+            let mut buf = [0u8; 4096];
+            loop {
+                // SAFETY: reads at most `buf.len()` bytes into `buf`
+                let read = unsafe { libc::read(self.fd, buf.as_mut_ptr().cast(), buf.len()) };
+                if read <= 0 {
+                    break;
+                }
+                changed |= self.names_file(&buf[..read as usize]);
+            }
+
+            Ok(changed)
+        }
+
+        /// Returns whether a buffer of inotify events mentions the watched file
+        fn names_file(&self, mut buf: &[u8]) -> bool {
+            let header = mem::size_of::<libc::inotify_event>();
+            let mut found = false;
+
+            while buf.len() >= header {
+                // SAFETY: the kernel writes whole events; read_unaligned copes
+                // with the byte buffer's alignment
+                let event: libc::inotify_event =
+                    unsafe { std::ptr::read_unaligned(buf.as_ptr().cast()) };
+                let end = (header + event.len as usize).min(buf.len());
+                let name: Vec<u8> = buf[header..end]
+                    .iter()
+                    .copied()
+                    .take_while(|&b| b != 0)
+                    .collect();
+                found |= OsString::from_vec(name) == self.name;
+                buf = &buf[end..];
+            }
+
+            found
+        }
+    }
+
+    impl Drop for Events {
+        fn drop(&mut self) {
+            // SAFETY: the descriptor is owned by `self` and closed once
+            unsafe {
+                libc::close(self.fd);
+            }
+        }
+    }
+}
+
+#[cfg(not(target_os = "linux"))]
+mod platform {
+    use std::fs;
+    use std::io;
+    use std::path::{Path, PathBuf};
+    use std::thread;
+    use std::time::{Duration, SystemTime};
+
+    /// Polls the file's modification time and size
+    pub struct Events {
+        file: PathBuf,
+        last: Option<(SystemTime, u64)>,
+    }
+
+    fn stamp(file: &Path) -> Option<(SystemTime, u64)> {
+        let meta = fs::metadata(file).ok()?;
+        Some((meta.modified().ok()?, meta.len()))
+    }
+
+    impl Events {
+        pub fn new(file: &Path) -> io::Result<Self> {
+            Ok(Self {
+                file: file.to_path_buf(),
+                last: stamp(file),
+            })
+        }
+
+        /// Waits up to `timeout`, returning whether the file changed
+        pub fn poll(&mut self, timeout: Duration) -> io::Result<bool> {
+            thread::sleep(timeout);
+            let current = stamp(&self.file);
+            let changed = current != self.last;
+            self.last = current;
+            Ok(changed)
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::utils::atomic::write_atomic;
+    use std::fs;
+    use std::thread;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_watcher_sees_replaced_file() -> io::Result<()> {
+        let temp_dir = TempDir::new()?;
+        let config = temp_dir.path().join(".zshrc");
+        fs::write(&config, "export PATH=\"/usr/bin\"\n")?;
+        fs::write(temp_dir.path().join("unrelated"), "")?;
+
+        let mut watcher = FileWatcher::new(&config)?;
+        let target = config.clone();
+        let writer = thread::spawn(move || {
+            thread::sleep(Duration::from_millis(100));
+            write_atomic(&target, b"export PATH=\"/usr/bin:/missing\"\n")
+        });
+
+        assert!(watcher.wait_for_change(Duration::from_millis(100))?);
+        writer.join().unwrap()?;
+        Ok(())
+    }
+}
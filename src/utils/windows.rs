@@ -0,0 +1,91 @@
+//! Windows registry backend for persistent PATH changes.
+//!
+//! On Windows, PATH is not read from a shell rc file. It is stored in the
+//! `Environment` registry key, with a per-user value under `HKEY_CURRENT_USER`
+//! and a machine-wide value under `HKEY_LOCAL_MACHINE`. The PATH a process
+//! sees is the system value followed by the user value.
+
+use std::env;
+use std::io;
+use std::path::PathBuf;
+use winreg::enums::{RegType, HKEY_CURRENT_USER, HKEY_LOCAL_MACHINE, KEY_READ, KEY_WRITE};
+use winreg::{RegKey, RegValue};
+
+/// Registry key holding the current user's environment
+const USER_ENVIRONMENT: &str = "Environment";
+
+/// Registry key holding the machine-wide environment
+const SYSTEM_ENVIRONMENT: &str = r"SYSTEM\CurrentControlSet\Control\Session Manager\Environment";
+
+/// Name of the PATH value inside the environment keys
+const PATH_VALUE: &str = "Path";
+
+/// Opens the environment key for the user or system hive
+fn open_environment(system: bool) -> io::Result<RegKey> {
+    let (hive, subkey) = if system {
+        (RegKey::predef(HKEY_LOCAL_MACHINE), SYSTEM_ENVIRONMENT)
+    } else {
+        (RegKey::predef(HKEY_CURRENT_USER), USER_ENVIRONMENT)
+    };
+    hive.open_subkey_with_flags(subkey, KEY_READ | KEY_WRITE)
+}
+
+/// Returns the full name of the environment key, e.g. `HKEY_CURRENT_USER\Environment`
+pub fn environment_key_name(system: bool) -> PathBuf {
+    if system {
+        PathBuf::from(format!(r"HKEY_LOCAL_MACHINE\{}", SYSTEM_ENVIRONMENT))
+    } else {
+        PathBuf::from(format!(r"HKEY_CURRENT_USER\{}", USER_ENVIRONMENT))
+    }
+}
+
+/// Reads the persistent PATH entries stored in the registry
+///
+/// # Arguments
+///
+/// * `system` - Read the machine-wide PATH instead of the user PATH
+///
+/// # Returns
+///
+/// The registry PATH split on `;`. A missing value yields no entries.
+pub fn read_path_entries(system: bool) -> io::Result<Vec<PathBuf>> {
+    let key = open_environment(system)?;
+    let value: String = match key.get_value(PATH_VALUE) {
+        Ok(value) => value,
+        Err(e) if e.kind() == io::ErrorKind::NotFound => return Ok(Vec::new()),
+        Err(e) => return Err(e),
+    };
+
+    Ok(env::split_paths(&value)
+        .filter(|entry| !entry.as_os_str().is_empty())
+        .collect())
+}
+
+/// Writes PATH entries to the registry
+///
+/// The value is stored as `REG_EXPAND_SZ` so entries such as
+/// `%USERPROFILE%\bin` keep expanding. Changing the system PATH requires
+/// administrator rights.
+///
+/// # Arguments
+///
+/// * `entries` - The PATH entries to store
+/// * `system` - Write the machine-wide PATH instead of the user PATH
+pub fn write_path_entries(entries: &[PathBuf], system: bool) -> io::Result<()> {
+    let joined =
+        env::join_paths(entries).map_err(|e| io::Error::new(io::ErrorKind::InvalidInput, e))?;
+    let bytes = joined
+        .to_string_lossy()
+        .encode_utf16()
+        .chain(std::iter::once(0))
+        .flat_map(|unit| unit.to_le_bytes())
+        .collect();
+
+    open_environment(system)?.set_raw_value(
+        PATH_VALUE,
+        &RegValue {
+            bytes,
+            vtype: RegType::REG_EXPAND_SZ,
+        },
+    )
+}
@@ -0,0 +1,139 @@
+//! Where pathmaster keeps the files it creates.
+//!
+//! This module handles:
+//! - Following the XDG Base Directory spec on Linux and other Unix systems:
+//!   backups are data (`$XDG_DATA_HOME`, default `~/.local/share`) and undo
+//!   history and the record of entries pathmaster added are state
+//!   (`$XDG_STATE_HOME`, default `~/.local/state`)
+//! - Falling back to the legacy `~/.pathmaster` directory, so existing
+//!   backups and undo history are still found
+//!
+//! On macOS and Windows everything stays under `~/.pathmaster`.
+
+use std::env;
+use std::path::PathBuf;
+
+/// Returns the user's home directory, falling back to `/`
+fn home_dir() -> PathBuf {
+    dirs_next::home_dir().unwrap_or_else(|| PathBuf::from("/"))
+}
+
+/// Returns the legacy directory that held everything before XDG support
+pub fn legacy_dir() -> PathBuf {
+    home_dir().join(".pathmaster")
+}
+
+/// Resolves the directory for one kind of file
+///
+/// An existing `~/.pathmaster/<name>` wins. Otherwise, on XDG platforms, this
+/// is `<base>/pathmaster/<name>`, where `<base>` comes from the `xdg_var`
+/// environment variable if it is set to an absolute path and is
+/// `~/<default_base>` if not.
+fn resolve(name: &str, xdg_var: &str, default_base: &str) -> PathBuf {
+    let legacy = legacy_dir().join(name);
+    if legacy.exists() || !cfg!(all(unix, not(target_os = "macos"))) {
+        return legacy;
+    }
+
+    // The spec says relative paths are invalid and must be ignored
+    let base = env::var_os(xdg_var)
+        .map(PathBuf::from)
+        .filter(|base| base.is_absolute())
+        .unwrap_or_else(|| home_dir().join(default_base));
+    base.join("pathmaster").join(name)
+}
+
+/// Returns the default directory for PATH backups
+///
+/// `$XDG_DATA_HOME/pathmaster/backups`, or `~/.pathmaster/backups` if it
+/// already exists.
+pub fn backup_dir() -> PathBuf {
+    resolve("backups", "XDG_DATA_HOME", ".local/share")
+}
+
+/// Returns the default directory for undo history
+///
+/// `$XDG_STATE_HOME/pathmaster/undo`, or `~/.pathmaster/undo` if it already
+/// exists.
+pub fn undo_dir() -> PathBuf {
+    resolve("undo", "XDG_STATE_HOME", ".local/state")
+}
+
+/// Returns the default file recording the entries pathmaster added
+///
+/// `$XDG_STATE_HOME/pathmaster/managed.json`, or
+/// `~/.pathmaster/managed.json` if it already exists.
+pub fn managed_file() -> PathBuf {
+    resolve("managed.json", "XDG_STATE_HOME", ".local/state")
+}
+
+#[cfg(all(test, unix, not(target_os = "macos")))]
+mod tests {
+    use super::*;
+    use serial_test::serial;
+    use std::fs;
+    use tempfile::TempDir;
+
+    /// Runs `f` with HOME pointing at a fresh directory and the XDG
+    /// variables set as given, restoring the environment afterwards
+    fn with_env<T>(data: Option<&str>, state: Option<&str>, f: impl FnOnce(&TempDir) -> T) -> T {
+        let temp_dir = TempDir::new().unwrap();
+        let saved: Vec<_> = ["HOME", "XDG_DATA_HOME", "XDG_STATE_HOME"]
+            .iter()
+            .map(|name| (*name, env::var_os(name)))
+            .collect();
+
+        env::set_var("HOME", temp_dir.path());
+        for (name, value) in [("XDG_DATA_HOME", data), ("XDG_STATE_HOME", state)] {
+            match value {
+                Some(value) => env::set_var(name, temp_dir.path().join(value)),
+                None => env::remove_var(name),
+            }
+        }
+
+        let result = f(&temp_dir);
+        for (name, value) in saved {
+            match value {
+                Some(value) => env::set_var(name, value),
+                None => env::remove_var(name),
+            }
+        }
+        result
+    }
+
+    #[test]
+    #[serial]
+    fn test_xdg_variables_are_respected() {
+        with_env(Some("data"), Some("state"), |home| {
+            assert_eq!(backup_dir(), home.path().join("data/pathmaster/backups"));
+            assert_eq!(undo_dir(), home.path().join("state/pathmaster/undo"));
+            assert_eq!(
+                managed_file(),
+                home.path().join("state/pathmaster/managed.json")
+            );
+        });
+    }
+
+    #[test]
+    #[serial]
+    fn test_xdg_defaults() {
+        with_env(None, None, |home| {
+            assert_eq!(
+                backup_dir(),
+                home.path().join(".local/share/pathmaster/backups")
+            );
+            assert_eq!(undo_dir(), home.path().join(".local/state/pathmaster/undo"));
+        });
+    }
+
+    #[test]
+    #[serial]
+    fn test_existing_legacy_dirs_win() {
+        with_env(Some("data"), Some("state"), |home| {
+            fs::create_dir_all(home.path().join(".pathmaster/backups")).unwrap();
+            assert_eq!(backup_dir(), home.path().join(".pathmaster/backups"));
+            // Only the directories that exist are kept where they were
+            assert_eq!(undo_dir(), home.path().join("state/pathmaster/undo"));
+        });
+    }
+}